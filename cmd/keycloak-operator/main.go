@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"os/signal"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
@@ -15,12 +19,16 @@ import (
 
 	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
 	"github.com/integr8ly/keycloak-operator/pkg/dispatch"
+	"github.com/integr8ly/keycloak-operator/pkg/health"
 	"github.com/integr8ly/keycloak-operator/pkg/k8s"
 	"github.com/integr8ly/keycloak-operator/pkg/keycloak"
 	"github.com/integr8ly/keycloak-operator/pkg/keycloak/realm"
+	"github.com/integr8ly/keycloak-operator/pkg/leader"
 	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
 	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
 	// Load Openshift types
 	_ "github.com/integr8ly/keycloak-operator/pkg/apis/openshift"
 )
@@ -29,7 +37,7 @@ func printVersion() {
 	logrus.Infof("Go Version: %s", runtime.Version())
 	logrus.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
 	logrus.Infof("operator-sdk Version: %v", sdkVersion.Version)
-	logrus.Infof("operator config: resync: %v, sync-resources: %v", cfg.ResyncPeriod, cfg.SyncResources)
+	logrus.Infof("operator config: resync: %v, sync-resources: %v, keycloak-page-size: %v, realm-workers: %v, realm-parallelism: %v, leader-elect: %v", cfg.ResyncPeriod, cfg.SyncResources, cfg.KeycloakPageSize, cfg.RealmWorkers, cfg.RealmParallelism, cfg.LeaderElection)
 }
 
 var (
@@ -41,6 +49,14 @@ func init() {
 	flagset.IntVar(&cfg.ResyncPeriod, "resync", 60, "change the resync period")
 	flagset.StringVar(&cfg.LogLevel, "log-level", logrus.Level.String(logrus.InfoLevel), "Log level to use. Possible values: panic, fatal, error, warn, info, debug")
 	flagset.BoolVar(&cfg.SyncResources, "sync-resources", true, "Sync Keycloak resources on each reconciliation loop after the initial creation of the realm.")
+	flagset.IntVar(&cfg.KeycloakPageSize, "keycloak-page-size", keycloak.DefaultPageSize, "Number of items to request per page when listing Keycloak users, clients and roles")
+	flagset.IntVar(&cfg.RealmWorkers, "realm-workers", 1, "Number of KeycloakRealm events handled at the same time per watched namespace. Events for the same realm are never handled concurrently")
+	flagset.IntVar(&cfg.RealmParallelism, "realm-parallelism", 1, "Number of users or clients reconciled at the same time within a single realm")
+	flagset.BoolVar(&cfg.LeaderElection, "leader-elect", true, "Elect a leader amongst the replicas of the operator so only one of them reconciles the resources at a time")
+	flagset.IntVar(&cfg.LeaseDuration, "leader-elect-lease-duration", 15, "Seconds the standby replicas wait after the last renewal of the leader before taking over")
+	flagset.IntVar(&cfg.RenewDeadline, "leader-elect-renew-deadline", 10, "Seconds the leader keeps trying to renew its lease before it steps down")
+	flagset.IntVar(&cfg.RetryPeriod, "leader-elect-retry-period", 2, "Seconds between two attempts to acquire or renew the lease")
+	flagset.IntVar(&cfg.ShutdownTimeout, "shutdown-timeout", 20, "Seconds to wait for the events being handled to finish when the operator stops, before handing off the leadership")
 	flagset.Parse(os.Args[1:])
 }
 
@@ -59,14 +75,16 @@ func main() {
 		logrus.Fatalf("Failed to get watch namespace: %v", err)
 	}
 	k8Client := k8sclient.GetKubeClient()
-	kcFactory := &keycloak.KeycloakFactory{SecretClient: k8Client.CoreV1().Secrets(namespace)}
+	kcFactory := &keycloak.KeycloakFactory{SecretClient: k8Client.CoreV1().Secrets(namespace), PageSize: cfg.KeycloakPageSize}
 
 	resyncDuration := time.Second * time.Duration(cfg.ResyncPeriod)
 	logrus.Infof("Watching kc namespace: %s", namespace)
 	sdk.Watch(resource, v1alpha1.KeycloakKind, namespace, resyncDuration)
+	sdk.Watch(resource, v1alpha1.KeycloakBackupKind, namespace, resyncDuration)
+	sdk.Watch(resource, v1alpha1.KeycloakRestoreKind, namespace, resyncDuration)
 	for _, ns := range strings.Split(os.Getenv("CONSUMER_NAMESPACES"), ";") {
 		logrus.Infof("Watching namespace: %s", ns)
-		sdk.Watch(resource, v1alpha1.KeycloakRealmKind, ns, resyncDuration)
+		sdk.Watch(resource, v1alpha1.KeycloakRealmKind, ns, resyncDuration, sdk.WithNumWorkers(cfg.RealmWorkers))
 	}
 
 	dh := dispatch.NewHandler(k8Client)
@@ -76,9 +94,80 @@ func main() {
 	cruder := k8s.Cruder{}
 	// Handle keycloak resource reconcile
 	dispatcher.AddHandler(keycloak.NewReconciler(kcFactory, k8Client, cruder))
-	dispatcher.AddHandler(realm.NewRealmHandler(kcFactory, cruder, realm.NewPhaseHandler(k8Client, cruder, namespace, kcFactory)))
+	dispatcher.AddHandler(keycloak.NewBackupReconciler(k8Client, cruder))
+	dispatcher.AddHandler(keycloak.NewRestoreReconciler(k8Client, cruder))
+	dispatcher.AddHandler(realm.NewRealmHandler(kcFactory, cruder, realm.NewPhaseHandler(k8Client, cruder, namespace, kcFactory, cfg.RealmParallelism)))
+
+	elector, err := newElector(k8Client, namespace)
+	if err != nil {
+		logrus.Fatalf("Failed to set up leader election: %v", err)
+	}
+
+	// only the leader watches, so the standby replicas are live and ready as long as the leader election runs
+	var watching int32
+	liveness, readiness := health.Checks{}, health.Checks{
+		"watch": func() error {
+			if (elector == nil || elector.IsLeader()) && atomic.LoadInt32(&watching) == 0 {
+				return errors.New("the watches are not started")
+			}
+			return nil
+		},
+	}
+	if elector != nil {
+		liveness["leader-election"] = elector.Check
+		readiness["leader-election"] = elector.Ready
+	}
+	health.Register(http.DefaultServeMux, liveness, readiness)
+	// serve the metrics of the sdk and the operator on /metrics, and the health checks on the same port
+	sdk.ExposeMetricsPort()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		s := <-signals
+		logrus.Infof("Received %v, stopping", s)
+		cancel()
+	}()
 
 	// main dispatch of resources
 	sdk.Handle(dispatcher)
-	sdk.Run(context.TODO())
+	lead := func(ctx context.Context) {
+		atomic.StoreInt32(&watching, 1)
+		sdk.Run(ctx)
+		atomic.StoreInt32(&watching, 0)
+		if !dispatcher.Drain(time.Second * time.Duration(cfg.ShutdownTimeout)) {
+			logrus.Warnf("Stopping while events are still being handled after %vs", cfg.ShutdownTimeout)
+		}
+	}
+	if elector == nil {
+		lead(ctx)
+		return
+	}
+	if err := elector.Run(ctx, lead); err != nil {
+		logrus.Fatalf("Leader election failed: %v", err)
+	}
+}
+
+// newElector returns the leader elector of the replicas of the operator, nil when leader election is disabled
+func newElector(k8Client kubernetes.Interface, namespace string) (*leader.Elector, error) {
+	if !cfg.LeaderElection {
+		return nil, nil
+	}
+	operatorName, err := k8sutil.GetOperatorName()
+	if err != nil {
+		return nil, err
+	}
+	identity, err := leader.Identity()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the identity of the replica")
+	}
+	return leader.NewElector(k8Client, leader.Config{
+		Namespace:     namespace,
+		Name:          operatorName + "-lock",
+		Identity:      identity,
+		LeaseDuration: time.Second * time.Duration(cfg.LeaseDuration),
+		RenewDeadline: time.Second * time.Duration(cfg.RenewDeadline),
+		RetryPeriod:   time.Second * time.Duration(cfg.RetryPeriod),
+	})
 }
@@ -31,6 +31,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&KeycloakList{},
 		&KeycloakRealm{},
 		&KeycloakRealmList{},
+		&KeycloakBackup{},
+		&KeycloakBackupList{},
+		&KeycloakRestore{},
+		&KeycloakRestoreList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -1,10 +1,23 @@
 package v1alpha1
 
 import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/integr8ly/keycloak-operator/pkg/util"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
 const (
@@ -12,13 +25,29 @@ const (
 	Version           = "v1alpha1"
 	KeycloakKind      = "Keycloak"
 	KeycloakRealmKind = "KeycloakRealm"
-	KeycloakFinalizer = "finalizer.org.aerogear.keycloak"
+	// KeycloakBackupKind and KeycloakRestoreKind are on-demand backups and restores of a Keycloak database
+	KeycloakBackupKind  = "KeycloakBackup"
+	KeycloakRestoreKind = "KeycloakRestore"
+	KeycloakFinalizer   = "finalizer.org.aerogear.keycloak"
+	// RotateAdminCredentialsAnnotation rotates the admin credentials of a Keycloak whenever its value changes
+	RotateAdminCredentialsAnnotation = "aerogear.org/rotate-admin-credentials"
+	// RotateDatabaseCredentialsAnnotation rotates the password of the bundled database whenever its value changes
+	RotateDatabaseCredentialsAnnotation = "aerogear.org/rotate-database-credentials"
 )
 
 type Config struct {
-	ResyncPeriod  int
-	LogLevel      string
-	SyncResources bool
+	ResyncPeriod     int
+	LogLevel         string
+	SyncResources    bool
+	KeycloakPageSize int
+	RealmWorkers     int
+	RealmParallelism int
+	// LeaderElection lets a single replica reconcile the resources, the durations are in seconds
+	LeaderElection  bool
+	LeaseDuration   int
+	RenewDeadline   int
+	RetryPeriod     int
+	ShutdownTimeout int
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -37,23 +66,423 @@ type Keycloak struct {
 	Status            KeycloakStatus `json:"status,omitempty"`
 }
 
-func (k *Keycloak) Defaults() {
+const DefaultDatabasePort = 5432
 
+func (k *Keycloak) Defaults() {
+	if k.Spec.ExternalDatabase != nil && k.Spec.ExternalDatabase.Port == 0 {
+		k.Spec.ExternalDatabase.Port = DefaultDatabasePort
+	}
 }
 
 func (k *Keycloak) Validate() error {
+	if err := k.Spec.Instance.validate(); err != nil {
+		return err
+	}
+	for _, b := range k.Spec.Backups {
+		if err := b.Validate(); err != nil {
+			return err
+		}
+	}
+	if r := k.Spec.AdminCredentialRotation; r != nil && (r.Interval == nil || r.Interval.Duration <= 0) {
+		return errors.New("adminCredentialRotation requires a positive interval")
+	}
+	if r := k.Spec.DatabaseCredentialRotation; r != nil {
+		if r.Interval == nil || r.Interval.Duration <= 0 {
+			return errors.New("databaseCredentialRotation requires a positive interval")
+		}
+		if k.Spec.ExternalDatabase != nil {
+			return errors.New("databaseCredentialRotation only rotates the bundled database, not an externalDatabase")
+		}
+	}
+	extensions := map[string]bool{}
+	for _, e := range k.Spec.Extensions {
+		if err := e.validate(); err != nil {
+			return err
+		}
+		if extensions[e.Name] {
+			return errors.Errorf("extension %s is declared twice", e.Name)
+		}
+		extensions[e.Name] = true
+	}
+	for _, o := range k.Spec.Overrides {
+		if err := o.validate(); err != nil {
+			return err
+		}
+	}
+	if err := k.Spec.Monitoring.validate(); err != nil {
+		return err
+	}
+	if e := k.Spec.Exposure; e != nil {
+		if e.Hostname != "" {
+			if errs := validation.IsDNS1123Subdomain(e.Hostname); len(errs) > 0 {
+				return errors.Errorf("exposure.hostname '%s' is not a valid hostname: %s", e.Hostname, strings.Join(errs, ", "))
+			}
+		}
+		if tls := e.TLS; tls != nil {
+			switch tls.Termination {
+			case "", "edge", "reencrypt", "passthrough":
+			default:
+				return errors.Errorf("exposure.tls.termination must be one of edge, reencrypt or passthrough, got '%s'", tls.Termination)
+			}
+			if tls.Termination == "passthrough" && tls.Secret != "" {
+				return errors.New("exposure.tls.secret can't be set with passthrough termination, the pods serve their own certificate")
+			}
+		}
+	}
+	if db := k.Spec.ExternalDatabase; db != nil {
+		if db.Host == "" || db.Database == "" || db.CredentialsSecret == "" {
+			return errors.New("externalDatabase requires a host, database and credentialsSecret")
+		}
+		if db.TLS != nil {
+			switch db.TLS.SSLMode {
+			case "require", "verify-ca", "verify-full":
+			default:
+				return errors.Errorf("externalDatabase.tls.sslMode must be one of require, verify-ca or verify-full, got '%s'", db.TLS.SSLMode)
+			}
+			if db.TLS.SSLMode != "require" && db.TLS.CASecret == "" {
+				return errors.Errorf("externalDatabase.tls.caSecret is required with sslMode %s", db.TLS.SSLMode)
+			}
+		}
+	}
 	return nil
 }
 
 type KeycloakSpec struct {
-	AdminCredentials string           `json:"adminCredentials"`
-	Plugins          []string         `json:"plugins,omitempty"`
-	Backups          []KeycloakBackup `json:"backups,omitempty"`
-	Provision        bool             `json:"provision, omitempty"`
+	AdminCredentials string                 `json:"adminCredentials"`
+	Plugins          []string               `json:"plugins,omitempty"`
+	Backups          []KeycloakBackupConfig `json:"backups,omitempty"`
+	Provision        bool                   `json:"provision,omitempty"`
+	// Platform selects how a provisioned instance is deployed, it is detected from the cluster when empty
+	Platform Platform `json:"platform,omitempty"`
+	// Version is the Keycloak release of a provisioned instance, the latest supported release when empty.
+	// Changing it upgrades the instance
+	Version string `json:"version,omitempty"`
+	// Image replaces the container image of the release
+	Image string `json:"image,omitempty"`
+	// ExternalDatabase points a provisioned instance at an existing PostgreSQL server instead of deploying one
+	ExternalDatabase *KeycloakExternalDatabase `json:"externalDatabase,omitempty"`
+	// Instance sizes and schedules the Keycloak workload of a provisioned instance
+	Instance KeycloakInstanceSpec `json:"instance,omitempty"`
+	// Database sizes and schedules the bundled database workload of a provisioned instance
+	Database KeycloakWorkloadSpec `json:"database,omitempty"`
+	// AdminCredentialRotation rotates the master admin password on a schedule, it can also be rotated on demand with
+	// the RotateAdminCredentialsAnnotation
+	AdminCredentialRotation *KeycloakCredentialRotationSpec `json:"adminCredentialRotation,omitempty"`
+	// DatabaseCredentialRotation rotates the password of the bundled database on a schedule, it can also be rotated on
+	// demand with the RotateDatabaseCredentialsAnnotation
+	DatabaseCredentialRotation *KeycloakCredentialRotationSpec `json:"databaseCredentialRotation,omitempty"`
+	// Exposure sets the hostname and TLS of the route or ingress of a provisioned instance
+	Exposure *KeycloakExposureSpec `json:"exposure,omitempty"`
+	// Extensions are plugins and themes fetched into a provisioned instance, unlike the Plugins which name plugins
+	// of the plugins init image. Changing them rolls the Keycloak pods
+	Extensions []KeycloakExtension `json:"extensions,omitempty"`
+	// Overrides patch the objects generated for a provisioned instance, in the order they are listed
+	Overrides []KeycloakOverride `json:"overrides,omitempty"`
+	// Monitoring configures the GrafanaDashboard, ServiceMonitor and PrometheusRule of a provisioned instance
+	Monitoring KeycloakMonitoringSpec `json:"monitoring,omitempty"`
 }
 
-//KeycloakBackup details of a backup task
-type KeycloakBackup struct {
+// KeycloakMonitoringSpec configures the monitoring resources, they are all created when it is left out
+type KeycloakMonitoringSpec struct {
+	// Labels are set on every monitoring resource, a monitoring-key label replaces the MONITORING_KEY of the operator
+	Labels           map[string]string              `json:"labels,omitempty"`
+	GrafanaDashboard KeycloakMonitoringResourceSpec `json:"grafanaDashboard,omitempty"`
+	ServiceMonitor   KeycloakMonitoringResourceSpec `json:"serviceMonitor,omitempty"`
+	PrometheusRule   KeycloakPrometheusRuleSpec     `json:"prometheusRule,omitempty"`
+}
+
+// KeycloakMonitoringResourceSpec enables a monitoring resource
+type KeycloakMonitoringResourceSpec struct {
+	// Disabled deletes the resource and stops the operator from creating it
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// KeycloakPrometheusRuleSpec enables the alerts of an instance and sets their thresholds
+type KeycloakPrometheusRuleSpec struct {
+	KeycloakMonitoringResourceSpec `json:",inline"`
+	Thresholds                     KeycloakAlertThresholds `json:"thresholds,omitempty"`
+}
+
+// KeycloakAlertThresholds are the values the alerts fire at, unset fields keep the defaults of the operator
+type KeycloakAlertThresholds struct {
+	// HeapUsagePercent and NonHeapUsagePercent are the JVM memory usage alerted on, 90 by default
+	HeapUsagePercent    *float64 `json:"heapUsagePercent,omitempty"`
+	NonHeapUsagePercent *float64 `json:"nonHeapUsagePercent,omitempty"`
+	// GCTimePercent is the share of a minute spent on garbage collection alerted on, 90 by default
+	GCTimePercent *float64 `json:"gcTimePercent,omitempty"`
+	// FailedLogins is the number of failed logins to a realm over 5 minutes alerted on, 50 by default
+	FailedLogins *int32 `json:"failedLogins,omitempty"`
+	// RequestsWithin1sPercent and RequestsWithin10sPercent are the share of requests that must be served within 1
+	// and 10 seconds, 90 and 99.5 by default
+	RequestsWithin1sPercent  *float64 `json:"requestsWithin1sPercent,omitempty"`
+	RequestsWithin10sPercent *float64 `json:"requestsWithin10sPercent,omitempty"`
+}
+
+func (m KeycloakMonitoringSpec) validate() error {
+	for k, v := range m.Labels {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return errors.Errorf("monitoring label '%s' is not valid: %s", k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return errors.Errorf("monitoring label %s has an invalid value '%s': %s", k, v, strings.Join(errs, ", "))
+		}
+	}
+	t := m.PrometheusRule.Thresholds
+	percents := map[string]*float64{
+		"heapUsagePercent":         t.HeapUsagePercent,
+		"nonHeapUsagePercent":      t.NonHeapUsagePercent,
+		"gcTimePercent":            t.GCTimePercent,
+		"requestsWithin1sPercent":  t.RequestsWithin1sPercent,
+		"requestsWithin10sPercent": t.RequestsWithin10sPercent,
+	}
+	for name, p := range percents {
+		if p != nil && (*p <= 0 || *p > 100) {
+			return errors.Errorf("monitoring.prometheusRule.thresholds.%s must be above 0 and at most 100, got %v", name, *p)
+		}
+	}
+	if t.FailedLogins != nil && *t.FailedLogins < 0 {
+		return errors.Errorf("monitoring.prometheusRule.thresholds.failedLogins must not be negative, got %d", *t.FailedLogins)
+	}
+	return nil
+}
+
+const (
+	OverrideStrategic = "strategic"
+	OverrideJSON      = "json"
+)
+
+// KeycloakOverride patches the generated object of Kind named Name before it is created and whenever the operator
+// reconciles it
+type KeycloakOverride struct {
+	// Kind and Name select the generated object, such as DeploymentConfig and the name of the Keycloak
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Type is strategic for a strategic merge patch or json for an RFC 6902 JSON patch, strategic when empty
+	Type string `json:"type,omitempty"`
+	// Patch is the patch in JSON or YAML
+	Patch string `json:"patch"`
+}
+
+// PatchJSON returns the patch converted to JSON
+func (o KeycloakOverride) PatchJSON() ([]byte, error) {
+	patch, err := yaml.ToJSON([]byte(o.Patch))
+	return patch, errors.Wrapf(err, "the override of %s/%s has an invalid patch", o.Kind, o.Name)
+}
+
+func (o KeycloakOverride) validate() error {
+	if o.Kind == "" || o.Name == "" {
+		return errors.New("an override requires the kind and name of the object it patches")
+	}
+	patch, err := o.PatchJSON()
+	if err != nil {
+		return err
+	}
+	switch o.Type {
+	case "", OverrideStrategic:
+		if err := json.Unmarshal(patch, &map[string]interface{}{}); err != nil {
+			return errors.Errorf("the strategic merge patch of the override of %s/%s must be an object", o.Kind, o.Name)
+		}
+	case OverrideJSON:
+		if _, err := util.DecodeJSONPatch(patch); err != nil {
+			return errors.Wrapf(err, "the override of %s/%s has an invalid patch", o.Kind, o.Name)
+		}
+	default:
+		return errors.Errorf("the override of %s/%s must be of type strategic or json, got '%s'", o.Kind, o.Name, o.Type)
+	}
+	return nil
+}
+
+const (
+	ExtensionPlugin = "plugin"
+	ExtensionTheme  = "theme"
+)
+
+var sha256Pattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// KeycloakExtension is a plugin jar or a zip archive of a theme, fetched from exactly one of URL, ConfigMap or Image
+type KeycloakExtension struct {
+	// Name identifies the extension, a plugin is installed as <name>.jar and a theme in a directory of that name
+	Name string `json:"name"`
+	// Type is plugin or theme
+	Type string `json:"type"`
+	// Version is reported in the status once the extension is loaded
+	Version string `json:"version,omitempty"`
+	// Providers are the ids of the providers a plugin registers, the plugin is reported loaded once the serverinfo of
+	// the server lists all of them
+	Providers []string `json:"providers,omitempty"`
+	// SHA256 is the hex encoded checksum the file must match, it is required for a URL
+	SHA256 string `json:"sha256,omitempty"`
+	// URL is an http or https URL the file is downloaded from
+	URL       string                      `json:"url,omitempty"`
+	ConfigMap *KeycloakExtensionConfigMap `json:"configMap,omitempty"`
+	Image     *KeycloakExtensionImage     `json:"image,omitempty"`
+}
+
+// KeycloakExtensionConfigMap is a key of a ConfigMap in the Keycloak namespace holding the file, binaryData for jars
+// and archives
+type KeycloakExtensionConfigMap struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// KeycloakExtensionImage is the file at Path in Image, the image needs sh and cp
+type KeycloakExtensionImage struct {
+	Image string `json:"image"`
+	Path  string `json:"path"`
+}
+
+func (e KeycloakExtension) validate() error {
+	if errs := validation.IsDNS1123Label(e.Name); len(errs) > 0 {
+		return errors.Errorf("extension name '%s' is not valid: %s", e.Name, strings.Join(errs, ", "))
+	}
+	if e.Type != ExtensionPlugin && e.Type != ExtensionTheme {
+		return errors.Errorf("extension %s must be of type plugin or theme, got '%s'", e.Name, e.Type)
+	}
+	sources := 0
+	if e.URL != "" {
+		sources++
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.Errorf("extension %s requires an http or https url, got '%s'", e.Name, e.URL)
+		}
+		if e.SHA256 == "" {
+			return errors.Errorf("extension %s requires a sha256 with a url", e.Name)
+		}
+	}
+	if e.ConfigMap != nil {
+		sources++
+		if e.ConfigMap.Name == "" || e.ConfigMap.Key == "" {
+			return errors.Errorf("extension %s requires the name and key of the configMap", e.Name)
+		}
+	}
+	if e.Image != nil {
+		sources++
+		if e.Image.Image == "" || !path.IsAbs(e.Image.Path) {
+			return errors.Errorf("extension %s requires an image and an absolute path in it", e.Name)
+		}
+	}
+	if sources != 1 {
+		return errors.Errorf("extension %s requires exactly one of url, configMap or image", e.Name)
+	}
+	if e.Type == ExtensionTheme && len(e.Providers) > 0 {
+		return errors.Errorf("extension %s is a theme, only plugins have providers", e.Name)
+	}
+	if e.SHA256 != "" && !sha256Pattern.MatchString(e.SHA256) {
+		return errors.Errorf("extension %s has an invalid sha256 '%s'", e.Name, e.SHA256)
+	}
+	return nil
+}
+
+// KeycloakExposureSpec is how a provisioned instance is reached from outside the cluster
+type KeycloakExposureSpec struct {
+	// Hostname is the external hostname of the route or ingress and SSO_HOSTNAME of Keycloak, the cluster generates
+	// one when empty
+	Hostname string               `json:"hostname,omitempty"`
+	TLS      *KeycloakExposureTLS `json:"tls,omitempty"`
+}
+
+// KeycloakExposureTLS configures where TLS is terminated and the certificate served for the hostname
+type KeycloakExposureTLS struct {
+	// Termination is reencrypt or passthrough for a route, reencrypt when empty, and edge for an ingress
+	Termination string `json:"termination,omitempty"`
+	// Secret is the name of a kubernetes.io/tls secret with the tls.crt and tls.key keys, and an optional ca.crt
+	Secret string `json:"secret,omitempty"`
+}
+
+// KeycloakCredentialRotationSpec is how often credentials are rotated
+type KeycloakCredentialRotationSpec struct {
+	// Interval is the time between rotations, such as 720h
+	Interval *metav1.Duration `json:"interval"`
+}
+
+// KeycloakWorkloadSpec is the sizing and placement of a workload, unset fields keep the values it was provisioned with
+type KeycloakWorkloadSpec struct {
+	Resources    *v1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector map[string]string        `json:"nodeSelector,omitempty"`
+	Tolerations  []v1.Toleration          `json:"tolerations,omitempty"`
+	Affinity     *v1.Affinity             `json:"affinity,omitempty"`
+}
+
+// KeycloakInstanceSpec is the sizing and availability of the Keycloak workload
+type KeycloakInstanceSpec struct {
+	KeycloakWorkloadSpec `json:",inline"`
+	Replicas             *int32                           `json:"replicas,omitempty"`
+	JVM                  *KeycloakJVMSpec                 `json:"jvm,omitempty"`
+	PodDisruptionBudget  *KeycloakPodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+}
+
+// KeycloakJVMSpec sets the heap of the Keycloak JVM instead of deriving it from the container memory limit
+type KeycloakJVMSpec struct {
+	InitialHeap *resource.Quantity `json:"initialHeap,omitempty"`
+	MaxHeap     *resource.Quantity `json:"maxHeap,omitempty"`
+}
+
+// KeycloakPodDisruptionBudgetSpec limits voluntary disruptions of the Keycloak pods, exactly one field must be set
+type KeycloakPodDisruptionBudgetSpec struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+func (i KeycloakInstanceSpec) validate() error {
+	if i.Replicas != nil && *i.Replicas < 0 {
+		return errors.Errorf("instance.replicas must not be negative, got %d", *i.Replicas)
+	}
+	if pdb := i.PodDisruptionBudget; pdb != nil && (pdb.MinAvailable == nil) == (pdb.MaxUnavailable == nil) {
+		return errors.New("instance.podDisruptionBudget requires exactly one of minAvailable or maxUnavailable")
+	}
+	if jvm := i.JVM; jvm != nil {
+		// the heap is rendered in MiB
+		minHeap := resource.MustParse("1Mi")
+		if jvm.InitialHeap != nil && jvm.InitialHeap.Cmp(minHeap) < 0 {
+			return errors.Errorf("instance.jvm.initialHeap must be at least 1Mi, got %s", jvm.InitialHeap.String())
+		}
+		if jvm.MaxHeap != nil && jvm.MaxHeap.Cmp(minHeap) < 0 {
+			return errors.Errorf("instance.jvm.maxHeap must be at least 1Mi, got %s", jvm.MaxHeap.String())
+		}
+	}
+	if jvm := i.JVM; jvm != nil && jvm.MaxHeap != nil {
+		if jvm.InitialHeap != nil && jvm.InitialHeap.Cmp(*jvm.MaxHeap) > 0 {
+			return errors.Errorf("instance.jvm.initialHeap %s is above maxHeap %s", jvm.InitialHeap.String(), jvm.MaxHeap.String())
+		}
+		if i.Resources != nil {
+			if limit, ok := i.Resources.Limits[v1.ResourceMemory]; ok && jvm.MaxHeap.Cmp(limit) >= 0 {
+				return errors.Errorf("instance.jvm.maxHeap %s must leave room below the memory limit %s", jvm.MaxHeap.String(), limit.String())
+			}
+		}
+	}
+	return nil
+}
+
+// KeycloakExternalDatabase is a PostgreSQL server managed outside of the operator
+type KeycloakExternalDatabase struct {
+	Host     string `json:"host"`
+	Port     int32  `json:"port,omitempty"`
+	Database string `json:"database"`
+	// CredentialsSecret is the name of a secret in the Keycloak namespace with the username and password keys
+	CredentialsSecret string                       `json:"credentialsSecret"`
+	TLS               *KeycloakExternalDatabaseTLS `json:"tls,omitempty"`
+}
+
+// KeycloakExternalDatabaseTLS configures how Keycloak connects to the external database over TLS
+type KeycloakExternalDatabaseTLS struct {
+	// SSLMode is the PostgreSQL JDBC sslmode, one of require, verify-ca or verify-full
+	SSLMode string `json:"sslMode"`
+	// CASecret is the name of a secret with the ca.crt key used to verify the server certificate
+	CASecret string `json:"caSecret,omitempty"`
+}
+
+// Platform is the kind of cluster a Keycloak instance is provisioned on
+type Platform string
+
+var (
+	// PlatformOpenShift provisions from the RH-SSO template as DeploymentConfigs exposed through a Route
+	PlatformOpenShift Platform = "openshift"
+	// PlatformKubernetes provisions native Deployments and StatefulSets exposed through an Ingress
+	PlatformKubernetes Platform = "kubernetes"
+)
+
+// KeycloakBackupConfig details of a backup task
+type KeycloakBackupConfig struct {
 	Name                          string            `json:"name"`
 	Labels                        map[string]string `json:"labels"`
 	Schedule                      string            `json:"schedule"`
@@ -63,6 +492,175 @@ type KeycloakBackup struct {
 	DbCredentialsSecretName       string            `json:"db_credentials_secret_name"`
 	Image                         string            `json:"image"`
 	ImageTag                      string            `json:"image_tag"`
+	// Destination is where the archives are stored, AWS S3 with the aws credentials secret when it is left out
+	Destination *KeycloakBackupDestination `json:"destination,omitempty"`
+	// Retention is how many scheduled archives are kept at the destination, the operator prunes it after every
+	// scheduled backup
+	Retention *KeycloakBackupRetention `json:"retention,omitempty"`
+}
+
+// KeycloakBackupDestination is where backups are stored, exactly one of its fields is set
+type KeycloakBackupDestination struct {
+	S3        *KeycloakBackupS3Destination        `json:"s3,omitempty"`
+	PVC       *KeycloakBackupPVCDestination       `json:"pvc,omitempty"`
+	InCluster *KeycloakBackupInClusterDestination `json:"inCluster,omitempty"`
+}
+
+// KeycloakBackupS3Destination is an S3-compatible object store outside the cluster
+type KeycloakBackupS3Destination struct {
+	// Endpoint is the http or https URL of the object store
+	Endpoint string `json:"endpoint"`
+	// Bucket overrides the bucket in the credentials secret
+	Bucket string `json:"bucket,omitempty"`
+	// CredentialsSecret is the secret in the namespace of the Keycloak holding the access keys and bucket
+	CredentialsSecret string `json:"credentialsSecret"`
+	// CASecret is a secret in the namespace of the Keycloak whose ca.crt key signed the certificate of the endpoint
+	CASecret string `json:"caSecret,omitempty"`
+}
+
+// KeycloakBackupPVCDestination is a persistent volume claim in the namespace of the Keycloak
+type KeycloakBackupPVCDestination struct {
+	ClaimName string `json:"claimName"`
+	// Path is the directory within the volume the archives are stored in
+	Path string `json:"path,omitempty"`
+}
+
+// KeycloakBackupInClusterDestination is an S3-compatible object store running as a service in the cluster
+type KeycloakBackupInClusterDestination struct {
+	Service string `json:"service"`
+	// Namespace of the service, the namespace of the Keycloak when it is left out
+	Namespace         string `json:"namespace,omitempty"`
+	Port              int32  `json:"port,omitempty"`
+	Bucket            string `json:"bucket,omitempty"`
+	CredentialsSecret string `json:"credentialsSecret"`
+	// CASecret switches the endpoint to https, its ca.crt key signed the certificate of the service
+	CASecret string `json:"caSecret,omitempty"`
+}
+
+// KeycloakBackupRetention limits the archives kept at a destination, archives beyond either limit are deleted
+type KeycloakBackupRetention struct {
+	KeepLast *int32 `json:"keepLast,omitempty"`
+	// MaxAge is a duration such as 720h
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// DefaultObjectStorePort is the port of an in-cluster object store when the destination doesn't name one
+const DefaultObjectStorePort = 9000
+
+// Validate checks the destination and retention of the backup
+func (b KeycloakBackupConfig) Validate() error {
+	if d := b.Destination; d != nil {
+		set := 0
+		if d.S3 != nil {
+			set++
+			endpoint, err := url.Parse(d.S3.Endpoint)
+			if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+				return errors.Errorf("backup %s: destination.s3.endpoint must be an http or https URL, got '%s'", b.Name, d.S3.Endpoint)
+			}
+			if d.S3.CredentialsSecret == "" {
+				return errors.Errorf("backup %s: destination.s3 requires a credentialsSecret", b.Name)
+			}
+		}
+		if d.PVC != nil {
+			set++
+			if d.PVC.ClaimName == "" {
+				return errors.Errorf("backup %s: destination.pvc requires a claimName", b.Name)
+			}
+			if path.IsAbs(d.PVC.Path) || strings.HasPrefix(path.Clean(d.PVC.Path), "..") {
+				return errors.Errorf("backup %s: destination.pvc.path must be relative to the volume, got '%s'", b.Name, d.PVC.Path)
+			}
+		}
+		if d.InCluster != nil {
+			set++
+			if d.InCluster.Service == "" || d.InCluster.CredentialsSecret == "" {
+				return errors.Errorf("backup %s: destination.inCluster requires a service and credentialsSecret", b.Name)
+			}
+			if d.InCluster.Port < 0 || d.InCluster.Port > 65535 {
+				return errors.Errorf("backup %s: destination.inCluster.port must be a valid port, got %d", b.Name, d.InCluster.Port)
+			}
+		}
+		if set != 1 {
+			return errors.Errorf("backup %s: destination requires exactly one of s3, pvc or inCluster", b.Name)
+		}
+	}
+	if r := b.Retention; r != nil {
+		if b.Destination == nil {
+			return errors.Errorf("backup %s: retention requires a destination, expire the archives of the default destination with a lifecycle rule of its bucket", b.Name)
+		}
+		if r.KeepLast == nil && r.MaxAge == nil {
+			return errors.Errorf("backup %s: retention requires keepLast or maxAge", b.Name)
+		}
+		if r.KeepLast != nil && *r.KeepLast < 1 {
+			return errors.Errorf("backup %s: retention.keepLast must be at least 1, got %d", b.Name, *r.KeepLast)
+		}
+		if r.MaxAge != nil && r.MaxAge.Duration <= 0 {
+			return errors.Errorf("backup %s: retention.maxAge must be positive, got %s", b.Name, r.MaxAge.Duration)
+		}
+	}
+	return nil
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// crd:gen:Kind=KeycloakBackup:Group=aerogear.org
+type KeycloakBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              KeycloakBackupSpec `json:"spec"`
+	Status            KeycloakJobStatus  `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type KeycloakBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []KeycloakBackup `json:"items"`
+}
+
+type KeycloakBackupSpec struct {
+	// Keycloak is the name of the Keycloak in the same namespace whose database is backed up
+	Keycloak string `json:"keycloak"`
+	// Backup is the name of the entry in the backups of the Keycloak whose image and secrets are used, the first
+	// entry is used when it is left out
+	Backup string `json:"backup,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// crd:gen:Kind=KeycloakRestore:Group=aerogear.org
+type KeycloakRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              KeycloakRestoreSpec   `json:"spec"`
+	Status            KeycloakRestoreStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type KeycloakRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []KeycloakRestore `json:"items"`
+}
+
+type KeycloakRestoreSpec struct {
+	// Backup is the name of the completed KeycloakBackup in the same namespace to restore, it is restored into the
+	// Keycloak it was taken from. Only the backups stored on a pvc destination can be restored
+	Backup string `json:"backup"`
+}
+
+// KeycloakJobStatus is the progress of the job running a backup or restore
+type KeycloakJobStatus struct {
+	Phase   StatusPhase `json:"phase,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Job     string      `json:"job,omitempty"`
+	// Location is where the archive of a backup is stored
+	Location       string       `json:"location,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+type KeycloakRestoreStatus struct {
+	KeycloakJobStatus `json:",inline"`
+	// Replicas is what the Keycloak workload is scaled back up to once the restore is done
+	Replicas int32 `json:"replicas,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -132,8 +730,8 @@ type KeycloakIdentityProviderPair struct {
 
 type KeycloakUser struct {
 	*KeycloakApiUser
-	OutputSecret        *string             `json:"outputSecret, omitempty"`
-	Password            *string             `json:"password, omitempty"`
+	OutputSecret        *string             `json:"outputSecret,omitempty"`
+	Password            *string             `json:"password,omitempty"`
 	FederatedIdentities []FederatedIdentity `json:"federatedIdentities,omitempty"`
 }
 
@@ -204,7 +802,7 @@ type AuthenticatorConfig struct {
 
 type KeycloakClient struct {
 	*KeycloakApiClient
-	OutputSecret *string `json:"outputSecret, omitempty"`
+	OutputSecret *string `json:"outputSecret,omitempty"`
 }
 
 type KeycloakApiClient struct {
@@ -269,15 +867,151 @@ type GenericStatus struct {
 
 type KeycloakStatus struct {
 	GenericStatus
-	MonitoringResourcesCreated bool  `json:"monitoringResourcesCreated"`
-	Replicas                   int32 `json:"replicas"`
+	// MonitoringResourcesCreated is true when every enabled monitoring resource exists
+	MonitoringResourcesCreated bool     `json:"monitoringResourcesCreated"`
+	Replicas                   int32    `json:"replicas"`
+	Platform                   Platform `json:"platform,omitempty"`
+	// ApplicationName is the name the objects generated for the instance are derived from, the name of the Keycloak
+	ApplicationName string `json:"applicationName,omitempty"`
+	// Image is the container image set in the spec the instance runs, it is empty when it runs the image of its release
+	Image string `json:"image,omitempty"`
+	// Upgrade reports the progress of a running upgrade
+	Upgrade *KeycloakUpgradeStatus `json:"upgrade,omitempty"`
+	// RollbackPoint is the backup taken before the last upgrade and what the instance ran at the time
+	RollbackPoint *KeycloakRollbackPoint `json:"rollbackPoint,omitempty"`
+	// RolledBack is the upgrade that was rolled back, it isn't retried until the spec asks for something else
+	RolledBack *KeycloakRolledBackUpgrade `json:"rolledBack,omitempty"`
+	// Backups reports the last runs of the scheduled backups
+	Backups []KeycloakScheduledBackupStatus `json:"backups,omitempty"`
+	// Corrections are the install objects the last reconcile recreated or set back to what the operator rendered, as
+	// kind/name and what was corrected. They are cleared by a reconcile that found nothing to correct
+	Corrections []string `json:"corrections,omitempty"`
+	// LastCorrected is when install objects were last found missing or drifted
+	LastCorrected *metav1.Time `json:"lastCorrected,omitempty"`
+	// AdminCredentials reports the rotations of the master admin password
+	AdminCredentials *KeycloakCredentialsStatus `json:"adminCredentials,omitempty"`
+	// DatabaseCredentials reports the rotations of the password of the bundled database
+	DatabaseCredentials *KeycloakCredentialsStatus `json:"databaseCredentials,omitempty"`
+	// Overrides reports whether the overrides apply to the objects rendered for the current spec
+	Overrides *KeycloakOverridesStatus `json:"overrides,omitempty"`
+	// Extensions report whether the server lists the extensions in its serverinfo once the pods fetching them rolled
+	// out
+	Extensions []KeycloakExtensionStatus `json:"extensions,omitempty"`
+}
+
+// KeycloakOverridesStatus is the result of the last check of the overrides
+type KeycloakOverridesStatus struct {
+	// Checksum identifies the spec the overrides were checked with, they are checked again when it changes
+	Checksum string `json:"checksum"`
+	// Error is why the overrides don't apply, the install objects are not provisioned or reconciled until it is fixed
+	Error string `json:"error,omitempty"`
+}
+
+// KeycloakExtensionStatus is an extension of the spec and whether the server loaded it
+type KeycloakExtensionStatus struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	// Loaded is true when the serverinfo lists the theme, or all the providers of the plugin
+	Loaded bool `json:"loaded"`
+	// Message tells why the extension isn't reported loaded
+	Message string `json:"message,omitempty"`
+}
+
+// KeycloakServerInfo is what the serverinfo endpoint of the admin API reports of a running server
+type KeycloakServerInfo struct {
+	Version string `json:"version"`
+	// Providers are the ids of the loaded providers by SPI
+	Providers map[string][]string `json:"providers,omitempty"`
+	// Themes are the names of the loaded themes by theme type
+	Themes map[string][]string `json:"themes,omitempty"`
+}
+
+// KeycloakCredentialsStatus is the rotation history of credentials
+type KeycloakCredentialsStatus struct {
+	// LastRotated is when the last rotation completed, scheduled rotations are due an interval after it
+	LastRotated *metav1.Time `json:"lastRotated,omitempty"`
+	// Request is the value of the rotation annotation the last requested rotation was started for
+	Request string `json:"request,omitempty"`
+	// Rotations are the last rotations, the most recent last
+	Rotations []KeycloakCredentialRotation `json:"rotations,omitempty"`
+}
+
+// KeycloakCredentialRotation is a rotation of credentials, it is running until it completes
+type KeycloakCredentialRotation struct {
+	// Reason is requested when the rotation was started by the annotation and scheduled otherwise
+	Reason    string       `json:"reason"`
+	Started   metav1.Time  `json:"started"`
+	Completed *metav1.Time `json:"completed,omitempty"`
+	// Message is why the last attempt of a running rotation failed
+	Message string `json:"message,omitempty"`
+}
+
+// KeycloakScheduledBackupStatus is the outcome of the last jobs of a scheduled backup
+type KeycloakScheduledBackupStatus struct {
+	Name        string       `json:"name"`
+	LastSuccess *metav1.Time `json:"lastSuccess,omitempty"`
+	LastFailure *metav1.Time `json:"lastFailure,omitempty"`
+	// LastFailureMessage is why the last failed job failed
+	LastFailureMessage string `json:"lastFailureMessage,omitempty"`
+	// LastPruned is the last success after which the archives beyond the retention were deleted
+	LastPruned *metav1.Time `json:"lastPruned,omitempty"`
+}
+
+// KeycloakRollbackPoint is what an upgrade restores when the new pods never become ready
+type KeycloakRollbackPoint struct {
+	Version string `json:"version"`
+	// Image is the container image the instance ran, it is pinned on the workload when rolling back
+	Image string `json:"image"`
+	// Backup is the name of the first backup in the spec with a pvc destination, the database was backed up with it.
+	// It is empty when no backup is set
+	Backup string `json:"backup,omitempty"`
+	// BackupJob is the name of the job that took the backup and of the archive it stored
+	BackupJob string `json:"backupJob,omitempty"`
+	// Completed is when the backup job succeeded
+	Completed *metav1.Time `json:"completed,omitempty"`
+}
+
+// KeycloakRolledBackUpgrade is an upgrade that was rolled back and why
+type KeycloakRolledBackUpgrade struct {
+	TargetVersion string `json:"targetVersion"`
+	TargetImage   string `json:"targetImage,omitempty"`
+	Reason        string `json:"reason"`
+}
+
+// KeycloakUpgradeStatus is the plan of an upgrade
+type KeycloakUpgradeStatus struct {
+	TargetVersion string `json:"targetVersion"`
+	TargetImage   string `json:"targetImage,omitempty"`
+	// Path is the version every step of the upgrade migrates to, in order
+	Path []string `json:"path"`
+	// Step is the version the running step migrates to
+	Step string `json:"step,omitempty"`
+	// ScaledUp is when the running step scaled the workload back up
+	ScaledUp *metav1.Time `json:"scaledUp,omitempty"`
+	// RollingBack is set once the upgrade is being rolled back to the rollback point
+	RollingBack bool `json:"rollingBack,omitempty"`
+	// Restored is set once the database was restored from the backup of the rollback point
+	Restored bool `json:"restored,omitempty"`
 }
 
 type StatusPhase string
 
+// Phased is implemented by the custom resources, the dispatcher labels the metrics of a reconcile with their phase
+type Phased interface {
+	CurrentPhase() StatusPhase
+}
+
+func (k *Keycloak) CurrentPhase() StatusPhase        { return k.Status.Phase }
+func (k *KeycloakRealm) CurrentPhase() StatusPhase   { return k.Status.Phase }
+func (k *KeycloakBackup) CurrentPhase() StatusPhase  { return k.Status.Phase }
+func (k *KeycloakRestore) CurrentPhase() StatusPhase { return k.Status.Phase }
+
 var (
 	NoPhase                    StatusPhase = ""
 	PhaseAccepted              StatusPhase = "accepted"
+	PhaseRunning               StatusPhase = "running"
 	PhaseComplete              StatusPhase = "complete"
 	PhaseFailed                StatusPhase = "failed"
 	PhaseModified              StatusPhase = "modified"
@@ -5,7 +5,10 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -106,7 +109,7 @@ func (in *Keycloak) DeepCopyInto(out *Keycloak) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -128,6 +131,52 @@ func (in *Keycloak) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakAlertThresholds) DeepCopyInto(out *KeycloakAlertThresholds) {
+	*out = *in
+	if in.HeapUsagePercent != nil {
+		in, out := &in.HeapUsagePercent, &out.HeapUsagePercent
+		*out = new(float64)
+		**out = **in
+	}
+	if in.NonHeapUsagePercent != nil {
+		in, out := &in.NonHeapUsagePercent, &out.NonHeapUsagePercent
+		*out = new(float64)
+		**out = **in
+	}
+	if in.GCTimePercent != nil {
+		in, out := &in.GCTimePercent, &out.GCTimePercent
+		*out = new(float64)
+		**out = **in
+	}
+	if in.FailedLogins != nil {
+		in, out := &in.FailedLogins, &out.FailedLogins
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RequestsWithin1sPercent != nil {
+		in, out := &in.RequestsWithin1sPercent, &out.RequestsWithin1sPercent
+		*out = new(float64)
+		**out = **in
+	}
+	if in.RequestsWithin10sPercent != nil {
+		in, out := &in.RequestsWithin10sPercent, &out.RequestsWithin10sPercent
+		*out = new(float64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakAlertThresholds.
+func (in *KeycloakAlertThresholds) DeepCopy() *KeycloakAlertThresholds {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakAlertThresholds)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeycloakApiClient) DeepCopyInto(out *KeycloakApiClient) {
 	*out = *in
@@ -299,13 +348,10 @@ func (in *KeycloakApiUser) DeepCopy() *KeycloakApiUser {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeycloakBackup) DeepCopyInto(out *KeycloakBackup) {
 	*out = *in
-	if in.Labels != nil {
-		in, out := &in.Labels, &out.Labels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -319,115 +365,102 @@ func (in *KeycloakBackup) DeepCopy() *KeycloakBackup {
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakClient) DeepCopyInto(out *KeycloakClient) {
-	*out = *in
-	if in.KeycloakApiClient != nil {
-		in, out := &in.KeycloakApiClient, &out.KeycloakApiClient
-		*out = new(KeycloakApiClient)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.OutputSecret != nil {
-		in, out := &in.OutputSecret, &out.OutputSecret
-		*out = new(string)
-		**out = **in
-	}
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakClient.
-func (in *KeycloakClient) DeepCopy() *KeycloakClient {
-	if in == nil {
-		return nil
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KeycloakBackup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
 	}
-	out := new(KeycloakClient)
-	in.DeepCopyInto(out)
-	return out
+	return nil
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakClientPair) DeepCopyInto(out *KeycloakClientPair) {
+func (in *KeycloakBackupConfig) DeepCopyInto(out *KeycloakBackupConfig) {
 	*out = *in
-	if in.KcClient != nil {
-		in, out := &in.KcClient, &out.KcClient
-		*out = new(KeycloakClient)
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Destination != nil {
+		in, out := &in.Destination, &out.Destination
+		*out = new(KeycloakBackupDestination)
 		(*in).DeepCopyInto(*out)
 	}
-	if in.SpecClient != nil {
-		in, out := &in.SpecClient, &out.SpecClient
-		*out = new(KeycloakClient)
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(KeycloakBackupRetention)
 		(*in).DeepCopyInto(*out)
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakClientPair.
-func (in *KeycloakClientPair) DeepCopy() *KeycloakClientPair {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupConfig.
+func (in *KeycloakBackupConfig) DeepCopy() *KeycloakBackupConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakClientPair)
+	out := new(KeycloakBackupConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakIdentityProvider) DeepCopyInto(out *KeycloakIdentityProvider) {
+func (in *KeycloakBackupDestination) DeepCopyInto(out *KeycloakBackupDestination) {
 	*out = *in
-	if in.Config != nil {
-		in, out := &in.Config, &out.Config
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(KeycloakBackupS3Destination)
+		**out = **in
+	}
+	if in.PVC != nil {
+		in, out := &in.PVC, &out.PVC
+		*out = new(KeycloakBackupPVCDestination)
+		**out = **in
+	}
+	if in.InCluster != nil {
+		in, out := &in.InCluster, &out.InCluster
+		*out = new(KeycloakBackupInClusterDestination)
+		**out = **in
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakIdentityProvider.
-func (in *KeycloakIdentityProvider) DeepCopy() *KeycloakIdentityProvider {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupDestination.
+func (in *KeycloakBackupDestination) DeepCopy() *KeycloakBackupDestination {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakIdentityProvider)
+	out := new(KeycloakBackupDestination)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakIdentityProviderPair) DeepCopyInto(out *KeycloakIdentityProviderPair) {
+func (in *KeycloakBackupInClusterDestination) DeepCopyInto(out *KeycloakBackupInClusterDestination) {
 	*out = *in
-	if in.KcIdentityProvider != nil {
-		in, out := &in.KcIdentityProvider, &out.KcIdentityProvider
-		*out = new(KeycloakIdentityProvider)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.SpecIdentityProvider != nil {
-		in, out := &in.SpecIdentityProvider, &out.SpecIdentityProvider
-		*out = new(KeycloakIdentityProvider)
-		(*in).DeepCopyInto(*out)
-	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakIdentityProviderPair.
-func (in *KeycloakIdentityProviderPair) DeepCopy() *KeycloakIdentityProviderPair {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupInClusterDestination.
+func (in *KeycloakBackupInClusterDestination) DeepCopy() *KeycloakBackupInClusterDestination {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakIdentityProviderPair)
+	out := new(KeycloakBackupInClusterDestination)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakList) DeepCopyInto(out *KeycloakList) {
+func (in *KeycloakBackupList) DeepCopyInto(out *KeycloakBackupList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	out.ListMeta = in.ListMeta
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]Keycloak, len(*in))
+		*out = make([]KeycloakBackup, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -435,18 +468,18 @@ func (in *KeycloakList) DeepCopyInto(out *KeycloakList) {
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakList.
-func (in *KeycloakList) DeepCopy() *KeycloakList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupList.
+func (in *KeycloakBackupList) DeepCopy() *KeycloakBackupList {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakList)
+	out := new(KeycloakBackupList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *KeycloakList) DeepCopyObject() runtime.Object {
+func (in *KeycloakBackupList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -454,203 +487,1148 @@ func (in *KeycloakList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakProtocolMapper) DeepCopyInto(out *KeycloakProtocolMapper) {
+func (in *KeycloakBackupPVCDestination) DeepCopyInto(out *KeycloakBackupPVCDestination) {
 	*out = *in
-	if in.Config != nil {
-		in, out := &in.Config, &out.Config
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakProtocolMapper.
-func (in *KeycloakProtocolMapper) DeepCopy() *KeycloakProtocolMapper {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupPVCDestination.
+func (in *KeycloakBackupPVCDestination) DeepCopy() *KeycloakBackupPVCDestination {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakProtocolMapper)
+	out := new(KeycloakBackupPVCDestination)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakRealm) DeepCopyInto(out *KeycloakRealm) {
+func (in *KeycloakBackupRetention) DeepCopyInto(out *KeycloakBackupRetention) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	if in.KeepLast != nil {
+		in, out := &in.KeepLast, &out.KeepLast
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealm.
-func (in *KeycloakRealm) DeepCopy() *KeycloakRealm {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupRetention.
+func (in *KeycloakBackupRetention) DeepCopy() *KeycloakBackupRetention {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakRealm)
+	out := new(KeycloakBackupRetention)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *KeycloakRealm) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakRealmList) DeepCopyInto(out *KeycloakRealmList) {
+func (in *KeycloakBackupS3Destination) DeepCopyInto(out *KeycloakBackupS3Destination) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]KeycloakRealm, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealmList.
-func (in *KeycloakRealmList) DeepCopy() *KeycloakRealmList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupS3Destination.
+func (in *KeycloakBackupS3Destination) DeepCopy() *KeycloakBackupS3Destination {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakRealmList)
+	out := new(KeycloakBackupS3Destination)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *KeycloakRealmList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakBackupSpec) DeepCopyInto(out *KeycloakBackupSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakBackupSpec.
+func (in *KeycloakBackupSpec) DeepCopy() *KeycloakBackupSpec {
+	if in == nil {
+		return nil
 	}
-	return nil
+	out := new(KeycloakBackupSpec)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakRealmSpec) DeepCopyInto(out *KeycloakRealmSpec) {
+func (in *KeycloakClient) DeepCopyInto(out *KeycloakClient) {
 	*out = *in
-	if in.KeycloakApiRealm != nil {
-		in, out := &in.KeycloakApiRealm, &out.KeycloakApiRealm
-		*out = new(KeycloakApiRealm)
+	if in.KeycloakApiClient != nil {
+		in, out := &in.KeycloakApiClient, &out.KeycloakApiClient
+		*out = new(KeycloakApiClient)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.OutputSecret != nil {
+		in, out := &in.OutputSecret, &out.OutputSecret
+		*out = new(string)
+		**out = **in
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealmSpec.
-func (in *KeycloakRealmSpec) DeepCopy() *KeycloakRealmSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakClient.
+func (in *KeycloakClient) DeepCopy() *KeycloakClient {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakRealmSpec)
+	out := new(KeycloakClient)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakRealmStatus) DeepCopyInto(out *KeycloakRealmStatus) {
+func (in *KeycloakClientPair) DeepCopyInto(out *KeycloakClientPair) {
 	*out = *in
+	if in.KcClient != nil {
+		in, out := &in.KcClient, &out.KcClient
+		*out = new(KeycloakClient)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SpecClient != nil {
+		in, out := &in.SpecClient, &out.SpecClient
+		*out = new(KeycloakClient)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealmStatus.
-func (in *KeycloakRealmStatus) DeepCopy() *KeycloakRealmStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakClientPair.
+func (in *KeycloakClientPair) DeepCopy() *KeycloakClientPair {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakRealmStatus)
+	out := new(KeycloakClientPair)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakSpec) DeepCopyInto(out *KeycloakSpec) {
+func (in *KeycloakCredentialRotation) DeepCopyInto(out *KeycloakCredentialRotation) {
 	*out = *in
-	if in.Plugins != nil {
-		in, out := &in.Plugins, &out.Plugins
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-	if in.Backups != nil {
-		in, out := &in.Backups, &out.Backups
-		*out = make([]KeycloakBackup, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	in.Started.DeepCopyInto(&out.Started)
+	if in.Completed != nil {
+		in, out := &in.Completed, &out.Completed
+		*out = (*in).DeepCopy()
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakSpec.
-func (in *KeycloakSpec) DeepCopy() *KeycloakSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakCredentialRotation.
+func (in *KeycloakCredentialRotation) DeepCopy() *KeycloakCredentialRotation {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakSpec)
+	out := new(KeycloakCredentialRotation)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakStatus) DeepCopyInto(out *KeycloakStatus) {
+func (in *KeycloakCredentialRotationSpec) DeepCopyInto(out *KeycloakCredentialRotationSpec) {
 	*out = *in
-	out.GenericStatus = in.GenericStatus
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakStatus.
-func (in *KeycloakStatus) DeepCopy() *KeycloakStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakCredentialRotationSpec.
+func (in *KeycloakCredentialRotationSpec) DeepCopy() *KeycloakCredentialRotationSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakStatus)
+	out := new(KeycloakCredentialRotationSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KeycloakUser) DeepCopyInto(out *KeycloakUser) {
+func (in *KeycloakCredentialsStatus) DeepCopyInto(out *KeycloakCredentialsStatus) {
 	*out = *in
-	if in.KeycloakApiUser != nil {
-		in, out := &in.KeycloakApiUser, &out.KeycloakApiUser
-		*out = new(KeycloakApiUser)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.OutputSecret != nil {
-		in, out := &in.OutputSecret, &out.OutputSecret
-		*out = new(string)
-		**out = **in
-	}
-	if in.Password != nil {
-		in, out := &in.Password, &out.Password
-		*out = new(string)
-		**out = **in
+	if in.LastRotated != nil {
+		in, out := &in.LastRotated, &out.LastRotated
+		*out = (*in).DeepCopy()
 	}
-	if in.FederatedIdentities != nil {
-		in, out := &in.FederatedIdentities, &out.FederatedIdentities
-		*out = make([]FederatedIdentity, len(*in))
-		copy(*out, *in)
+	if in.Rotations != nil {
+		in, out := &in.Rotations, &out.Rotations
+		*out = make([]KeycloakCredentialRotation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakUser.
-func (in *KeycloakUser) DeepCopy() *KeycloakUser {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakCredentialsStatus.
+func (in *KeycloakCredentialsStatus) DeepCopy() *KeycloakCredentialsStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(KeycloakUser)
+	out := new(KeycloakCredentialsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExposureSpec) DeepCopyInto(out *KeycloakExposureSpec) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(KeycloakExposureTLS)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExposureSpec.
+func (in *KeycloakExposureSpec) DeepCopy() *KeycloakExposureSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExposureSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExposureTLS) DeepCopyInto(out *KeycloakExposureTLS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExposureTLS.
+func (in *KeycloakExposureTLS) DeepCopy() *KeycloakExposureTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExposureTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExtension) DeepCopyInto(out *KeycloakExtension) {
+	*out = *in
+	if in.Providers != nil {
+		in, out := &in.Providers, &out.Providers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(KeycloakExtensionConfigMap)
+		**out = **in
+	}
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(KeycloakExtensionImage)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExtension.
+func (in *KeycloakExtension) DeepCopy() *KeycloakExtension {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExtension)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExtensionConfigMap) DeepCopyInto(out *KeycloakExtensionConfigMap) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExtensionConfigMap.
+func (in *KeycloakExtensionConfigMap) DeepCopy() *KeycloakExtensionConfigMap {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExtensionConfigMap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExtensionImage) DeepCopyInto(out *KeycloakExtensionImage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExtensionImage.
+func (in *KeycloakExtensionImage) DeepCopy() *KeycloakExtensionImage {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExtensionImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExtensionStatus) DeepCopyInto(out *KeycloakExtensionStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExtensionStatus.
+func (in *KeycloakExtensionStatus) DeepCopy() *KeycloakExtensionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExtensionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExternalDatabase) DeepCopyInto(out *KeycloakExternalDatabase) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(KeycloakExternalDatabaseTLS)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExternalDatabase.
+func (in *KeycloakExternalDatabase) DeepCopy() *KeycloakExternalDatabase {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExternalDatabase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakExternalDatabaseTLS) DeepCopyInto(out *KeycloakExternalDatabaseTLS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakExternalDatabaseTLS.
+func (in *KeycloakExternalDatabaseTLS) DeepCopy() *KeycloakExternalDatabaseTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakExternalDatabaseTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakIdentityProvider) DeepCopyInto(out *KeycloakIdentityProvider) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakIdentityProvider.
+func (in *KeycloakIdentityProvider) DeepCopy() *KeycloakIdentityProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakIdentityProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakIdentityProviderPair) DeepCopyInto(out *KeycloakIdentityProviderPair) {
+	*out = *in
+	if in.KcIdentityProvider != nil {
+		in, out := &in.KcIdentityProvider, &out.KcIdentityProvider
+		*out = new(KeycloakIdentityProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SpecIdentityProvider != nil {
+		in, out := &in.SpecIdentityProvider, &out.SpecIdentityProvider
+		*out = new(KeycloakIdentityProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakIdentityProviderPair.
+func (in *KeycloakIdentityProviderPair) DeepCopy() *KeycloakIdentityProviderPair {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakIdentityProviderPair)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakInstanceSpec) DeepCopyInto(out *KeycloakInstanceSpec) {
+	*out = *in
+	in.KeycloakWorkloadSpec.DeepCopyInto(&out.KeycloakWorkloadSpec)
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.JVM != nil {
+		in, out := &in.JVM, &out.JVM
+		*out = new(KeycloakJVMSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(KeycloakPodDisruptionBudgetSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakInstanceSpec.
+func (in *KeycloakInstanceSpec) DeepCopy() *KeycloakInstanceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakInstanceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakJVMSpec) DeepCopyInto(out *KeycloakJVMSpec) {
+	*out = *in
+	if in.InitialHeap != nil {
+		in, out := &in.InitialHeap, &out.InitialHeap
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxHeap != nil {
+		in, out := &in.MaxHeap, &out.MaxHeap
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakJVMSpec.
+func (in *KeycloakJVMSpec) DeepCopy() *KeycloakJVMSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakJVMSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakJobStatus) DeepCopyInto(out *KeycloakJobStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakJobStatus.
+func (in *KeycloakJobStatus) DeepCopy() *KeycloakJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakList) DeepCopyInto(out *KeycloakList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Keycloak, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakList.
+func (in *KeycloakList) DeepCopy() *KeycloakList {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KeycloakList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakMonitoringResourceSpec) DeepCopyInto(out *KeycloakMonitoringResourceSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakMonitoringResourceSpec.
+func (in *KeycloakMonitoringResourceSpec) DeepCopy() *KeycloakMonitoringResourceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakMonitoringResourceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakMonitoringSpec) DeepCopyInto(out *KeycloakMonitoringSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	out.GrafanaDashboard = in.GrafanaDashboard
+	out.ServiceMonitor = in.ServiceMonitor
+	in.PrometheusRule.DeepCopyInto(&out.PrometheusRule)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakMonitoringSpec.
+func (in *KeycloakMonitoringSpec) DeepCopy() *KeycloakMonitoringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakMonitoringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakOverride) DeepCopyInto(out *KeycloakOverride) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakOverride.
+func (in *KeycloakOverride) DeepCopy() *KeycloakOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakOverridesStatus) DeepCopyInto(out *KeycloakOverridesStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakOverridesStatus.
+func (in *KeycloakOverridesStatus) DeepCopy() *KeycloakOverridesStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakOverridesStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakPodDisruptionBudgetSpec) DeepCopyInto(out *KeycloakPodDisruptionBudgetSpec) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakPodDisruptionBudgetSpec.
+func (in *KeycloakPodDisruptionBudgetSpec) DeepCopy() *KeycloakPodDisruptionBudgetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakPodDisruptionBudgetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakPrometheusRuleSpec) DeepCopyInto(out *KeycloakPrometheusRuleSpec) {
+	*out = *in
+	out.KeycloakMonitoringResourceSpec = in.KeycloakMonitoringResourceSpec
+	in.Thresholds.DeepCopyInto(&out.Thresholds)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakPrometheusRuleSpec.
+func (in *KeycloakPrometheusRuleSpec) DeepCopy() *KeycloakPrometheusRuleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakPrometheusRuleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakProtocolMapper) DeepCopyInto(out *KeycloakProtocolMapper) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakProtocolMapper.
+func (in *KeycloakProtocolMapper) DeepCopy() *KeycloakProtocolMapper {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakProtocolMapper)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRealm) DeepCopyInto(out *KeycloakRealm) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealm.
+func (in *KeycloakRealm) DeepCopy() *KeycloakRealm {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRealm)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KeycloakRealm) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRealmList) DeepCopyInto(out *KeycloakRealmList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KeycloakRealm, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealmList.
+func (in *KeycloakRealmList) DeepCopy() *KeycloakRealmList {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRealmList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KeycloakRealmList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRealmSpec) DeepCopyInto(out *KeycloakRealmSpec) {
+	*out = *in
+	if in.KeycloakApiRealm != nil {
+		in, out := &in.KeycloakApiRealm, &out.KeycloakApiRealm
+		*out = new(KeycloakApiRealm)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealmSpec.
+func (in *KeycloakRealmSpec) DeepCopy() *KeycloakRealmSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRealmSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRealmStatus) DeepCopyInto(out *KeycloakRealmStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRealmStatus.
+func (in *KeycloakRealmStatus) DeepCopy() *KeycloakRealmStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRealmStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRestore) DeepCopyInto(out *KeycloakRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRestore.
+func (in *KeycloakRestore) DeepCopy() *KeycloakRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KeycloakRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRestoreList) DeepCopyInto(out *KeycloakRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KeycloakRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRestoreList.
+func (in *KeycloakRestoreList) DeepCopy() *KeycloakRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KeycloakRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRestoreSpec) DeepCopyInto(out *KeycloakRestoreSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRestoreSpec.
+func (in *KeycloakRestoreSpec) DeepCopy() *KeycloakRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRestoreStatus) DeepCopyInto(out *KeycloakRestoreStatus) {
+	*out = *in
+	in.KeycloakJobStatus.DeepCopyInto(&out.KeycloakJobStatus)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRestoreStatus.
+func (in *KeycloakRestoreStatus) DeepCopy() *KeycloakRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRollbackPoint) DeepCopyInto(out *KeycloakRollbackPoint) {
+	*out = *in
+	if in.Completed != nil {
+		in, out := &in.Completed, &out.Completed
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRollbackPoint.
+func (in *KeycloakRollbackPoint) DeepCopy() *KeycloakRollbackPoint {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRollbackPoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakRolledBackUpgrade) DeepCopyInto(out *KeycloakRolledBackUpgrade) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakRolledBackUpgrade.
+func (in *KeycloakRolledBackUpgrade) DeepCopy() *KeycloakRolledBackUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakRolledBackUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakScheduledBackupStatus) DeepCopyInto(out *KeycloakScheduledBackupStatus) {
+	*out = *in
+	if in.LastSuccess != nil {
+		in, out := &in.LastSuccess, &out.LastSuccess
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailure != nil {
+		in, out := &in.LastFailure, &out.LastFailure
+		*out = (*in).DeepCopy()
+	}
+	if in.LastPruned != nil {
+		in, out := &in.LastPruned, &out.LastPruned
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakScheduledBackupStatus.
+func (in *KeycloakScheduledBackupStatus) DeepCopy() *KeycloakScheduledBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakScheduledBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakServerInfo) DeepCopyInto(out *KeycloakServerInfo) {
+	*out = *in
+	if in.Providers != nil {
+		in, out := &in.Providers, &out.Providers
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.Themes != nil {
+		in, out := &in.Themes, &out.Themes
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakServerInfo.
+func (in *KeycloakServerInfo) DeepCopy() *KeycloakServerInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakServerInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakSpec) DeepCopyInto(out *KeycloakSpec) {
+	*out = *in
+	if in.Plugins != nil {
+		in, out := &in.Plugins, &out.Plugins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Backups != nil {
+		in, out := &in.Backups, &out.Backups
+		*out = make([]KeycloakBackupConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExternalDatabase != nil {
+		in, out := &in.ExternalDatabase, &out.ExternalDatabase
+		*out = new(KeycloakExternalDatabase)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Instance.DeepCopyInto(&out.Instance)
+	in.Database.DeepCopyInto(&out.Database)
+	if in.AdminCredentialRotation != nil {
+		in, out := &in.AdminCredentialRotation, &out.AdminCredentialRotation
+		*out = new(KeycloakCredentialRotationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DatabaseCredentialRotation != nil {
+		in, out := &in.DatabaseCredentialRotation, &out.DatabaseCredentialRotation
+		*out = new(KeycloakCredentialRotationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exposure != nil {
+		in, out := &in.Exposure, &out.Exposure
+		*out = new(KeycloakExposureSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make([]KeycloakExtension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]KeycloakOverride, len(*in))
+		copy(*out, *in)
+	}
+	in.Monitoring.DeepCopyInto(&out.Monitoring)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakSpec.
+func (in *KeycloakSpec) DeepCopy() *KeycloakSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakStatus) DeepCopyInto(out *KeycloakStatus) {
+	*out = *in
+	out.GenericStatus = in.GenericStatus
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(KeycloakUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RollbackPoint != nil {
+		in, out := &in.RollbackPoint, &out.RollbackPoint
+		*out = new(KeycloakRollbackPoint)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RolledBack != nil {
+		in, out := &in.RolledBack, &out.RolledBack
+		*out = new(KeycloakRolledBackUpgrade)
+		**out = **in
+	}
+	if in.Backups != nil {
+		in, out := &in.Backups, &out.Backups
+		*out = make([]KeycloakScheduledBackupStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Corrections != nil {
+		in, out := &in.Corrections, &out.Corrections
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastCorrected != nil {
+		in, out := &in.LastCorrected, &out.LastCorrected
+		*out = (*in).DeepCopy()
+	}
+	if in.AdminCredentials != nil {
+		in, out := &in.AdminCredentials, &out.AdminCredentials
+		*out = new(KeycloakCredentialsStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DatabaseCredentials != nil {
+		in, out := &in.DatabaseCredentials, &out.DatabaseCredentials
+		*out = new(KeycloakCredentialsStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = new(KeycloakOverridesStatus)
+		**out = **in
+	}
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make([]KeycloakExtensionStatus, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakStatus.
+func (in *KeycloakStatus) DeepCopy() *KeycloakStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakUpgradeStatus) DeepCopyInto(out *KeycloakUpgradeStatus) {
+	*out = *in
+	if in.Path != nil {
+		in, out := &in.Path, &out.Path
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ScaledUp != nil {
+		in, out := &in.ScaledUp, &out.ScaledUp
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakUpgradeStatus.
+func (in *KeycloakUpgradeStatus) DeepCopy() *KeycloakUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakUser) DeepCopyInto(out *KeycloakUser) {
+	*out = *in
+	if in.KeycloakApiUser != nil {
+		in, out := &in.KeycloakApiUser, &out.KeycloakApiUser
+		*out = new(KeycloakApiUser)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OutputSecret != nil {
+		in, out := &in.OutputSecret, &out.OutputSecret
+		*out = new(string)
+		**out = **in
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(string)
+		**out = **in
+	}
+	if in.FederatedIdentities != nil {
+		in, out := &in.FederatedIdentities, &out.FederatedIdentities
+		*out = make([]FederatedIdentity, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakUser.
+func (in *KeycloakUser) DeepCopy() *KeycloakUser {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakUser)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -697,6 +1675,46 @@ func (in *KeycloakUserRole) DeepCopy() *KeycloakUserRole {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeycloakWorkloadSpec) DeepCopyInto(out *KeycloakWorkloadSpec) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeycloakWorkloadSpec.
+func (in *KeycloakWorkloadSpec) DeepCopy() *KeycloakWorkloadSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KeycloakWorkloadSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenResponse) DeepCopyInto(out *TokenResponse) {
 	*out = *in
@@ -1,92 +1,232 @@
 package template
 
 import (
-	"errors"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
 
-	"github.com/integr8ly/keycloak-operator/pkg/util"
 	v1template "github.com/openshift/api/template/v1"
-	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
-	"github.com/sirupsen/logrus"
+	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/json"
-	"k8s.io/client-go/rest"
 )
 
-type TemplateProcessor struct {
-	namespace  string
-	restClient *rest.RESTClient
+const (
+	// generateExpression is the only parameter generator supported by OpenShift
+	generateExpression = "expression"
+	// maxGeneratedLength matches the limit enforced by OpenShift on a single range of an expression
+	maxGeneratedLength = 255
+)
+
+var (
+	// stringParameterExp matches ${PARAM}, substituted as text
+	stringParameterExp = regexp.MustCompile(`\$\{([a-zA-Z0-9_]+)\}`)
+	// nonStringParameterExp matches ${{PARAM}}, substituted as a JSON value when it makes up the whole field
+	nonStringParameterExp = regexp.MustCompile(`\$\{\{([a-zA-Z0-9_]+)\}\}`)
+	// generatorExp matches a range of an expression such as [a-zA-Z0-9]{32}
+	generatorExp = regexp.MustCompile(`\[([a-zA-Z0-9\-\\]+)\](\{(\w+)\})`)
+	// rangeExp matches the parts of a range, either a single character, a span such as a-z or a class such as \w
+	rangeExp = regexp.MustCompile(`([\\]?[a-zA-Z0-9]\-?[a-zA-Z0-9]?)`)
+)
+
+const (
+	alphabetUpper = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	alphabetLower = "abcdefghijklmnopqrstuvwxyz"
+	digits        = "0123456789"
+	symbols       = "~!@#$%^&*()-_+={}[]\\|<,>.?/\"';:`"
+)
+
+// characterClasses are the escapes supported in expression ranges
+var characterClasses = map[string]string{
+	`\w`: alphabetUpper + alphabetLower + digits + "_",
+	`\d`: digits,
+	`\a`: alphabetUpper + alphabetLower + digits,
+	`\A`: symbols,
 }
 
-func NewTemplateProcessor(namespace string) (*TemplateProcessor, error) {
-	inConfig := k8sclient.GetKubeConfig()
+// TemplateProcessor processes OpenShift templates in process, substituting parameters the same way
+// the processedtemplates API does
+type TemplateProcessor struct {
+	// rand is the source of the generated parameter values
+	rand io.Reader
+}
 
-	config := rest.CopyConfig(inConfig)
-	config.GroupVersion = &schema.GroupVersion{
-		Group:   "template.openshift.io",
-		Version: "v1",
-	}
-	config.APIPath = "/apis"
-	config.AcceptContentTypes = "application/json"
-	config.ContentType = "application/json"
-
-	// this gets used for discovery and error handling types
-	config.NegotiatedSerializer = basicNegotiatedSerializer{}
-	if config.UserAgent == "" {
-		config.UserAgent = rest.DefaultKubernetesUserAgent()
-	}
+func NewTemplateProcessor() *TemplateProcessor {
+	return &TemplateProcessor{rand: rand.Reader}
+}
 
-	restClient, err := rest.RESTClientFor(config)
+// Process returns the objects of sourceTemplate with every parameter reference replaced. Values in parameters
+// override the template defaults, missing values are generated when the template says how to, and an error is
+// returned when a required parameter ends up empty
+func (p *TemplateProcessor) Process(sourceTemplate *v1template.Template, parameters map[string]string) ([]runtime.RawExtension, error) {
+	values, err := p.parameterValues(sourceTemplate, parameters)
 	if err != nil {
 		return nil, err
 	}
 
-	return &TemplateProcessor{
-		namespace:  namespace,
-		restClient: restClient,
-	}, nil
+	objects := make([]runtime.RawExtension, 0, len(sourceTemplate.Objects))
+	for i, o := range sourceTemplate.Objects {
+		var obj interface{}
+		if err := json.Unmarshal(o.Raw, &obj); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode object %d of template %s", i, sourceTemplate.Name)
+		}
+		data, err := json.Marshal(substitute(obj, values))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode object %d of template %s", i, sourceTemplate.Name)
+		}
+		objects = append(objects, runtime.RawExtension{Raw: data})
+	}
+	return objects, nil
 }
 
-func (p *TemplateProcessor) Process(sourceTemplate *v1template.Template, parameters map[string]string) ([]runtime.RawExtension, error) {
-	p.fillInParameters(sourceTemplate, parameters)
+func (p *TemplateProcessor) parameterValues(template *v1template.Template, parameters map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, param := range template.Parameters {
+		value := param.Value
+		if v, ok := parameters[param.Name]; ok {
+			value = v
+		}
+		if value == "" && param.Generate != "" {
+			if param.Generate != generateExpression {
+				return nil, errors.Errorf("unsupported generator '%s' for parameter %s", param.Generate, param.Name)
+			}
+			generated, err := p.generate(param.From)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to generate a value for parameter %s", param.Name)
+			}
+			value = generated
+		}
+		if value == "" && param.Required {
+			return nil, errors.Errorf("template %s requires a value for parameter %s", template.Name, param.Name)
+		}
+		values[param.Name] = value
+	}
+	return values, nil
+}
 
-	resource, err := json.Marshal(sourceTemplate)
-	if err != nil {
-		return nil, err
+// substitute replaces the parameter references in every string and map key of obj
+func substitute(obj interface{}, values map[string]string) interface{} {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		substituted := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			substituted[substituteString(k, values)] = substitute(v, values)
+		}
+		return substituted
+	case []interface{}:
+		for i := range o {
+			o[i] = substitute(o[i], values)
+		}
+		return o
+	case string:
+		if match := nonStringParameterExp.FindStringSubmatch(o); match != nil && match[0] == o {
+			if value, ok := values[match[1]]; ok {
+				var decoded interface{}
+				if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+					return decoded
+				}
+				return value
+			}
+		}
+		return substituteString(o, values)
 	}
+	return obj
+}
 
-	result := p.restClient.
-		Post().
-		Namespace(p.namespace).
-		Body(resource).
-		Resource("processedtemplates").
-		Do()
+func substituteString(s string, values map[string]string) string {
+	replace := func(exp *regexp.Regexp) func(string) string {
+		return func(ref string) string {
+			name := exp.FindStringSubmatch(ref)[1]
+			if value, ok := values[name]; ok {
+				return value
+			}
+			return ref
+		}
+	}
+	s = nonStringParameterExp.ReplaceAllStringFunc(s, replace(nonStringParameterExp))
+	return stringParameterExp.ReplaceAllStringFunc(s, replace(stringParameterExp))
+}
 
-	if result.Error() == nil {
-		data, err := result.Raw()
+// generate returns a random value for an expression such as user[a-zA-Z0-9]{3}, text outside the ranges
+// is copied as is
+func (p *TemplateProcessor) generate(expression string) (string, error) {
+	var err error
+	generated := generatorExp.ReplaceAllStringFunc(expression, func(r string) string {
 		if err != nil {
-			return nil, err
+			return ""
 		}
-
-		templ, err := util.LoadKubernetesResource(data)
+		match := generatorExp.FindStringSubmatch(r)
+		var alphabet string
+		alphabet, err = expandRange(match[1])
 		if err != nil {
-			return nil, err
+			return ""
 		}
-
-		if v1Temp, ok := templ.(*v1template.Template); ok {
-			return v1Temp.Objects, nil
+		var length int
+		length, err = strconv.Atoi(match[3])
+		if err != nil {
+			err = errors.Errorf("invalid length '%s' in expression %s", match[3], expression)
+			return ""
+		}
+		if length > maxGeneratedLength {
+			err = errors.Errorf("length %d in expression %s is above the maximum of %d", length, expression, maxGeneratedLength)
+			return ""
 		}
-		logrus.Error("Wrong type returned by the server", templ)
-		return nil, errors.New("wrong type returned by the server")
+		var value string
+		value, err = p.randomString(alphabet, length)
+		return value
+	})
+	if err != nil {
+		return "", err
 	}
+	return generated, nil
+}
 
-	return nil, result.Error()
+// expandRange returns every character allowed by the inside of a range such as a-zA-Z0-9 or \w
+func expandRange(r string) (string, error) {
+	alphabet := strings.Builder{}
+	for _, part := range rangeExp.FindAllString(r, -1) {
+		if class, ok := characterClasses[part]; ok {
+			alphabet.WriteString(class)
+			continue
+		}
+		if strings.HasPrefix(part, `\`) {
+			return "", errors.Errorf("unsupported character class '%s' in range [%s]", part, r)
+		}
+		if len(part) == 3 && part[1] == '-' {
+			if part[0] > part[2] {
+				return "", errors.Errorf("invalid span '%s' in range [%s]", part, r)
+			}
+			for c := part[0]; c <= part[2]; c++ {
+				alphabet.WriteByte(c)
+			}
+			continue
+		}
+		alphabet.WriteString(part)
+	}
+	if alphabet.Len() == 0 {
+		return "", errors.Errorf("empty range [%s]", r)
+	}
+	return alphabet.String(), nil
 }
 
-func (p *TemplateProcessor) fillInParameters(template *v1template.Template, parameters map[string]string) {
-	for i, param := range template.Parameters {
-		if value, ok := parameters[param.Name]; ok {
-			template.Parameters[i].Value = value
+// randomString picks length characters from alphabet, rejecting bytes that would bias the choice
+func (p *TemplateProcessor) randomString(alphabet string, length int) (string, error) {
+	if len(alphabet) > 256 {
+		return "", errors.Errorf("range of %d characters is too large", len(alphabet))
+	}
+	limit := 256 - 256%len(alphabet)
+	value := make([]byte, 0, length)
+	buf := make([]byte, 1)
+	for len(value) < length {
+		if _, err := io.ReadFull(p.rand, buf); err != nil {
+			return "", errors.Wrap(err, "failed to read random data")
+		}
+		if int(buf[0]) >= limit {
+			continue
 		}
+		value = append(value, alphabet[int(buf[0])%len(alphabet)])
 	}
+	return string(value), nil
 }
@@ -0,0 +1,183 @@
+package template
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	v1template "github.com/openshift/api/template/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newSeededProcessor(seed int64) *TemplateProcessor {
+	return &TemplateProcessor{rand: rand.New(rand.NewSource(seed))}
+}
+
+func TestTemplateProcessorProcess(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Parameters  []v1template.Parameter
+		Values      map[string]string
+		Object      string
+		Expected    string
+		ExpectError bool
+	}{
+		{
+			Name:       "String parameters",
+			Parameters: []v1template.Parameter{{Name: "APPLICATION_NAME", Value: "sso"}},
+			Object:     `{"kind":"Service","metadata":{"name":"${APPLICATION_NAME}-ping","labels":{"${APPLICATION_NAME}":"true"}}}`,
+			Expected:   `{"kind":"Service","metadata":{"labels":{"sso":"true"},"name":"sso-ping"}}`,
+		},
+		{
+			Name:       "Values override defaults",
+			Parameters: []v1template.Parameter{{Name: "APPLICATION_NAME", Value: "sso"}},
+			Values:     map[string]string{"APPLICATION_NAME": "keycloak", "UNKNOWN": "ignored"},
+			Object:     `{"name":"${APPLICATION_NAME}","other":"${UNKNOWN}"}`,
+			Expected:   `{"name":"keycloak","other":"${UNKNOWN}"}`,
+		},
+		{
+			Name:       "Non string parameters",
+			Parameters: []v1template.Parameter{{Name: "REPLICAS", Value: "2"}, {Name: "ENABLED", Value: "true"}, {Name: "NAME", Value: "sso"}},
+			Object:     `{"replicas":"${{REPLICAS}}","enabled":"${{ENABLED}}","name":"${{NAME}}","description":"${{REPLICAS}} replicas"}`,
+			Expected:   `{"description":"2 replicas","enabled":true,"name":"sso","replicas":2}`,
+		},
+		{
+			Name:        "Missing required parameter",
+			Parameters:  []v1template.Parameter{{Name: "DB_DATABASE", Required: true}},
+			Object:      `{"name":"${DB_DATABASE}"}`,
+			ExpectError: true,
+		},
+		{
+			Name:       "Empty optional parameter",
+			Parameters: []v1template.Parameter{{Name: "SSO_HOSTNAME"}},
+			Object:     `{"value":"${SSO_HOSTNAME}"}`,
+			Expected:   `{"value":""}`,
+		},
+		{
+			Name:        "Unsupported generator",
+			Parameters:  []v1template.Parameter{{Name: "PASSWORD", Generate: "uuid", Required: true}},
+			Object:      `{}`,
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tpl := &v1template.Template{
+				Parameters: tc.Parameters,
+				Objects:    []runtime.RawExtension{{Raw: []byte(tc.Object)}},
+			}
+			objects, err := newSeededProcessor(1).Process(tpl, tc.Values)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(objects[0].Raw) != tc.Expected {
+				t.Fatalf("expected %s, got %s", tc.Expected, string(objects[0].Raw))
+			}
+		})
+	}
+}
+
+func TestTemplateProcessorGenerate(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Expression  string
+		Matches     string
+		ExpectError bool
+	}{
+		{
+			Name:       "Alphanumeric",
+			Expression: "[a-zA-Z0-9]{32}",
+			Matches:    `^[a-zA-Z0-9]{32}$`,
+		},
+		{
+			Name:       "Literal prefix",
+			Expression: "user[a-zA-Z0-9]{3}",
+			Matches:    `^user[a-zA-Z0-9]{3}$`,
+		},
+		{
+			Name:       "Character classes",
+			Expression: `[\d]{4}-[\w]{6}`,
+			Matches:    `^[0-9]{4}-[a-zA-Z0-9_]{6}$`,
+		},
+		{
+			Name:        "Length above the maximum",
+			Expression:  "[a-z]{256}",
+			ExpectError: true,
+		},
+		{
+			Name:        "Unsupported class",
+			Expression:  `[\x]{4}`,
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			value, err := newSeededProcessor(1).generate(tc.Expression)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatalf("expected an error but got '%s'", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !regexp.MustCompile(tc.Matches).MatchString(value) {
+				t.Fatalf("expected '%s' to match %s", value, tc.Matches)
+			}
+			again, _ := newSeededProcessor(1).generate(tc.Expression)
+			if again != value {
+				t.Fatalf("expected the same source of randomness to generate the same value, got '%s' and '%s'", value, again)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessorShippedTemplates(t *testing.T) {
+	for _, name := range []string{"sso72-x509-postgresql-persistent.json", "sso73-x509-postgresql-persistent.json", "sso74-x509-postgresql-persistent.json"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile("../../../../deploy/template/" + name)
+			if err != nil {
+				t.Fatalf("failed to read template: %v", err)
+			}
+			tpl := &v1template.Template{}
+			if err := json.Unmarshal(data, tpl); err != nil {
+				t.Fatalf("failed to load template: %v", err)
+			}
+			objects, err := newSeededProcessor(1).Process(tpl, map[string]string{"SSO_ADMIN_USERNAME": "admin", "DB_PASSWORD": "password"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(objects) != len(tpl.Objects) {
+				t.Fatalf("expected %d objects, got %d", len(tpl.Objects), len(objects))
+			}
+			passedIn := false
+			for _, o := range objects {
+				if strings.Contains(string(o.Raw), `{"name":"DB_PASSWORD","value":"password"}`) {
+					passedIn = true
+				}
+				if strings.Contains(string(o.Raw), "${") {
+					t.Fatalf("expected every parameter to be substituted, got %s", string(o.Raw))
+				}
+				obj := map[string]interface{}{}
+				if err := json.Unmarshal(o.Raw, &obj); err != nil {
+					t.Fatalf("expected valid json, got %v", err)
+				}
+			}
+			if !passedIn {
+				t.Fatal("expected the values passed in to be used")
+			}
+		})
+	}
+}
@@ -2,9 +2,14 @@ package dispatch
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/metrics"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 )
@@ -13,6 +18,8 @@ func NewHandler(k8Client kubernetes.Interface) sdk.Handler {
 	return &Handler{
 		k8Client:    k8Client,
 		gvkHandlers: map[schema.GroupVersionKind]MuxHandler{},
+		locks:       map[string]*objectLock{},
+		phases:      metrics.NewPhaseTracker(),
 	}
 }
 
@@ -20,13 +27,103 @@ type Handler struct {
 	// Fill me
 	k8Client    kubernetes.Interface
 	gvkHandlers map[schema.GroupVersionKind]MuxHandler
+
+	// events may be delivered concurrently by several watch workers, locks make sure two
+	// events for the same object are never handled at the same time
+	mu    sync.Mutex
+	locks map[string]*objectLock
+	// phases records how long the objects stay in each phase
+	phases *metrics.PhaseTracker
+	// inFlight counts the events being handled, no event is handled anymore once draining
+	inFlight sync.WaitGroup
+	draining bool
+}
+
+type objectLock struct {
+	sync.Mutex
+	waiters int
 }
 
 func (h *Handler) Handle(ctx context.Context, event sdk.Event) error {
-	if handler, ok := h.gvkHandlers[event.Object.GetObjectKind().GroupVersionKind()]; ok {
-		return handler.Handle(ctx, event.Object, event.Deleted)
+	h.mu.Lock()
+	if h.draining {
+		h.mu.Unlock()
+		return nil
+	}
+	h.inFlight.Add(1)
+	h.mu.Unlock()
+	defer h.inFlight.Done()
+
+	gvk := event.Object.GetObjectKind().GroupVersionKind()
+	handler, ok := h.gvkHandlers[gvk]
+	if !ok {
+		return errors.New("no handler registered for group version kind " + gvk.String())
+	}
+	accessor, err := meta.Accessor(event.Object)
+	if err != nil {
+		return errors.Wrap(err, "failed to get object metadata")
+	}
+
+	unlock := h.lock(gvk.String() + "/" + accessor.GetNamespace() + "/" + accessor.GetName())
+	defer unlock()
+
+	start := time.Now()
+	phase := ""
+	if phased, ok := event.Object.(v1alpha1.Phased); ok {
+		phase = string(phased.CurrentPhase())
+	}
+	key := accessor.GetNamespace() + "/" + accessor.GetName()
+	if event.Deleted {
+		h.phases.Forget(gvk.Kind, key)
+	} else {
+		h.phases.Observe(gvk.Kind, key, phase, start)
+	}
+	err = handler.Handle(ctx, event.Object, event.Deleted)
+	metrics.ObserveReconcile(gvk.Kind, phase, time.Since(start), err)
+	return err
+}
+
+// lock blocks until no other event for the object identified by key is being handled
+func (h *Handler) lock(key string) func() {
+	h.mu.Lock()
+	l, ok := h.locks[key]
+	if !ok {
+		l = &objectLock{}
+		h.locks[key] = l
+	}
+	l.waiters++
+	h.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		h.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			delete(h.locks, key)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Drain stops handling new events and waits up to timeout for the events being handled, it reports whether they all
+// finished in time. The events dropped are handled again by the next leader when it lists the resources
+func (h *Handler) Drain(timeout time.Duration) bool {
+	h.mu.Lock()
+	h.draining = true
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
 	}
-	return errors.New("no handler registered for group version kind " + event.Object.GetObjectKind().GroupVersionKind().String())
 }
 
 type MuxHandler interface {
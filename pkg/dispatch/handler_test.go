@@ -0,0 +1,115 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type trackingHandler struct {
+	mu        sync.Mutex
+	active    map[string]int
+	maxActive map[string]int
+	total     int
+	maxTotal  int
+}
+
+func (th *trackingHandler) Handle(ctx context.Context, object interface{}, deleted bool) error {
+	name := object.(*v1alpha1.KeycloakRealm).Name
+	th.mu.Lock()
+	th.active[name]++
+	th.total++
+	if th.active[name] > th.maxActive[name] {
+		th.maxActive[name] = th.active[name]
+	}
+	if th.total > th.maxTotal {
+		th.maxTotal = th.total
+	}
+	th.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	th.mu.Lock()
+	th.active[name]--
+	th.total--
+	th.mu.Unlock()
+	return nil
+}
+
+func (th *trackingHandler) GVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: v1alpha1.Group, Version: v1alpha1.Version, Kind: v1alpha1.KeycloakRealmKind}
+}
+
+func TestHandlerSerializesEventsPerObject(t *testing.T) {
+	th := &trackingHandler{active: map[string]int{}, maxActive: map[string]int{}}
+	h := NewHandler(fake.NewSimpleClientset()).(*Handler)
+	h.AddHandler(th)
+
+	wg := sync.WaitGroup{}
+	for _, name := range []string{"realm-a", "realm-a", "realm-a", "realm-b", "realm-b", "realm-b"} {
+		kcr := &v1alpha1.KeycloakRealm{
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.Group + "/" + v1alpha1.Version, Kind: v1alpha1.KeycloakRealmKind},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.Handle(context.TODO(), sdk.Event{Object: kcr}); err != nil {
+				t.Errorf("unexpected error handling event: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for name, max := range th.maxActive {
+		if max != 1 {
+			t.Fatalf("expected events for %s to be handled one at a time, got %d at once", name, max)
+		}
+	}
+	if th.maxTotal != 2 {
+		t.Fatalf("expected events for different realms to be handled concurrently, got at most %d at once", th.maxTotal)
+	}
+	if len(h.locks) != 0 {
+		t.Fatalf("expected object locks to be released, got %d", len(h.locks))
+	}
+}
+
+func TestHandlerDrain(t *testing.T) {
+	th := &trackingHandler{active: map[string]int{}, maxActive: map[string]int{}}
+	h := NewHandler(fake.NewSimpleClientset()).(*Handler)
+	h.AddHandler(th)
+	event := func(name string) sdk.Event {
+		return sdk.Event{Object: &v1alpha1.KeycloakRealm{
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.Group + "/" + v1alpha1.Version, Kind: v1alpha1.KeycloakRealmKind},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+		}}
+	}
+
+	go h.Handle(context.TODO(), event("realm-a"))
+	for handling := 0; handling == 0; time.Sleep(time.Millisecond) {
+		th.mu.Lock()
+		handling = th.total
+		th.mu.Unlock()
+	}
+	if !h.Drain(time.Second) {
+		t.Fatal("expected the event being handled to finish before the timeout")
+	}
+	if err := h.Handle(context.TODO(), event("realm-b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	if th.total != 0 || th.maxActive["realm-a"] != 1 {
+		t.Fatalf("expected the event being handled to finish, got %d still handled", th.total)
+	}
+	if th.maxActive["realm-b"] != 0 {
+		t.Fatal("expected the events to be dropped once draining")
+	}
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Checks are named checks served together, they pass when none of them returns an error
+type Checks map[string]func() error
+
+// ServeHTTP answers ok when all the checks pass, and 503 with the failing checks otherwise
+func (c Checks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := ""
+	for _, name := range names {
+		if err := c[name](); err != nil {
+			failures += fmt.Sprintf("%s: %v\n", name, err)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if failures != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, failures)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Register serves the liveness checks on LivenessPath and the readiness checks on ReadinessPath of mux
+func Register(mux *http.ServeMux, liveness, readiness Checks) {
+	mux.Handle(LivenessPath, liveness)
+	mux.Handle(ReadinessPath, readiness)
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	pass := func() error { return nil }
+	cases := []struct {
+		Name         string
+		Checks       Checks
+		ExpectedCode int
+		ExpectedBody string
+	}{
+		{
+			Name:         "No checks",
+			Checks:       Checks{},
+			ExpectedCode: http.StatusOK,
+			ExpectedBody: "ok\n",
+		},
+		{
+			Name:         "Passing checks",
+			Checks:       Checks{"watch": pass, "leader-election": pass},
+			ExpectedCode: http.StatusOK,
+			ExpectedBody: "ok\n",
+		},
+		{
+			Name: "Failing checks",
+			Checks: Checks{
+				"watch":           func() error { return errors.New("the watches are not started") },
+				"leader-election": func() error { return errors.New("the lock was not read yet") },
+				"other":           pass,
+			},
+			ExpectedCode: http.StatusServiceUnavailable,
+			ExpectedBody: "leader-election: the lock was not read yet\nwatch: the watches are not started\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			Register(mux, Checks{}, tc.Checks)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", ReadinessPath, nil))
+			if rec.Code != tc.ExpectedCode || rec.Body.String() != tc.ExpectedBody {
+				t.Fatalf("expected %d %q, got %d %q", tc.ExpectedCode, tc.ExpectedBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
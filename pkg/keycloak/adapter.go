@@ -0,0 +1,137 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+)
+
+const (
+	// legacyContextPath is the context path the admin console and API are served under before Keycloak 17
+	legacyContextPath = "/auth"
+	// quarkusMajorVersion is the first Keycloak release built on Quarkus, which dropped the /auth context path
+	quarkusMajorVersion = 17
+)
+
+// Adapter maps the requests made by Client onto the URL layout and representations
+// understood by a particular Keycloak server version
+type Adapter interface {
+	// ServerVersion is the version reported by the server, or empty when it wasn't detected
+	ServerVersion() string
+	// AdminPath returns the path of an admin API resource relative to the server URL
+	AdminPath(resourcePath string) string
+	// TokenPath returns the path of the master realm token endpoint relative to the server URL
+	TokenPath() string
+	// PingPath returns the path used to check the server is up relative to the server URL
+	PingPath() string
+	// ClientRepresentation converts a client into the representation accepted by the server
+	ClientRepresentation(client *v1alpha1.KeycloakApiClient) T
+}
+
+// NewAdapter returns the adapter for a server of the given version, serving on the given context path
+func NewAdapter(version, contextPath string) Adapter {
+	base := baseAdapter{
+		version:     version,
+		contextPath: strings.Trim(contextPath, "/"),
+	}
+	if majorVersion(version) >= quarkusMajorVersion {
+		return &quarkusAdapter{baseAdapter: base}
+	}
+	return &legacyAdapter{baseAdapter: base}
+}
+
+// defaultAdapter is used until the server has been detected, it matches the RH-SSO 7.x servers
+var defaultAdapter = NewAdapter("", legacyContextPath)
+
+type baseAdapter struct {
+	version     string
+	contextPath string
+}
+
+func (a *baseAdapter) ServerVersion() string {
+	return a.version
+}
+
+func (a *baseAdapter) path(p string) string {
+	if a.contextPath == "" {
+		return p
+	}
+	return a.contextPath + "/" + p
+}
+
+func (a *baseAdapter) AdminPath(resourcePath string) string {
+	return a.path("admin/" + resourcePath)
+}
+
+func (a *baseAdapter) TokenPath() string {
+	return a.path("realms/master/protocol/openid-connect/token")
+}
+
+func (a *baseAdapter) PingPath() string {
+	return a.path("")
+}
+
+// legacyAdapter handles RH-SSO 7.x and WildFly based Keycloak releases
+type legacyAdapter struct {
+	baseAdapter
+}
+
+func (a *legacyAdapter) ClientRepresentation(client *v1alpha1.KeycloakApiClient) T {
+	return client
+}
+
+// quarkusAdapter handles Keycloak 17 and later
+type quarkusAdapter struct {
+	baseAdapter
+}
+
+// removedClientFields are client representation fields that newer servers no longer accept
+var removedClientFields = []string{"useTemplateConfig", "useTemplateScope", "useTemplateMappers", "defaultRoles"}
+
+func (a *quarkusAdapter) ClientRepresentation(client *v1alpha1.KeycloakApiClient) T {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return client
+	}
+	rep := map[string]interface{}{}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return client
+	}
+	for _, field := range removedClientFields {
+		delete(rep, field)
+	}
+	return rep
+}
+
+var versionRegexp = regexp.MustCompile(`^(\d+)\.`)
+
+// imageContextPath is the context path of a server running image, the Quarkus based Keycloak images are tagged with
+// their version. The release images, used when image is empty, serve under the legacy context path
+func imageContextPath(image string) string {
+	name := strings.Split(image, "@")[0]
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		tag = name[i+1:]
+	}
+	if majorVersion(tag) >= quarkusMajorVersion {
+		return ""
+	}
+	return legacyContextPath
+}
+
+// majorVersion returns the major part of a Keycloak version such as 9.0.3.redhat-00002 or 21.1.1,
+// or 0 when it can't be parsed
+func majorVersion(version string) int {
+	match := versionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return 0
+	}
+	major, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return major
+}
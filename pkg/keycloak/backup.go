@@ -0,0 +1,304 @@
+package keycloak
+
+import (
+	"fmt"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/batch/v1beta1"
+	"k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	backupEntrypoint = "/opt/intly/tools/entrypoint.sh"
+	// backupArchiveEnv names the archive a one-off job writes to or restores from a pvc destination
+	backupArchiveEnv = "ARCHIVE_NAME"
+	// awsBucketKey is the key of the bucket in the secret of the s3 backend
+	awsBucketKey = "AWS_S3_BUCKET_NAME"
+)
+
+func (ph *phaseHandler) reconcileBackups(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	multiError := &util.MultiError{}
+
+	statuses := []v1alpha1.KeycloakScheduledBackupStatus{}
+	for _, backup := range sso.Spec.Backups {
+		if err := backup.Validate(); err != nil {
+			multiError.AddError(err)
+			continue
+		}
+		err := ph.reconcileBackup(sso, backup, sso.Namespace)
+		if err != nil {
+			multiError.AddError(err)
+		}
+		status, err := ph.scheduledBackupStatus(sso, backup)
+		if err != nil {
+			multiError.AddError(err)
+			continue
+		}
+		if err := ph.reconcileRetention(sso, backup, &status); err != nil {
+			multiError.AddError(err)
+		}
+		statuses = append(statuses, status)
+	}
+	sso.Status.Backups = statuses
+	if !multiError.IsNil() {
+		return sso, multiError
+	}
+	return sso, nil
+}
+
+func (ph *phaseHandler) reconcileBackup(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, namespace string) error {
+	cronJobLabels := instanceLabels(sso)
+	jobLabels := map[string]string{"cronjob-name": backup.Name, SSO_INSTANCE_LABEL: sso.Name}
+	for k, v := range backup.Labels {
+		cronJobLabels[k] = v
+		jobLabels[k] = v
+	}
+	cron := &v1beta1.CronJob{
+		ObjectMeta: v12.ObjectMeta{
+			Name:            scopedName(sso, backup.Name),
+			Labels:          cronJobLabels,
+			OwnerReferences: []v12.OwnerReference{ownerReference(sso)},
+		},
+		Spec: v1beta1.CronJobSpec{
+			Schedule: backup.Schedule,
+			JobTemplate: v1beta1.JobTemplateSpec{
+				ObjectMeta: v12.ObjectMeta{
+					Labels: jobLabels,
+				},
+				Spec: batchv1.JobSpec{
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: v12.ObjectMeta{
+							Labels: jobLabels,
+						},
+						Spec: v1.PodSpec{
+							ServiceAccountName: "backupjob",
+							Containers:         []v1.Container{scheduledBackupContainer(sso, backup, namespace)},
+							Volumes:            destinationBackend(sso, backup).volumes,
+							RestartPolicy:      v1.RestartPolicyNever,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := ph.k8sClient.BatchV1beta1().CronJobs(namespace).Create(cron)
+	if err != nil && !errors2.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "error creating cronjob %s/%s", cron.Namespace, cron.Name)
+	}
+	if err != nil && errors2.IsAlreadyExists(err) {
+		_, err := ph.k8sClient.BatchV1beta1().CronJobs(namespace).Update(cron)
+		if err != nil {
+			return errors.Wrapf(err, "could not update cronjob %s/%s", cron.Namespace, cron.Name)
+		}
+	}
+
+	return nil
+}
+
+// scheduledBackupStatus reports when the jobs the cronjob of backup started last succeeded and failed
+func (ph *phaseHandler) scheduledBackupStatus(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig) (v1alpha1.KeycloakScheduledBackupStatus, error) {
+	status := v1alpha1.KeycloakScheduledBackupStatus{Name: backup.Name}
+	selector := "sso=" + sso.Name + ",cronjob-name=" + backup.Name
+	jobs, err := ph.k8sClient.BatchV1().Jobs(sso.Namespace).List(v12.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return status, errors.Wrapf(err, "failed to list the jobs of the backup %s", backup.Name)
+	}
+	for _, job := range jobs.Items {
+		if job.Status.Succeeded > 0 && job.Status.CompletionTime != nil {
+			if status.LastSuccess == nil || status.LastSuccess.Before(job.Status.CompletionTime) {
+				status.LastSuccess = job.Status.CompletionTime
+			}
+		}
+		if c := jobFailure(&job); c != nil {
+			if status.LastFailure == nil || status.LastFailure.Before(&c.LastTransitionTime) {
+				status.LastFailure = &c.LastTransitionTime
+				status.LastFailureMessage = c.Message
+			}
+		}
+	}
+	return status, nil
+}
+
+// reconcileRetention prunes the destination of backup with a job once after every successful scheduled backup
+func (ph *phaseHandler) reconcileRetention(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, status *v1alpha1.KeycloakScheduledBackupStatus) error {
+	for _, s := range sso.Status.Backups {
+		if s.Name == backup.Name {
+			status.LastPruned = s.LastPruned
+		}
+	}
+	if backup.Retention == nil || status.LastSuccess == nil {
+		return nil
+	}
+	if status.LastPruned != nil && !status.LastPruned.Before(status.LastSuccess) {
+		return nil
+	}
+	job, err := runJob(ph.k8sClient, pruneJob(sso, backup, scopedName(sso, fmt.Sprintf("%s-prune-%d", backup.Name, status.LastSuccess.Unix()))))
+	if err != nil {
+		return err
+	}
+	if c := jobFailure(job); c != nil {
+		return errors.Errorf("pruning the archives of the backup %s failed: %s", backup.Name, c.Message)
+	}
+	if job.Status.Succeeded == 0 {
+		return nil
+	}
+	logrus.Infof("pruned the archives of the backup %s of %s/%s", backup.Name, sso.Namespace, sso.Name)
+	status.LastPruned = status.LastSuccess
+	propagation := v12.DeletePropagationBackground
+	err = ph.k8sClient.BatchV1().Jobs(job.Namespace).Delete(job.Name, &v12.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors2.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the job %s/%s", job.Namespace, job.Name)
+	}
+	return nil
+}
+
+// specBackup returns the backup of sso called name, the first backup when name is empty
+func specBackup(sso *v1alpha1.Keycloak, name string) (v1alpha1.KeycloakBackupConfig, bool) {
+	for _, b := range sso.Spec.Backups {
+		if b.Name == name || name == "" {
+			return b, true
+		}
+	}
+	return v1alpha1.KeycloakBackupConfig{}, false
+}
+
+// backupContainer is the container that backs up the database of sso to the destination of backup. The entrypoint of
+// the backup image uploads to object stores, volumes are written with pg_dump from the postgres image
+func backupContainer(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, namespace string) v1.Container {
+	if d := backup.Destination; d != nil && d.PVC != nil {
+		return volumeContainer(sso, backup, backup.Name+"-keycloak-backup", volumeBackupScript)
+	}
+	backend := destinationBackend(sso, backup)
+	return v1.Container{
+		Name:    backup.Name + "-keycloak-backup",
+		Image:   backup.Image + ":" + backup.ImageTag,
+		Command: []string{backupEntrypoint, "-c", "postgres", "-n", namespace, "-b", backend.name, "-e", ""},
+		Env: append(backend.env, []v1.EnvVar{
+			{
+				Name:  "ENCRYPTION_SECRET_NAME",
+				Value: backup.EncryptionKeySecretName,
+			},
+			{
+				Name:  "COMPONENT_SECRET_NAME",
+				Value: databaseSecretName(sso),
+			},
+			{
+				Name:  "COMPONENT_SECRET_NAMESPACE",
+				Value: sso.Namespace,
+			},
+			{
+				Name:  backupProductEnv,
+				Value: "rhsso",
+			},
+		}...),
+		VolumeMounts: backend.mounts,
+	}
+}
+
+// scheduledBackupContainer is the backupContainer the cronjob of backup runs, it uploads to the product the scheduled
+// archives of backup are pruned from
+func scheduledBackupContainer(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, namespace string) v1.Container {
+	container := backupContainer(sso, backup, namespace)
+	for i, e := range container.Env {
+		if e.Name == backupProductEnv {
+			container.Env[i].Value = scheduledProduct(sso, backup)
+		}
+	}
+	return container
+}
+
+// volumeContainer runs script with the client tools of the postgres image against the database of sso, with the
+// volume of the pvc destination of backup mounted
+func volumeContainer(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, name, script string) v1.Container {
+	backend := destinationBackend(sso, backup)
+	return v1.Container{
+		Name:         name,
+		Image:        POSTGRES_KUBERNETES_IMAGE,
+		Command:      []string{"/bin/sh", "-c", script},
+		Env:          backend.env,
+		VolumeMounts: backend.mounts,
+	}
+}
+
+// backupJob is a one-off run of backup, on a pvc destination it stores its archive as name so restoreJob can
+// restore it
+func backupJob(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, name string) *batchv1.Job {
+	container := backupContainer(sso, backup, sso.Namespace)
+	if restorable(backup) == nil {
+		container.Env = append(container.Env, v1.EnvVar{Name: backupArchiveEnv, Value: name})
+	}
+	return oneOffJob(sso, backup, name, container)
+}
+
+// restoreJob restores the archive a backupJob named archive stored on the pvc destination of backup
+func restoreJob(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, name, archive string) *batchv1.Job {
+	container := volumeContainer(sso, backup, backup.Name+"-keycloak-restore", volumeRestoreScript)
+	container.Env = append(container.Env, v1.EnvVar{Name: backupArchiveEnv, Value: archive})
+	return oneOffJob(sso, backup, name, container)
+}
+
+// pruneJob deletes the scheduled archives at the destination of backup that are beyond its retention
+func pruneJob(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, name string) *batchv1.Job {
+	if d := backup.Destination; d == nil || d.PVC == nil {
+		return oneOffJob(sso, backup, name, objectStorePruneContainer(sso, backup))
+	}
+	container := volumeContainer(sso, backup, backup.Name+"-keycloak-prune", volumePruneScript)
+	container.Env = append(container.Env, retentionEnv(backup.Retention)...)
+	return oneOffJob(sso, backup, name, container)
+}
+
+func oneOffJob(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, name string, container v1.Container) *batchv1.Job {
+	labels := instanceLabels(sso)
+	for k, v := range backup.Labels {
+		labels[k] = v
+	}
+	return &batchv1.Job{
+		ObjectMeta: v12.ObjectMeta{
+			Name:            name,
+			Namespace:       sso.Namespace,
+			Labels:          labels,
+			OwnerReferences: []v12.OwnerReference{ownerReference(sso)},
+		},
+		Spec: batchv1.JobSpec{
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: v12.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "backupjob",
+					Containers:         []v1.Container{container},
+					Volumes:            destinationBackend(sso, backup).volumes,
+					RestartPolicy:      v1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+}
+
+// runJob creates job unless it exists and returns the job as it is in the cluster
+func runJob(k8sClient kubernetes.Interface, job *batchv1.Job) (*batchv1.Job, error) {
+	jobs := k8sClient.BatchV1().Jobs(job.Namespace)
+	existing, err := jobs.Get(job.Name, v12.GetOptions{})
+	if errors2.IsNotFound(err) {
+		created, err := jobs.Create(job)
+		return created, errors.Wrapf(err, "failed to create the job %s/%s", job.Namespace, job.Name)
+	}
+	return existing, errors.Wrapf(err, "failed to get the job %s/%s", job.Namespace, job.Name)
+}
+
+func jobFailure(job *batchv1.Job) *batchv1.JobCondition {
+	for i, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == v1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package keycloak
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	backupCAVolume      = "backup-ca"
+	backupCAMountPath   = "/etc/backup/ca"
+	backupPVCVolume     = "backup-pvc"
+	backupPVCMountPath  = "/var/keycloak-backups"
+	backupEndpointEnv   = "AWS_S3_ENDPOINT_URL"
+	backupCABundleEnv   = "AWS_CA_BUNDLE"
+	backupBucketEnv     = "AWS_S3_BUCKET_NAME"
+	backupDirectoryEnv  = "BACKUP_DIRECTORY"
+	backupNameEnv       = "BACKUP_NAME"
+	backupKeepLastEnv   = "KEEP_LAST"
+	backupMaxAgeEnv     = "MAX_AGE_MINUTES"
+	backupSecretNameEnv = "BACKEND_SECRET_NAME"
+	backupSecretNsEnv   = "BACKEND_SECRET_NAMESPACE"
+	backupProductEnv    = "PRODUCT_NAME"
+	backupAccessKeyEnv  = "AWS_ACCESS_KEY_ID"
+	backupSecretKeyEnv  = "AWS_SECRET_ACCESS_KEY"
+	// archiveExtension is the extension of the archives pg_dump writes to a volume, in its custom format
+	archiveExtension = ".dump"
+)
+
+// The archives on a volume are written, restored and pruned by the operator with the client tools of the postgres
+// image. Scheduled backups name their archives scheduled-<backup>-<time>, only those are pruned
+const (
+	// volumeBackupScript dumps the database to ARCHIVE_NAME, or to a timestamped scheduled archive. The dump is only
+	// given its final name once pg_restore could read it back, so a truncated dump never looks like an archive
+	volumeBackupScript = `set -e
+archive="${ARCHIVE_NAME:-scheduled-$BACKUP_NAME-$(date -u +%Y%m%d%H%M%S)}"
+mkdir -p "$BACKUP_DIRECTORY"
+pg_dump --format=custom --file="$BACKUP_DIRECTORY/$archive.partial"
+pg_restore --list "$BACKUP_DIRECTORY/$archive.partial" >/dev/null
+mv "$BACKUP_DIRECTORY/$archive.partial" "$BACKUP_DIRECTORY/$archive` + archiveExtension + `"`
+	// volumePruneScript deletes the scheduled archives of BACKUP_NAME beyond the KEEP_LAST newest ones that are older
+	// than MAX_AGE_MINUTES, an archive is kept when either of them keeps it
+	volumePruneScript = `set -e
+cd "$BACKUP_DIRECTORY" 2>/dev/null || exit 0
+ls -1t -- "scheduled-$BACKUP_NAME-"[0-9]*` + archiveExtension + ` 2>/dev/null | tail -n +"$((${KEEP_LAST:-0} + 1))" | while read -r archive; do
+  if [ -z "$MAX_AGE_MINUTES" ] || [ -n "$(find "$archive" -mmin +"$MAX_AGE_MINUTES")" ]; then
+    rm -f -- "$archive"
+  fi
+done`
+	// volumeRestoreScript replaces everything the database user owns with the archive ARCHIVE_NAME, in a single
+	// transaction so a failed restore leaves the database as it was
+	volumeRestoreScript = `set -e
+archive="$BACKUP_DIRECTORY/$ARCHIVE_NAME` + archiveExtension + `"
+test -f "$archive"
+pg_restore --no-owner --no-privileges --file="${TMPDIR:-/tmp}/restore.sql" "$archive"
+psql -v ON_ERROR_STOP=1 --single-transaction -c 'DROP OWNED BY CURRENT_USER' -f "${TMPDIR:-/tmp}/restore.sql"`
+)
+
+// The scheduled archives of an object store destination are uploaded by the backup image, which stores them under a
+// path named after its PRODUCT_NAME. A backup with a retention uploads its scheduled archives under a product of its
+// own, rhsso-scheduled-<namespace>-<cronjob>, and is pruned with the s3cmd of the backup image
+const (
+	// objectStorePruneScript deletes the objects stored under PRODUCT_NAME in the bucket beyond the KEEP_LAST newest
+	// ones that are older than MAX_AGE_MINUTES, an object is kept when either of them keeps it
+	objectStorePruneScript = `set -e
+set -- --access_key="$AWS_ACCESS_KEY_ID" --secret_key="$AWS_SECRET_ACCESS_KEY"
+if [ -n "$AWS_S3_ENDPOINT_URL" ]; then
+  host="${AWS_S3_ENDPOINT_URL#*://}"
+  set -- "$@" --host="${host%/}" --host-bucket="${host%/}"
+  case "$AWS_S3_ENDPOINT_URL" in http://*) set -- "$@" --no-ssl;; esac
+fi
+if [ -n "$AWS_CA_BUNDLE" ]; then set -- "$@" --ca-certs="$AWS_CA_BUNDLE"; fi
+cutoff=""
+if [ -n "$MAX_AGE_MINUTES" ]; then cutoff="$(date -u -d "@$(($(date +%s) - MAX_AGE_MINUTES * 60))" '+%Y-%m-%d %H:%M')"; fi
+objects="$(s3cmd "$@" ls --recursive "s3://$AWS_S3_BUCKET_NAME/")"
+printf '%s\n' "$objects" | grep -F "/$PRODUCT_NAME/" | sort -r | tail -n +"$((${KEEP_LAST:-0} + 1))" | while read -r day time size object; do
+  if [ -z "$cutoff" ] || expr "$day $time" \< "$cutoff" >/dev/null; then
+    s3cmd "$@" del "$object"
+  fi
+done`
+)
+
+// backupBackend is how a backup job reaches the destination of a backup: the backend argument of the entrypoint of
+// the backup image, empty for the volumes the operator writes with pg_dump, and the env and volumes that configure it
+type backupBackend struct {
+	name string
+	// secret holds the keys of an object store, and its bucket when the destination doesn't name one
+	secret  string
+	bucket  string
+	env     []v1.EnvVar
+	mounts  []v1.VolumeMount
+	volumes []v1.Volume
+}
+
+func destinationBackend(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig) backupBackend {
+	d := backup.Destination
+	switch {
+	case d != nil && d.S3 != nil:
+		return objectStoreBackend(sso, d.S3.Endpoint, d.S3.Bucket, d.S3.CredentialsSecret, d.S3.CASecret)
+	case d != nil && d.InCluster != nil:
+		return objectStoreBackend(sso, inClusterEndpoint(sso, d.InCluster), d.InCluster.Bucket, d.InCluster.CredentialsSecret, d.InCluster.CASecret)
+	case d != nil && d.PVC != nil:
+		env, mounts, volumes := databaseClientEnv(sso)
+		return backupBackend{
+			env: append(env,
+				v1.EnvVar{Name: backupDirectoryEnv, Value: path.Join(backupPVCMountPath, d.PVC.Path)},
+				v1.EnvVar{Name: backupNameEnv, Value: backup.Name},
+			),
+			mounts: append(mounts, v1.VolumeMount{Name: backupPVCVolume, MountPath: backupPVCMountPath}),
+			volumes: append(volumes, v1.Volume{
+				Name: backupPVCVolume,
+				VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: d.PVC.ClaimName},
+				},
+			}),
+		}
+	}
+	return backupBackend{
+		name: "s3",
+		env: []v1.EnvVar{
+			{Name: backupSecretNameEnv, Value: backup.AwsCredentialsSecretName},
+			{Name: backupSecretNsEnv, Value: backup.AwsCredentialsSecretNamespace},
+		},
+	}
+}
+
+// objectStoreBackend is the s3 backend pointed at endpoint, the credentials and CA secrets are in the namespace of sso
+func objectStoreBackend(sso *v1alpha1.Keycloak, endpoint, bucket, credentialsSecret, caSecret string) backupBackend {
+	b := backupBackend{
+		name:   "s3",
+		secret: credentialsSecret,
+		bucket: bucket,
+		env: []v1.EnvVar{
+			{Name: backupSecretNameEnv, Value: credentialsSecret},
+			{Name: backupSecretNsEnv, Value: sso.Namespace},
+			{Name: backupEndpointEnv, Value: endpoint},
+		},
+	}
+	if bucket != "" {
+		b.env = append(b.env, v1.EnvVar{Name: backupBucketEnv, Value: bucket})
+	}
+	if caSecret != "" {
+		b.env = append(b.env, v1.EnvVar{Name: backupCABundleEnv, Value: path.Join(backupCAMountPath, "ca.crt")})
+		b.mounts = append(b.mounts, v1.VolumeMount{Name: backupCAVolume, MountPath: backupCAMountPath, ReadOnly: true})
+		b.volumes = append(b.volumes, v1.Volume{
+			Name:         backupCAVolume,
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: caSecret}},
+		})
+	}
+	return b
+}
+
+func inClusterEndpoint(sso *v1alpha1.Keycloak, d *v1alpha1.KeycloakBackupInClusterDestination) string {
+	scheme := "http"
+	if d.CASecret != "" {
+		scheme = "https"
+	}
+	namespace := d.Namespace
+	if namespace == "" {
+		namespace = sso.Namespace
+	}
+	port := d.Port
+	if port == 0 {
+		port = v1alpha1.DefaultObjectStorePort
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%d", scheme, d.Service, namespace, port)
+}
+
+// scheduledProduct is the product the backup image uploads the scheduled archives of backup under, the one of a
+// backup with a retention is unique to its cronjob so that the bucket can be shared
+func scheduledProduct(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig) string {
+	if backup.Retention != nil {
+		return "rhsso-scheduled-" + sso.Namespace + "-" + scopedName(sso, backup.Name)
+	}
+	return "rhsso"
+}
+
+// objectStorePruneContainer prunes the scheduled archives of backup from its object store with the backup image, it
+// reads the keys of the store from its secret
+func objectStorePruneContainer(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig) v1.Container {
+	backend := destinationBackend(sso, backup)
+	secretEnv := func(name, key string) v1.EnvVar {
+		return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: backend.secret},
+			Key:                  key,
+		}}}
+	}
+	env := append(backend.env,
+		secretEnv(backupAccessKeyEnv, backupAccessKeyEnv),
+		secretEnv(backupSecretKeyEnv, backupSecretKeyEnv),
+		v1.EnvVar{Name: backupProductEnv, Value: scheduledProduct(sso, backup)},
+	)
+	if backend.bucket == "" {
+		env = append(env, secretEnv(backupBucketEnv, awsBucketKey))
+	}
+	return v1.Container{
+		Name:         backup.Name + "-keycloak-prune",
+		Image:        backup.Image + ":" + backup.ImageTag,
+		Command:      []string{"/bin/sh", "-c", objectStorePruneScript},
+		Env:          append(env, retentionEnv(backup.Retention)...),
+		VolumeMounts: backend.mounts,
+	}
+}
+
+// retentionEnv tells the prune scripts which archives to keep, the age is rounded up to the minute
+func retentionEnv(r *v1alpha1.KeycloakBackupRetention) []v1.EnvVar {
+	env := []v1.EnvVar{}
+	if r.KeepLast != nil {
+		env = append(env, v1.EnvVar{Name: backupKeepLastEnv, Value: strconv.Itoa(int(*r.KeepLast))})
+	}
+	if r.MaxAge != nil {
+		minutes := (r.MaxAge.Duration + time.Minute - 1) / time.Minute
+		env = append(env, v1.EnvVar{Name: backupMaxAgeEnv, Value: strconv.Itoa(int(minutes))})
+	}
+	return env
+}
+
+// backupLocation is where backup stores archive: the archive on a pvc destination, and the bucket of an object store
+// as the backup image names the archives it uploads. The bucket is read from the credentials secret when the
+// destination doesn't name one, the location is empty when it can't be read
+func backupLocation(k8sClient kubernetes.Interface, sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackupConfig, archive string) string {
+	bucket := func(namespace, secretName, bucket string) string {
+		if bucket != "" {
+			return bucket
+		}
+		secret, err := k8sClient.CoreV1().Secrets(namespace).Get(secretName, v12.GetOptions{})
+		if err != nil {
+			return ""
+		}
+		return string(secret.Data[awsBucketKey])
+	}
+	objectStore := func(endpoint, bucket string) string {
+		if bucket == "" {
+			return ""
+		}
+		return strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/"
+	}
+
+	d := backup.Destination
+	switch {
+	case d != nil && d.S3 != nil:
+		return objectStore(d.S3.Endpoint, bucket(sso.Namespace, d.S3.CredentialsSecret, d.S3.Bucket))
+	case d != nil && d.InCluster != nil:
+		return objectStore(inClusterEndpoint(sso, d.InCluster), bucket(sso.Namespace, d.InCluster.CredentialsSecret, d.InCluster.Bucket))
+	case d != nil && d.PVC != nil:
+		return fmt.Sprintf("pvc://%s/%s", d.PVC.ClaimName, path.Join(d.PVC.Path, archive+archiveExtension))
+	}
+	if b := bucket(backup.AwsCredentialsSecretNamespace, backup.AwsCredentialsSecretName, ""); b != "" {
+		return fmt.Sprintf("s3://%s/", b)
+	}
+	return ""
+}
+
+// restorable fails for the backups whose archives the operator can't restore, it only restores the archives it
+// writes to a pvc destination
+func restorable(backup v1alpha1.KeycloakBackupConfig) error {
+	if d := backup.Destination; d == nil || d.PVC == nil {
+		return errors.Errorf("backup %s can't be restored by the operator, only the archives of a pvc destination can", backup.Name)
+	}
+	return nil
+}
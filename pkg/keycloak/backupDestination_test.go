@@ -0,0 +1,681 @@
+package keycloak
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKeycloakBackupConfigValidate(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Destination *v1alpha1.KeycloakBackupDestination
+		Retention   *v1alpha1.KeycloakBackupRetention
+		ExpectError bool
+	}{
+		{
+			Name: "Default destination",
+		},
+		{
+			Name: "S3-compatible endpoint",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				S3: &v1alpha1.KeycloakBackupS3Destination{Endpoint: "https://objects.example.com", CredentialsSecret: "s3"},
+			},
+		},
+		{
+			Name: "Endpoint without a scheme",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				S3: &v1alpha1.KeycloakBackupS3Destination{Endpoint: "objects.example.com", CredentialsSecret: "s3"},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "Path escaping the volume",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups", Path: "../other"},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "Two destinations",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				PVC:       &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"},
+				InCluster: &v1alpha1.KeycloakBackupInClusterDestination{Service: "minio", CredentialsSecret: "minio"},
+			},
+			ExpectError: true,
+		},
+		{
+			Name:        "No destination set",
+			Destination: &v1alpha1.KeycloakBackupDestination{},
+			ExpectError: true,
+		},
+		{
+			Name:        "Retention",
+			Destination: &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}},
+			Retention:   &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(7), MaxAge: &v12.Duration{Duration: 720 * time.Hour}},
+		},
+		{
+			Name: "Retention on an object store",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				S3: &v1alpha1.KeycloakBackupS3Destination{Endpoint: "https://objects.example.com", CredentialsSecret: "s3"},
+			},
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(7)},
+		},
+		{
+			Name:        "Retention on the default destination",
+			Retention:   &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(7)},
+			ExpectError: true,
+		},
+		{
+			Name:        "Empty retention",
+			Destination: &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}},
+			Retention:   &v1alpha1.KeycloakBackupRetention{},
+			ExpectError: true,
+		},
+		{
+			Name:        "Keeping nothing",
+			Destination: &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}},
+			Retention:   &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(0)},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			backup := v1alpha1.KeycloakBackupConfig{Name: "nightly", Destination: tc.Destination, Retention: tc.Retention}
+			err := backup.Validate()
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected an error but got none")
+			}
+			if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBackupContainerDestination(t *testing.T) {
+	cases := []struct {
+		Name             string
+		Destination      *v1alpha1.KeycloakBackupDestination
+		ExpectedBackend  string
+		ExpectedEnv      map[string]string
+		ExpectedVolume   string
+		ExpectedLocation string
+	}{
+		{
+			Name:             "AWS S3",
+			ExpectedBackend:  "s3",
+			ExpectedEnv:      map[string]string{backupSecretNameEnv: "aws", backupSecretNsEnv: "backups"},
+			ExpectedLocation: "s3://keycloak-backups/",
+		},
+		{
+			Name: "S3-compatible endpoint with a CA",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				S3: &v1alpha1.KeycloakBackupS3Destination{Endpoint: "https://objects.example.com/", Bucket: "sso", CredentialsSecret: "s3", CASecret: "objects-ca"},
+			},
+			ExpectedBackend: "s3",
+			ExpectedEnv: map[string]string{
+				backupSecretNameEnv: "s3",
+				backupSecretNsEnv:   "test-namespace",
+				backupEndpointEnv:   "https://objects.example.com/",
+				backupBucketEnv:     "sso",
+				backupCABundleEnv:   "/etc/backup/ca/ca.crt",
+			},
+			ExpectedVolume:   "objects-ca",
+			ExpectedLocation: "https://objects.example.com/sso/",
+		},
+		{
+			Name: "In-cluster object store",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				InCluster: &v1alpha1.KeycloakBackupInClusterDestination{Service: "minio", Namespace: "storage", Bucket: "sso", CredentialsSecret: "minio"},
+			},
+			ExpectedBackend:  "s3",
+			ExpectedEnv:      map[string]string{backupEndpointEnv: "http://minio.storage.svc:9000", backupSecretNsEnv: "test-namespace"},
+			ExpectedLocation: "http://minio.storage.svc:9000/sso/",
+		},
+		{
+			Name: "Persistent volume claim",
+			Destination: &v1alpha1.KeycloakBackupDestination{
+				PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups", Path: "sso"},
+			},
+			ExpectedEnv:      map[string]string{backupDirectoryEnv: "/var/keycloak-backups/sso", backupNameEnv: "nightly", backupArchiveEnv: "archive"},
+			ExpectedVolume:   "backups",
+			ExpectedLocation: "pvc://backups/sso/archive.dump",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := backedUpKeycloak("", "")
+			backup := kc.Spec.Backups[0]
+			backup.AwsCredentialsSecretName = "aws"
+			backup.AwsCredentialsSecretNamespace = "backups"
+			backup.Destination = tc.Destination
+			k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: v12.ObjectMeta{Name: "aws", Namespace: "backups"},
+				Data:       map[string][]byte{awsBucketKey: []byte("keycloak-backups")},
+			})
+
+			job := backupJob(kc, backup, "archive")
+			container := job.Spec.Template.Spec.Containers[0]
+			if tc.ExpectedBackend == "" && (container.Image != POSTGRES_KUBERNETES_IMAGE || container.Command[2] != volumeBackupScript) {
+				t.Fatalf("expected the volume to be written with pg_dump, got %s %v", container.Image, container.Command)
+			}
+			if backend := strings.Join(container.Command, " "); tc.ExpectedBackend != "" && !strings.Contains(backend, "-b "+tc.ExpectedBackend+" ") {
+				t.Fatalf("expected the %s backend, got '%s'", tc.ExpectedBackend, backend)
+			}
+			env := map[string]string{}
+			for _, e := range container.Env {
+				env[e.Name] = e.Value
+			}
+			if _, named := env[backupArchiveEnv]; named != (tc.ExpectedBackend == "") {
+				t.Fatalf("expected the archive to be named only on a volume, got %v", env)
+			}
+			for name, value := range tc.ExpectedEnv {
+				if env[name] != value {
+					t.Fatalf("expected %s to be '%s', got '%s'", name, value, env[name])
+				}
+			}
+			volumes := job.Spec.Template.Spec.Volumes
+			if tc.ExpectedVolume == "" && len(volumes) != 0 {
+				t.Fatalf("expected no volumes, got %v", volumes)
+			}
+			if tc.ExpectedVolume != "" {
+				if len(volumes) != 1 || len(container.VolumeMounts) != 1 || container.VolumeMounts[0].Name != volumes[0].Name {
+					t.Fatalf("expected one mounted volume, got %v and %v", volumes, container.VolumeMounts)
+				}
+				source := volumes[0].VolumeSource
+				if (source.Secret == nil || source.Secret.SecretName != tc.ExpectedVolume) && (source.PersistentVolumeClaim == nil || source.PersistentVolumeClaim.ClaimName != tc.ExpectedVolume) {
+					t.Fatalf("expected the volume of %s, got %v", tc.ExpectedVolume, source)
+				}
+			}
+			if location := backupLocation(k8sClient, kc, backup, "archive"); location != tc.ExpectedLocation {
+				t.Fatalf("expected the location %s, got %s", tc.ExpectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestPhaseHandlerReconcileRetention(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	kc.Spec.Backups[0].Destination = &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}}
+	kc.Spec.Backups[0].Retention = &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(7), MaxAge: &v12.Duration{Duration: 720 * time.Hour}}
+	completed := v12.NewTime(time.Unix(1500000000, 0))
+	k8sClient := fake.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: v12.ObjectMeta{Name: "nightly-1", Namespace: "test-namespace", Labels: map[string]string{"sso": kc.Name, "cronjob-name": "nightly"}},
+		Status:     batchv1.JobStatus{Succeeded: 1, CompletionTime: &completed},
+	})
+	jobs := k8sClient.BatchV1().Jobs("test-namespace")
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+	kc, err := ph.reconcileBackups(kc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	job, err := jobs.Get("nightly-prune-1500000000", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the prune job to be created: %v", err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	env := map[string]string{}
+	for _, e := range container.Env {
+		env[e.Name] = e.Value
+	}
+	if container.Command[2] != volumePruneScript || env[backupKeepLastEnv] != "7" || env[backupMaxAgeEnv] != "43200" {
+		t.Fatalf("expected the volume to be pruned with the retention, got %v and %v", container.Command, env)
+	}
+	if kc.Status.Backups[0].LastPruned != nil {
+		t.Fatal("expected the prune to be recorded only once it succeeded")
+	}
+
+	job.Status = batchv1.JobStatus{Succeeded: 1}
+	if _, err := jobs.Update(job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kc, err = ph.reconcileBackups(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !kc.Status.Backups[0].LastPruned.Equal(&completed) {
+		t.Fatalf("expected the prune to be recorded, got %v", kc.Status.Backups[0].LastPruned)
+	}
+	if _, err := jobs.Get(job.Name, v12.GetOptions{}); err == nil {
+		t.Fatal("expected the prune job to be deleted once it succeeded")
+	}
+	if kc, err = ph.reconcileBackups(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := jobs.Get(job.Name, v12.GetOptions{}); err == nil {
+		t.Fatal("expected the archives not to be pruned again until the next backup")
+	}
+}
+
+func TestPhaseHandlerReconcileRetentionOnObjectStore(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	kc.Spec.Backups[0].Destination = &v1alpha1.KeycloakBackupDestination{
+		InCluster: &v1alpha1.KeycloakBackupInClusterDestination{Service: "minio", CredentialsSecret: "minio"},
+	}
+	kc.Spec.Backups[0].Retention = &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(7)}
+	completed := v12.NewTime(time.Unix(1500000000, 0))
+	k8sClient := fake.NewSimpleClientset(&batchv1.Job{
+		ObjectMeta: v12.ObjectMeta{Name: "nightly-1", Namespace: "test-namespace", Labels: map[string]string{"sso": kc.Name, "cronjob-name": "nightly"}},
+		Status:     batchv1.JobStatus{Succeeded: 1, CompletionTime: &completed},
+	})
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+	if _, err := ph.reconcileBackups(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	product := "rhsso-scheduled-test-namespace-nightly"
+	cron, err := k8sClient.BatchV1beta1().CronJobs("test-namespace").Get("nightly", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env := containerEnv(cron.Spec.JobTemplate.Spec.Template.Spec.Containers[0]); env[backupProductEnv] != product {
+		t.Fatalf("expected the scheduled archives to be uploaded under %s, got %v", product, env)
+	}
+	job, err := k8sClient.BatchV1().Jobs("test-namespace").Get("nightly-prune-1500000000", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the prune job to be created: %v", err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	if container.Image != "quay.io/integreatly/backup-container:1.0.8" || container.Command[2] != objectStorePruneScript {
+		t.Fatalf("expected the object store to be pruned with the backup image, got %s %v", container.Image, container.Command)
+	}
+	env := containerEnv(container)
+	if env[backupProductEnv] != product || env[backupKeepLastEnv] != "7" || env[backupEndpointEnv] != "http://minio.test-namespace.svc:9000" {
+		t.Fatalf("expected the scheduled archives to be pruned with the retention, got %v", env)
+	}
+	keys := map[string]string{}
+	for _, e := range container.Env {
+		if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil && e.ValueFrom.SecretKeyRef.Name == "minio" {
+			keys[e.Name] = e.ValueFrom.SecretKeyRef.Key
+		}
+	}
+	if keys[backupAccessKeyEnv] != backupAccessKeyEnv || keys[backupSecretKeyEnv] != backupSecretKeyEnv || keys[backupBucketEnv] != awsBucketKey {
+		t.Fatalf("expected the keys and bucket to be read from the credentials secret, got %v", keys)
+	}
+}
+
+func containerEnv(container corev1.Container) map[string]string {
+	env := map[string]string{}
+	for _, e := range container.Env {
+		env[e.Name] = e.Value
+	}
+	return env
+}
+
+// s3cmdStub lists the objects of S3_OBJECTS, lines of the form of s3cmd ls, and records the arguments of its calls
+// in S3_CALLS
+const s3cmdStub = `#!/bin/sh
+echo "$*" >> "$S3_CALLS"
+for arg; do case "$arg" in ls) cat "$S3_OBJECTS";; esac; done`
+
+func TestObjectStorePruneScript(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	backup := kc.Spec.Backups[0]
+	backup.Destination = &v1alpha1.KeycloakBackupDestination{
+		S3: &v1alpha1.KeycloakBackupS3Destination{Endpoint: "http://objects.example.com:9000", Bucket: "backups", CredentialsSecret: "s3"},
+	}
+	day := 24 * time.Hour
+	now := time.Now().UTC()
+	// the scheduled archives of the backup are 1, 2, 4, 5 and 6 days old, the others are older than all of them
+	scheduled := func(days int) string {
+		return fmt.Sprintf("s3://backups/backups/rhsso-scheduled-test-namespace-nightly/%d/postgres.tar.gz.enc", days)
+	}
+	untouched := []string{
+		"s3://backups/backups/rhsso/0/postgres.tar.gz.enc",
+		"s3://backups/backups/rhsso-scheduled-test-namespace-nightly-extra/0/postgres.tar.gz.enc",
+	}
+
+	cases := []struct {
+		Name      string
+		Retention *v1alpha1.KeycloakBackupRetention
+		Expected  []string
+	}{
+		{
+			Name:      "Keep last",
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(2)},
+			Expected:  []string{scheduled(1), scheduled(2)},
+		},
+		{
+			Name:      "Max age",
+			Retention: &v1alpha1.KeycloakBackupRetention{MaxAge: &v12.Duration{Duration: 3 * day}},
+			Expected:  []string{scheduled(1), scheduled(2)},
+		},
+		{
+			Name:      "Keep last or younger than the max age",
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(3), MaxAge: &v12.Duration{Duration: 3 * day}},
+			Expected:  []string{scheduled(1), scheduled(2), scheduled(4)},
+		},
+		{
+			Name:      "Keep more than there are",
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(10), MaxAge: &v12.Duration{Duration: day}},
+			Expected:  []string{scheduled(1), scheduled(2), scheduled(4), scheduled(5), scheduled(6)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "s3cmd")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, "s3cmd"), []byte(s3cmdStub), 0755); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			objects := map[string]time.Time{}
+			for _, days := range []int{1, 2, 4, 5, 6} {
+				objects[scheduled(days)] = now.Add(-time.Duration(days) * day)
+			}
+			for _, name := range untouched {
+				objects[name] = now.Add(-100 * day)
+			}
+			listing := ""
+			for name, modified := range objects {
+				listing += fmt.Sprintf("%s      1024   %s\n", modified.Format("2006-01-02 15:04"), name)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "objects"), []byte(listing), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			backup.Retention = tc.Retention
+			container := pruneJob(kc, backup, "nightly-prune").Spec.Template.Spec.Containers[0]
+			cmd := exec.Command(container.Command[0], container.Command[1:]...)
+			cmd.Env = []string{
+				"PATH=" + dir + ":" + os.Getenv("PATH"),
+				"S3_OBJECTS=" + filepath.Join(dir, "objects"),
+				"S3_CALLS=" + filepath.Join(dir, "calls"),
+				backupAccessKeyEnv + "=access", backupSecretKeyEnv + "=secret",
+			}
+			for _, e := range container.Env {
+				if e.ValueFrom == nil {
+					cmd.Env = append(cmd.Env, e.Name+"="+e.Value)
+				}
+			}
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("unexpected error: %v: %s", err, out)
+			}
+
+			calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+			kept := map[string]bool{}
+			for name := range objects {
+				kept[name] = true
+			}
+			for _, call := range strings.Split(strings.TrimSpace(string(calls)), "\n") {
+				if !strings.HasPrefix(call, "--access_key=access --secret_key=secret --host=objects.example.com:9000 --host-bucket=objects.example.com:9000 --no-ssl ") {
+					t.Fatalf("expected s3cmd to be called with the keys and endpoint, got %q", call)
+				}
+				if fields := strings.Fields(call); fields[5] == "del" {
+					delete(kept, fields[6])
+				}
+			}
+			expected := append(append([]string{}, tc.Expected...), untouched...)
+			remaining := []string{}
+			for name := range kept {
+				remaining = append(remaining, name)
+			}
+			sort.Strings(expected)
+			sort.Strings(remaining)
+			if strings.Join(remaining, ",") != strings.Join(expected, ",") {
+				t.Fatalf("expected %v to be kept, got %v", expected, remaining)
+			}
+		})
+	}
+}
+
+// postgresStubs are stand-ins of the postgres client tools for the scripts of the volume jobs: an archive holds the
+// name of the database it was dumped from, pg_dump truncates the archives of the database named truncated and psql
+// prints the statements it would run
+var postgresStubs = map[string]string{
+	"psql": `#!/bin/sh
+while [ $# -gt 0 ]; do case "$1" in -c) echo "$2"; shift;; -f) cat "$2"; shift;; esac; shift; done`,
+	"pg_dump": `#!/bin/sh
+for arg; do case "$arg" in --file=*) out="${arg#--file=}";; esac; done
+if [ "$PGDATABASE" = truncated ]; then printf 'dum' > "$out"; else echo "dump of $PGDATABASE" > "$out"; fi`,
+	"pg_restore": `#!/bin/sh
+for arg; do case "$arg" in --list) list=1;; --file=*) out="${arg#--file=}";; -*) ;; *) in="$arg";; esac; done
+grep -q '^dump of' "$in" || exit 1
+if [ -z "$list" ]; then sed 's/^dump of/restore of/' "$in" > "$out"; fi`,
+}
+
+// runVolumeJob runs the script of the container of job with its plain env, dir as the backup directory and the
+// postgres stubs on the path, and returns its output
+func runVolumeJob(t *testing.T, job *batchv1.Job, dir, database string) (string, error) {
+	bin, err := ioutil.TempDir("", "postgres-stubs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(bin)
+	for name, stub := range postgresStubs {
+		if err := ioutil.WriteFile(filepath.Join(bin, name), []byte(stub), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	container := job.Spec.Template.Spec.Containers[0]
+	cmd := exec.Command(container.Command[0], container.Command[1:]...)
+	cmd.Env = []string{"PATH=" + bin + ":" + os.Getenv("PATH"), "TMPDIR=" + bin, "PGDATABASE=" + database}
+	for _, e := range container.Env {
+		if e.ValueFrom == nil && e.Name != backupDirectoryEnv {
+			cmd.Env = append(cmd.Env, e.Name+"="+e.Value)
+		}
+	}
+	cmd.Env = append(cmd.Env, backupDirectoryEnv+"="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("%v: %s", err, out)
+	}
+	return string(out), nil
+}
+
+func archives(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestVolumeBackupScript(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	backup := kc.Spec.Backups[0]
+	backup.Destination = &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}}
+	scheduled := regexp.MustCompile(`^scheduled-nightly-[0-9]{14}\.dump$`)
+
+	cases := []struct {
+		Name            string
+		Job             *batchv1.Job
+		Database        string
+		ExpectError     bool
+		ExpectedArchive func(string) bool
+	}{
+		{
+			Name:            "Scheduled backup",
+			Job:             oneOffJob(kc, backup, "nightly-1", backupContainer(kc, backup, kc.Namespace)),
+			Database:        "keycloak",
+			ExpectedArchive: scheduled.MatchString,
+		},
+		{
+			Name:            "Named backup",
+			Job:             backupJob(kc, backup, "pre-upgrade"),
+			Database:        "keycloak",
+			ExpectedArchive: func(name string) bool { return name == "pre-upgrade.dump" },
+		},
+		{
+			Name:        "Truncated dump",
+			Job:         backupJob(kc, backup, "pre-upgrade"),
+			Database:    "truncated",
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "backups")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			dir = filepath.Join(dir, "sso")
+
+			_, err = runVolumeJob(t, tc.Job, dir, tc.Database)
+			if (err != nil) != tc.ExpectError {
+				t.Fatalf("expected an error: %v, got %v", tc.ExpectError, err)
+			}
+			written := []string{}
+			for _, name := range archives(t, dir) {
+				if strings.HasSuffix(name, archiveExtension) {
+					written = append(written, name)
+				}
+			}
+			if tc.ExpectError {
+				if len(written) != 0 {
+					t.Fatalf("expected no archive from a failed dump, got %v", written)
+				}
+				return
+			}
+			if len(written) != 1 || !tc.ExpectedArchive(written[0]) {
+				t.Fatalf("expected a single archive, got %v", written)
+			}
+			if content, _ := ioutil.ReadFile(filepath.Join(dir, written[0])); string(content) != "dump of keycloak\n" {
+				t.Fatalf("expected a dump of the database, got %q", content)
+			}
+		})
+	}
+}
+
+func TestVolumePruneScript(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	backup := kc.Spec.Backups[0]
+	backup.Destination = &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}}
+	day := 24 * time.Hour
+	// the scheduled archives of the backup are 1, 2, 4, 5 and 6 days old, the others are older than all of them
+	scheduled := func(days int) string { return fmt.Sprintf("scheduled-nightly-201901%02d000000.dump", 10-days) }
+	untouched := []string{"scheduled-nightly-extra-20190101000000.dump", "pre-upgrade.dump", "scheduled-nightly-20190101000000.dump.partial"}
+
+	cases := []struct {
+		Name      string
+		Retention *v1alpha1.KeycloakBackupRetention
+		Expected  []string
+	}{
+		{
+			Name:      "Keep last",
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(2)},
+			Expected:  []string{scheduled(1), scheduled(2)},
+		},
+		{
+			Name:      "Max age",
+			Retention: &v1alpha1.KeycloakBackupRetention{MaxAge: &v12.Duration{Duration: 3 * day}},
+			Expected:  []string{scheduled(1), scheduled(2)},
+		},
+		{
+			Name:      "Keep last or younger than the max age",
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(3), MaxAge: &v12.Duration{Duration: 3 * day}},
+			Expected:  []string{scheduled(1), scheduled(2), scheduled(4)},
+		},
+		{
+			Name:      "Keep more than there are",
+			Retention: &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(10), MaxAge: &v12.Duration{Duration: day}},
+			Expected:  []string{scheduled(1), scheduled(2), scheduled(4), scheduled(5), scheduled(6)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "backups")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			now := time.Now()
+			files := map[string]time.Duration{}
+			for _, days := range []int{1, 2, 4, 5, 6} {
+				files[scheduled(days)] = time.Duration(days) * day
+			}
+			for _, name := range untouched {
+				files[name] = 100 * day
+			}
+			for name, age := range files {
+				file := filepath.Join(dir, name)
+				if err := ioutil.WriteFile(file, []byte("dump of keycloak\n"), 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := os.Chtimes(file, now.Add(-age), now.Add(-age)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			backup.Retention = tc.Retention
+			if _, err := runVolumeJob(t, pruneJob(kc, backup, "nightly-prune"), dir, "keycloak"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := append(append([]string{}, tc.Expected...), untouched...)
+			sort.Strings(expected)
+			if kept := archives(t, dir); strings.Join(kept, ",") != strings.Join(expected, ",") {
+				t.Fatalf("expected %v to be kept, got %v", expected, kept)
+			}
+		})
+	}
+}
+
+func TestVolumePruneScriptWithoutArchives(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	backup := kc.Spec.Backups[0]
+	backup.Destination = &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups"}}
+	backup.Retention = &v1alpha1.KeycloakBackupRetention{KeepLast: int32Ptr(2)}
+	dir, err := ioutil.TempDir("", "backups")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{dir, filepath.Join(dir, "missing")} {
+		if _, err := runVolumeJob(t, pruneJob(kc, backup, "nightly-prune"), d, "keycloak"); err != nil {
+			t.Fatalf("expected nothing to prune in %s, got %v", d, err)
+		}
+	}
+}
+
+func TestVolumeRestoreScript(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	backup := kc.Spec.Backups[0]
+	dir, err := ioutil.TempDir("", "backups")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := runVolumeJob(t, backupJob(kc, backup, "pre-upgrade"), dir, "keycloak"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := runVolumeJob(t, restoreJob(kc, backup, "pre-upgrade-restore", "pre-upgrade"), dir, "keycloak")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "DROP OWNED BY CURRENT_USER\nrestore of keycloak\n" {
+		t.Fatalf("expected the objects of the user to be replaced with the archive, got %q", out)
+	}
+	if out, err := runVolumeJob(t, restoreJob(kc, backup, "missing-restore", "missing"), dir, "keycloak"); err == nil {
+		t.Fatalf("expected the restore of a missing archive to fail, got %q", out)
+	}
+}
@@ -0,0 +1,300 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// restoringAnnotation marks the Keycloak workload a KeycloakRestore scaled down, the sizing leaves it alone meanwhile
+const restoringAnnotation = "aerogear.org/restoring"
+
+// BackupReconciler backs up the database of a Keycloak on demand with a job and reports how it went
+type BackupReconciler struct {
+	k8sClient kubernetes.Interface
+	sdkCrud   SdkCruder
+}
+
+func NewBackupReconciler(k8client kubernetes.Interface, cruder SdkCruder) *BackupReconciler {
+	return &BackupReconciler{
+		k8sClient: k8client,
+		sdkCrud:   cruder,
+	}
+}
+
+func (h *BackupReconciler) Handle(ctx context.Context, object interface{}, deleted bool) error {
+	if deleted {
+		return nil
+	}
+	kb, ok := object.(*v1alpha1.KeycloakBackup)
+	if !ok {
+		return errors.New("error converting object to keycloak backup")
+	}
+	if finished(kb.Status) {
+		return nil
+	}
+	state, err := h.backup(kb.DeepCopy())
+	if err != nil {
+		return errors.Wrapf(err, "failed to back up %s", kb.Name)
+	}
+	if reflect.DeepEqual(state.Status, kb.Status) {
+		return nil
+	}
+	return h.sdkCrud.Update(state)
+}
+
+func (h *BackupReconciler) backup(kb *v1alpha1.KeycloakBackup) (*v1alpha1.KeycloakBackup, error) {
+	kc, err := getKeycloak(h.sdkCrud, kb.Namespace, kb.Spec.Keycloak)
+	if errors2.IsNotFound(err) {
+		fail(&kb.Status, fmt.Sprintf("keycloak %s not found", kb.Spec.Keycloak))
+		return kb, nil
+	}
+	if err != nil {
+		return kb, err
+	}
+	config, ok := specBackup(kc, kb.Spec.Backup)
+	if !ok {
+		fail(&kb.Status, fmt.Sprintf("keycloak %s has no backup '%s'", kc.Name, kb.Spec.Backup))
+		return kb, nil
+	}
+	if err := config.Validate(); err != nil {
+		fail(&kb.Status, err.Error())
+		return kb, nil
+	}
+
+	if kb.Status.Phase == v1alpha1.NoPhase {
+		now := v12.Now()
+		kb.Status.Phase = v1alpha1.PhaseRunning
+		kb.Status.Job = "keycloak-backup-" + kb.Name
+		kb.Status.StartTime = &now
+		kb.Status.Message = fmt.Sprintf("backing up keycloak %s", kc.Name)
+	}
+	job := backupJob(kc, config, kb.Status.Job)
+	job.OwnerReferences = []v12.OwnerReference{*v12.NewControllerRef(kb, h.GVK())}
+	job, err = runJob(h.k8sClient, job)
+	if err != nil {
+		return kb, err
+	}
+	if done := jobDone(&kb.Status, job); done && kb.Status.Phase == v1alpha1.PhaseComplete {
+		kb.Status.Location = backupLocation(h.k8sClient, kc, config, kb.Status.Job)
+		logrus.Infof("backed up keycloak %s/%s to %s", kc.Namespace, kc.Name, kb.Status.Location)
+	}
+	return kb, nil
+}
+
+func (h *BackupReconciler) GVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{
+		Version: v1alpha1.Version,
+		Group:   v1alpha1.Group,
+		Kind:    v1alpha1.KeycloakBackupKind,
+	}
+}
+
+// RestoreReconciler restores a completed KeycloakBackup into the Keycloak it was taken from. The Keycloak workload is
+// scaled down while the restore job runs and scaled back up once it is done, whether it succeeded or not
+type RestoreReconciler struct {
+	k8sClient    kubernetes.Interface
+	sdkCrud      SdkCruder
+	phaseHandler *phaseHandler
+}
+
+func NewRestoreReconciler(k8client kubernetes.Interface, cruder SdkCruder) *RestoreReconciler {
+	return &RestoreReconciler{
+		k8sClient:    k8client,
+		sdkCrud:      cruder,
+		phaseHandler: clusterPhaseHandler(k8client),
+	}
+}
+
+func (h *RestoreReconciler) Handle(ctx context.Context, object interface{}, deleted bool) error {
+	if deleted {
+		return nil
+	}
+	kr, ok := object.(*v1alpha1.KeycloakRestore)
+	if !ok {
+		return errors.New("error converting object to keycloak restore")
+	}
+	if finished(kr.Status.KeycloakJobStatus) {
+		return nil
+	}
+	state, err := h.restore(kr.DeepCopy())
+	if err != nil {
+		return errors.Wrapf(err, "failed to restore %s", kr.Name)
+	}
+	if reflect.DeepEqual(state.Status, kr.Status) {
+		return nil
+	}
+	return h.sdkCrud.Update(state)
+}
+
+func (h *RestoreReconciler) restore(kr *v1alpha1.KeycloakRestore) (*v1alpha1.KeycloakRestore, error) {
+	kb := &v1alpha1.KeycloakBackup{
+		TypeMeta:   v12.TypeMeta{Kind: v1alpha1.KeycloakBackupKind, APIVersion: v1alpha1.Group + "/" + v1alpha1.Version},
+		ObjectMeta: v12.ObjectMeta{Name: kr.Spec.Backup, Namespace: kr.Namespace},
+	}
+	err := h.sdkCrud.Get(kb)
+	if errors2.IsNotFound(err) {
+		fail(&kr.Status.KeycloakJobStatus, fmt.Sprintf("keycloak backup %s not found", kr.Spec.Backup))
+		return kr, nil
+	}
+	if err != nil {
+		return kr, errors.Wrapf(err, "failed to get the keycloak backup %s", kr.Spec.Backup)
+	}
+	switch kb.Status.Phase {
+	case v1alpha1.PhaseComplete:
+	case v1alpha1.PhaseFailed:
+		fail(&kr.Status.KeycloakJobStatus, fmt.Sprintf("keycloak backup %s failed", kb.Name))
+		return kr, nil
+	default:
+		kr.Status.Message = fmt.Sprintf("waiting for keycloak backup %s to complete", kb.Name)
+		return kr, nil
+	}
+	kc, err := getKeycloak(h.sdkCrud, kb.Namespace, kb.Spec.Keycloak)
+	if errors2.IsNotFound(err) {
+		fail(&kr.Status.KeycloakJobStatus, fmt.Sprintf("keycloak %s not found", kb.Spec.Keycloak))
+		return kr, nil
+	}
+	if err != nil {
+		return kr, err
+	}
+	config, ok := specBackup(kc, kb.Spec.Backup)
+	if !ok {
+		fail(&kr.Status.KeycloakJobStatus, fmt.Sprintf("keycloak %s has no backup '%s'", kc.Name, kb.Spec.Backup))
+		return kr, nil
+	}
+	// checked before scaling down, a running restore is left to finish and scale the workload back up
+	if err := restorable(config); err != nil && kr.Status.Phase == v1alpha1.NoPhase {
+		fail(&kr.Status.KeycloakJobStatus, err.Error())
+		return kr, nil
+	}
+	if kr.Status.Phase == v1alpha1.NoPhase && kc.Status.Phase != v1alpha1.PhaseReconcile {
+		kr.Status.Message = fmt.Sprintf("waiting for keycloak %s to be provisioned and not upgrading", kc.Name)
+		return kr, nil
+	}
+
+	p, err := h.phaseHandler.platformFor(kc)
+	if err != nil {
+		return kr, err
+	}
+	application, _, err := p.Workloads(kc)
+	if err != nil {
+		return kr, errors.Wrap(err, "failed to get the workload to restore")
+	}
+	accessor, err := meta.Accessor(application.object)
+	if err != nil {
+		return kr, err
+	}
+	replicas := workloadReplicas(application.object)
+
+	if kr.Status.Phase == v1alpha1.NoPhase {
+		now := v12.Now()
+		kr.Status.Phase = v1alpha1.PhaseRunning
+		kr.Status.Job = "keycloak-restore-" + kr.Name
+		kr.Status.StartTime = &now
+		kr.Status.Replicas = *replicas
+		kr.Status.Location = kb.Status.Location
+		kr.Status.Message = fmt.Sprintf("scaling down keycloak %s to restore %s", kc.Name, kb.Status.Location)
+		setAnnotation(accessor, restoringAnnotation, kr.Name)
+		*replicas = 0
+		return kr, errors.Wrap(application.update(), "failed to scale down for the restore")
+	}
+	if !scaledDown(application.object) {
+		return kr, nil
+	}
+
+	job := restoreJob(kc, config, kr.Status.Job, kb.Status.Job)
+	job.OwnerReferences = []v12.OwnerReference{*v12.NewControllerRef(kr, h.GVK())}
+	job, err = runJob(h.k8sClient, job)
+	if err != nil {
+		return kr, err
+	}
+	status := kr.Status.KeycloakJobStatus
+	if !jobDone(&status, job) {
+		kr.Status.Message = fmt.Sprintf("restoring %s into keycloak %s", kb.Status.Location, kc.Name)
+		return kr, nil
+	}
+	delete(accessor.GetAnnotations(), restoringAnnotation)
+	*replicas = kr.Status.Replicas
+	if err := application.update(); err != nil {
+		return kr, errors.Wrap(err, "failed to scale back up after the restore")
+	}
+	logrus.Infof("restored keycloak %s/%s from %s: %s", kc.Namespace, kc.Name, kb.Status.Location, status.Phase)
+	kr.Status.KeycloakJobStatus = status
+	return kr, nil
+}
+
+func (h *RestoreReconciler) GVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{
+		Version: v1alpha1.Version,
+		Group:   v1alpha1.Group,
+		Kind:    v1alpha1.KeycloakRestoreKind,
+	}
+}
+
+func getKeycloak(cruder SdkCruder, namespace, name string) (*v1alpha1.Keycloak, error) {
+	kc := &v1alpha1.Keycloak{
+		TypeMeta:   v12.TypeMeta{Kind: v1alpha1.KeycloakKind, APIVersion: v1alpha1.Group + "/" + v1alpha1.Version},
+		ObjectMeta: v12.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	if err := cruder.Get(kc); err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// jobDone moves status to complete or failed once job finished and reports whether it did
+func jobDone(status *v1alpha1.KeycloakJobStatus, job *batchv1.Job) bool {
+	if c := jobFailure(job); c != nil {
+		fail(status, fmt.Sprintf("job %s failed: %s", job.Name, c.Message))
+		return true
+	}
+	if job.Status.Succeeded == 0 {
+		return false
+	}
+	now := v12.Now()
+	status.Phase = v1alpha1.PhaseComplete
+	status.Message = ""
+	status.CompletionTime = &now
+	return true
+}
+
+func fail(status *v1alpha1.KeycloakJobStatus, message string) {
+	now := v12.Now()
+	status.Phase = v1alpha1.PhaseFailed
+	status.Message = message
+	status.CompletionTime = &now
+}
+
+func finished(status v1alpha1.KeycloakJobStatus) bool {
+	return status.Phase == v1alpha1.PhaseComplete || status.Phase == v1alpha1.PhaseFailed
+}
+
+func setAnnotation(o v12.Object, key, value string) {
+	annotations := o.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	o.SetAnnotations(annotations)
+}
+
+// restoring reports whether a KeycloakRestore scaled o down
+func restoring(o runtime.Object) bool {
+	accessor, err := meta.Accessor(o)
+	if err != nil {
+		return false
+	}
+	_, ok := accessor.GetAnnotations()[restoringAnnotation]
+	return ok
+}
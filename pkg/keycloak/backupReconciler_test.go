@@ -0,0 +1,301 @@
+package keycloak
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeCruder gets the Keycloak and KeycloakBackup given to it and records the last update
+func fakeCruder(kc *v1alpha1.Keycloak, kb *v1alpha1.KeycloakBackup, updated *sdk.Object) *SdkCruderMock {
+	return &SdkCruderMock{
+		GetFunc: func(object sdk.Object, opts ...sdk.GetOption) error {
+			switch o := object.(type) {
+			case *v1alpha1.Keycloak:
+				if kc == nil || kc.Name != o.Name {
+					return errors2.NewNotFound(schema.GroupResource{Resource: "keycloaks"}, o.Name)
+				}
+				kc.DeepCopyInto(o)
+			case *v1alpha1.KeycloakBackup:
+				if kb == nil || kb.Name != o.Name {
+					return errors2.NewNotFound(schema.GroupResource{Resource: "keycloakbackups"}, o.Name)
+				}
+				kb.DeepCopyInto(o)
+			}
+			return nil
+		},
+		UpdateFunc: func(object sdk.Object) error {
+			*updated = object
+			return nil
+		},
+	}
+}
+
+func TestBackupReconcilerHandle(t *testing.T) {
+	cases := []struct {
+		Name             string
+		Keycloak         *v1alpha1.Keycloak
+		Backup           string
+		JobStatus        batchv1.JobStatus
+		ExpectedPhase    v1alpha1.StatusPhase
+		ExpectedLocation string
+		ExpectMessage    string
+	}{
+		{
+			Name:             "Backup succeeded",
+			Keycloak:         backedUpKeycloak("", ""),
+			JobStatus:        batchv1.JobStatus{Succeeded: 1},
+			ExpectedPhase:    v1alpha1.PhaseComplete,
+			ExpectedLocation: "pvc://backups/sso/keycloak-backup-adhoc.dump",
+		},
+		{
+			Name: "Backup to an object store succeeded",
+			Keycloak: func() *v1alpha1.Keycloak {
+				kc := backedUpKeycloak("", "")
+				kc.Spec.Backups[0].Destination = nil
+				return kc
+			}(),
+			JobStatus:        batchv1.JobStatus{Succeeded: 1},
+			ExpectedPhase:    v1alpha1.PhaseComplete,
+			ExpectedLocation: "s3://keycloak-backups/",
+		},
+		{
+			Name:          "Backup running",
+			Keycloak:      backedUpKeycloak("", ""),
+			ExpectedPhase: v1alpha1.PhaseRunning,
+			ExpectMessage: "backing up",
+		},
+		{
+			Name:     "Backup failed",
+			Keycloak: backedUpKeycloak("", ""),
+			JobStatus: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+			}},
+			ExpectedPhase: v1alpha1.PhaseFailed,
+			ExpectMessage: "BackoffLimitExceeded",
+		},
+		{
+			Name:          "Unknown backup",
+			Keycloak:      backedUpKeycloak("", ""),
+			Backup:        "weekly",
+			ExpectedPhase: v1alpha1.PhaseFailed,
+			ExpectMessage: "has no backup 'weekly'",
+		},
+		{
+			Name:          "Unknown keycloak",
+			ExpectedPhase: v1alpha1.PhaseFailed,
+			ExpectMessage: "not found",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kb := &v1alpha1.KeycloakBackup{
+				ObjectMeta: v12.ObjectMeta{Name: "adhoc", Namespace: "test-namespace"},
+				Spec:       v1alpha1.KeycloakBackupSpec{Keycloak: "keycloak", Backup: tc.Backup},
+			}
+			k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: v12.ObjectMeta{Name: "aws", Namespace: "test-namespace"},
+				Data:       map[string][]byte{awsBucketKey: []byte("keycloak-backups")},
+			})
+			if tc.Keycloak != nil {
+				tc.Keycloak.Spec.Backups[0].AwsCredentialsSecretName = "aws"
+				tc.Keycloak.Spec.Backups[0].AwsCredentialsSecretNamespace = "test-namespace"
+			}
+			var updated sdk.Object
+			h := NewBackupReconciler(k8sClient, fakeCruder(tc.Keycloak, nil, &updated))
+
+			if err := h.Handle(context.TODO(), kb, false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			kb = updated.(*v1alpha1.KeycloakBackup)
+			if job, err := k8sClient.BatchV1().Jobs("test-namespace").Get("keycloak-backup-adhoc", v12.GetOptions{}); err == nil {
+				if job.OwnerReferences[0].Kind != v1alpha1.KeycloakBackupKind || job.OwnerReferences[0].Name != "adhoc" {
+					t.Fatalf("expected the job to be owned by the backup, got %v", job.OwnerReferences)
+				}
+				job.Status = tc.JobStatus
+				if _, err := k8sClient.BatchV1().Jobs("test-namespace").Update(job); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := h.Handle(context.TODO(), kb, false); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				kb = updated.(*v1alpha1.KeycloakBackup)
+			}
+
+			if kb.Status.Phase != tc.ExpectedPhase {
+				t.Fatalf("expected phase %s, got %s", tc.ExpectedPhase, kb.Status.Phase)
+			}
+			if kb.Status.Location != tc.ExpectedLocation {
+				t.Fatalf("expected the location %s, got %s", tc.ExpectedLocation, kb.Status.Location)
+			}
+			if !strings.Contains(kb.Status.Message, tc.ExpectMessage) {
+				t.Fatalf("expected the message to contain '%s', got '%s'", tc.ExpectMessage, kb.Status.Message)
+			}
+			if finished(kb.Status) != (kb.Status.CompletionTime != nil) {
+				t.Fatalf("expected a completion time once finished, got %v", kb.Status.CompletionTime)
+			}
+		})
+	}
+}
+
+func TestRestoreReconcilerHandle(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	kb := &v1alpha1.KeycloakBackup{
+		ObjectMeta: v12.ObjectMeta{Name: "adhoc", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakBackupSpec{Keycloak: "keycloak"},
+		Status:     v1alpha1.KeycloakJobStatus{Phase: v1alpha1.PhaseComplete, Job: "keycloak-backup-adhoc", Location: "pvc://backups/sso/keycloak-backup-adhoc.dump"},
+	}
+	kr := &v1alpha1.KeycloakRestore{
+		ObjectMeta: v12.ObjectMeta{Name: "undo", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakRestoreSpec{Backup: "adhoc"},
+	}
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+	deployment.Spec.Replicas = int32Ptr(2)
+	deployment.Status = appsv1.DeploymentStatus{Replicas: 2, AvailableReplicas: 2}
+	k8sClient := fake.NewSimpleClientset(deployment)
+	deployments := k8sClient.AppsV1().Deployments("test-namespace")
+	jobs := k8sClient.BatchV1().Jobs("test-namespace")
+	var updated sdk.Object
+	h := &RestoreReconciler{
+		k8sClient:    k8sClient,
+		sdkCrud:      fakeCruder(kc, kb, &updated),
+		phaseHandler: NewPhaseHandler(k8sClient, nil, nil, nil),
+	}
+	restoreStep := func(kr *v1alpha1.KeycloakRestore) (*v1alpha1.KeycloakRestore, *appsv1.Deployment) {
+		if err := h.Handle(context.TODO(), kr, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated != nil {
+			kr = updated.(*v1alpha1.KeycloakRestore)
+		}
+		deployment, err := deployments.Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return kr, deployment
+	}
+
+	kr, deployment = restoreStep(kr)
+	if kr.Status.Phase != v1alpha1.PhaseRunning || kr.Status.Replicas != 2 || *deployment.Spec.Replicas != 0 {
+		t.Fatalf("expected the deployment to be scaled down, got %d replicas and status %v", *deployment.Spec.Replicas, kr.Status)
+	}
+	if !restoring(deployment) {
+		t.Fatal("expected the deployment to be marked as restoring")
+	}
+	kr, _ = restoreStep(kr)
+	if _, err := jobs.Get("keycloak-restore-undo", v12.GetOptions{}); err == nil {
+		t.Fatal("expected the restore to wait for the pods to be gone")
+	}
+	deployment.Status = appsv1.DeploymentStatus{}
+	if _, err := deployments.Update(deployment); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kr, _ = restoreStep(kr)
+	job, err := jobs.Get("keycloak-restore-undo", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the restore job to be created: %v", err)
+	}
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		if e.Name == backupArchiveEnv && e.Value != kb.Status.Job {
+			t.Fatalf("expected the archive of the backup to be restored, got %s", e.Value)
+		}
+	}
+	job.Status = batchv1.JobStatus{Succeeded: 1}
+	if _, err := jobs.Update(job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kr, deployment = restoreStep(kr)
+	if kr.Status.Phase != v1alpha1.PhaseComplete || *deployment.Spec.Replicas != 2 || restoring(deployment) {
+		t.Fatalf("expected the restore to complete and the deployment to be scaled back up, got %d replicas and status %v", *deployment.Spec.Replicas, kr.Status)
+	}
+}
+
+func TestRestoreReconcilerUnrestorableBackup(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	kc.Spec.Backups[0].Destination = nil
+	kb := &v1alpha1.KeycloakBackup{
+		ObjectMeta: v12.ObjectMeta{Name: "adhoc", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakBackupSpec{Keycloak: "keycloak"},
+		Status:     v1alpha1.KeycloakJobStatus{Phase: v1alpha1.PhaseComplete, Job: "keycloak-backup-adhoc", Location: "s3://keycloak-backups/"},
+	}
+	kr := &v1alpha1.KeycloakRestore{
+		ObjectMeta: v12.ObjectMeta{Name: "undo", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakRestoreSpec{Backup: "adhoc"},
+	}
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+	deployment.Spec.Replicas = int32Ptr(2)
+	k8sClient := fake.NewSimpleClientset(deployment)
+	var updated sdk.Object
+	h := &RestoreReconciler{
+		k8sClient:    k8sClient,
+		sdkCrud:      fakeCruder(kc, kb, &updated),
+		phaseHandler: NewPhaseHandler(k8sClient, nil, nil, nil),
+	}
+
+	if err := h.Handle(context.TODO(), kr, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kr = updated.(*v1alpha1.KeycloakRestore)
+	if kr.Status.Phase != v1alpha1.PhaseFailed || !strings.Contains(kr.Status.Message, "can't be restored") {
+		t.Fatalf("expected the restore to fail, got %v", kr.Status)
+	}
+	deployment, _ = k8sClient.AppsV1().Deployments("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+	if *deployment.Spec.Replicas != 2 || restoring(deployment) {
+		t.Fatalf("expected the deployment to be left alone, got %d replicas", *deployment.Spec.Replicas)
+	}
+}
+
+func TestScheduledBackupStatus(t *testing.T) {
+	kc := backedUpKeycloak("", "")
+	earlier := v12.NewTime(time.Now().Add(-48 * time.Hour))
+	later := v12.NewTime(time.Now().Add(-24 * time.Hour))
+	labels := map[string]string{"sso": kc.Name, "cronjob-name": "nightly"}
+	k8sClient := fake.NewSimpleClientset(
+		&batchv1.Job{
+			ObjectMeta: v12.ObjectMeta{Name: "nightly-1", Namespace: "test-namespace", Labels: labels},
+			Status:     batchv1.JobStatus{Succeeded: 1, CompletionTime: &earlier},
+		},
+		&batchv1.Job{
+			ObjectMeta: v12.ObjectMeta{Name: "nightly-2", Namespace: "test-namespace", Labels: labels},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: later, Message: "BackoffLimitExceeded"},
+			}},
+		},
+		&batchv1.Job{
+			ObjectMeta: v12.ObjectMeta{Name: "other-1", Namespace: "test-namespace", Labels: map[string]string{"sso": "other", "cronjob-name": "nightly"}},
+			Status:     batchv1.JobStatus{Succeeded: 1, CompletionTime: &later},
+		},
+	)
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+	kc, err := ph.reconcileBackups(kc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kc.Status.Backups) != 1 {
+		t.Fatalf("expected the status of one backup, got %v", kc.Status.Backups)
+	}
+	status := kc.Status.Backups[0]
+	if !status.LastSuccess.Equal(&earlier) || !status.LastFailure.Equal(&later) || status.LastFailureMessage != "BackoffLimitExceeded" {
+		t.Fatalf("unexpected status %v", status)
+	}
+	cron, err := k8sClient.BatchV1beta1().CronJobs("test-namespace").Get("nightly", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the cronjob to be created: %v", err)
+	}
+	if cron.Spec.JobTemplate.Labels["cronjob-name"] != "nightly" || cron.Spec.JobTemplate.Labels["sso"] != kc.Name {
+		t.Fatalf("expected the jobs of the cronjob to be labelled, got %v", cron.Spec.JobTemplate.Labels)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -17,12 +19,14 @@ import (
 	"fmt"
 
 	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/metrics"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 const (
-	authUrl = "auth/realms/master/protocol/openid-connect/token"
+	// DefaultPageSize is the number of items requested per page from paged list endpoints
+	DefaultPageSize = 100
 )
 
 type Requester interface {
@@ -33,6 +37,23 @@ type Client struct {
 	requester Requester
 	URL       string
 	token     string
+	pageSize  int
+	user      string
+	pass      string
+	adapter   Adapter
+	mu        sync.Mutex
+}
+
+// paths returns the adapter for the server this client talks to
+func (c *Client) paths() Adapter {
+	if c.adapter == nil {
+		return defaultAdapter
+	}
+	return c.adapter
+}
+
+func (c *Client) adminURL(resourcePath string) string {
+	return fmt.Sprintf("%s/%s", c.URL, c.paths().AdminPath(resourcePath))
 }
 
 // T is a generic type for keycloak spec resources
@@ -48,7 +69,7 @@ func (c *Client) create(obj T, resourcePath, resourceName string) error {
 
 	req, err := http.NewRequest(
 		"POST",
-		fmt.Sprintf("%s/auth/admin/%s", c.URL, resourcePath),
+		c.adminURL(resourcePath),
 		bytes.NewBuffer(jsonValue),
 	)
 	if err != nil {
@@ -57,8 +78,7 @@ func (c *Client) create(obj T, resourcePath, resourceName string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	res, err := c.requester.Do(req)
+	res, err := c.do(req, resourceName)
 
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
@@ -67,12 +87,7 @@ func (c *Client) create(obj T, resourcePath, resourceName string) error {
 	defer res.Body.Close()
 
 	if res.StatusCode != 201 && res.StatusCode != 204 {
-		return fmt.Errorf("failed to create %s: (%d) %s", resourceName, res.StatusCode, res.Status)
-	}
-
-	if resourceName == "client" {
-		d, _ := ioutil.ReadAll(res.Body)
-		fmt.Println("user response ", string(d))
+		return errors.Wrapf(newAPIError(res), "failed to create %s", resourceName)
 	}
 
 	return nil
@@ -84,7 +99,7 @@ func (c *Client) CreateRealm(realm *v1alpha1.KeycloakRealm) error {
 }
 
 func (c *Client) CreateClient(client *v1alpha1.KeycloakClient, realmName string) error {
-	return c.create(client.KeycloakApiClient, fmt.Sprintf("realms/%s/clients", realmName), "client")
+	return c.create(c.paths().ClientRepresentation(client.KeycloakApiClient), fmt.Sprintf("realms/%s/clients", realmName), "client")
 }
 
 func (c *Client) CreateUser(user *v1alpha1.KeycloakUser, realmName string) error {
@@ -204,7 +219,7 @@ func (c *Client) CreateIdentityProvider(identityProvider *v1alpha1.KeycloakIdent
 
 // Generic get function for returning a Keycloak resource
 func (c *Client) get(resourcePath, resourceName string, unMarshalFunc func(body []byte) (T, error)) (T, error) {
-	u := fmt.Sprintf("%s/auth/admin/%s", c.URL, resourcePath)
+	u := c.adminURL(resourcePath)
 	req, err := http.NewRequest(
 		"GET",
 		u,
@@ -215,17 +230,16 @@ func (c *Client) get(resourcePath, resourceName string, unMarshalFunc func(body
 		return nil, errors.Wrapf(err, "error creating GET %s request", resourceName)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	res, err := c.requester.Do(req)
+	res, err := c.do(req, resourceName)
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
 		return nil, errors.Wrapf(err, "error performing GET %s request", resourceName)
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to GET %s: (%d) %s", resourceName, res.StatusCode, res.Status)
+		return nil, errors.Wrapf(newAPIError(res), "failed to GET %s", resourceName)
 	}
-	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -246,6 +260,12 @@ func (c *Client) GetRealm(realmName string) (*v1alpha1.KeycloakRealm, error) {
 		err := json.Unmarshal(body, realm)
 		return realm, err
 	})
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	if result == nil {
 		return nil, nil
 	}
@@ -331,6 +351,9 @@ func (c *Client) GetAuthenticatorConfig(configID, realmName string) (*v1alpha1.A
 		err := json.Unmarshal(body, authenticatorConfig)
 		return authenticatorConfig, err
 	})
+	if err != nil {
+		return nil, err
+	}
 	return result.(*v1alpha1.AuthenticatorConfig), err
 }
 
@@ -343,7 +366,7 @@ func (c *Client) update(obj T, resourcePath, resourceName string) error {
 
 	req, err := http.NewRequest(
 		"PUT",
-		fmt.Sprintf("%s/auth/admin/%s", c.URL, resourcePath),
+		c.adminURL(resourcePath),
 		bytes.NewBuffer(jsonValue),
 	)
 	if err != nil {
@@ -352,8 +375,7 @@ func (c *Client) update(obj T, resourcePath, resourceName string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+c.token)
-	res, err := c.requester.Do(req)
+	res, err := c.do(req, resourceName)
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
 		return errors.Wrapf(err, "error performing UPDATE %s request", resourceName)
@@ -361,7 +383,7 @@ func (c *Client) update(obj T, resourcePath, resourceName string) error {
 	defer res.Body.Close()
 	if res.StatusCode < 200 || res.StatusCode > 299 {
 		logrus.Errorf("failed to UPDATE %s %v", resourceName, res.Status)
-		return fmt.Errorf("failed to UPDATE %s: (%d) %s", resourceName, res.StatusCode, res.Status)
+		return errors.Wrapf(newAPIError(res), "failed to UPDATE %s", resourceName)
 	}
 
 	return nil
@@ -372,7 +394,7 @@ func (c *Client) UpdateRealm(realm *v1alpha1.KeycloakRealm) error {
 }
 
 func (c *Client) UpdateClient(specClient *v1alpha1.KeycloakClient, realmName string) error {
-	return c.update(specClient.KeycloakApiClient, fmt.Sprintf("realms/%s/clients/%s", realmName, specClient.ID), "client")
+	return c.update(c.paths().ClientRepresentation(specClient.KeycloakApiClient), fmt.Sprintf("realms/%s/clients/%s", realmName, specClient.ID), "client")
 }
 
 func (c *Client) UpdateUser(specUser *v1alpha1.KeycloakUser, realmName string) error {
@@ -391,7 +413,7 @@ func (c *Client) UpdateAuthenticatorConfig(authenticatorConfig *v1alpha1.Authent
 func (c *Client) delete(resourcePath, resourceName string, obj T) error {
 	req, err := http.NewRequest(
 		"DELETE",
-		fmt.Sprintf("%s/auth/admin/%s", c.URL, resourcePath),
+		c.adminURL(resourcePath),
 		nil,
 	)
 
@@ -402,7 +424,7 @@ func (c *Client) delete(resourcePath, resourceName string, obj T) error {
 		}
 		req, err = http.NewRequest(
 			"DELETE",
-			fmt.Sprintf("%s/auth/admin/%s", c.URL, resourcePath),
+			c.adminURL(resourcePath),
 			bytes.NewBuffer(jsonValue),
 		)
 		req.Header.Set("Content-Type", "application/json")
@@ -413,15 +435,14 @@ func (c *Client) delete(resourcePath, resourceName string, obj T) error {
 		return errors.Wrapf(err, "error creating DELETE %s request", resourceName)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	res, err := c.requester.Do(req)
+	res, err := c.do(req, resourceName)
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
 		return errors.Wrapf(err, "error performing DELETE %s request", resourceName)
 	}
 	defer res.Body.Close()
 	if res.StatusCode != 204 {
-		return fmt.Errorf("failed to DELETE %s: (%d) %s", resourceName, res.StatusCode, res.Status)
+		return errors.Wrapf(newAPIError(res), "failed to DELETE %s", resourceName)
 	}
 
 	return nil
@@ -456,7 +477,7 @@ func (c *Client) DeleteAuthenticatorConfig(configID, realmName string) error {
 func (c *Client) list(resourcePath, resourceName string, unMarshalListFunc func(body []byte) (T, error)) (T, error) {
 	req, err := http.NewRequest(
 		"GET",
-		fmt.Sprintf("%s/auth/admin/%s", c.URL, resourcePath),
+		c.adminURL(resourcePath),
 		nil,
 	)
 	if err != nil {
@@ -464,8 +485,7 @@ func (c *Client) list(resourcePath, resourceName string, unMarshalListFunc func(
 		return nil, errors.Wrapf(err, "error creating LIST %s request", resourceName)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	res, err := c.requester.Do(req)
+	res, err := c.do(req, resourceName)
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
 		return nil, errors.Wrapf(err, "error performing LIST %s request", resourceName)
@@ -473,7 +493,7 @@ func (c *Client) list(resourcePath, resourceName string, unMarshalListFunc func(
 	defer res.Body.Close()
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return nil, fmt.Errorf("failed to LIST %s: (%d) %s", resourceName, res.StatusCode, res.Status)
+		return nil, errors.Wrapf(newAPIError(res), "failed to LIST %s", resourceName)
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -490,6 +510,51 @@ func (c *Client) list(resourcePath, resourceName string, unMarshalListFunc func(
 	return objs, nil
 }
 
+// Generic paged list function for listing Keycloak resources that would otherwise be
+// truncated to the server's default page size. Pages are requested with the first/max
+// query parameters until a short page is returned. unMarshalPageFunc is called once per
+// page and must return the number of items it decoded.
+func (c *Client) listPaged(resourcePath, resourceName string, unMarshalPageFunc func(body []byte) (int, error)) error {
+	pageSize := c.pageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	var previous []byte
+	for first := 0; ; first += pageSize {
+		var page []byte
+		_, err := c.list(pagedPath(resourcePath, first, pageSize), resourceName, func(body []byte) (T, error) {
+			page = body
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// endpoints that don't support paging return the whole list on every request
+		if previous != nil && bytes.Equal(page, previous) {
+			return nil
+		}
+
+		count, err := unMarshalPageFunc(page)
+		if err != nil {
+			return errors.Wrapf(err, "error decoding %s LIST response", resourceName)
+		}
+		if count != pageSize {
+			return nil
+		}
+		previous = page
+	}
+}
+
+func pagedPath(resourcePath string, first, max int) string {
+	separator := "?"
+	if strings.Contains(resourcePath, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%sfirst=%d&max=%d", resourcePath, separator, first, max)
+}
+
 func (c *Client) ListRealms() ([]*v1alpha1.KeycloakRealm, error) {
 	result, err := c.list("realms", "realm", func(body []byte) (T, error) {
 		var realms []*v1alpha1.KeycloakRealm
@@ -504,36 +569,31 @@ func (c *Client) ListRealms() ([]*v1alpha1.KeycloakRealm, error) {
 }
 
 func (c *Client) ListClients(realmName string) ([]*v1alpha1.KeycloakClient, error) {
-	result, err := c.list(fmt.Sprintf("realms/%s/clients", realmName), "clients", func(body []byte) (T, error) {
-		var clients []*v1alpha1.KeycloakClient
-		err := json.Unmarshal(body, &clients)
-		return clients, err
+	clients := []*v1alpha1.KeycloakClient{}
+	err := c.listPaged(fmt.Sprintf("realms/%s/clients", realmName), "clients", func(body []byte) (int, error) {
+		var page []*v1alpha1.KeycloakClient
+		err := json.Unmarshal(body, &page)
+		clients = append(clients, page...)
+		return len(page), err
 	})
-
 	if err != nil {
 		return nil, err
 	}
-
-	res, ok := result.([]*v1alpha1.KeycloakClient)
-
-	if !ok {
-		return nil, errors.New("error decoding list clients response")
-	}
-
-	return res, nil
-
+	return clients, nil
 }
 
 func (c *Client) ListUsers(realmName string) ([]*v1alpha1.KeycloakUser, error) {
-	result, err := c.list(fmt.Sprintf("realms/%s/users", realmName), "users", func(body []byte) (T, error) {
-		var users []*v1alpha1.KeycloakUser
-		err := json.Unmarshal(body, &users)
-		return users, err
+	users := []*v1alpha1.KeycloakUser{}
+	err := c.listPaged(fmt.Sprintf("realms/%s/users", realmName), "users", func(body []byte) (int, error) {
+		var page []*v1alpha1.KeycloakUser
+		err := json.Unmarshal(body, &page)
+		users = append(users, page...)
+		return len(page), err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return result.([]*v1alpha1.KeycloakUser), err
+	return users, nil
 }
 
 func (c *Client) ListIdentityProviders(realmName string) ([]*v1alpha1.KeycloakIdentityProvider, error) {
@@ -549,51 +609,59 @@ func (c *Client) ListIdentityProviders(realmName string) ([]*v1alpha1.KeycloakId
 }
 
 func (c *Client) ListUserClientRoles(realmName, clientID, userID string) ([]*v1alpha1.KeycloakUserRole, error) {
-	objects, err := c.list("realms/"+realmName+"/users/"+userID+"/role-mappings/clients/"+clientID, "userClientRoles", func(body []byte) (t T, e error) {
-		var userClientRoles []*v1alpha1.KeycloakUserRole
-		err := json.Unmarshal(body, &userClientRoles)
-		return userClientRoles, err
+	roles := []*v1alpha1.KeycloakUserRole{}
+	err := c.listPaged("realms/"+realmName+"/users/"+userID+"/role-mappings/clients/"+clientID, "userClientRoles", func(body []byte) (int, error) {
+		var page []*v1alpha1.KeycloakUserRole
+		err := json.Unmarshal(body, &page)
+		roles = append(roles, page...)
+		return len(page), err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return objects.([]*v1alpha1.KeycloakUserRole), err
+	return roles, nil
 }
 
 func (c *Client) ListAvailableUserClientRoles(realmName, clientID, userID string) ([]*v1alpha1.KeycloakUserRole, error) {
-	objects, err := c.list("realms/"+realmName+"/users/"+userID+"/role-mappings/clients/"+clientID+"/available", "userClientRoles", func(body []byte) (t T, e error) {
-		var userClientRoles []*v1alpha1.KeycloakUserRole
-		err := json.Unmarshal(body, &userClientRoles)
-		return userClientRoles, err
+	roles := []*v1alpha1.KeycloakUserRole{}
+	err := c.listPaged("realms/"+realmName+"/users/"+userID+"/role-mappings/clients/"+clientID+"/available", "userClientRoles", func(body []byte) (int, error) {
+		var page []*v1alpha1.KeycloakUserRole
+		err := json.Unmarshal(body, &page)
+		roles = append(roles, page...)
+		return len(page), err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return objects.([]*v1alpha1.KeycloakUserRole), err
+	return roles, nil
 }
 
 func (c *Client) ListUserRealmRoles(realmName, userID string) ([]*v1alpha1.KeycloakUserRole, error) {
-	objects, err := c.list("realms/"+realmName+"/users/"+userID+"/role-mappings/realm", "userRealmRoles", func(body []byte) (t T, e error) {
-		var userRealmRoles []*v1alpha1.KeycloakUserRole
-		err := json.Unmarshal(body, &userRealmRoles)
-		return userRealmRoles, err
+	roles := []*v1alpha1.KeycloakUserRole{}
+	err := c.listPaged("realms/"+realmName+"/users/"+userID+"/role-mappings/realm", "userRealmRoles", func(body []byte) (int, error) {
+		var page []*v1alpha1.KeycloakUserRole
+		err := json.Unmarshal(body, &page)
+		roles = append(roles, page...)
+		return len(page), err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return objects.([]*v1alpha1.KeycloakUserRole), err
+	return roles, nil
 }
 
 func (c *Client) ListAvailableUserRealmRoles(realmName, userID string) ([]*v1alpha1.KeycloakUserRole, error) {
-	objects, err := c.list("realms/"+realmName+"/users/"+userID+"/role-mappings/realm/available", "userClientRoles", func(body []byte) (t T, e error) {
-		var userRealmRoles []*v1alpha1.KeycloakUserRole
-		err := json.Unmarshal(body, &userRealmRoles)
-		return userRealmRoles, err
+	roles := []*v1alpha1.KeycloakUserRole{}
+	err := c.listPaged("realms/"+realmName+"/users/"+userID+"/role-mappings/realm/available", "userRealmRoles", func(body []byte) (int, error) {
+		var page []*v1alpha1.KeycloakUserRole
+		err := json.Unmarshal(body, &page)
+		roles = append(roles, page...)
+		return len(page), err
 	})
 	if err != nil {
 		return nil, err
 	}
-	return objects.([]*v1alpha1.KeycloakUserRole), err
+	return roles, nil
 }
 
 func (c *Client) ListAuthenticationExecutionsForFlow(flowAlias, realmName string) ([]*v1alpha1.AuthenticationExecutionInfo, error) {
@@ -609,24 +677,24 @@ func (c *Client) ListAuthenticationExecutionsForFlow(flowAlias, realmName string
 }
 
 func (c *Client) Ping() error {
-	u := c.URL + "/auth/"
+	u := fmt.Sprintf("%s/%s", c.URL, c.paths().PingPath())
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		logrus.Errorf("error creating ping request %+v", err)
 		return errors.Wrap(err, "error creating ping request")
 	}
 
-	res, err := c.requester.Do(req)
+	res, err := c.send(req, "ping")
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
 		return errors.Wrapf(err, "error performing ping request")
 	}
 
+	defer res.Body.Close()
 	logrus.Debugf("response status: %v, %v", res.StatusCode, res.Status)
 	if res.StatusCode != 200 {
-		return fmt.Errorf("failed to ping, response status code: %v", res.StatusCode)
+		return errors.Wrap(newAPIError(res), "failed to ping")
 	}
-	defer res.Body.Close()
 
 	return nil
 }
@@ -641,7 +709,7 @@ func (c *Client) login(user, pass string) error {
 
 	req, err := http.NewRequest(
 		"POST",
-		fmt.Sprintf("%s/%s", c.URL, authUrl),
+		fmt.Sprintf("%s/%s", c.URL, c.paths().TokenPath()),
 		strings.NewReader(form.Encode()),
 	)
 	if err != nil {
@@ -649,12 +717,15 @@ func (c *Client) login(user, pass string) error {
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	res, err := c.requester.Do(req)
+	res, err := c.send(req, "token")
 	if err != nil {
 		logrus.Errorf("error on request %+v", err)
 		return errors.Wrap(err, "error performing token request")
 	}
 	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return errors.Wrap(newAPIError(res), "error requesting token")
+	}
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		logrus.Errorf("error reading response %+v", err)
@@ -668,7 +739,7 @@ func (c *Client) login(user, pass string) error {
 	}
 
 	if tokenRes.Error != "" {
-		logrus.Errorf("error with request: " + tokenRes.ErrorDescription)
+		logrus.Errorf("error with request: %s", tokenRes.ErrorDescription)
 		return errors.New(tokenRes.ErrorDescription)
 	}
 
@@ -677,6 +748,160 @@ func (c *Client) login(user, pass string) error {
 	return nil
 }
 
+// do performs an authenticated request against the admin API endpoint. A 401 response means the
+// token has expired or been revoked, so the client logs in again and retries the request once.
+func (c *Client) do(req *http.Request, endpoint string) (*http.Response, error) {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	res, err := c.send(req, endpoint)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || c.user == "" {
+		return res, err
+	}
+	res.Body.Close()
+
+	logrus.Debugf("token rejected for %s %s, logging in again", req.Method, req.URL.Path)
+	if err := c.reauthenticate(token); err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "error resetting request body for retry")
+		}
+		req.Body = body
+	}
+	c.mu.Lock()
+	token = c.token
+	c.mu.Unlock()
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return c.send(req, endpoint)
+}
+
+// send performs req and records its latency and status code against endpoint in the admin API metrics
+func (c *Client) send(req *http.Request, endpoint string) (*http.Response, error) {
+	start := time.Now()
+	res, err := c.requester.Do(req)
+	statusCode := 0
+	if err == nil {
+		statusCode = res.StatusCode
+	}
+	metrics.ObserveAdminAPIRequest(endpoint, req.Method, statusCode, time.Since(start))
+	return res, err
+}
+
+// reauthenticate requests a new token unless another request already replaced the rejected one
+func (c *Client) reauthenticate(rejectedToken string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != rejectedToken {
+		return nil
+	}
+	return c.login(c.user, c.pass)
+}
+
+// ServerVersion returns the version of the Keycloak server, when it has been detected
+func (c *Client) ServerVersion() string {
+	return c.paths().ServerVersion()
+}
+
+// detectServer logs in and selects the adapter matching the server's context path and version
+func (c *Client) detectServer(user, pass string) error {
+	contextPath, err := c.detectContextPath()
+	if err != nil {
+		return err
+	}
+	c.adapter = NewAdapter("", contextPath)
+	if err := c.login(user, pass); err != nil {
+		return err
+	}
+
+	version, err := c.getServerVersion()
+	if err != nil {
+		// the paths are known to work, only the representations fall back to the legacy ones
+		logrus.Warnf("could not detect keycloak server version at %s: %v", c.URL, err)
+		return nil
+	}
+	logrus.Debugf("keycloak server at %s reports version %s", c.URL, version)
+	c.adapter = NewAdapter(version, contextPath)
+	return nil
+}
+
+// detectContextPath checks whether the server is serving under the legacy /auth context path
+// by requesting the public master realm endpoint with and without it
+func (c *Client) detectContextPath() (string, error) {
+	for _, contextPath := range []string{legacyContextPath, ""} {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/realms/master", c.URL, contextPath), nil)
+		if err != nil {
+			return "", errors.Wrap(err, "error creating context path request")
+		}
+		res, err := c.send(req, "master realm")
+		if err != nil {
+			logrus.Errorf("error on request %+v", err)
+			return "", errors.Wrap(err, "error performing context path request")
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			return contextPath, nil
+		}
+	}
+	return "", fmt.Errorf("could not find the master realm at %s", c.URL)
+}
+
+// GetServerInfo reads the version and the loaded providers and themes of the server from its serverinfo
+func (c *Client) GetServerInfo() (*v1alpha1.KeycloakServerInfo, error) {
+	result, err := c.get("serverinfo", "serverinfo", func(body []byte) (T, error) {
+		raw := struct {
+			SystemInfo struct {
+				Version string `json:"version"`
+			} `json:"systemInfo"`
+			Providers map[string]struct {
+				Providers map[string]json.RawMessage `json:"providers"`
+			} `json:"providers"`
+			Themes map[string][]struct {
+				Name string `json:"name"`
+			} `json:"themes"`
+		}{}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, err
+		}
+		info := &v1alpha1.KeycloakServerInfo{
+			Version:   raw.SystemInfo.Version,
+			Providers: map[string][]string{},
+			Themes:    map[string][]string{},
+		}
+		for spi, p := range raw.Providers {
+			for id := range p.Providers {
+				info.Providers[spi] = append(info.Providers[spi], id)
+			}
+			sort.Strings(info.Providers[spi])
+		}
+		for themeType, themes := range raw.Themes {
+			for _, t := range themes {
+				info.Themes[themeType] = append(info.Themes[themeType], t.Name)
+			}
+		}
+		return info, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*v1alpha1.KeycloakServerInfo), nil
+}
+
+func (c *Client) getServerVersion() (string, error) {
+	info, err := c.GetServerInfo()
+	if err != nil {
+		return "", err
+	}
+	if info.Version == "" {
+		return "", errors.New("serverinfo did not include a version")
+	}
+	return info.Version, nil
+}
+
 // defaultRequester returns a default client for requesting http endpoints
 func defaultRequester() Requester {
 	transport := &http.Transport{
@@ -690,6 +915,7 @@ func defaultRequester() Requester {
 
 type KeycloakInterface interface {
 	Ping() error
+	GetServerInfo() (*v1alpha1.KeycloakServerInfo, error)
 
 	CreateRealm(realm *v1alpha1.KeycloakRealm) error
 	GetRealm(realmName string) (*v1alpha1.KeycloakRealm, error)
@@ -746,13 +972,24 @@ type KeycloakInterface interface {
 //KeycloakClientFactory interface
 type KeycloakClientFactory interface {
 	AuthenticatedClient(kc v1alpha1.Keycloak) (KeycloakInterface, error)
+	// Invalidate drops the client cached for kc along with its token, the next client logs in again
+	Invalidate(kc v1alpha1.Keycloak)
+	// PasswordClient logs in as the admin user of kc with password instead of the stored one, it isn't cached
+	PasswordClient(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error)
 }
 
 type KeycloakFactory struct {
 	SecretClient v1.SecretInterface
+	// PageSize is the number of items requested per page from paged list endpoints
+	PageSize int
+
+	mu      sync.Mutex
+	clients map[string]*Client
 }
 
-// AuthenticatedClient returns an authenticated client for requesting endpoints from the Keycloak api
+// AuthenticatedClient returns an authenticated client for requesting endpoints from the Keycloak api.
+// Clients are cached per Keycloak instance and reused for as long as the admin credentials don't change;
+// an expired token is renewed by the client itself.
 func (kf *KeycloakFactory) AuthenticatedClient(kc v1alpha1.Keycloak) (KeycloakInterface, error) {
 	adminCreds, err := kf.SecretClient.Get(kc.Spec.AdminCredentials, v12.GetOptions{})
 	if err != nil {
@@ -761,11 +998,53 @@ func (kf *KeycloakFactory) AuthenticatedClient(kc v1alpha1.Keycloak) (KeycloakIn
 	user := string(adminCreds.Data["SSO_ADMIN_USERNAME"])
 	pass := string(adminCreds.Data["SSO_ADMIN_PASSWORD"])
 	url := string(adminCreds.Data["SSO_ADMIN_URL"])
+
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	key := kc.Namespace + "/" + kc.Name
+	if client, ok := kf.clients[key]; ok && client.URL == url && client.user == user && client.pass == pass {
+		return client, nil
+	}
+
 	client := &Client{
 		URL:       url,
 		requester: defaultRequester(),
+		pageSize:  kf.PageSize,
+		user:      user,
+		pass:      pass,
+	}
+	if err := client.detectServer(user, pass); err != nil {
+		return nil, err
+	}
+	if kf.clients == nil {
+		kf.clients = map[string]*Client{}
+	}
+	kf.clients[key] = client
+	return client, nil
+}
+
+// Invalidate drops the client cached for kc, so a token issued for credentials that were just rotated isn't reused
+func (kf *KeycloakFactory) Invalidate(kc v1alpha1.Keycloak) {
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+	delete(kf.clients, kc.Namespace+"/"+kc.Name)
+}
+
+// PasswordClient logs in with password, a rotation checks with it whether Keycloak already has the password it sets
+func (kf *KeycloakFactory) PasswordClient(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error) {
+	adminCreds, err := kf.SecretClient.Get(kc.Spec.AdminCredentials, v12.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the admin credentials")
+	}
+	user := string(adminCreds.Data["SSO_ADMIN_USERNAME"])
+	client := &Client{
+		URL:       string(adminCreds.Data["SSO_ADMIN_URL"]),
+		requester: defaultRequester(),
+		pageSize:  kf.PageSize,
+		user:      user,
+		pass:      password,
 	}
-	if err := client.login(user, pass); err != nil {
+	if err := client.detectServer(user, password); err != nil {
 		return nil, err
 	}
 	return client, nil
@@ -0,0 +1,271 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+)
+
+func TestClientListUsersPaged(t *testing.T) {
+	cases := []struct {
+		Name             string
+		TotalUsers       int
+		PageSize         int
+		IgnorePaging     bool
+		ExpectedUsers    int
+		ExpectedRequests int
+	}{
+		{
+			Name:             "Fewer users than a page",
+			TotalUsers:       3,
+			PageSize:         5,
+			ExpectedUsers:    3,
+			ExpectedRequests: 1,
+		},
+		{
+			Name:             "Users spanning several pages",
+			TotalUsers:       12,
+			PageSize:         5,
+			ExpectedUsers:    12,
+			ExpectedRequests: 3,
+		},
+		{
+			Name:             "Users filling exactly the last page",
+			TotalUsers:       10,
+			PageSize:         5,
+			ExpectedUsers:    10,
+			ExpectedRequests: 3,
+		},
+		{
+			Name:             "Server ignoring first and max",
+			TotalUsers:       5,
+			PageSize:         5,
+			IgnorePaging:     true,
+			ExpectedUsers:    5,
+			ExpectedRequests: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.URL.Path != "/auth/admin/realms/test-realm/users" {
+					t.Fatalf("unexpected request path %s", r.URL.Path)
+				}
+				first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+				max, _ := strconv.Atoi(r.URL.Query().Get("max"))
+				if tc.IgnorePaging {
+					first, max = 0, tc.TotalUsers
+				}
+				users := []*v1alpha1.KeycloakApiUser{}
+				for i := first; i < first+max && i < tc.TotalUsers; i++ {
+					users = append(users, &v1alpha1.KeycloakApiUser{ID: fmt.Sprintf("%d", i), UserName: fmt.Sprintf("user%d", i)})
+				}
+				json.NewEncoder(w).Encode(users)
+			}))
+			defer server.Close()
+
+			client := &Client{URL: server.URL, requester: server.Client(), pageSize: tc.PageSize}
+			users, err := client.ListUsers("test-realm")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(users) != tc.ExpectedUsers {
+				t.Fatalf("expected %d users, got %d", tc.ExpectedUsers, len(users))
+			}
+			if requests != tc.ExpectedRequests {
+				t.Fatalf("expected %d requests, got %d", tc.ExpectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestClientReturnsAPIError(t *testing.T) {
+	cases := []struct {
+		Name            string
+		StatusCode      int
+		Body            string
+		IsNotFound      bool
+		IsConflict      bool
+		ExpectedMessage string
+	}{
+		{
+			Name:            "Not found",
+			StatusCode:      http.StatusNotFound,
+			Body:            `{"error":"Realm not found."}`,
+			IsNotFound:      true,
+			ExpectedMessage: "Realm not found.",
+		},
+		{
+			Name:            "Conflict",
+			StatusCode:      http.StatusConflict,
+			Body:            `{"errorMessage":"Client test already exists"}`,
+			IsConflict:      true,
+			ExpectedMessage: "Client test already exists",
+		},
+		{
+			Name:            "Server error without body",
+			StatusCode:      http.StatusInternalServerError,
+			ExpectedMessage: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.StatusCode)
+				w.Write([]byte(tc.Body))
+			}))
+			defer server.Close()
+
+			client := &Client{URL: server.URL, requester: server.Client()}
+			err := client.CreateClient(&v1alpha1.KeycloakClient{KeycloakApiClient: &v1alpha1.KeycloakApiClient{ClientID: "test"}}, "test-realm")
+			apiErr, ok := AsAPIError(err)
+			if !ok {
+				t.Fatalf("expected an APIError, got: %v", err)
+			}
+			if apiErr.StatusCode != tc.StatusCode || apiErr.Method != "POST" || apiErr.Path != "/auth/admin/realms/test-realm/clients" {
+				t.Fatalf("unexpected APIError: %+v", apiErr)
+			}
+			if apiErr.Message != tc.ExpectedMessage {
+				t.Fatalf("expected message '%s', got '%s'", tc.ExpectedMessage, apiErr.Message)
+			}
+			if IsNotFound(err) != tc.IsNotFound || IsConflict(err) != tc.IsConflict || IsUnauthorized(err) {
+				t.Fatalf("unexpected classification of error: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientReauthenticatesOnUnauthorized(t *testing.T) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+defaultAdapter.TokenPath() {
+			logins++
+			json.NewEncoder(w).Encode(v1alpha1.TokenResponse{AccessToken: fmt.Sprintf("token-%d", logins)})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, requester: server.Client(), user: "admin", pass: "pass"}
+	if err := client.login(client.user, client.pass); err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	if err := client.DeleteUser("user-id", "test-realm"); err != nil {
+		t.Fatalf("expected request to succeed after logging in again, got: %v", err)
+	}
+	if logins != 2 {
+		t.Fatalf("expected 2 logins, got %d", logins)
+	}
+}
+
+func TestClientDetectsServer(t *testing.T) {
+	cases := []struct {
+		Name                string
+		ContextPath         string
+		Version             string
+		ExpectQuarkusFields bool
+	}{
+		{
+			Name:                "RH-SSO 7.4 under /auth",
+			ContextPath:         "/auth",
+			Version:             "9.0.3.redhat-00002",
+			ExpectQuarkusFields: false,
+		},
+		{
+			Name:                "Keycloak 21 without context path",
+			ContextPath:         "",
+			Version:             "21.1.1",
+			ExpectQuarkusFields: true,
+		},
+		{
+			Name:                "Keycloak 21 configured with the legacy context path",
+			ContextPath:         "/auth",
+			Version:             "21.1.1",
+			ExpectQuarkusFields: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var createdClient map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case tc.ContextPath + "/realms/master":
+					w.Write([]byte(`{"realm":"master"}`))
+				case tc.ContextPath + "/realms/master/protocol/openid-connect/token":
+					json.NewEncoder(w).Encode(v1alpha1.TokenResponse{AccessToken: "token"})
+				case tc.ContextPath + "/admin/serverinfo":
+					w.Write([]byte(fmt.Sprintf(`{"systemInfo":{"version":"%s"}}`, tc.Version)))
+				case tc.ContextPath + "/admin/realms/test-realm/clients":
+					json.NewDecoder(r.Body).Decode(&createdClient)
+					w.WriteHeader(http.StatusCreated)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			client := &Client{URL: server.URL, requester: server.Client(), user: "admin", pass: "pass"}
+			if err := client.detectServer(client.user, client.pass); err != nil {
+				t.Fatalf("unexpected error detecting server: %v", err)
+			}
+			if client.ServerVersion() != tc.Version {
+				t.Fatalf("expected version %s, got %s", tc.Version, client.ServerVersion())
+			}
+			if err := client.CreateClient(&v1alpha1.KeycloakClient{KeycloakApiClient: &v1alpha1.KeycloakApiClient{ClientID: "test"}}, "test-realm"); err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+			if _, ok := createdClient["useTemplateConfig"]; ok == tc.ExpectQuarkusFields {
+				t.Fatalf("unexpected client representation sent: %v", createdClient)
+			}
+		})
+	}
+}
+
+func TestClientGetServerInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/admin/serverinfo":
+			w.Write([]byte(`{
+				"systemInfo": {"version": "9.0.3.redhat-00002"},
+				"themes": {"login": [{"name": "keycloak", "locales": ["en"]}, {"name": "corporate"}], "email": [{"name": "base"}]},
+				"providers": {
+					"authenticator": {"internal": false, "providers": {"otp-sms": {"order": 0}, "auth-cookie": {"order": 0}}},
+					"hash": {"providers": {"pbkdf2-sha256": {}}}
+				}
+			}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, requester: server.Client(), token: "token"}
+	info, err := client.GetServerInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &v1alpha1.KeycloakServerInfo{
+		Version:   "9.0.3.redhat-00002",
+		Providers: map[string][]string{"authenticator": {"auth-cookie", "otp-sms"}, "hash": {"pbkdf2-sha256"}},
+		Themes:    map[string][]string{"login": {"keycloak", "corporate"}, "email": {"base"}},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, info)
+	}
+}
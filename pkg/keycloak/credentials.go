@@ -0,0 +1,155 @@
+package keycloak
+
+import (
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	adminUsernameKey = "SSO_ADMIN_USERNAME"
+	adminPasswordKey = "SSO_ADMIN_PASSWORD"
+	// adminPendingPasswordKey holds the password a rotation sets until it is stored as the admin password, so a
+	// rotation interrupted in between is resumed with the same password
+	adminPendingPasswordKey = "SSO_ADMIN_PASSWORD_PENDING"
+
+	rotationRequested = "requested"
+	rotationScheduled = "scheduled"
+	// maxRotationHistory is the number of rotations kept in the status
+	maxRotationHistory = 10
+)
+
+// reconcileAdminCredentials rotates the master admin password when the rotation annotation changed or the rotation
+// interval passed. A rotation that fails is retried on the next reconcile, the error is reported in its status
+func (ph *phaseHandler) reconcileAdminCredentials(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	status, rotation := runningRotation(kc, kc.Status.AdminCredentials, v1alpha1.RotateAdminCredentialsAnnotation, kc.Spec.AdminCredentialRotation)
+	if rotation == nil {
+		return kc, nil
+	}
+	kc.Status.AdminCredentials = status
+
+	if ph.kcClientFactory == nil {
+		return kc, errors.New("no keycloak client factory to rotate the admin credentials with")
+	}
+	if err := ph.rotateAdminCredentials(kc); err != nil {
+		logrus.Errorf("failed to rotate the admin credentials of %s/%s: %v", kc.Namespace, kc.Name, err)
+		rotation.Message = err.Error()
+		return kc, nil
+	}
+	logrus.Infof("rotated the admin credentials of %s/%s", kc.Namespace, kc.Name)
+	completeRotation(status, rotation)
+	return kc, nil
+}
+
+// runningRotation returns the rotation of status that is still running, starting one when the annotation of kc
+// changed or the interval of spec passed. The rotation is nil when there is nothing to rotate
+func runningRotation(kc *v1alpha1.Keycloak, status *v1alpha1.KeycloakCredentialsStatus, annotation string, spec *v1alpha1.KeycloakCredentialRotationSpec) (*v1alpha1.KeycloakCredentialsStatus, *v1alpha1.KeycloakCredentialRotation) {
+	if status == nil {
+		status = &v1alpha1.KeycloakCredentialsStatus{}
+	}
+	if n := len(status.Rotations); n > 0 && status.Rotations[n-1].Completed == nil {
+		return status, &status.Rotations[n-1]
+	}
+	reason := rotationDue(kc, status, annotation, spec, time.Now())
+	if reason == "" {
+		return status, nil
+	}
+	if reason == rotationRequested {
+		status.Request = kc.Annotations[annotation]
+	}
+	status.Rotations = append(status.Rotations, v1alpha1.KeycloakCredentialRotation{Reason: reason, Started: v12.Now()})
+	if len(status.Rotations) > maxRotationHistory {
+		status.Rotations = status.Rotations[len(status.Rotations)-maxRotationHistory:]
+	}
+	return status, &status.Rotations[len(status.Rotations)-1]
+}
+
+func completeRotation(status *v1alpha1.KeycloakCredentialsStatus, rotation *v1alpha1.KeycloakCredentialRotation) {
+	now := v12.Now()
+	rotation.Completed = &now
+	rotation.Message = ""
+	status.LastRotated = &now
+}
+
+// rotationDue returns why credentials should be rotated at now, or nothing when they shouldn't
+func rotationDue(kc *v1alpha1.Keycloak, status *v1alpha1.KeycloakCredentialsStatus, annotation string, spec *v1alpha1.KeycloakCredentialRotationSpec, now time.Time) string {
+	if request := kc.Annotations[annotation]; request != "" && request != status.Request {
+		return rotationRequested
+	}
+	if spec == nil || spec.Interval == nil {
+		return ""
+	}
+	last := kc.CreationTimestamp.Time
+	if status.LastRotated != nil {
+		last = status.LastRotated.Time
+	}
+	if now.Sub(last) >= spec.Interval.Duration {
+		return rotationScheduled
+	}
+	return ""
+}
+
+// rotateAdminCredentials sets a new admin password through the admin API and stores it in the credentials secret.
+// The new password is kept as pending until it replaced the admin password in the secret, a rotation interrupted
+// after Keycloak accepted it logs in with the pending password and only has to store it
+func (ph *phaseHandler) rotateAdminCredentials(kc *v1alpha1.Keycloak) error {
+	secrets := ph.k8sClient.CoreV1().Secrets(kc.Namespace)
+	secret, err := secrets.Get(kc.Spec.AdminCredentials, v12.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get the admin credentials")
+	}
+	pending := string(secret.Data[adminPendingPasswordKey])
+	if pending == "" {
+		if pending, err = GeneratePassword(); err != nil {
+			return err
+		}
+		secret.Data[adminPendingPasswordKey] = []byte(pending)
+		if secret, err = secrets.Update(secret); err != nil {
+			return errors.Wrap(err, "failed to store the new admin password")
+		}
+	} else if _, err := ph.kcClientFactory.PasswordClient(*kc, pending); err == nil {
+		logrus.Infof("keycloak %s/%s already has the pending admin password, storing it", kc.Namespace, kc.Name)
+		return ph.storeAdminPassword(kc, secret, pending)
+	}
+	if err := ph.setAdminPassword(kc, secret, pending); err != nil {
+		return err
+	}
+	// the secret keeps the old password until Keycloak is known to accept the new one
+	if _, err := ph.kcClientFactory.PasswordClient(*kc, pending); err != nil {
+		return errors.Wrap(err, "failed to log in with the new admin password")
+	}
+	return ph.storeAdminPassword(kc, secret, pending)
+}
+
+// storeAdminPassword replaces the admin password in secret with password once Keycloak has it, and checks that a
+// fresh login with it succeeds
+func (ph *phaseHandler) storeAdminPassword(kc *v1alpha1.Keycloak, secret *v1.Secret, password string) error {
+	secret.Data[adminPasswordKey] = []byte(password)
+	delete(secret.Data, adminPendingPasswordKey)
+	if _, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Update(secret); err != nil {
+		return errors.Wrap(err, "failed to update the admin credentials")
+	}
+	// the cached client holds a token issued for the old password
+	ph.kcClientFactory.Invalidate(*kc)
+	_, err := ph.kcClientFactory.AuthenticatedClient(*kc)
+	return errors.Wrap(err, "failed to log in with the new admin password")
+}
+
+// setAdminPassword sets password on the admin user of the master realm, authenticated with the current credentials
+func (ph *phaseHandler) setAdminPassword(kc *v1alpha1.Keycloak, secret *v1.Secret, password string) error {
+	client, err := ph.kcClientFactory.AuthenticatedClient(*kc)
+	if err != nil {
+		return errors.Wrap(err, "failed to log in with the current admin password")
+	}
+	username := string(secret.Data[adminUsernameKey])
+	user, err := client.FindUserByUsername(username, "master")
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the admin user %s", username)
+	}
+	return errors.Wrap(client.UpdatePassword(user, "master", password), "failed to set the new admin password")
+}
@@ -0,0 +1,295 @@
+package keycloak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPhaseHandlerReconcileAdminCredentials(t *testing.T) {
+	lastRotated := v12.NewTime(time.Now().Add(-2 * time.Hour))
+	cases := []struct {
+		Name       string
+		Annotation string
+		Interval   time.Duration
+		Status     *v1alpha1.KeycloakCredentialsStatus
+		SecretData map[string]string
+		// KeycloakPassword is the admin password Keycloak has, the one in the secret when it is empty
+		KeycloakPassword string
+		UpdateFails      bool
+		RejectLogin      bool
+		// RejectFreshLogin makes a fresh login with the new password fail after Keycloak accepted it
+		RejectFreshLogin bool
+		ExpectedReason   string
+		ExpectRotated    bool
+		ExpectUpdate     bool
+	}{
+		{
+			Name:   "Nothing to rotate",
+			Status: &v1alpha1.KeycloakCredentialsStatus{Request: "1"},
+		},
+		{
+			Name:           "Requested by the annotation",
+			Annotation:     "1",
+			ExpectedReason: rotationRequested,
+			ExpectRotated:  true,
+			ExpectUpdate:   true,
+		},
+		{
+			Name:       "Request already handled",
+			Annotation: "1",
+			Status:     &v1alpha1.KeycloakCredentialsStatus{Request: "1", LastRotated: &lastRotated},
+			Interval:   3 * time.Hour,
+		},
+		{
+			Name:           "Interval passed",
+			Status:         &v1alpha1.KeycloakCredentialsStatus{LastRotated: &lastRotated},
+			Interval:       time.Hour,
+			ExpectedReason: rotationScheduled,
+			ExpectRotated:  true,
+			ExpectUpdate:   true,
+		},
+		{
+			Name:           "Admin API rejects the new password",
+			Annotation:     "1",
+			UpdateFails:    true,
+			ExpectedReason: rotationRequested,
+			ExpectUpdate:   true,
+		},
+		{
+			Name:           "Login with the new password fails",
+			Annotation:     "1",
+			RejectLogin:    true,
+			ExpectedReason: rotationRequested,
+			ExpectUpdate:   true,
+		},
+		{
+			Name:             "Fresh login with the new password fails",
+			Annotation:       "1",
+			RejectFreshLogin: true,
+			ExpectedReason:   rotationRequested,
+			ExpectUpdate:     true,
+		},
+		{
+			Name:       "Resuming a rotation Keycloak accepted",
+			Annotation: "1",
+			Status: &v1alpha1.KeycloakCredentialsStatus{Request: "1", Rotations: []v1alpha1.KeycloakCredentialRotation{
+				{Reason: rotationRequested, Started: lastRotated, Message: "failed to update the admin credentials"},
+			}},
+			SecretData:       map[string]string{adminPendingPasswordKey: "pending"},
+			KeycloakPassword: "pending",
+			ExpectedReason:   rotationRequested,
+			ExpectRotated:    true,
+		},
+		{
+			Name:       "Resuming a rotation Keycloak didn't accept",
+			Annotation: "1",
+			Status: &v1alpha1.KeycloakCredentialsStatus{Request: "1", Rotations: []v1alpha1.KeycloakCredentialRotation{
+				{Reason: rotationRequested, Started: lastRotated, Message: "failed to set the new admin password"},
+			}},
+			SecretData:     map[string]string{adminPendingPasswordKey: "pending"},
+			ExpectedReason: rotationRequested,
+			ExpectRotated:  true,
+			ExpectUpdate:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			data := map[string][]byte{adminUsernameKey: []byte("admin"), adminPasswordKey: []byte("old")}
+			for k, v := range tc.SecretData {
+				data[k] = []byte(v)
+			}
+			k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: v12.ObjectMeta{Name: "credential-keycloak", Namespace: "test-namespace"},
+				Data:       data,
+			})
+			secrets := k8sClient.CoreV1().Secrets("test-namespace")
+			keycloakPassword := string(data[adminPasswordKey])
+			if tc.KeycloakPassword != "" {
+				keycloakPassword = tc.KeycloakPassword
+			}
+			updates := 0
+			kcClient := &KeycloakInterfaceMock{
+				FindUserByUsernameFunc: func(name, realm string) (*v1alpha1.KeycloakApiUser, error) {
+					return &v1alpha1.KeycloakApiUser{ID: "1", UserName: name}, nil
+				},
+				UpdatePasswordFunc: func(user *v1alpha1.KeycloakApiUser, realmName, newPass string) error {
+					updates++
+					if tc.UpdateFails {
+						return errors.New("password policy not met")
+					}
+					keycloakPassword = newPass
+					return nil
+				},
+			}
+			factory := &KeycloakClientFactoryMock{
+				AuthenticatedClientFunc: func(kc v1alpha1.Keycloak) (KeycloakInterface, error) {
+					secret, _ := secrets.Get(kc.Spec.AdminCredentials, v12.GetOptions{})
+					if string(secret.Data[adminPasswordKey]) != keycloakPassword || (tc.RejectLogin && updates > 0) {
+						return nil, errors.New("invalid user credentials")
+					}
+					return kcClient, nil
+				},
+				InvalidateFunc: func(kc v1alpha1.Keycloak) {},
+				PasswordClientFunc: func(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error) {
+					if password != keycloakPassword || (tc.RejectFreshLogin && updates > 0) {
+						return nil, errors.New("invalid user credentials")
+					}
+					return kcClient, nil
+				},
+			}
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+			ph.kcClientFactory = factory
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{
+					Name:              "keycloak",
+					Namespace:         "test-namespace",
+					CreationTimestamp: v12.NewTime(time.Now().Add(-24 * time.Hour)),
+					Annotations:       map[string]string{},
+				},
+				Spec:   v1alpha1.KeycloakSpec{AdminCredentials: "credential-keycloak"},
+				Status: v1alpha1.KeycloakStatus{AdminCredentials: tc.Status},
+			}
+			if tc.Annotation != "" {
+				kc.Annotations[v1alpha1.RotateAdminCredentialsAnnotation] = tc.Annotation
+			}
+			if tc.Interval > 0 {
+				kc.Spec.AdminCredentialRotation = &v1alpha1.KeycloakCredentialRotationSpec{Interval: &v12.Duration{Duration: tc.Interval}}
+			}
+
+			kc, err := ph.reconcileAdminCredentials(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (updates > 0) != tc.ExpectUpdate {
+				t.Fatalf("expected the password to be set through the admin API: %v, got %d calls", tc.ExpectUpdate, updates)
+			}
+			secret, _ := secrets.Get("credential-keycloak", v12.GetOptions{})
+			if tc.ExpectedReason == "" {
+				if string(secret.Data[adminPasswordKey]) != "old" || (kc.Status.AdminCredentials != nil && len(kc.Status.AdminCredentials.Rotations) > 0) {
+					t.Fatalf("expected no rotation, got %v and %v", secret.Data, kc.Status.AdminCredentials)
+				}
+				return
+			}
+
+			rotations := kc.Status.AdminCredentials.Rotations
+			rotation := rotations[len(rotations)-1]
+			if len(rotations) != 1 || rotation.Reason != tc.ExpectedReason {
+				t.Fatalf("expected one %s rotation, got %v", tc.ExpectedReason, rotations)
+			}
+			if tc.ExpectedReason == rotationRequested && kc.Status.AdminCredentials.Request != tc.Annotation {
+				t.Fatalf("expected the request %s to be recorded, got %s", tc.Annotation, kc.Status.AdminCredentials.Request)
+			}
+			if !tc.ExpectRotated {
+				if rotation.Completed != nil || rotation.Message == "" {
+					t.Fatalf("expected the rotation to keep running with the error, got %v", rotation)
+				}
+				if (tc.UpdateFails || tc.RejectFreshLogin) && (string(secret.Data[adminPasswordKey]) != "old" || len(secret.Data[adminPendingPasswordKey]) == 0) {
+					t.Fatalf("expected the old password to be kept and the new one to be pending, got %v", secret.Data)
+				}
+				if tc.RejectLogin && (string(secret.Data[adminPasswordKey]) != keycloakPassword || len(secret.Data[adminPendingPasswordKey]) != 0) {
+					t.Fatalf("expected the password Keycloak accepted to be stored, got %v", secret.Data)
+				}
+				return
+			}
+			if rotation.Completed == nil || rotation.Message != "" || kc.Status.AdminCredentials.LastRotated == nil {
+				t.Fatalf("expected the rotation to be completed, got %v", kc.Status.AdminCredentials)
+			}
+			if password := string(secret.Data[adminPasswordKey]); password == "old" || password != keycloakPassword {
+				t.Fatalf("expected the secret to hold the new password %s, got %s", keycloakPassword, password)
+			}
+			if _, ok := secret.Data[adminPendingPasswordKey]; ok {
+				t.Fatal("expected the pending password to be removed")
+			}
+			if len(factory.InvalidateCalls()) != 1 {
+				t.Fatalf("expected the cached client to be invalidated once, got %d", len(factory.InvalidateCalls()))
+			}
+		})
+	}
+}
+
+func TestRotateAdminCredentialsInterruptedBeforeStoring(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: v12.ObjectMeta{Name: "credential-keycloak", Namespace: "test-namespace"},
+		Data:       map[string][]byte{adminUsernameKey: []byte("admin"), adminPasswordKey: []byte("old")},
+	})
+	secrets := k8sClient.CoreV1().Secrets("test-namespace")
+	// the operator stops between setting the password in Keycloak and storing it as the admin password
+	interrupted := true
+	k8sClient.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.UpdateAction).GetObject().(*corev1.Secret)
+		if _, pending := secret.Data[adminPendingPasswordKey]; interrupted && !pending {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	keycloakPassword := "old"
+	updates := 0
+	kcClient := &KeycloakInterfaceMock{
+		FindUserByUsernameFunc: func(name, realm string) (*v1alpha1.KeycloakApiUser, error) {
+			return &v1alpha1.KeycloakApiUser{ID: "1", UserName: name}, nil
+		},
+		UpdatePasswordFunc: func(user *v1alpha1.KeycloakApiUser, realmName, newPass string) error {
+			updates++
+			keycloakPassword = newPass
+			return nil
+		},
+	}
+	login := func(password string) (KeycloakInterface, error) {
+		if password != keycloakPassword {
+			return nil, errors.New("invalid user credentials")
+		}
+		return kcClient, nil
+	}
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+	ph.kcClientFactory = &KeycloakClientFactoryMock{
+		AuthenticatedClientFunc: func(kc v1alpha1.Keycloak) (KeycloakInterface, error) {
+			secret, _ := secrets.Get(kc.Spec.AdminCredentials, v12.GetOptions{})
+			return login(string(secret.Data[adminPasswordKey]))
+		},
+		InvalidateFunc: func(kc v1alpha1.Keycloak) {},
+		PasswordClientFunc: func(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error) {
+			return login(password)
+		},
+	}
+	kc := &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{
+			Name:        "keycloak",
+			Namespace:   "test-namespace",
+			Annotations: map[string]string{v1alpha1.RotateAdminCredentialsAnnotation: "1"},
+		},
+		Spec: v1alpha1.KeycloakSpec{AdminCredentials: "credential-keycloak"},
+	}
+
+	kc, err := ph.reconcileAdminCredentials(kc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, _ := secrets.Get("credential-keycloak", v12.GetOptions{})
+	if rotation := kc.Status.AdminCredentials.Rotations[0]; rotation.Completed != nil || updates != 1 {
+		t.Fatalf("expected the rotation to fail after Keycloak accepted the password, got %v and %d updates", rotation, updates)
+	}
+	if string(secret.Data[adminPasswordKey]) != "old" || string(secret.Data[adminPendingPasswordKey]) != keycloakPassword {
+		t.Fatalf("expected the password Keycloak accepted to still be pending, got %v", secret.Data)
+	}
+
+	interrupted = false
+	if kc, err = ph.reconcileAdminCredentials(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, _ = secrets.Get("credential-keycloak", v12.GetOptions{})
+	if rotation := kc.Status.AdminCredentials.Rotations[0]; rotation.Completed == nil || updates != 1 {
+		t.Fatalf("expected the rotation to complete without setting the password again, got %v and %d updates", rotation, updates)
+	}
+	if string(secret.Data[adminPasswordKey]) != keycloakPassword || len(secret.Data[adminPendingPasswordKey]) != 0 {
+		t.Fatalf("expected the secret to hold the password Keycloak has, got %v", secret.Data)
+	}
+}
@@ -0,0 +1,169 @@
+package keycloak
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	osappsv1 "github.com/openshift/api/apps/v1"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	externalDatabaseCAVolume = "sso-database-ca"
+	externalDatabaseCAPath   = "/etc/x509/database"
+)
+
+type databaseCredentials struct {
+	Username string
+	Password string
+	Database string
+	Host     string
+	Port     int32
+}
+
+// externalDatabaseCredentials reads the connection details of the external database of kc
+func externalDatabaseCredentials(k8sClient kubernetes.Interface, kc *v1alpha1.Keycloak) (*databaseCredentials, error) {
+	db := kc.Spec.ExternalDatabase
+	secret, err := k8sClient.CoreV1().Secrets(kc.Namespace).Get(db.CredentialsSecret, v12.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get the external database credentials secret %s", db.CredentialsSecret)
+	}
+	creds := &databaseCredentials{
+		Username: string(secret.Data["username"]),
+		Password: string(secret.Data["password"]),
+		Database: db.Database,
+		Host:     db.Host,
+		Port:     db.Port,
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return nil, errors.Errorf("the external database credentials secret %s requires the username and password keys", db.CredentialsSecret)
+	}
+	if creds.Port == 0 {
+		creds.Port = v1alpha1.DefaultDatabasePort
+	}
+	return creds, nil
+}
+
+// wireExternalDatabase drops the bundled database from the install resources and points the Keycloak
+// container at the external database instead
+func wireExternalDatabase(objects []runtime.Object, kc *v1alpha1.Keycloak, creds *databaseCredentials) ([]runtime.Object, error) {
+	wired := make([]runtime.Object, 0, len(objects))
+	var container *v1.Container
+	var podSpec *v1.PodSpec
+	for _, o := range objects {
+		if dataLayerObject(kc, objectName(o)) {
+			continue
+		}
+		wired = append(wired, o)
+		if spec := workloadPodSpec(o); spec != nil && objectName(o) == applicationName(kc) {
+			podSpec = spec
+			for i := range spec.Containers {
+				if spec.Containers[i].Name == applicationName(kc) {
+					container = &spec.Containers[i]
+				}
+			}
+		}
+	}
+	if container == nil {
+		return nil, errors.New("could not find the sso container in the install resources")
+	}
+
+	// the image resolves the database through the environment of the service named in DB_SERVICE_PREFIX_MAPPING
+	prefix := strings.ToUpper(strings.Replace(databaseName(kc), "-", "_", -1))
+	setEnv(container, prefix+"_SERVICE_HOST", creds.Host)
+	setEnv(container, prefix+"_SERVICE_PORT", fmt.Sprintf("%d", creds.Port))
+
+	if tls := kc.Spec.ExternalDatabase.TLS; tls != nil {
+		setEnv(container, "DB_XA_CONNECTION_PROPERTY_sslmode", tls.SSLMode)
+		if tls.CASecret != "" {
+			podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+				Name:         externalDatabaseCAVolume,
+				VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: tls.CASecret}},
+			})
+			container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+				Name:      externalDatabaseCAVolume,
+				MountPath: externalDatabaseCAPath,
+				ReadOnly:  true,
+			})
+			setEnv(container, "DB_XA_CONNECTION_PROPERTY_sslrootcert", externalDatabaseCAPath+"/ca.crt")
+		}
+	}
+	return wired, nil
+}
+
+// databaseClientEnv is the libpq environment, read from the database secret, and the volumes that connect psql and
+// pg_dump to the database of kc
+func databaseClientEnv(kc *v1alpha1.Keycloak) ([]v1.EnvVar, []v1.VolumeMount, []v1.Volume) {
+	secretEnv := func(name, key string) v1.EnvVar {
+		return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: databaseSecretName(kc)},
+			Key:                  key,
+		}}}
+	}
+	env := []v1.EnvVar{
+		secretEnv("PGHOST", "POSTGRES_HOST"),
+		secretEnv("PGPORT", "POSTGRES_PORT"),
+		secretEnv("PGUSER", "POSTGRES_USERNAME"),
+		secretEnv("PGPASSWORD", databasePasswordKey),
+		secretEnv("PGDATABASE", "POSTGRES_DATABASE"),
+	}
+	if kc.Spec.ExternalDatabase == nil || kc.Spec.ExternalDatabase.TLS == nil {
+		return env, nil, nil
+	}
+	tls := kc.Spec.ExternalDatabase.TLS
+	env = append(env, v1.EnvVar{Name: "PGSSLMODE", Value: tls.SSLMode})
+	if tls.CASecret == "" {
+		return env, nil, nil
+	}
+	env = append(env, v1.EnvVar{Name: "PGSSLROOTCERT", Value: externalDatabaseCAPath + "/ca.crt"})
+	return env,
+		[]v1.VolumeMount{{Name: externalDatabaseCAVolume, MountPath: externalDatabaseCAPath, ReadOnly: true}},
+		[]v1.Volume{{Name: externalDatabaseCAVolume, VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: tls.CASecret}}}}
+}
+
+func objectName(o runtime.Object) string {
+	if accessor, ok := o.(v12.Object); ok {
+		return accessor.GetName()
+	}
+	return ""
+}
+
+// workloadPodSpec returns the pod spec of a Deployment, StatefulSet or DeploymentConfig, or nil for other objects
+func workloadPodSpec(o runtime.Object) *v1.PodSpec {
+	if template := workloadPodTemplate(o); template != nil {
+		return &template.Spec
+	}
+	return nil
+}
+
+// workloadPodTemplate returns the pod template of a Deployment, StatefulSet or DeploymentConfig, or nil for other
+// objects
+func workloadPodTemplate(o runtime.Object) *v1.PodTemplateSpec {
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	case *osappsv1.DeploymentConfig:
+		return w.Spec.Template
+	}
+	return nil
+}
+
+// setEnv sets the value of an environment variable of container, adding it when missing
+func setEnv(container *v1.Container, name, value string) {
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env[i].Value = value
+			container.Env[i].ValueFrom = nil
+			return
+		}
+	}
+	container.Env = append(container.Env, v1.EnvVar{Name: name, Value: value})
+}
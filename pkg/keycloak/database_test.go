@@ -0,0 +1,211 @@
+package keycloak
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func externalDatabaseKeycloak(tls *v1alpha1.KeycloakExternalDatabaseTLS) *v1alpha1.Keycloak {
+	return &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+		Spec: v1alpha1.KeycloakSpec{
+			Provision: true,
+			ExternalDatabase: &v1alpha1.KeycloakExternalDatabase{
+				Host:              "postgres.example.com",
+				Port:              5433,
+				Database:          "keycloak",
+				CredentialsSecret: "keycloak-db",
+				TLS:               tls,
+			},
+		},
+		Status: v1alpha1.KeycloakStatus{Platform: v1alpha1.PlatformKubernetes},
+	}
+}
+
+func externalDatabaseSecret() runtime.Object {
+	return &corev1.Secret{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak-db", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"username": []byte("kc"), "password": []byte("secret")},
+	}
+}
+
+func TestKeycloakExternalDatabaseValidate(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Database    v1alpha1.KeycloakExternalDatabase
+		ExpectError bool
+	}{
+		{
+			Name:     "Valid without tls",
+			Database: v1alpha1.KeycloakExternalDatabase{Host: "db", Database: "keycloak", CredentialsSecret: "keycloak-db"},
+		},
+		{
+			Name:        "Missing host",
+			Database:    v1alpha1.KeycloakExternalDatabase{Database: "keycloak", CredentialsSecret: "keycloak-db"},
+			ExpectError: true,
+		},
+		{
+			Name:        "Missing credentials secret",
+			Database:    v1alpha1.KeycloakExternalDatabase{Host: "db", Database: "keycloak"},
+			ExpectError: true,
+		},
+		{
+			Name: "Require without a ca",
+			Database: v1alpha1.KeycloakExternalDatabase{Host: "db", Database: "keycloak", CredentialsSecret: "keycloak-db",
+				TLS: &v1alpha1.KeycloakExternalDatabaseTLS{SSLMode: "require"}},
+		},
+		{
+			Name: "Verify without a ca",
+			Database: v1alpha1.KeycloakExternalDatabase{Host: "db", Database: "keycloak", CredentialsSecret: "keycloak-db",
+				TLS: &v1alpha1.KeycloakExternalDatabaseTLS{SSLMode: "verify-full"}},
+			ExpectError: true,
+		},
+		{
+			Name: "Unknown ssl mode",
+			Database: v1alpha1.KeycloakExternalDatabase{Host: "db", Database: "keycloak", CredentialsSecret: "keycloak-db",
+				TLS: &v1alpha1.KeycloakExternalDatabaseTLS{SSLMode: "prefer", CASecret: "ca"}},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			db := tc.Database
+			kc := &v1alpha1.Keycloak{Spec: v1alpha1.KeycloakSpec{ExternalDatabase: &db}}
+			kc.Defaults()
+			err := kc.Validate()
+			if tc.ExpectError && err == nil {
+				t.Fatal("expected an error but got none")
+			}
+			if !tc.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if db.Port != v1alpha1.DefaultDatabasePort {
+				t.Fatalf("expected the port to default to %d, got %d", v1alpha1.DefaultDatabasePort, db.Port)
+			}
+		})
+	}
+}
+
+func TestWireExternalDatabase(t *testing.T) {
+	cases := []struct {
+		Name        string
+		TLS         *v1alpha1.KeycloakExternalDatabaseTLS
+		ExpectedEnv map[string]string
+		ExpectCA    bool
+	}{
+		{
+			Name:        "Without tls",
+			ExpectedEnv: map[string]string{"SSO_POSTGRESQL_SERVICE_HOST": "postgres.example.com", "SSO_POSTGRESQL_SERVICE_PORT": "5433"},
+		},
+		{
+			Name: "With a ca",
+			TLS:  &v1alpha1.KeycloakExternalDatabaseTLS{SSLMode: "verify-full", CASecret: "keycloak-db-ca"},
+			ExpectedEnv: map[string]string{
+				"DB_XA_CONNECTION_PROPERTY_sslmode":     "verify-full",
+				"DB_XA_CONNECTION_PROPERTY_sslrootcert": "/etc/x509/database/ca.crt",
+			},
+			ExpectCA: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := externalDatabaseKeycloak(tc.TLS)
+			p := &kubernetesPlatform{k8sClient: fake.NewSimpleClientset()}
+			objects, err := p.InstallResources(kc, map[string]string{"DB_USERNAME": "kc", "DB_PASSWORD": "secret"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			creds := &databaseCredentials{Username: "kc", Password: "secret", Database: "keycloak", Host: "postgres.example.com", Port: 5433}
+			wired, err := wireExternalDatabase(objects, kc, creds)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var deployment *appsv1.Deployment
+			for _, o := range wired {
+				if strings.Contains(objectName(o), "postgresql") {
+					t.Fatalf("expected the bundled database to be dropped, got %s", objectName(o))
+				}
+				if d, ok := o.(*appsv1.Deployment); ok {
+					deployment = d
+				}
+			}
+			if deployment == nil {
+				t.Fatal("expected the keycloak deployment to be kept")
+			}
+			env := map[string]string{}
+			for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+				env[e.Name] = e.Value
+			}
+			for name, value := range tc.ExpectedEnv {
+				if env[name] != value {
+					t.Fatalf("expected %s to be '%s', got '%s'", name, value, env[name])
+				}
+			}
+			hasCA := false
+			for _, v := range deployment.Spec.Template.Spec.Volumes {
+				if v.Secret != nil && v.Secret.SecretName == "keycloak-db-ca" {
+					hasCA = true
+				}
+			}
+			if hasCA != tc.ExpectCA {
+				t.Fatalf("expected the ca volume to be mounted: %v, got %v", tc.ExpectCA, hasCA)
+			}
+		})
+	}
+}
+
+func TestPhaseHandlerExternalDatabase(t *testing.T) {
+	os.Setenv("WATCH_NAMESPACE", "test-namespace")
+	defer os.Unsetenv("WATCH_NAMESPACE")
+	k8sClient := fake.NewSimpleClientset(externalDatabaseSecret())
+	resources := newFakeResourceClients()
+	ph := NewPhaseHandler(k8sClient, nil, nil, resources.Factory)
+
+	kc, err := ph.Accepted(externalDatabaseKeycloak(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kc.Status.Phase != v1alpha1.PhaseProvisionApplication {
+		t.Fatalf("expected the data layer phases to be skipped, got phase %s", kc.Status.Phase)
+	}
+
+	kc, err = ph.ProvisionApplication(kc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kc.Status.Phase != v1alpha1.PhaseWaitApplication {
+		t.Fatalf("expected phase %s, got %s", v1alpha1.PhaseWaitApplication, kc.Status.Phase)
+	}
+	for _, name := range resources.Names() {
+		if strings.Contains(name, "postgresql") {
+			t.Fatalf("expected no bundled database objects to be created, got %v", resources.Names())
+		}
+	}
+	if resources.Get("Deployment", SSO_APPLICATION_NAME) == nil {
+		t.Fatalf("expected the keycloak deployment to be created, got %v", resources.Names())
+	}
+
+	if _, err := ph.reconcileDBPassword(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, err := k8sClient.CoreV1().Secrets("test-namespace").Get("db-credentials-keycloak", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"POSTGRES_USERNAME": "kc", "POSTGRES_HOST": "postgres.example.com", "POSTGRES_PORT": "5433", "POSTGRES_DATABASE": "keycloak"}
+	for k, v := range expected {
+		if string(secret.Data[k]) != v {
+			t.Fatalf("expected %s to be '%s', got '%s'", k, v, string(secret.Data[k]))
+		}
+	}
+}
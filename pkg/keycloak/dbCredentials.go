@@ -0,0 +1,287 @@
+package keycloak
+
+import (
+	"fmt"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	databasePasswordKey = "POSTGRES_PASSWORD"
+	// databasePendingPasswordKey holds the password a rotation sets until the database accepted it, so an
+	// interrupted rotation is retried with the same password
+	databasePendingPasswordKey = "POSTGRES_PASSWORD_PENDING"
+	// databaseRotatedAnnotation is set on the pod template of the Keycloak workload to roll its pods onto a rotated
+	// password, it holds the name of the job that changed it
+	databaseRotatedAnnotation = "aerogear.org/db-credentials-rotated"
+	// databaseRotationScript changes the password of the role with psql, a password the role already logs in with
+	// is left alone so a job retried after the change succeeds
+	databaseRotationScript = `if PGPASSWORD="$NEW_PASSWORD" psql -c 'SELECT 1' >/dev/null 2>&1; then exit 0; fi
+psql -v ON_ERROR_STOP=1 -v user="$PGUSER" -v password="$NEW_PASSWORD" <<'EOF'
+ALTER ROLE :"user" WITH PASSWORD :'password';
+EOF`
+)
+
+// databaseEnvKeys maps the database environment of the bundled workloads to the keys of the database secret
+var databaseEnvKeys = map[string]string{
+	"DB_USERNAME":         "POSTGRES_USERNAME",
+	"DB_PASSWORD":         databasePasswordKey,
+	"DB_DATABASE":         "POSTGRES_DATABASE",
+	"POSTGRESQL_USER":     "POSTGRES_USERNAME",
+	"POSTGRESQL_PASSWORD": databasePasswordKey,
+	"POSTGRESQL_DATABASE": "POSTGRES_DATABASE",
+}
+
+// secretDatabaseEnv makes the Keycloak and database containers of o read the database credentials from the database
+// secret instead of literal values and returns whether anything changed
+func secretDatabaseEnv(kc *v1alpha1.Keycloak, o runtime.Object) bool {
+	name := objectName(o)
+	if name != applicationName(kc) && name != databaseName(kc) {
+		return false
+	}
+	container := workloadContainer(o, name)
+	if container == nil {
+		return false
+	}
+	changed := false
+	for i, e := range container.Env {
+		key, ok := databaseEnvKeys[e.Name]
+		if !ok || e.ValueFrom != nil {
+			continue
+		}
+		container.Env[i] = v1.EnvVar{Name: e.Name, ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: databaseSecretName(kc)},
+			Key:                  key,
+		}}}
+		changed = true
+	}
+	return changed
+}
+
+// envValue returns the value of e, reading it from its secret when it references one
+func (ph *phaseHandler) envValue(namespace string, e v1.EnvVar) (string, error) {
+	if e.ValueFrom == nil || e.ValueFrom.SecretKeyRef == nil {
+		return e.Value, nil
+	}
+	ref := e.ValueFrom.SecretKeyRef
+	secret, err := ph.k8sClient.CoreV1().Secrets(namespace).Get(ref.Name, v12.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get the secret %s of %s", ref.Name, e.Name)
+	}
+	return string(secret.Data[ref.Key]), nil
+}
+
+// ensureDatabaseSecret creates the database secret from the credentials the bundled database in objects was rendered
+// with, unless it exists
+func (ph *phaseHandler) ensureDatabaseSecret(kc *v1alpha1.Keycloak, objects []runtime.Object) error {
+	secrets := ph.k8sClient.CoreV1().Secrets(kc.Namespace)
+	_, err := secrets.Get(databaseSecretName(kc), v12.GetOptions{})
+	if err == nil || !errors2.IsNotFound(err) {
+		return errors.Wrap(err, "could not get db credentials secret")
+	}
+	creds := &databaseCredentials{Host: databaseHost(kc), Port: POSTGRES_PORT}
+	for _, o := range objects {
+		if objectName(o) != databaseName(kc) {
+			continue
+		}
+		if container := workloadContainer(o, databaseName(kc)); container != nil {
+			for _, e := range container.Env {
+				switch e.Name {
+				case "POSTGRESQL_USER":
+					creds.Username = e.Value
+				case "POSTGRESQL_PASSWORD":
+					creds.Password = e.Value
+				case "POSTGRESQL_DATABASE":
+					creds.Database = e.Value
+				}
+			}
+		}
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return errors.New("could not find the database credentials in the install resources")
+	}
+	_, err = secrets.Create(databaseSecret(kc, creds))
+	if err != nil && !errors2.IsAlreadyExists(err) {
+		return errors.Wrap(err, "could not create db credentials secret")
+	}
+	return nil
+}
+
+// reconcileDatabaseCredentials rotates the password of the bundled database when the rotation annotation changed or
+// the rotation interval passed. A job changes the password of the role, the new password is then stored in the
+// database secret and the Keycloak pods are rolled to pick it up. A rotation that fails is retried on the next
+// reconcile, the error is reported in its status
+func (ph *phaseHandler) reconcileDatabaseCredentials(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	if kc.Spec.ExternalDatabase != nil {
+		return kc, nil
+	}
+	status, rotation := runningRotation(kc, kc.Status.DatabaseCredentials, v1alpha1.RotateDatabaseCredentialsAnnotation, kc.Spec.DatabaseCredentialRotation)
+	if rotation == nil {
+		return kc, nil
+	}
+	kc.Status.DatabaseCredentials = status
+
+	done, err := ph.rotateDatabaseCredentials(kc, rotation)
+	if err != nil {
+		logrus.Errorf("failed to rotate the database credentials of %s/%s: %v", kc.Namespace, kc.Name, err)
+		rotation.Message = err.Error()
+		return kc, nil
+	}
+	if done {
+		logrus.Infof("rotated the database credentials of %s/%s", kc.Namespace, kc.Name)
+		completeRotation(status, rotation)
+	}
+	return kc, nil
+}
+
+// rotateDatabaseCredentials takes the rotation one step further and reports whether it is done. The password is
+// generated and kept as pending in the database secret, changed by a job and only then stored as the password
+func (ph *phaseHandler) rotateDatabaseCredentials(kc *v1alpha1.Keycloak, rotation *v1alpha1.KeycloakCredentialRotation) (bool, error) {
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return false, err
+	}
+	application, database, err := p.Workloads(kc)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the workloads")
+	}
+	if database == nil {
+		return false, errors.Errorf("the database workload %s is missing", databaseName(kc))
+	}
+	if restoring(application.object) {
+		rotation.Message = "waiting for the restore to finish"
+		return false, nil
+	}
+	// instances provisioned before the credentials were kept in the secret have them as literal values
+	migrated := false
+	for _, w := range []*workload{database, application} {
+		if secretDatabaseEnv(kc, w.object) {
+			logrus.Infof("reading the database credentials of %s from the secret %s", objectName(w.object), databaseSecretName(kc))
+			if err := w.update(); err != nil {
+				return false, errors.Wrapf(err, "failed to update the database environment of %s", objectName(w.object))
+			}
+			migrated = true
+		}
+	}
+	if migrated || !database.rolledOut || !application.rolledOut {
+		rotation.Message = "waiting for the workloads to roll out"
+		return false, nil
+	}
+
+	secrets := ph.k8sClient.CoreV1().Secrets(kc.Namespace)
+	secret, err := secrets.Get(databaseSecretName(kc), v12.GetOptions{})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the database credentials")
+	}
+	jobName := fmt.Sprintf("%s-db-rotation-%d", applicationName(kc), rotation.Started.Unix())
+	template := workloadPodTemplate(application.object)
+	if template.Annotations[databaseRotatedAnnotation] == jobName {
+		return true, ph.deleteJob(kc.Namespace, jobName)
+	}
+
+	jobs := ph.k8sClient.BatchV1().Jobs(kc.Namespace)
+	if len(secret.Data[databasePendingPasswordKey]) == 0 {
+		job, err := jobs.Get(jobName, v12.GetOptions{})
+		if err != nil && !errors2.IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to get the job %s", jobName)
+		}
+		if err != nil || job.Status.Succeeded == 0 {
+			pending, err := GeneratePassword()
+			if err != nil {
+				return false, err
+			}
+			secret.Data[databasePendingPasswordKey] = []byte(pending)
+			if secret, err = secrets.Update(secret); err != nil {
+				return false, errors.Wrap(err, "failed to store the new database password")
+			}
+		}
+	}
+
+	if pending := secret.Data[databasePendingPasswordKey]; len(pending) > 0 {
+		container := workloadContainer(database.object, databaseName(kc))
+		if container == nil {
+			return false, errors.Errorf("could not find the container of %s", databaseName(kc))
+		}
+		job, err := runJob(ph.k8sClient, databaseRotationJob(kc, jobName, container.Image))
+		if err != nil {
+			return false, err
+		}
+		if c := jobFailure(job); c != nil {
+			return false, errors.Errorf("the job %s failed to change the password, delete it to retry: %s", jobName, c.Message)
+		}
+		if job.Status.Succeeded == 0 {
+			rotation.Message = fmt.Sprintf("waiting for the job %s to change the password", jobName)
+			return false, nil
+		}
+		secret.Data[databasePasswordKey] = pending
+		delete(secret.Data, databasePendingPasswordKey)
+		if _, err := secrets.Update(secret); err != nil {
+			return false, errors.Wrap(err, "failed to update the database credentials")
+		}
+	}
+
+	// connections opened with the old password keep working, new ones need the pods to read the new password
+	setAnnotation(template, databaseRotatedAnnotation, jobName)
+	if err := application.update(); err != nil {
+		return false, errors.Wrapf(err, "failed to roll %s onto the new password", objectName(application.object))
+	}
+	return true, ph.deleteJob(kc.Namespace, jobName)
+}
+
+func (ph *phaseHandler) deleteJob(namespace, name string) error {
+	propagation := v12.DeletePropagationBackground
+	err := ph.k8sClient.BatchV1().Jobs(namespace).Delete(name, &v12.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors2.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the job %s", name)
+	}
+	return nil
+}
+
+// databaseRotationJob changes the password of the database role to the pending one with psql from image
+func databaseRotationJob(kc *v1alpha1.Keycloak, name, image string) *batchv1.Job {
+	secretEnv := func(name, key string) v1.EnvVar {
+		return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: databaseSecretName(kc)},
+			Key:                  key,
+		}}}
+	}
+	return &batchv1.Job{
+		ObjectMeta: v12.ObjectMeta{
+			Name:            name,
+			Namespace:       kc.Namespace,
+			Labels:          instanceLabels(kc),
+			OwnerReferences: []v12.OwnerReference{ownerReference(kc)},
+		},
+		Spec: batchv1.JobSpec{
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: v12.ObjectMeta{
+					Labels: instanceLabels(kc),
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:    "db-rotation",
+						Image:   image,
+						Command: []string{"/bin/sh", "-c", databaseRotationScript},
+						Env: []v1.EnvVar{
+							{Name: "PGHOST", Value: databaseHost(kc)},
+							{Name: "PGPORT", Value: fmt.Sprintf("%d", POSTGRES_PORT)},
+							secretEnv("PGUSER", "POSTGRES_USERNAME"),
+							secretEnv("PGDATABASE", "POSTGRES_DATABASE"),
+							secretEnv("PGPASSWORD", databasePasswordKey),
+							secretEnv("NEW_PASSWORD", databasePendingPasswordKey),
+						},
+					}},
+					RestartPolicy: v1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,181 @@
+package keycloak
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPhaseHandlerReconcileDatabaseCredentials(t *testing.T) {
+	started := v12.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	running := &v1alpha1.KeycloakCredentialsStatus{Request: "1", Rotations: []v1alpha1.KeycloakCredentialRotation{
+		{Reason: rotationRequested, Started: started},
+	}}
+	jobName := fmt.Sprintf("sso-db-rotation-%d", started.Unix())
+	cases := []struct {
+		Name             string
+		Annotation       string
+		ExternalDatabase bool
+		LiteralEnv       bool
+		Status           *v1alpha1.KeycloakCredentialsStatus
+		Pending          string
+		Job              *batchv1.JobStatus
+		ExpectRunning    bool
+		ExpectMessage    string
+		ExpectJob        bool
+		ExpectPassword   string
+		ExpectPending    bool
+		ExpectRolled     bool
+	}{
+		{
+			Name:           "Nothing to rotate",
+			ExpectPassword: "old",
+		},
+		{
+			Name:             "External database",
+			Annotation:       "1",
+			ExternalDatabase: true,
+			ExpectPassword:   "old",
+		},
+		{
+			Name:           "Literal credentials are moved to the secret first",
+			Annotation:     "1",
+			LiteralEnv:     true,
+			ExpectRunning:  true,
+			ExpectMessage:  "waiting for the workloads to roll out",
+			ExpectPassword: "old",
+		},
+		{
+			Name:           "Requested by the annotation",
+			Annotation:     "1",
+			Status:         running,
+			ExpectRunning:  true,
+			ExpectMessage:  "waiting for the job " + jobName,
+			ExpectJob:      true,
+			ExpectPassword: "old",
+			ExpectPending:  true,
+		},
+		{
+			Name:           "Job failed",
+			Annotation:     "1",
+			Status:         running,
+			Pending:        "new",
+			Job:            &batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}},
+			ExpectRunning:  true,
+			ExpectMessage:  "delete it to retry",
+			ExpectJob:      true,
+			ExpectPassword: "old",
+			ExpectPending:  true,
+		},
+		{
+			Name:           "Job changed the password",
+			Annotation:     "1",
+			Status:         running,
+			Pending:        "new",
+			Job:            &batchv1.JobStatus{Succeeded: 1},
+			ExpectPassword: "new",
+			ExpectRolled:   true,
+		},
+		{
+			Name:           "Password stored before the pods were rolled",
+			Annotation:     "1",
+			Status:         running,
+			Job:            &batchv1.JobStatus{Succeeded: 1},
+			ExpectPassword: "old",
+			ExpectRolled:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace", Annotations: map[string]string{}},
+				Status:     v1alpha1.KeycloakStatus{Platform: v1alpha1.PlatformKubernetes, DatabaseCredentials: tc.Status.DeepCopy()},
+			}
+			if tc.Annotation != "" {
+				kc.Annotations[v1alpha1.RotateDatabaseCredentialsAnnotation] = tc.Annotation
+			}
+			if tc.ExternalDatabase {
+				kc.Spec.ExternalDatabase = &v1alpha1.KeycloakExternalDatabase{Host: "postgres.example.com", CredentialsSecret: "external-db"}
+			}
+			dbParams := map[string]string{"DB_USERNAME": "user", "DB_PASSWORD": "old", "DB_DATABASE": "root"}
+			deployment := kubernetesDeployment(kc, dbParams, map[string]string{})
+			statefulSet := kubernetesPostgresStatefulSet(kc, dbParams)
+			if !tc.LiteralEnv {
+				secretDatabaseEnv(kc, deployment)
+				secretDatabaseEnv(kc, statefulSet)
+			}
+			deployment.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1}
+			statefulSet.Status = appsv1.StatefulSetStatus{ReadyReplicas: 1}
+			data := map[string][]byte{"POSTGRES_USERNAME": []byte("user"), databasePasswordKey: []byte("old"), "POSTGRES_DATABASE": []byte("root")}
+			if tc.Pending != "" {
+				data[databasePendingPasswordKey] = []byte(tc.Pending)
+			}
+			objects := []runtime.Object{deployment, statefulSet, &corev1.Secret{
+				ObjectMeta: v12.ObjectMeta{Name: databaseSecretName(kc), Namespace: kc.Namespace},
+				Data:       data,
+			}}
+			if tc.Job != nil {
+				objects = append(objects, &batchv1.Job{ObjectMeta: v12.ObjectMeta{Name: jobName, Namespace: kc.Namespace}, Status: *tc.Job})
+			}
+			k8sClient := fake.NewSimpleClientset(objects...)
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+			kc, err := ph.reconcileDatabaseCredentials(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			secret, _ := k8sClient.CoreV1().Secrets(kc.Namespace).Get(databaseSecretName(kc), v12.GetOptions{})
+			if password := string(secret.Data[databasePasswordKey]); password != tc.ExpectPassword {
+				t.Fatalf("expected the password %s, got %s", tc.ExpectPassword, password)
+			}
+			if _, ok := secret.Data[databasePendingPasswordKey]; ok != tc.ExpectPending {
+				t.Fatalf("expected a pending password: %v, got %v", tc.ExpectPending, secret.Data)
+			}
+			job, err := k8sClient.BatchV1().Jobs(kc.Namespace).Get(jobName, v12.GetOptions{})
+			if tc.ExpectJob == errors2.IsNotFound(err) {
+				t.Fatalf("expected the job %s to exist: %v, got %v", jobName, tc.ExpectJob, err)
+			}
+			if tc.ExpectJob && tc.Job == nil && job.Spec.Template.Spec.Containers[0].Image != statefulSet.Spec.Template.Spec.Containers[0].Image {
+				t.Fatalf("expected the job to run the database image, got %s", job.Spec.Template.Spec.Containers[0].Image)
+			}
+			deployment, _ = k8sClient.AppsV1().Deployments(kc.Namespace).Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+			if rolled := deployment.Spec.Template.Annotations[databaseRotatedAnnotation] == jobName; rolled != tc.ExpectRolled {
+				t.Fatalf("expected the keycloak pods to be rolled: %v, got %v", tc.ExpectRolled, deployment.Spec.Template.Annotations)
+			}
+			for _, e := range workloadContainer(deployment, SSO_APPLICATION_NAME).Env {
+				if _, ok := databaseEnvKeys[e.Name]; ok && !tc.ExternalDatabase && e.ValueFrom == nil {
+					t.Fatalf("expected %s to be read from the secret", e.Name)
+				}
+			}
+
+			status := kc.Status.DatabaseCredentials
+			if tc.Annotation == "" || tc.ExternalDatabase {
+				if status != nil {
+					t.Fatalf("expected no rotation, got %v", status)
+				}
+				return
+			}
+			rotation := status.Rotations[len(status.Rotations)-1]
+			if tc.ExpectRunning {
+				if rotation.Completed != nil || !strings.Contains(rotation.Message, tc.ExpectMessage) {
+					t.Fatalf("expected the rotation to keep running with '%s', got %v", tc.ExpectMessage, rotation)
+				}
+				return
+			}
+			if rotation.Completed == nil || status.LastRotated == nil {
+				t.Fatalf("expected the rotation to be completed, got %v", status)
+			}
+		})
+	}
+}
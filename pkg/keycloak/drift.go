@@ -0,0 +1,303 @@
+package keycloak
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ownership lists the fields of an install object the operator keeps as it rendered them. Label maps are merged so
+// labels added by others are kept, the other fields are replaced. Fields managed elsewhere, such as the image,
+// environment, replicas and resources of the workloads, are left out
+type ownership struct {
+	labels [][]string
+	fields [][]string
+	// generated are only restored when the desired object sets them, the cluster fills them in otherwise
+	generated  [][]string
+	containers []string
+}
+
+var (
+	objectLabels   = [][]string{{"metadata", "labels"}}
+	workloadLabels = [][]string{{"metadata", "labels"}, {"spec", "template", "metadata", "labels"}}
+	workloadProbes = []string{"ports", "readinessProbe", "livenessProbe"}
+)
+
+var ownedFields = map[string]ownership{
+	"Service": {labels: objectLabels, fields: [][]string{{"spec", "ports"}, {"spec", "selector"}}},
+	"Route": {
+		labels:    objectLabels,
+		fields:    [][]string{{"spec", "to"}, {"spec", "port"}, {"spec", "tls"}},
+		generated: [][]string{{"spec", "host"}},
+	},
+	"Ingress": {labels: objectLabels, fields: [][]string{{"spec", "rules"}, {"spec", "tls"}}},
+	"DeploymentConfig": {
+		labels:     workloadLabels,
+		fields:     [][]string{{"spec", "selector"}},
+		containers: workloadProbes,
+	},
+	"Deployment":  {labels: workloadLabels, containers: workloadProbes},
+	"StatefulSet": {labels: workloadLabels, containers: workloadProbes},
+	// the monitoring resources are rendered from the templates and the monitoring spec alone
+	"GrafanaDashboard": {labels: objectLabels, fields: [][]string{{"spec"}}},
+	"ServiceMonitor":   {labels: objectLabels, fields: [][]string{{"spec"}}},
+	"PrometheusRule":   {labels: objectLabels, fields: [][]string{{"spec"}}},
+}
+
+// reconcileInstallObjects compares the install objects with the live ones, recreating the missing ones and setting
+// the fields the operator owns back on the drifted ones. What it corrected is reported in the status
+func (ph *phaseHandler) reconcileInstallObjects(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	if brokenOverrides(kc) {
+		logrus.Infof("not reconciling the install objects of %s/%s until its overrides apply", kc.Namespace, kc.Name)
+		return kc, nil
+	}
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return kc, err
+	}
+	dbCreds, err := ph.installedDatabaseCredentials(kc, p)
+	if err != nil {
+		return kc, err
+	}
+	if dbCreds == nil {
+		logrus.Infof("not reconciling the install objects of %s/%s, its database credentials are unknown", kc.Namespace, kc.Name)
+		return kc, nil
+	}
+	objects, err := ph.installObjects(kc, p, dbCreds)
+	if err != nil {
+		return kc, err
+	}
+
+	corrections := []string{}
+	for _, o := range objects {
+		correction, err := ph.reconcileInstallObject(kc, o)
+		if err != nil {
+			return kc, err
+		}
+		if correction != "" {
+			logrus.Infof("keycloak %s/%s: %s", kc.Namespace, kc.Name, correction)
+			corrections = append(corrections, correction)
+		}
+	}
+	if len(corrections) == 0 {
+		// a clean pass clears the corrections, lastCorrected still tells when the last ones were made
+		kc.Status.Corrections = nil
+		return kc, nil
+	}
+	now := v12.Now()
+	kc.Status.Corrections = corrections
+	kc.Status.LastCorrected = &now
+	return kc, nil
+}
+
+// reconcileInstallObject recreates o when it is missing or restores the fields the operator owns, it returns what
+// it corrected or nothing when the live object matches
+func (ph *phaseHandler) reconcileInstallObject(kc *v1alpha1.Keycloak, o runtime.Object) (string, error) {
+	desired, err := k8sutil.UnstructuredFromRuntimeObject(o)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to turn runtime object "+o.GetObjectKind().GroupVersionKind().String()+" into unstructured object")
+	}
+	gvk := o.GetObjectKind().GroupVersionKind()
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	name := kind + "/" + desired.GetName()
+	resourceClient, _, err := ph.dynamicResourceClientFactory(apiVersion, kind, kc.Namespace)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get resource client for %s", name)
+	}
+
+	live, err := resourceClient.Get(desired.GetName(), v12.GetOptions{})
+	if errors2.IsNotFound(err) {
+		if _, err := resourceClient.Create(desired); err != nil && !errors2.IsAlreadyExists(err) {
+			return "", errors.Wrapf(err, "failed to recreate %s", name)
+		}
+		return "recreated " + name, nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get %s", name)
+	}
+
+	drifted := restoreOwnedFields(desired, live)
+	overridden, err := reapplyOverrides(kc, o, live)
+	if err != nil {
+		return "", err
+	}
+	if overridden {
+		drifted = append(drifted, "overrides")
+	}
+	if len(drifted) == 0 {
+		return "", nil
+	}
+	if _, err := resourceClient.Update(live); err != nil {
+		return "", errors.Wrapf(err, "failed to restore %s", name)
+	}
+	return fmt.Sprintf("restored %s of %s", strings.Join(drifted, ", "), name), nil
+}
+
+// restoreOwnedFields sets the fields of live the operator owns back to their value in desired and returns the ones
+// it changed
+func restoreOwnedFields(desired, live *unstructured.Unstructured) []string {
+	owned, ok := ownedFields[desired.GetKind()]
+	if !ok {
+		owned = ownership{labels: objectLabels}
+	}
+	drifted := []string{}
+	if ref := v12.GetControllerOf(desired); ref != nil && v12.GetControllerOf(live) == nil {
+		live.SetOwnerReferences(append(live.GetOwnerReferences(), *ref))
+		drifted = append(drifted, "metadata.ownerReferences")
+	}
+	for _, path := range owned.labels {
+		if mergeField(desired.Object, live.Object, path) {
+			drifted = append(drifted, strings.Join(path, "."))
+		}
+	}
+	for _, path := range owned.fields {
+		if restoreField(desired.Object, live.Object, path) {
+			drifted = append(drifted, strings.Join(path, "."))
+		}
+	}
+	for _, path := range owned.generated {
+		if want, _, _ := unstructured.NestedString(desired.Object, path...); want != "" && restoreField(desired.Object, live.Object, path) {
+			drifted = append(drifted, strings.Join(path, "."))
+		}
+	}
+	if len(owned.containers) == 0 {
+		return drifted
+	}
+
+	containersPath := []string{"spec", "template", "spec", "containers"}
+	desiredContainers, _, _ := unstructured.NestedSlice(desired.Object, containersPath...)
+	liveContainers, _, _ := unstructured.NestedSlice(live.Object, containersPath...)
+	changed := false
+	for _, d := range desiredContainers {
+		dc, _ := d.(map[string]interface{})
+		for _, l := range liveContainers {
+			lc, _ := l.(map[string]interface{})
+			if lc == nil || lc["name"] != dc["name"] {
+				continue
+			}
+			for _, field := range owned.containers {
+				if restoreField(dc, lc, []string{field}) {
+					drifted = append(drifted, fmt.Sprintf("%s of container %v", field, dc["name"]))
+					changed = true
+				}
+			}
+		}
+	}
+	if changed {
+		unstructured.SetNestedSlice(live.Object, liveContainers, containersPath...)
+	}
+	return drifted
+}
+
+// restoreField replaces the field at path in live with the one in desired unless live already holds it
+func restoreField(desired, live map[string]interface{}, path []string) bool {
+	want, found, _ := unstructured.NestedFieldNoCopy(desired, path...)
+	if !found {
+		return false
+	}
+	have, _, _ := unstructured.NestedFieldNoCopy(live, path...)
+	if holds(have, want) {
+		return false
+	}
+	unstructured.SetNestedField(live, runtime.DeepCopyJSONValue(want), path...)
+	return true
+}
+
+// mergeField sets the keys of the map at path in desired on the one in live, keeping the other keys of live
+func mergeField(desired, live map[string]interface{}, path []string) bool {
+	want, found, _ := unstructured.NestedMap(desired, path...)
+	if !found {
+		return false
+	}
+	have, _, _ := unstructured.NestedMap(live, path...)
+	if holds(have, want) {
+		return false
+	}
+	if have == nil {
+		have = map[string]interface{}{}
+	}
+	for k, v := range want {
+		have[k] = v
+	}
+	unstructured.SetNestedMap(live, have, path...)
+	return true
+}
+
+// holds reports whether have contains everything set in want. Fields only in have, such as the ones the api server
+// defaults, are ignored and scalars are compared by their printed value as numbers may be decoded differently
+func holds(have, want interface{}) bool {
+	switch w := want.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		h, _ := have.(map[string]interface{})
+		for k, v := range w {
+			if !holds(h[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		h, _ := have.([]interface{})
+		if len(h) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !holds(h[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return have != nil && fmt.Sprint(have) == fmt.Sprint(want)
+	}
+}
+
+// installedDatabaseCredentials are the database credentials the install objects were rendered with, preferring the
+// deployed Keycloak container over the stored secret and the database pods. It returns nil while none are available
+func (ph *phaseHandler) installedDatabaseCredentials(kc *v1alpha1.Keycloak, p platform) (*databaseCredentials, error) {
+	if kc.Spec.ExternalDatabase != nil {
+		return externalDatabaseCredentials(ph.k8sClient, kc)
+	}
+	creds, err := ph.deployedDatabaseCredentials(kc)
+	if err == nil {
+		return creds, nil
+	}
+	if !errors2.IsNotFound(errors.Cause(err)) {
+		return nil, err
+	}
+	if creds, err = ph.storedDatabaseCredentials(kc); creds != nil || err != nil {
+		return creds, err
+	}
+	return ph.bundledDatabaseCredentials(kc, p), nil
+}
+
+// storedDatabaseCredentials reads the database credentials reconcileDBPassword stored, nil when there are none
+func (ph *phaseHandler) storedDatabaseCredentials(kc *v1alpha1.Keycloak) (*databaseCredentials, error) {
+	secret, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(databaseSecretName(kc), v12.GetOptions{})
+	if errors2.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get db credentials secret")
+	}
+	if len(secret.Data["POSTGRES_USERNAME"]) == 0 || len(secret.Data["POSTGRES_PASSWORD"]) == 0 {
+		return nil, nil
+	}
+	return &databaseCredentials{
+		Username: string(secret.Data["POSTGRES_USERNAME"]),
+		Password: string(secret.Data["POSTGRES_PASSWORD"]),
+		Database: string(secret.Data["POSTGRES_DATABASE"]),
+		Host:     databaseHost(kc),
+		Port:     POSTGRES_PORT,
+	}, nil
+}
@@ -0,0 +1,226 @@
+package keycloak
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPhaseHandlerReconcileInstallObjects(t *testing.T) {
+	cases := []struct {
+		Name                string
+		Kind                string
+		Object              string
+		Overrides           []v1alpha1.KeycloakOverride
+		Drift               func(o *unstructured.Unstructured)
+		ExpectedCorrections []string
+		Validate            func(t *testing.T, o *unstructured.Unstructured)
+	}{
+		{
+			Name:   "Nothing drifted",
+			Kind:   "Service",
+			Object: SSO_APPLICATION_NAME,
+			Drift:  func(o *unstructured.Unstructured) {},
+		},
+		{
+			Name:                "Missing service",
+			Kind:                "Service",
+			Object:              SSO_APPLICATION_NAME + "-ping",
+			ExpectedCorrections: []string{"recreated Service/sso-ping"},
+		},
+		{
+			Name:   "Drifted service ports and labels",
+			Kind:   "Service",
+			Object: SSO_APPLICATION_NAME,
+			Drift: func(o *unstructured.Unstructured) {
+				unstructured.SetNestedSlice(o.Object, []interface{}{map[string]interface{}{"name": "sso", "port": int64(80)}}, "spec", "ports")
+				o.SetLabels(map[string]string{"application": "other", "team": "identity"})
+			},
+			ExpectedCorrections: []string{"restored metadata.labels, spec.ports of Service/sso"},
+			Validate: func(t *testing.T, o *unstructured.Unstructured) {
+				if labels := o.GetLabels(); labels["application"] != SSO_APPLICATION_NAME || labels["team"] != "identity" {
+					t.Fatalf("expected the owned label to be restored and the others kept, got %v", labels)
+				}
+				ports, _, _ := unstructured.NestedSlice(o.Object, "spec", "ports")
+				if len(ports) != 1 || !holds(ports[0], map[string]interface{}{"port": SSO_HTTP_PORT}) {
+					t.Fatalf("expected the ports to be restored, got %v", ports)
+				}
+			},
+		},
+		{
+			Name:   "Fields the operator does not own",
+			Kind:   "Deployment",
+			Object: SSO_APPLICATION_NAME,
+			Drift: func(o *unstructured.Unstructured) {
+				unstructured.SetNestedField(o.Object, int64(3), "spec", "replicas")
+				unstructured.SetNestedField(o.Object, "false", "metadata", "annotations", "sidecar.istio.io/inject")
+			},
+			Validate: func(t *testing.T, o *unstructured.Unstructured) {
+				if replicas, _, _ := unstructured.NestedInt64(o.Object, "spec", "replicas"); replicas != 3 {
+					t.Fatalf("expected the replicas to be left alone, got %d", replicas)
+				}
+				if o.GetAnnotations()["sidecar.istio.io/inject"] != "false" {
+					t.Fatalf("expected the annotations to be left alone, got %v", o.GetAnnotations())
+				}
+			},
+		},
+		{
+			Name:   "Drifted probe",
+			Kind:   "Deployment",
+			Object: SSO_APPLICATION_NAME,
+			Drift: func(o *unstructured.Unstructured) {
+				containers, _, _ := unstructured.NestedSlice(o.Object, "spec", "template", "spec", "containers")
+				for _, c := range containers {
+					delete(c.(map[string]interface{}), "readinessProbe")
+				}
+				unstructured.SetNestedSlice(o.Object, containers, "spec", "template", "spec", "containers")
+			},
+			ExpectedCorrections: []string{"restored readinessProbe of container sso of Deployment/sso"},
+		},
+		{
+			Name:   "Drifted strategic merge override",
+			Kind:   "Service",
+			Object: SSO_APPLICATION_NAME,
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "Service", Name: SSO_APPLICATION_NAME, Patch: "spec:\n  sessionAffinity: ClientIP\n"},
+			},
+			Drift: func(o *unstructured.Unstructured) {
+				unstructured.SetNestedField(o.Object, "None", "spec", "sessionAffinity")
+			},
+			ExpectedCorrections: []string{"restored overrides of Service/sso"},
+			Validate: func(t *testing.T, o *unstructured.Unstructured) {
+				if affinity, _, _ := unstructured.NestedString(o.Object, "spec", "sessionAffinity"); affinity != "ClientIP" {
+					t.Fatalf("expected the override to be applied again, got %s", affinity)
+				}
+			},
+		},
+		{
+			Name:   "JSON patch override applied once",
+			Kind:   "Service",
+			Object: SSO_APPLICATION_NAME,
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "Service", Name: SSO_APPLICATION_NAME, Type: "json", Patch: `[{"op": "add", "path": "/spec/externalIPs", "value": ["10.0.0.1"]}]`},
+			},
+			Drift: func(o *unstructured.Unstructured) {
+				unstructured.RemoveNestedField(o.Object, "spec", "externalIPs")
+			},
+			Validate: func(t *testing.T, o *unstructured.Unstructured) {
+				if ips, found, _ := unstructured.NestedStringSlice(o.Object, "spec", "externalIPs"); found {
+					t.Fatalf("expected the json patch not to be applied to the live object again, got %v", ips)
+				}
+			},
+		},
+		{
+			Name:   "Removed override",
+			Kind:   "Service",
+			Object: SSO_APPLICATION_NAME,
+			Drift: func(o *unstructured.Unstructured) {
+				unstructured.SetNestedField(o.Object, "ClientIP", "spec", "sessionAffinity")
+				unstructured.SetNestedField(o.Object, "previous", "metadata", "annotations", overridesAnnotation)
+			},
+			ExpectedCorrections: []string{"restored overrides of Service/sso"},
+			Validate: func(t *testing.T, o *unstructured.Unstructured) {
+				if _, ok := o.GetAnnotations()[overridesAnnotation]; ok {
+					t.Fatalf("expected the checksum of the removed overrides to be dropped, got %v", o.GetAnnotations())
+				}
+				if affinity, _, _ := unstructured.NestedString(o.Object, "spec", "sessionAffinity"); affinity != "ClientIP" {
+					t.Fatalf("expected the fields patched by the removed override to be left alone, got %s", affinity)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(externalDatabaseSecret(), &corev1.Secret{
+				ObjectMeta: v12.ObjectMeta{Name: "credential-keycloak", Namespace: "test-namespace"},
+				Data:       map[string][]byte{"SSO_ADMIN_USERNAME": []byte("admin")},
+			})
+			resources := newFakeResourceClients()
+			ph := NewPhaseHandler(k8sClient, nil, nil, resources.Factory)
+			kc := externalDatabaseKeycloak(nil)
+			kc.Spec.Overrides = tc.Overrides
+			kc, err := ph.ProvisionApplication(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			client, _, _ := resources.Factory("", tc.Kind, "test-namespace")
+			if tc.Drift == nil {
+				if err := client.Delete(tc.Object, nil); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else {
+				o := resources.Get(tc.Kind, tc.Object)
+				tc.Drift(o)
+				if _, err := client.Update(o); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			kc, err = ph.reconcileInstallObjects(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(kc.Status.Corrections, tc.ExpectedCorrections) {
+				t.Fatalf("expected the corrections %v, got %v", tc.ExpectedCorrections, kc.Status.Corrections)
+			}
+			if (kc.Status.LastCorrected != nil) != (len(tc.ExpectedCorrections) > 0) {
+				t.Fatalf("expected the last correction to be recorded only when something was corrected, got %v", kc.Status.LastCorrected)
+			}
+			o := resources.Get(tc.Kind, tc.Object)
+			if o == nil {
+				t.Fatalf("expected %s/%s to exist, got %v", tc.Kind, tc.Object, resources.Names())
+			}
+			if tc.Validate != nil {
+				tc.Validate(t, o)
+			}
+
+			lastCorrected := kc.Status.LastCorrected
+			if kc, err = ph.reconcileInstallObjects(kc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(kc.Status.Corrections) != 0 || !reflect.DeepEqual(kc.Status.LastCorrected, lastCorrected) {
+				t.Fatalf("expected a clean pass to clear the corrections and keep when they were made, got %v at %v", kc.Status.Corrections, kc.Status.LastCorrected)
+			}
+		})
+	}
+}
+
+func TestRestoreOwnedFieldsGenerated(t *testing.T) {
+	cases := []struct {
+		Name        string
+		DesiredHost string
+		ExpectHost  string
+	}{
+		{
+			Name:       "Host generated by the cluster is kept",
+			ExpectHost: "sso-test-namespace.apps.example.com",
+		},
+		{
+			Name:        "Host set by the operator is restored",
+			DesiredHost: "sso.example.com",
+			ExpectHost:  "sso.example.com",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			route := func(host string) *unstructured.Unstructured {
+				return &unstructured.Unstructured{Object: map[string]interface{}{
+					"kind": "Route",
+					"spec": map[string]interface{}{"host": host, "to": map[string]interface{}{"name": SSO_APPLICATION_NAME}},
+				}}
+			}
+			live := route("sso-test-namespace.apps.example.com")
+			restoreOwnedFields(route(tc.DesiredHost), live)
+			if host, _, _ := unstructured.NestedString(live.Object, "spec", "host"); host != tc.ExpectHost {
+				t.Fatalf("expected the host %s, got %s", tc.ExpectHost, host)
+			}
+		})
+	}
+}
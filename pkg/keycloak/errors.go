@@ -0,0 +1,94 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// APIError is returned by Client when the Keycloak admin API answers with an unexpected status code
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Body is the raw error body returned by Keycloak
+	Body string
+	// Message is the error message extracted from Body, if Keycloak sent one
+	Message string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s %s failed: (%d) %s", e.Method, e.Path, e.StatusCode, msg)
+}
+
+// keycloakErrorBody covers the error representations used by the admin and token endpoints
+type keycloakErrorBody struct {
+	ErrorMessage     string `json:"errorMessage"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// newAPIError builds an APIError from a Keycloak response, consuming its body
+func newAPIError(res *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+	}
+	if res.Request != nil {
+		apiErr.Method = res.Request.Method
+		apiErr.Path = res.Request.URL.Path
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return apiErr
+	}
+	apiErr.Body = string(body)
+
+	errBody := keycloakErrorBody{}
+	if err := json.Unmarshal(body, &errBody); err == nil {
+		switch {
+		case errBody.ErrorMessage != "":
+			apiErr.Message = errBody.ErrorMessage
+		case errBody.ErrorDescription != "":
+			apiErr.Message = errBody.ErrorDescription
+		default:
+			apiErr.Message = errBody.Error
+		}
+	}
+	return apiErr
+}
+
+// AsAPIError returns the APIError wrapped by err, if there is one
+func AsAPIError(err error) (*APIError, bool) {
+	if err == nil {
+		return nil, false
+	}
+	apiErr, ok := errors.Cause(err).(*APIError)
+	return apiErr, ok
+}
+
+func hasStatus(err error, status int) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode == status
+}
+
+// IsNotFound returns true if err is a Keycloak API 404 response
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict returns true if err is a Keycloak API 409 response, e.g. the resource already exists
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsUnauthorized returns true if err is a Keycloak API 401 response
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
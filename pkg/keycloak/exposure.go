@@ -0,0 +1,160 @@
+package keycloak
+
+import (
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const ssoHostnameEnv = "SSO_HOSTNAME"
+
+// applyExposure sets the hostname and TLS of the exposure of kc on the route or ingress in objects and the hostname on
+// the Keycloak container. The certificate is copied into the route, so rendering again picks up a renewed secret
+func (ph *phaseHandler) applyExposure(kc *v1alpha1.Keycloak, objects []runtime.Object) error {
+	exposure := kc.Spec.Exposure
+	if exposure == nil {
+		return nil
+	}
+	var cert *v1.Secret
+	if exposure.TLS != nil && exposure.TLS.Secret != "" {
+		var err error
+		cert, err = ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(exposure.TLS.Secret, v12.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the certificate secret %s", exposure.TLS.Secret)
+		}
+	}
+	for _, o := range objects {
+		if objectName(o) != applicationName(kc) {
+			continue
+		}
+		switch w := o.(type) {
+		case *routev1.Route:
+			if err := exposeRoute(w, exposure, cert); err != nil {
+				return err
+			}
+		case *extv1beta1.Ingress:
+			if err := exposeIngress(w, exposure, cert); err != nil {
+				return err
+			}
+		}
+		if container := workloadContainer(o, applicationName(kc)); container != nil && exposure.Hostname != "" {
+			setEnv(container, ssoHostnameEnv, exposure.Hostname)
+		}
+	}
+	return nil
+}
+
+// exposeRoute sets the host and TLS of route. The Keycloak service only serves https, so the route either
+// re-encrypts or passes the traffic through
+func exposeRoute(route *routev1.Route, exposure *v1alpha1.KeycloakExposureSpec, cert *v1.Secret) error {
+	if exposure.Hostname != "" {
+		route.Spec.Host = exposure.Hostname
+	}
+	if exposure.TLS == nil {
+		return nil
+	}
+	termination := routev1.TLSTerminationType(exposure.TLS.Termination)
+	switch termination {
+	case "":
+		termination = routev1.TLSTerminationReencrypt
+	case routev1.TLSTerminationEdge:
+		return errors.New("a route can't use edge termination, the keycloak service only serves https")
+	}
+	route.Spec.TLS = &routev1.TLSConfig{Termination: termination}
+	if cert == nil {
+		return nil
+	}
+	route.Spec.TLS.Certificate = string(cert.Data[v1.TLSCertKey])
+	route.Spec.TLS.Key = string(cert.Data[v1.TLSPrivateKeyKey])
+	route.Spec.TLS.CACertificate = string(cert.Data["ca.crt"])
+	if route.Spec.TLS.Certificate == "" || route.Spec.TLS.Key == "" {
+		return errors.Errorf("the certificate secret %s requires the %s and %s keys", cert.Name, v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+	return nil
+}
+
+// exposeIngress routes the hostname to the Keycloak service and terminates TLS with the certificate secret, the
+// ingress controller picks up a renewed secret by itself
+func exposeIngress(ingress *extv1beta1.Ingress, exposure *v1alpha1.KeycloakExposureSpec, cert *v1.Secret) error {
+	if tls := exposure.TLS; tls != nil && tls.Termination != "" && tls.Termination != string(routev1.TLSTerminationEdge) {
+		return errors.Errorf("an ingress only supports edge termination, got %s", tls.Termination)
+	}
+	hosts := []string{}
+	if exposure.Hostname != "" {
+		hosts = append(hosts, exposure.Hostname)
+		ingress.Spec.Rules = []extv1beta1.IngressRule{{
+			Host: exposure.Hostname,
+			IngressRuleValue: extv1beta1.IngressRuleValue{HTTP: &extv1beta1.HTTPIngressRuleValue{
+				Paths: []extv1beta1.HTTPIngressPath{{Backend: *ingress.Spec.Backend}},
+			}},
+		}}
+	}
+	if cert != nil {
+		ingress.Spec.TLS = []extv1beta1.IngressTLS{{Hosts: hosts, SecretName: cert.Name}}
+	}
+	return nil
+}
+
+// reconcileExposure keeps SSO_HOSTNAME of the Keycloak workload on the hostname of the spec and SSO_ADMIN_URL of the
+// admin credentials on the URL the instance is exposed on. The route and ingress are kept in sync by
+// reconcileInstallObjects
+func (ph *phaseHandler) reconcileExposure(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	p, err := ph.platformFor(sso)
+	if err != nil {
+		return sso, err
+	}
+	if exposure := sso.Spec.Exposure; exposure != nil && exposure.Hostname != "" {
+		application, _, err := p.Workloads(sso)
+		if err != nil {
+			return sso, err
+		}
+		container := workloadContainer(application.object, applicationName(sso))
+		if container != nil && !restoring(application.object) && envVar(container, ssoHostnameEnv) != exposure.Hostname {
+			if !application.rolledOut {
+				logrus.Infof("waiting for the previous rollout of %s to finish before setting its hostname", objectName(application.object))
+			} else {
+				setEnv(container, ssoHostnameEnv, exposure.Hostname)
+				if err := application.update(); err != nil {
+					return sso, errors.Wrapf(err, "failed to set the hostname of %s", objectName(application.object))
+				}
+			}
+		}
+	}
+
+	url, err := p.AdminURL(sso)
+	if err != nil || url == "" {
+		return sso, errors.Wrap(err, "could not get the admin url")
+	}
+	secrets := ph.k8sClient.CoreV1().Secrets(sso.Namespace)
+	secret, err := secrets.Get(sso.Spec.AdminCredentials, v12.GetOptions{})
+	if err != nil {
+		return sso, errors.Wrap(err, "could not retrieve admin secret")
+	}
+	if string(secret.Data["SSO_ADMIN_URL"]) == url {
+		return sso, nil
+	}
+	logrus.Infof("keycloak %s/%s is now exposed on %s", sso.Namespace, sso.Name, url)
+	secret.Data["SSO_ADMIN_URL"] = []byte(url)
+	if _, err := secrets.Update(secret); err != nil {
+		return sso, errors.Wrap(err, "could not update admin credentials")
+	}
+	// the cached client still talks to the previous url
+	if ph.kcClientFactory != nil {
+		ph.kcClientFactory.Invalidate(*sso)
+	}
+	return sso, nil
+}
+
+func envVar(container *v1.Container, name string) string {
+	for _, e := range container.Env {
+		if e.Name == name {
+			return e.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package keycloak
+
+import (
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyExposure(t *testing.T) {
+	cases := []struct {
+		Name           string
+		Exposure       *v1alpha1.KeycloakExposureSpec
+		Ingress        bool
+		ExpectError    bool
+		ExpectHost     string
+		ExpectTLS      string
+		ExpectHostname string
+	}{
+		{
+			Name:      "No exposure keeps the rendered route",
+			ExpectTLS: "reencrypt",
+		},
+		{
+			Name:           "Route with a hostname and certificate",
+			Exposure:       &v1alpha1.KeycloakExposureSpec{Hostname: "sso.example.com", TLS: &v1alpha1.KeycloakExposureTLS{Secret: "sso-cert"}},
+			ExpectHost:     "sso.example.com",
+			ExpectTLS:      "reencrypt",
+			ExpectHostname: "sso.example.com",
+		},
+		{
+			Name:      "Route passing TLS through",
+			Exposure:  &v1alpha1.KeycloakExposureSpec{TLS: &v1alpha1.KeycloakExposureTLS{Termination: "passthrough"}},
+			ExpectTLS: "passthrough",
+		},
+		{
+			Name:        "Route terminating at the edge",
+			Exposure:    &v1alpha1.KeycloakExposureSpec{TLS: &v1alpha1.KeycloakExposureTLS{Termination: "edge"}},
+			ExpectError: true,
+		},
+		{
+			Name:        "Missing certificate secret",
+			Exposure:    &v1alpha1.KeycloakExposureSpec{TLS: &v1alpha1.KeycloakExposureTLS{Secret: "missing"}},
+			ExpectError: true,
+		},
+		{
+			Name:           "Ingress with a hostname and certificate",
+			Exposure:       &v1alpha1.KeycloakExposureSpec{Hostname: "sso.example.com", TLS: &v1alpha1.KeycloakExposureTLS{Secret: "sso-cert"}},
+			Ingress:        true,
+			ExpectHost:     "sso.example.com",
+			ExpectTLS:      "sso-cert",
+			ExpectHostname: "sso.example.com",
+		},
+		{
+			Name:        "Ingress re-encrypting",
+			Exposure:    &v1alpha1.KeycloakExposureSpec{TLS: &v1alpha1.KeycloakExposureTLS{Termination: "reencrypt"}},
+			Ingress:     true,
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+				Spec:       v1alpha1.KeycloakSpec{Exposure: tc.Exposure},
+			}
+			k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: v12.ObjectMeta{Name: "sso-cert", Namespace: "test-namespace"},
+				Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+			})
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+			deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+			route := &routev1.Route{
+				ObjectMeta: v12.ObjectMeta{Name: SSO_APPLICATION_NAME},
+				Spec: routev1.RouteSpec{
+					To:  routev1.RouteTargetReference{Name: SSO_APPLICATION_NAME},
+					TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationReencrypt},
+				},
+			}
+			ingress := kubernetesIngress(kc)
+			objects := []runtime.Object{deployment, route}
+			if tc.Ingress {
+				objects = []runtime.Object{deployment, ingress}
+			}
+
+			err := ph.applyExposure(kc, objects)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hostname := envVar(workloadContainer(deployment, SSO_APPLICATION_NAME), ssoHostnameEnv); hostname != tc.ExpectHostname {
+				t.Fatalf("expected %s to be '%s', got '%s'", ssoHostnameEnv, tc.ExpectHostname, hostname)
+			}
+			if tc.Ingress {
+				if len(ingress.Spec.Rules) != 1 || ingress.Spec.Rules[0].Host != tc.ExpectHost {
+					t.Fatalf("expected a rule for %s, got %v", tc.ExpectHost, ingress.Spec.Rules)
+				}
+				if len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].SecretName != tc.ExpectTLS || ingress.Spec.TLS[0].Hosts[0] != tc.ExpectHost {
+					t.Fatalf("expected tls for %s with %s, got %v", tc.ExpectHost, tc.ExpectTLS, ingress.Spec.TLS)
+				}
+				return
+			}
+			if route.Spec.Host != tc.ExpectHost || string(route.Spec.TLS.Termination) != tc.ExpectTLS {
+				t.Fatalf("expected the host '%s' with %s termination, got %v", tc.ExpectHost, tc.ExpectTLS, route.Spec)
+			}
+			if certificate := tc.Exposure != nil && tc.Exposure.TLS != nil && tc.Exposure.TLS.Secret != ""; certificate != (route.Spec.TLS.Certificate == "cert" && route.Spec.TLS.Key == "key") {
+				t.Fatalf("expected the certificate to be copied into the route: %v, got %v", certificate, route.Spec.TLS)
+			}
+		})
+	}
+}
+
+func TestPhaseHandlerReconcileExposure(t *testing.T) {
+	kc := &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+		Spec: v1alpha1.KeycloakSpec{
+			AdminCredentials: "credential-keycloak",
+			Exposure:         &v1alpha1.KeycloakExposureSpec{Hostname: "sso.example.com", TLS: &v1alpha1.KeycloakExposureTLS{Secret: "sso-cert"}},
+		},
+		Status: v1alpha1.KeycloakStatus{Platform: v1alpha1.PlatformKubernetes},
+	}
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{"SSO_HOSTNAME": "old.example.com"})
+	deployment.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1}
+	ingress := kubernetesIngress(kc)
+	if err := exposeIngress(ingress, kc.Spec.Exposure, &corev1.Secret{ObjectMeta: v12.ObjectMeta{Name: "sso-cert"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k8sClient := fake.NewSimpleClientset(deployment, ingress, &corev1.Secret{
+		ObjectMeta: v12.ObjectMeta{Name: "credential-keycloak", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"SSO_ADMIN_URL": []byte("https://old.example.com")},
+	})
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+	factory := &KeycloakClientFactoryMock{InvalidateFunc: func(kc v1alpha1.Keycloak) {}}
+	ph.kcClientFactory = factory
+
+	if _, err := ph.reconcileExposure(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployment, _ = k8sClient.AppsV1().Deployments("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+	if hostname := envVar(workloadContainer(deployment, SSO_APPLICATION_NAME), ssoHostnameEnv); hostname != "sso.example.com" {
+		t.Fatalf("expected %s to follow the hostname, got %s", ssoHostnameEnv, hostname)
+	}
+	secret, _ := k8sClient.CoreV1().Secrets("test-namespace").Get("credential-keycloak", v12.GetOptions{})
+	if url := string(secret.Data["SSO_ADMIN_URL"]); url != "https://sso.example.com" {
+		t.Fatalf("expected the admin url to follow the hostname, got %s", url)
+	}
+	if len(factory.InvalidateCalls()) != 1 {
+		t.Fatalf("expected the cached client to be invalidated once, got %d", len(factory.InvalidateCalls()))
+	}
+}
@@ -0,0 +1,227 @@
+package keycloak
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// extensionsVolume is where the extensions are staged before they are verified and installed, the ConfigMap
+	// volumes of the extensions are named after it
+	extensionsVolume          = "sso-extensions"
+	extensionsPath            = "/opt/extensions"
+	extensionsConfigMapsPath  = "/opt/extension-configmaps"
+	extensionsInstallerSuffix = "-extensions"
+)
+
+// applyExtensions sets the init containers and volumes fetching the extensions of kc on the Keycloak workload o and
+// returns whether anything changed. The installer runs the Keycloak image, which has curl, sha256sum and unzip, and
+// keeps the image it was created with so an upgrade doesn't roll the pods twice
+func applyExtensions(kc *v1alpha1.Keycloak, o runtime.Object) bool {
+	if objectName(o) != applicationName(kc) {
+		return false
+	}
+	podSpec := workloadPodSpec(o)
+	container := workloadContainer(o, applicationName(kc))
+	if podSpec == nil || container == nil {
+		return false
+	}
+	before := podSpec.DeepCopy()
+	installerName := applicationName(kc) + extensionsInstallerSuffix
+	installerImage := container.Image
+	initContainers := []v1.Container{}
+	for _, c := range podSpec.InitContainers {
+		if c.Name == installerName {
+			installerImage = c.Image
+		}
+		if !strings.HasPrefix(c.Name, installerName) && !strings.HasPrefix(c.Name, extensionContainerName(kc, "")) {
+			initContainers = append(initContainers, c)
+		}
+	}
+	volumes := []v1.Volume{}
+	for _, v := range podSpec.Volumes {
+		if !strings.HasPrefix(v.Name, extensionsVolume) {
+			volumes = append(volumes, v)
+		}
+	}
+
+	if extensions := kc.Spec.Extensions; len(extensions) > 0 {
+		mutator := newTemplateMutator()
+		staging := v1.VolumeMount{Name: extensionsVolume, MountPath: extensionsPath}
+		installer := v1.Container{
+			Name:    installerName,
+			Image:   installerImage,
+			Command: []string{"/bin/sh", "-c", extensionsScript(extensions)},
+			VolumeMounts: []v1.VolumeMount{
+				staging,
+				{Name: mutator.PluginsVolumeInfo.VolumeName, MountPath: mutator.PluginsVolumeInfo.InitVolumeMount},
+				{Name: mutator.ThemesVolumeInfo.VolumeName, MountPath: mutator.ThemesVolumeInfo.InitVolumeMount},
+			},
+		}
+		volumes = append(volumes, v1.Volume{Name: extensionsVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+		for _, e := range extensions {
+			switch {
+			case e.ConfigMap != nil:
+				name := extensionsVolume + "-" + e.Name
+				volumes = append(volumes, v1.Volume{Name: name, VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: e.ConfigMap.Name},
+					Items:                []v1.KeyToPath{{Key: e.ConfigMap.Key, Path: e.ConfigMap.Key}},
+				}}})
+				installer.VolumeMounts = append(installer.VolumeMounts, v1.VolumeMount{
+					Name:      name,
+					MountPath: path.Join(extensionsConfigMapsPath, e.Name),
+					ReadOnly:  true,
+				})
+			case e.Image != nil:
+				initContainers = append(initContainers, v1.Container{
+					Name:         extensionContainerName(kc, e.Name),
+					Image:        e.Image.Image,
+					Command:      []string{"/bin/sh", "-c", fmt.Sprintf("cp %s %s", shellQuote(e.Image.Path), shellQuote(path.Join(extensionsPath, e.Name)))},
+					VolumeMounts: []v1.VolumeMount{staging},
+				})
+			}
+		}
+		initContainers = append(initContainers, installer)
+	}
+
+	podSpec.InitContainers = initContainers
+	podSpec.Volumes = volumes
+	return !reflect.DeepEqual(before, podSpec)
+}
+
+// extensionContainerName is the init container copying the extension name out of its image
+func extensionContainerName(kc *v1alpha1.Keycloak, name string) string {
+	return applicationName(kc) + "-extension-" + name
+}
+
+// extensionsScript downloads or copies the extensions into the staging directory, verifies their checksums and
+// installs the plugins as jars and unpacks the themes. Any failure fails the init container and keeps the pod from
+// starting
+func extensionsScript(extensions []v1alpha1.KeycloakExtension) string {
+	mutator := newTemplateMutator()
+	lines := []string{"set -e"}
+	for _, e := range extensions {
+		file := shellQuote(path.Join(extensionsPath, e.Name))
+		switch {
+		case e.URL != "":
+			lines = append(lines, fmt.Sprintf("curl -fsSL -o %s %s", file, shellQuote(e.URL)))
+		case e.ConfigMap != nil:
+			lines = append(lines, fmt.Sprintf("cp %s %s", shellQuote(path.Join(extensionsConfigMapsPath, e.Name, e.ConfigMap.Key)), file))
+		}
+		if e.SHA256 != "" {
+			lines = append(lines, fmt.Sprintf("echo %s | sha256sum -c -", shellQuote(e.SHA256+"  "+path.Join(extensionsPath, e.Name))))
+		}
+		switch e.Type {
+		case v1alpha1.ExtensionPlugin:
+			lines = append(lines, fmt.Sprintf("cp %s %s", file, shellQuote(path.Join(mutator.PluginsVolumeInfo.InitVolumeMount, e.Name+".jar"))))
+		case v1alpha1.ExtensionTheme:
+			dir := shellQuote(path.Join(mutator.ThemesVolumeInfo.InitVolumeMount, e.Name))
+			lines = append(lines, fmt.Sprintf("mkdir -p %s", dir), fmt.Sprintf("unzip -oq %s -d %s", file, dir))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// reconcileExtensions rolls the Keycloak pods onto changed extensions one pod at a time and reports the extensions
+// in the status once the pods loading them rolled out
+func (ph *phaseHandler) reconcileExtensions(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return kc, err
+	}
+	application, _, err := p.Workloads(kc)
+	if err != nil {
+		return kc, err
+	}
+	name := objectName(application.object)
+	if restoring(application.object) || kc.Status.Upgrade != nil {
+		logrus.Infof("not applying the extensions to %s while it is restored or upgraded", name)
+		return kc, nil
+	}
+	if applyExtensions(kc, application.object) {
+		if !application.rolledOut {
+			logrus.Infof("waiting for the previous rollout of %s to finish before applying the extensions", name)
+			return kc, nil
+		}
+		logrus.Infof("rolling the extensions out to %s", name)
+		rollingUpdate(application.object)
+		return kc, errors.Wrapf(application.update(), "failed to update the extensions of %s", name)
+	}
+	if !application.rolledOut {
+		return kc, nil
+	}
+	if len(kc.Spec.Extensions) == 0 {
+		kc.Status.Extensions = nil
+		return kc, nil
+	}
+	if ph.kcClientFactory == nil {
+		return kc, errors.New("no keycloak client factory to check the loaded extensions with")
+	}
+	client, err := ph.kcClientFactory.AuthenticatedClient(*kc)
+	if err != nil {
+		return kc, errors.Wrap(err, "failed to log in to check the loaded extensions")
+	}
+	info, err := client.GetServerInfo()
+	if err != nil {
+		return kc, errors.Wrap(err, "failed to read the loaded extensions from the serverinfo")
+	}
+	kc.Status.Extensions = extensionStatuses(kc.Spec.Extensions, info)
+	return kc, nil
+}
+
+// extensionStatuses reports a theme loaded when the server lists a theme of its name, and a plugin when the server
+// lists all its providers. A plugin without providers can't be checked and is never reported loaded
+func extensionStatuses(extensions []v1alpha1.KeycloakExtension, info *v1alpha1.KeycloakServerInfo) []v1alpha1.KeycloakExtensionStatus {
+	themes := map[string]bool{}
+	for _, names := range info.Themes {
+		for _, name := range names {
+			themes[name] = true
+		}
+	}
+	providers := map[string]bool{}
+	for _, ids := range info.Providers {
+		for _, id := range ids {
+			providers[id] = true
+		}
+	}
+
+	statuses := []v1alpha1.KeycloakExtensionStatus{}
+	for _, e := range extensions {
+		status := v1alpha1.KeycloakExtensionStatus{
+			Name:    e.Name,
+			Type:    e.Type,
+			Version: e.Version,
+			SHA256:  e.SHA256,
+		}
+		missing := []string{}
+		for _, id := range e.Providers {
+			if !providers[id] {
+				missing = append(missing, id)
+			}
+		}
+		switch {
+		case e.Type == v1alpha1.ExtensionTheme && !themes[e.Name]:
+			status.Message = fmt.Sprintf("the server didn't load a theme named %s", e.Name)
+		case e.Type == v1alpha1.ExtensionPlugin && len(e.Providers) == 0:
+			status.Message = "list the providers of the plugin to check that the server loaded it"
+		case len(missing) > 0:
+			status.Message = fmt.Sprintf("the server didn't load the providers %s", strings.Join(missing, ", "))
+		}
+		status.Loaded = status.Message == ""
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
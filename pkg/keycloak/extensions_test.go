@@ -0,0 +1,249 @@
+package keycloak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const themeChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestApplyExtensions(t *testing.T) {
+	cases := []struct {
+		Name             string
+		Extensions       []v1alpha1.KeycloakExtension
+		ExpectInit       []string
+		ExpectVolumes    []string
+		ExpectScript     []string
+		ExpectNoInstalls bool
+	}{
+		{
+			Name:             "No extensions",
+			ExpectInit:       []string{"sso-plugins-init"},
+			ExpectNoInstalls: true,
+		},
+		{
+			Name: "Plugin from a url",
+			Extensions: []v1alpha1.KeycloakExtension{
+				{Name: "metrics", Type: v1alpha1.ExtensionPlugin, URL: "https://example.com/metrics.jar", SHA256: themeChecksum},
+			},
+			ExpectInit:    []string{"sso-plugins-init", "sso-extensions"},
+			ExpectVolumes: []string{extensionsVolume},
+			ExpectScript: []string{
+				"curl -fsSL -o '/opt/extensions/metrics' 'https://example.com/metrics.jar'",
+				"echo '" + themeChecksum + "  /opt/extensions/metrics' | sha256sum -c -",
+				"cp '/opt/extensions/metrics' '/opt/plugins/metrics.jar'",
+			},
+		},
+		{
+			Name: "Theme from a config map and plugin from an image",
+			Extensions: []v1alpha1.KeycloakExtension{
+				{Name: "branding", Type: v1alpha1.ExtensionTheme, ConfigMap: &v1alpha1.KeycloakExtensionConfigMap{Name: "themes", Key: "branding.zip"}},
+				{Name: "events", Type: v1alpha1.ExtensionPlugin, Image: &v1alpha1.KeycloakExtensionImage{Image: "example.com/events:1.2", Path: "/plugins/events.jar"}},
+			},
+			ExpectInit:    []string{"sso-plugins-init", "sso-extension-events", "sso-extensions"},
+			ExpectVolumes: []string{extensionsVolume, extensionsVolume + "-branding"},
+			ExpectScript: []string{
+				"cp '/opt/extension-configmaps/branding/branding.zip' '/opt/extensions/branding'",
+				"unzip -oq '/opt/extensions/branding' -d '/opt/themes/branding'",
+				"cp '/opt/extensions/events' '/opt/plugins/events.jar'",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+				Spec:       v1alpha1.KeycloakSpec{Extensions: tc.Extensions},
+			}
+			deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+			changed := applyExtensions(kc, deployment)
+			if changed == tc.ExpectNoInstalls {
+				t.Fatalf("expected the deployment to change: %v", !tc.ExpectNoInstalls)
+			}
+			podSpec := deployment.Spec.Template.Spec
+			names := []string{}
+			for _, c := range podSpec.InitContainers {
+				names = append(names, c.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tc.ExpectInit, ",") {
+				t.Fatalf("expected the init containers %v, got %v", tc.ExpectInit, names)
+			}
+			for _, name := range tc.ExpectVolumes {
+				found := false
+				for _, v := range podSpec.Volumes {
+					found = found || v.Name == name
+				}
+				if !found {
+					t.Fatalf("expected the volume %s, got %v", name, podSpec.Volumes)
+				}
+			}
+			if !tc.ExpectNoInstalls {
+				script := podSpec.InitContainers[len(podSpec.InitContainers)-1].Command[2]
+				for _, line := range tc.ExpectScript {
+					if !strings.Contains(script, line) {
+						t.Fatalf("expected the script to contain %s, got %s", line, script)
+					}
+				}
+			}
+			if applyExtensions(kc, deployment) {
+				t.Fatal("expected applying the same extensions twice to leave the deployment unchanged")
+			}
+
+			kc.Spec.Extensions = nil
+			applyExtensions(kc, deployment)
+			if len(deployment.Spec.Template.Spec.InitContainers) != 1 {
+				t.Fatalf("expected removing the extensions to remove their init containers, got %v", deployment.Spec.Template.Spec.InitContainers)
+			}
+			for _, v := range deployment.Spec.Template.Spec.Volumes {
+				if strings.HasPrefix(v.Name, extensionsVolume) {
+					t.Fatalf("expected removing the extensions to remove their volumes, got %s", v.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestPhaseHandlerReconcileExtensions(t *testing.T) {
+	cases := []struct {
+		Name          string
+		Applied       bool
+		RolledOut     bool
+		Themes        []string
+		ExpectUpdate  bool
+		ExpectStatus  bool
+		ExpectLoaded  bool
+		ExpectRolling bool
+	}{
+		{
+			Name:          "Changed extensions roll out",
+			RolledOut:     true,
+			ExpectUpdate:  true,
+			ExpectRolling: true,
+		},
+		{
+			Name: "Previous rollout still running",
+		},
+		{
+			Name:         "Extensions loaded",
+			Applied:      true,
+			RolledOut:    true,
+			Themes:       []string{"keycloak", "branding"},
+			ExpectStatus: true,
+			ExpectLoaded: true,
+		},
+		{
+			Name:         "Theme missing from the serverinfo",
+			Applied:      true,
+			RolledOut:    true,
+			Themes:       []string{"keycloak"},
+			ExpectStatus: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+				Spec: v1alpha1.KeycloakSpec{Extensions: []v1alpha1.KeycloakExtension{
+					{Name: "branding", Type: v1alpha1.ExtensionTheme, Version: "2.0", URL: "https://example.com/branding.zip", SHA256: themeChecksum},
+				}},
+				Status: v1alpha1.KeycloakStatus{Platform: v1alpha1.PlatformKubernetes},
+			}
+			deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+			if tc.Applied {
+				applyExtensions(kc, deployment)
+			}
+			if tc.RolledOut {
+				deployment.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1}
+			}
+			k8sClient := fake.NewSimpleClientset(deployment)
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+			ph.kcClientFactory = &KeycloakClientFactoryMock{
+				AuthenticatedClientFunc: func(kc v1alpha1.Keycloak) (KeycloakInterface, error) {
+					return &KeycloakInterfaceMock{
+						GetServerInfoFunc: func() (*v1alpha1.KeycloakServerInfo, error) {
+							return &v1alpha1.KeycloakServerInfo{Themes: map[string][]string{"login": tc.Themes}}, nil
+						},
+					}, nil
+				},
+			}
+
+			kc, err := ph.reconcileExtensions(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			deployment, _ = k8sClient.AppsV1().Deployments("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+			updated := len(deployment.Spec.Template.Spec.InitContainers) == 2
+			if updated != (tc.ExpectUpdate || tc.Applied) {
+				t.Fatalf("expected the extensions to be applied: %v, got %v", tc.ExpectUpdate, deployment.Spec.Template.Spec.InitContainers)
+			}
+			if rolling := deployment.Spec.Strategy.Type == appsv1.RollingUpdateDeploymentStrategyType; rolling != tc.ExpectRolling {
+				t.Fatalf("expected a rolling update: %v, got %v", tc.ExpectRolling, deployment.Spec.Strategy)
+			}
+			if loaded := len(kc.Status.Extensions) == 1 && kc.Status.Extensions[0].Version == "2.0"; loaded != tc.ExpectStatus {
+				t.Fatalf("expected the extensions to be reported: %v, got %v", tc.ExpectStatus, kc.Status.Extensions)
+			}
+			if tc.ExpectStatus && kc.Status.Extensions[0].Loaded != tc.ExpectLoaded {
+				t.Fatalf("expected the extension to be loaded: %v, got %v", tc.ExpectLoaded, kc.Status.Extensions[0])
+			}
+		})
+	}
+}
+
+func TestExtensionsScriptQuoting(t *testing.T) {
+	script := extensionsScript([]v1alpha1.KeycloakExtension{
+		{Name: "plugin", Type: v1alpha1.ExtensionPlugin, URL: "https://example.com/it's.jar", SHA256: themeChecksum},
+	})
+	if !strings.Contains(script, `'https://example.com/it'\''s.jar'`) {
+		t.Fatalf("expected the url to be quoted, got %s", script)
+	}
+}
+
+func TestExtensionStatuses(t *testing.T) {
+	info := &v1alpha1.KeycloakServerInfo{
+		Providers: map[string][]string{"authenticator": {"auth-cookie", "otp-sms"}, "required-action": {"verify-phone"}},
+		Themes:    map[string][]string{"login": {"keycloak"}},
+	}
+	cases := []struct {
+		Name          string
+		Extension     v1alpha1.KeycloakExtension
+		ExpectLoaded  bool
+		ExpectMessage string
+	}{
+		{
+			Name:         "Plugin with all its providers loaded",
+			Extension:    v1alpha1.KeycloakExtension{Name: "sms", Type: v1alpha1.ExtensionPlugin, Providers: []string{"otp-sms", "verify-phone"}},
+			ExpectLoaded: true,
+		},
+		{
+			Name:          "Plugin with a missing provider",
+			Extension:     v1alpha1.KeycloakExtension{Name: "sms", Type: v1alpha1.ExtensionPlugin, Providers: []string{"otp-sms", "sms-sender"}},
+			ExpectMessage: "the server didn't load the providers sms-sender",
+		},
+		{
+			Name:          "Plugin without providers",
+			Extension:     v1alpha1.KeycloakExtension{Name: "sms", Type: v1alpha1.ExtensionPlugin},
+			ExpectMessage: "list the providers of the plugin to check that the server loaded it",
+		},
+		{
+			Name:          "Missing theme",
+			Extension:     v1alpha1.KeycloakExtension{Name: "branding", Type: v1alpha1.ExtensionTheme},
+			ExpectMessage: "the server didn't load a theme named branding",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			statuses := extensionStatuses([]v1alpha1.KeycloakExtension{tc.Extension}, info)
+			if len(statuses) != 1 || statuses[0].Loaded != tc.ExpectLoaded || statuses[0].Message != tc.ExpectMessage {
+				t.Fatalf("expected loaded %v with message %q, got %v", tc.ExpectLoaded, tc.ExpectMessage, statuses)
+			}
+		})
+	}
+}
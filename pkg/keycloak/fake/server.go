@@ -0,0 +1,870 @@
+// Package fake provides an in-memory Keycloak admin REST API for testing the operator
+// against the endpoints used by keycloak.Client without a real server.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+)
+
+const (
+	// Version is the server version reported by serverinfo, matching the RH-SSO 7.4 servers
+	Version     = "9.0.3.redhat-00002"
+	contextPath = "/auth"
+	adminPrefix = contextPath + "/admin/"
+	token       = "fake-token"
+)
+
+// defaultClientRoles are the clients Keycloak creates in every realm, with the roles they define
+var defaultClientRoles = map[string][]string{
+	"account":                {"manage-account", "view-profile"},
+	"admin-cli":              {},
+	"broker":                 {"read-token"},
+	"realm-management":       {"manage-users", "view-users", "view-clients"},
+	"security-admin-console": {},
+}
+
+var defaultRealmRoles = []string{"offline_access", "uma_authorization"}
+
+// Server is an httptest server implementing the subset of the Keycloak admin REST API used by
+// keycloak.Client, backed by in-memory state
+type Server struct {
+	*httptest.Server
+	Username string
+	Password string
+
+	mu     sync.Mutex
+	realms map[string]*realm
+}
+
+type realm struct {
+	rep               v1alpha1.KeycloakApiRealm
+	clients           map[string]*v1alpha1.KeycloakApiClient
+	clientRoles       map[string][]*v1alpha1.KeycloakUserRole
+	realmRoles        []*v1alpha1.KeycloakUserRole
+	users             map[string]*v1alpha1.KeycloakApiUser
+	passwords         map[string]string
+	userRealmRoles    map[string]map[string]*v1alpha1.KeycloakUserRole
+	userClientRoles   map[string]map[string]map[string]*v1alpha1.KeycloakUserRole
+	federatedIds      map[string]map[string]v1alpha1.FederatedIdentity
+	identityProviders map[string]*v1alpha1.KeycloakIdentityProvider
+	executions        []*v1alpha1.AuthenticationExecutionInfo
+	authConfigs       map[string]*v1alpha1.AuthenticatorConfig
+}
+
+// NewServer starts a fake Keycloak serving under the legacy /auth context path with a master
+// realm that accepts the given admin credentials. Callers must Close it.
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Username: username,
+		Password: password,
+		realms:   map[string]*realm{},
+	}
+	s.realms["master"] = newRealm(v1alpha1.KeycloakApiRealm{ID: "master", Realm: "master", Enabled: true})
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func newRealm(rep v1alpha1.KeycloakApiRealm) *realm {
+	if rep.ID == "" {
+		rep.ID = rep.Realm
+	}
+	rep.Users = nil
+	rep.Clients = nil
+	rep.IdentityProviders = nil
+	r := &realm{
+		rep:               rep,
+		clients:           map[string]*v1alpha1.KeycloakApiClient{},
+		clientRoles:       map[string][]*v1alpha1.KeycloakUserRole{},
+		users:             map[string]*v1alpha1.KeycloakApiUser{},
+		passwords:         map[string]string{},
+		userRealmRoles:    map[string]map[string]*v1alpha1.KeycloakUserRole{},
+		userClientRoles:   map[string]map[string]map[string]*v1alpha1.KeycloakUserRole{},
+		federatedIds:      map[string]map[string]v1alpha1.FederatedIdentity{},
+		identityProviders: map[string]*v1alpha1.KeycloakIdentityProvider{},
+		authConfigs:       map[string]*v1alpha1.AuthenticatorConfig{},
+		executions: []*v1alpha1.AuthenticationExecutionInfo{
+			{ID: newID(), ProviderID: "auth-cookie", DisplayName: "Cookie"},
+			{ID: newID(), ProviderID: "identity-provider-redirector", DisplayName: "Identity Provider Redirector", Configurable: true},
+		},
+	}
+	for _, name := range defaultRealmRoles {
+		r.realmRoles = append(r.realmRoles, &v1alpha1.KeycloakUserRole{ID: newID(), Name: name, ContainerID: rep.ID})
+	}
+	for clientID, roles := range defaultClientRoles {
+		client := &v1alpha1.KeycloakApiClient{ID: newID(), ClientID: clientID, Enabled: true, Protocol: "openid-connect"}
+		r.clients[client.ID] = client
+		for _, name := range roles {
+			r.clientRoles[client.ID] = append(r.clientRoles[client.ID], &v1alpha1.KeycloakUserRole{ID: newID(), Name: name, ClientRole: true, ContainerID: client.ID})
+		}
+	}
+	return r
+}
+
+func newID() string {
+	return uuid.New().String()
+}
+
+// AddRealm seeds a realm as if it had been created outside of the operator
+func (s *Server) AddRealm(rep v1alpha1.KeycloakApiRealm) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.realms[rep.Realm] = newRealm(rep)
+}
+
+// HasRealm returns true if the realm exists
+func (s *Server) HasRealm(realmName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.realms[realmName]
+	return ok
+}
+
+// AddUser seeds a user in a realm as if it had been created outside of the operator and returns its ID
+func (s *Server) AddUser(realmName string, user v1alpha1.KeycloakApiUser) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.realms[realmName]
+	user.ID = newID()
+	user.RealmRoles = nil
+	user.ClientRoles = nil
+	r.users[user.ID] = &user
+	return user.ID
+}
+
+// Users returns copies of the users of a realm sorted by username
+func (s *Server) Users(realmName string) []v1alpha1.KeycloakApiUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := []v1alpha1.KeycloakApiUser{}
+	if r, ok := s.realms[realmName]; ok {
+		for _, u := range r.sortedUsers() {
+			users = append(users, *u)
+		}
+	}
+	return users
+}
+
+// UserPassword returns the password last set for a user
+func (s *Server) UserPassword(realmName, userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.realms[realmName]; ok {
+		return r.passwords[userID]
+	}
+	return ""
+}
+
+// UserRealmRoles returns the sorted names of the realm roles mapped to a user
+func (s *Server) UserRealmRoles(realmName, userID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	if r, ok := s.realms[realmName]; ok {
+		for name := range r.userRealmRoles[userID] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UserClientRoles returns the sorted names of the roles of a client, by clientId, mapped to a user
+func (s *Server) UserClientRoles(realmName, userID, clientID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	if r, ok := s.realms[realmName]; ok {
+		if client := r.clientByClientID(clientID); client != nil {
+			for name := range r.userClientRoles[userID][client.ID] {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clients returns copies of the clients of a realm sorted by clientId
+func (s *Server) Clients(realmName string) []v1alpha1.KeycloakApiClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := []v1alpha1.KeycloakApiClient{}
+	if r, ok := s.realms[realmName]; ok {
+		for _, c := range r.sortedClients() {
+			clients = append(clients, *c)
+		}
+	}
+	return clients
+}
+
+// AddClient seeds a client in a realm as if it had been created outside of the operator and returns its ID
+func (s *Server) AddClient(realmName string, client v1alpha1.KeycloakApiClient) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.realms[realmName]
+	client.ID = newID()
+	r.clients[client.ID] = &client
+	return client.ID
+}
+
+// IdentityProviders returns copies of the identity providers of a realm sorted by alias
+func (s *Server) IdentityProviders(realmName string) []v1alpha1.KeycloakIdentityProvider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idps := []v1alpha1.KeycloakIdentityProvider{}
+	if r, ok := s.realms[realmName]; ok {
+		aliases := []string{}
+		for alias := range r.identityProviders {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			idps = append(idps, *r.identityProviders[alias])
+		}
+	}
+	return idps
+}
+
+// BrowserRedirectorProvider returns the default provider configured on the browser flow's
+// identity provider redirector, or an empty string
+func (s *Server) BrowserRedirectorProvider(realmName string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.realms[realmName]
+	if !ok {
+		return ""
+	}
+	for _, e := range r.executions {
+		if e.ProviderID == "identity-provider-redirector" && e.AuthenticationConfig != "" {
+			if config, ok := r.authConfigs[e.AuthenticationConfig]; ok {
+				return config.Config["defaultProvider"]
+			}
+		}
+	}
+	return ""
+}
+
+func (r *realm) sortedUsers() []*v1alpha1.KeycloakApiUser {
+	users := []*v1alpha1.KeycloakApiUser{}
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	return users
+}
+
+func (r *realm) sortedClients() []*v1alpha1.KeycloakApiClient {
+	clients := []*v1alpha1.KeycloakApiClient{}
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
+	return clients
+}
+
+func (r *realm) clientByClientID(clientID string) *v1alpha1.KeycloakApiClient {
+	for _, c := range r.clients {
+		if c.ClientID == clientID {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := req.URL.Path
+	switch {
+	case path == contextPath+"/" && req.Method == http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+	case path == contextPath+"/realms/master" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"realm": "master"})
+	case path == contextPath+"/realms/master/protocol/openid-connect/token" && req.Method == http.MethodPost:
+		s.handleToken(w, req)
+	case strings.HasPrefix(path, adminPrefix):
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			writeError(w, http.StatusUnauthorized, "HTTP 401 Unauthorized")
+			return
+		}
+		s.handleAdmin(w, req, strings.Split(strings.TrimPrefix(path, adminPrefix), "/"))
+	default:
+		writeError(w, http.StatusNotFound, "RESTEASY003210: Could not find resource for full path")
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.PostForm.Get("username") != s.Username || req.PostForm.Get("password") != s.Password {
+		writeJSON(w, http.StatusUnauthorized, v1alpha1.TokenResponse{Error: "invalid_grant", ErrorDescription: "Invalid user credentials"})
+		return
+	}
+	writeJSON(w, http.StatusOK, v1alpha1.TokenResponse{AccessToken: token, TokenType: "bearer", ExpiresIn: 60})
+}
+
+func (s *Server) handleAdmin(w http.ResponseWriter, req *http.Request, parts []string) {
+	if len(parts) == 1 && parts[0] == "serverinfo" && req.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"systemInfo": map[string]string{"version": Version}})
+		return
+	}
+	if parts[0] != "realms" {
+		writeError(w, http.StatusNotFound, "Could not find resource")
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		s.handleRealms(w, req)
+		return
+	}
+
+	r, ok := s.realms[parts[1]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Realm not found.")
+		return
+	}
+	if len(parts) == 2 {
+		s.handleRealm(w, req, r)
+		return
+	}
+
+	rest := parts[3:]
+	switch parts[2] {
+	case "clients":
+		r.handleClients(w, req, rest)
+	case "users":
+		r.handleUsers(w, req, rest)
+	case "identity-provider":
+		if len(rest) > 0 && rest[0] == "instances" {
+			r.handleIdentityProviders(w, req, rest[1:])
+			return
+		}
+		writeError(w, http.StatusNotFound, "Could not find resource")
+	case "authentication":
+		r.handleAuthentication(w, req, rest)
+	default:
+		writeError(w, http.StatusNotFound, "Could not find resource")
+	}
+}
+
+func (s *Server) handleRealms(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		names := []string{}
+		for name := range s.realms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		realms := []v1alpha1.KeycloakApiRealm{}
+		for _, name := range names {
+			realms = append(realms, s.realms[name].rep)
+		}
+		writeJSON(w, http.StatusOK, realms)
+	case http.MethodPost:
+		rep := v1alpha1.KeycloakApiRealm{}
+		if !readJSON(w, req, &rep) {
+			return
+		}
+		if _, ok := s.realms[rep.Realm]; ok {
+			writeError(w, http.StatusConflict, "Realm with same name exists")
+			return
+		}
+		s.realms[rep.Realm] = newRealm(rep)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleRealm(w http.ResponseWriter, req *http.Request, r *realm) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.rep)
+	case http.MethodPut:
+		rep := v1alpha1.KeycloakApiRealm{}
+		if !readJSON(w, req, &rep) {
+			return
+		}
+		rep.ID = r.rep.ID
+		rep.Realm = r.rep.Realm
+		rep.Users, rep.Clients, rep.IdentityProviders = nil, nil, nil
+		r.rep = rep
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.realms, r.rep.Realm)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *realm) handleClients(w http.ResponseWriter, req *http.Request, parts []string) {
+	if len(parts) == 0 {
+		switch req.Method {
+		case http.MethodGet:
+			clients := r.sortedClients()
+			writeJSON(w, http.StatusOK, page(req.URL.Query(), len(clients), func(i int) interface{} { return clients[i] }))
+		case http.MethodPost:
+			client := &v1alpha1.KeycloakApiClient{}
+			if !readJSON(w, req, client) {
+				return
+			}
+			if r.clientByClientID(client.ClientID) != nil {
+				writeError(w, http.StatusConflict, fmt.Sprintf("Client %s already exists", client.ClientID))
+				return
+			}
+			if client.ID == "" {
+				client.ID = newID()
+			}
+			if client.Secret == "" {
+				client.Secret = newID()
+			}
+			r.clients[client.ID] = client
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	client, ok := r.clients[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Could not find client")
+		return
+	}
+	sub := strings.Join(parts[1:], "/")
+	switch {
+	case sub == "" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, client)
+	case sub == "" && req.Method == http.MethodPut:
+		update := &v1alpha1.KeycloakApiClient{}
+		if !readJSON(w, req, update) {
+			return
+		}
+		update.ID = client.ID
+		if update.Secret == "" {
+			update.Secret = client.Secret
+		}
+		r.clients[client.ID] = update
+		w.WriteHeader(http.StatusNoContent)
+	case sub == "" && req.Method == http.MethodDelete:
+		delete(r.clients, client.ID)
+		delete(r.clientRoles, client.ID)
+		for _, mappings := range r.userClientRoles {
+			delete(mappings, client.ID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case sub == "client-secret" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"type": "secret", "value": client.Secret})
+	case sub == "installation/providers/keycloak-oidc-keycloak-json" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"realm":       r.rep.Realm,
+			"resource":    client.ClientID,
+			"credentials": map[string]string{"secret": client.Secret},
+		})
+	default:
+		writeError(w, http.StatusNotFound, "Could not find resource")
+	}
+}
+
+func (r *realm) handleUsers(w http.ResponseWriter, req *http.Request, parts []string) {
+	if len(parts) == 0 {
+		switch req.Method {
+		case http.MethodGet:
+			users := []*v1alpha1.KeycloakApiUser{}
+			search := strings.ToLower(req.URL.Query().Get("search"))
+			for _, u := range r.sortedUsers() {
+				if search == "" || strings.Contains(strings.ToLower(u.UserName), search) || strings.Contains(strings.ToLower(u.Email), search) {
+					users = append(users, u)
+				}
+			}
+			writeJSON(w, http.StatusOK, page(req.URL.Query(), len(users), func(i int) interface{} { return users[i] }))
+		case http.MethodPost:
+			user := &v1alpha1.KeycloakApiUser{}
+			if !readJSON(w, req, user) {
+				return
+			}
+			for _, u := range r.users {
+				if u.UserName == user.UserName {
+					writeError(w, http.StatusConflict, "User exists with same username")
+					return
+				}
+			}
+			// role mappings in the user representation are ignored on create, as in Keycloak
+			user.ID = newID()
+			user.RealmRoles = nil
+			user.ClientRoles = nil
+			r.users[user.ID] = user
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	user, ok := r.users[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	rest := parts[1:]
+	if len(rest) == 0 {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, user)
+		case http.MethodPut:
+			update := &v1alpha1.KeycloakApiUser{}
+			if !readJSON(w, req, update) {
+				return
+			}
+			update.ID = user.ID
+			update.RealmRoles = nil
+			update.ClientRoles = nil
+			r.users[user.ID] = update
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			delete(r.users, user.ID)
+			delete(r.passwords, user.ID)
+			delete(r.userRealmRoles, user.ID)
+			delete(r.userClientRoles, user.ID)
+			delete(r.federatedIds, user.ID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch rest[0] {
+	case "reset-password":
+		reset := &v1alpha1.KeycloakApiPasswordReset{}
+		if req.Method != http.MethodPut || !readJSON(w, req, reset) {
+			return
+		}
+		r.passwords[user.ID] = reset.Value
+		w.WriteHeader(http.StatusNoContent)
+	case "federated-identity":
+		r.handleFederatedIdentities(w, req, user, rest[1:])
+	case "role-mappings":
+		r.handleRoleMappings(w, req, user, rest[1:])
+	default:
+		writeError(w, http.StatusNotFound, "Could not find resource")
+	}
+}
+
+func (r *realm) handleFederatedIdentities(w http.ResponseWriter, req *http.Request, user *v1alpha1.KeycloakApiUser, parts []string) {
+	if r.federatedIds[user.ID] == nil {
+		r.federatedIds[user.ID] = map[string]v1alpha1.FederatedIdentity{}
+	}
+	fids := r.federatedIds[user.ID]
+	if len(parts) == 0 && req.Method == http.MethodGet {
+		aliases := []string{}
+		for alias := range fids {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		list := []v1alpha1.FederatedIdentity{}
+		for _, alias := range aliases {
+			list = append(list, fids[alias])
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	if len(parts) != 1 {
+		writeError(w, http.StatusNotFound, "Could not find resource")
+		return
+	}
+	alias := parts[0]
+	switch req.Method {
+	case http.MethodPost:
+		if _, ok := r.identityProviders[alias]; !ok {
+			writeError(w, http.StatusNotFound, "Could not find identity provider")
+			return
+		}
+		if _, ok := fids[alias]; ok {
+			writeError(w, http.StatusConflict, "User is already linked with provider")
+			return
+		}
+		fid := v1alpha1.FederatedIdentity{}
+		if !readJSON(w, req, &fid) {
+			return
+		}
+		fid.IdentityProvider = alias
+		fids[alias] = fid
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if _, ok := fids[alias]; !ok {
+			writeError(w, http.StatusNotFound, "Link not found")
+			return
+		}
+		delete(fids, alias)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *realm) handleRoleMappings(w http.ResponseWriter, req *http.Request, user *v1alpha1.KeycloakApiUser, parts []string) {
+	var roles []*v1alpha1.KeycloakUserRole
+	var mapped map[string]*v1alpha1.KeycloakUserRole
+	var rest []string
+
+	switch {
+	case len(parts) >= 1 && parts[0] == "realm":
+		roles = r.realmRoles
+		if r.userRealmRoles[user.ID] == nil {
+			r.userRealmRoles[user.ID] = map[string]*v1alpha1.KeycloakUserRole{}
+		}
+		mapped = r.userRealmRoles[user.ID]
+		rest = parts[1:]
+	case len(parts) >= 2 && parts[0] == "clients":
+		clientID := parts[1]
+		if _, ok := r.clients[clientID]; !ok {
+			writeError(w, http.StatusNotFound, "Could not find client")
+			return
+		}
+		roles = r.clientRoles[clientID]
+		if r.userClientRoles[user.ID] == nil {
+			r.userClientRoles[user.ID] = map[string]map[string]*v1alpha1.KeycloakUserRole{}
+		}
+		if r.userClientRoles[user.ID][clientID] == nil {
+			r.userClientRoles[user.ID][clientID] = map[string]*v1alpha1.KeycloakUserRole{}
+		}
+		mapped = r.userClientRoles[user.ID][clientID]
+		rest = parts[2:]
+	default:
+		writeError(w, http.StatusNotFound, "Could not find resource")
+		return
+	}
+
+	if len(rest) == 1 && rest[0] == "available" && req.Method == http.MethodGet {
+		available := []*v1alpha1.KeycloakUserRole{}
+		for _, role := range roles {
+			if _, ok := mapped[role.Name]; !ok {
+				available = append(available, role)
+			}
+		}
+		writeJSON(w, http.StatusOK, available)
+		return
+	}
+	if len(rest) != 0 {
+		writeError(w, http.StatusNotFound, "Could not find resource")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		list := []*v1alpha1.KeycloakUserRole{}
+		for _, role := range roles {
+			if _, ok := mapped[role.Name]; ok {
+				list = append(list, role)
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodPost, http.MethodDelete:
+		requested := []*v1alpha1.KeycloakUserRole{}
+		if !readJSON(w, req, &requested) {
+			return
+		}
+		for _, role := range requested {
+			found := false
+			for _, existing := range roles {
+				if existing.Name == role.Name {
+					found = true
+					if req.Method == http.MethodPost {
+						mapped[role.Name] = existing
+					} else {
+						delete(mapped, role.Name)
+					}
+				}
+			}
+			if !found {
+				writeError(w, http.StatusNotFound, "Could not find role")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *realm) handleIdentityProviders(w http.ResponseWriter, req *http.Request, parts []string) {
+	if len(parts) == 0 {
+		switch req.Method {
+		case http.MethodGet:
+			aliases := []string{}
+			for alias := range r.identityProviders {
+				aliases = append(aliases, alias)
+			}
+			sort.Strings(aliases)
+			list := []*v1alpha1.KeycloakIdentityProvider{}
+			for _, alias := range aliases {
+				list = append(list, r.withoutSecret(r.identityProviders[alias]))
+			}
+			writeJSON(w, http.StatusOK, list)
+		case http.MethodPost:
+			idp := &v1alpha1.KeycloakIdentityProvider{}
+			if !readJSON(w, req, idp) {
+				return
+			}
+			if _, ok := r.identityProviders[idp.Alias]; ok {
+				writeError(w, http.StatusConflict, fmt.Sprintf("Identity Provider %s already exists", idp.Alias))
+				return
+			}
+			idp.InternalID = newID()
+			r.identityProviders[idp.Alias] = idp
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	idp, ok := r.identityProviders[parts[0]]
+	if !ok || len(parts) != 1 {
+		writeError(w, http.StatusNotFound, "Could not find identity provider")
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.withoutSecret(idp))
+	case http.MethodPut:
+		update := &v1alpha1.KeycloakIdentityProvider{}
+		if !readJSON(w, req, update) {
+			return
+		}
+		if update.InternalID != idp.InternalID {
+			writeError(w, http.StatusBadRequest, "internalId does not match")
+			return
+		}
+		update.Alias = idp.Alias
+		r.identityProviders[idp.Alias] = update
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(r.identityProviders, idp.Alias)
+		for _, fids := range r.federatedIds {
+			delete(fids, idp.Alias)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// withoutSecret returns a copy of the identity provider as Keycloak returns it, without the client secret
+func (r *realm) withoutSecret(idp *v1alpha1.KeycloakIdentityProvider) *v1alpha1.KeycloakIdentityProvider {
+	cp := *idp
+	cp.Config = map[string]string{}
+	for k, v := range idp.Config {
+		if k != "clientSecret" {
+			cp.Config[k] = v
+		}
+	}
+	return &cp
+}
+
+func (r *realm) handleAuthentication(w http.ResponseWriter, req *http.Request, parts []string) {
+	switch {
+	case len(parts) == 3 && parts[0] == "flows" && parts[2] == "executions" && req.Method == http.MethodGet:
+		if parts[1] != "browser" {
+			writeError(w, http.StatusNotFound, "Flow not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, r.executions)
+	case len(parts) == 3 && parts[0] == "executions" && parts[2] == "config" && req.Method == http.MethodPost:
+		var execution *v1alpha1.AuthenticationExecutionInfo
+		for _, e := range r.executions {
+			if e.ID == parts[1] {
+				execution = e
+			}
+		}
+		if execution == nil {
+			writeError(w, http.StatusNotFound, "Illegal execution")
+			return
+		}
+		config := &v1alpha1.AuthenticatorConfig{}
+		if !readJSON(w, req, config) {
+			return
+		}
+		config.ID = newID()
+		r.authConfigs[config.ID] = config
+		execution.AuthenticationConfig = config.ID
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 2 && parts[0] == "config":
+		config, ok := r.authConfigs[parts[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Could not find authenticator config")
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, config)
+		case http.MethodPut:
+			update := &v1alpha1.AuthenticatorConfig{}
+			if !readJSON(w, req, update) {
+				return
+			}
+			update.ID = config.ID
+			r.authConfigs[config.ID] = update
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			delete(r.authConfigs, config.ID)
+			for _, e := range r.executions {
+				if e.AuthenticationConfig == config.ID {
+					e.AuthenticationConfig = ""
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Could not find resource")
+	}
+}
+
+// page applies the first and max query parameters to a list of length total
+func page(query url.Values, total int, item func(i int) interface{}) []interface{} {
+	first, _ := strconv.Atoi(query.Get("first"))
+	max, err := strconv.Atoi(query.Get("max"))
+	if err != nil || max < 0 {
+		max = total
+	}
+	list := []interface{}{}
+	for i := first; i < total && i < first+max; i++ {
+		list = append(list, item(i))
+	}
+	return list
+}
+
+func readJSON(w http.ResponseWriter, req *http.Request, into interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(into); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"errorMessage": message})
+}
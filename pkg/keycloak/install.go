@@ -5,6 +5,7 @@ import (
 	"github.com/integr8ly/keycloak-operator/pkg/apis/openshift/template"
 	"github.com/integr8ly/keycloak-operator/pkg/util"
 	"github.com/openshift/api/template/v1"
+	"github.com/pkg/errors"
 	"io/ioutil"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -28,29 +29,54 @@ func GetInstallResourcesAsRuntimeObjects(keycloak *v1alpha1.Keycloak, params map
 }
 
 func GetInstallResources(keycloak *v1alpha1.Keycloak, params map[string]string) ([]runtime.RawExtension, error) {
-	templateFilePath, err := getTemplatePath(SSO_TEMPLATE_NAME)
+	release, err := targetRelease(keycloak)
 	if err != nil {
 		return nil, err
 	}
-	tpl, err := ioutil.ReadFile(templateFilePath)
+	templ, err := readTemplate(release.Template)
 	if err != nil {
 		return nil, err
 	}
+	return renderTemplate(templ, params)
+}
 
-	jsonInjector := newJsonInjector()
-	tpl, err = jsonInjector.InjectAll(tpl)
+// readTemplate loads the SSO template in the file name of the template directory
+func readTemplate(name string) (*v1.Template, error) {
+	templateFilePath, err := getTemplatePath(name)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := ioutil.ReadFile(templateFilePath)
 	if err != nil {
 		return nil, err
 	}
-
 	res, err := util.LoadKubernetesResource(tpl)
 	if err != nil {
 		return nil, err
 	}
-	templ := res.(*v1.Template)
-	processor, err := template.NewTemplateProcessor(keycloak.Namespace)
+	templ, ok := res.(*v1.Template)
+	if !ok {
+		return nil, errors.Errorf("%s is not a template", name)
+	}
+	return templ, nil
+}
+
+// renderTemplate processes templ with params and mutates the objects into the ones the operator installs
+func renderTemplate(templ *v1.Template, params map[string]string) ([]runtime.RawExtension, error) {
+	mutator := newTemplateMutator()
+	if err := mutator.MutateParameters(templ); err != nil {
+		return nil, err
+	}
+	objects, err := template.NewTemplateProcessor().Process(templ, params)
 	if err != nil {
 		return nil, err
 	}
-	return processor.Process(templ, params)
+	applicationName := params["APPLICATION_NAME"]
+	for _, p := range templ.Parameters {
+		if p.Name == "APPLICATION_NAME" && applicationName == "" {
+			applicationName = p.Value
+		}
+	}
+	objects, err = mutator.MutateObjects(objects, applicationName, params[mutator.PluginsEnvVarName])
+	return objects, errors.Wrapf(err, "template %s", templ.Name)
 }
@@ -22,14 +22,13 @@ import (
 )
 
 const (
-	SSO_TEMPLATE_NAME         = "sso74-x509-postgresql-persistent.json"
 	SSO_ROUTE_NAME            = "sso"
 	SSO_APPLICATION_NAME      = "sso"
 	SSO_TEMPLATE_PATH         = "deploy/template"
 	SSO_TEMPLATE_PATH_ENV_VAR = "TEMPLATE_DIR"
-	SSO_VERSION               = "v7.4.2.GA"
-	SSO_IMAGE_STREAM          = "redhat-sso74-openshift:1.0"
 	SSO_POSTGRES_VERSION      = "9.6"
+	// SSO_INSTANCE_LABEL holds the name of the Keycloak an object was generated for
+	SSO_INSTANCE_LABEL = "sso"
 )
 
 //go:generate moq -out sdkCruder_moq.go . SdkCruder
@@ -65,20 +64,27 @@ func NewReconciler(kcClientFactory KeycloakClientFactory, k8client kubernetes.In
 	for _, s := range kcDefaultClients {
 		set[s] = struct{}{}
 	}
-	// todo move out and stop ignoring error
-	kubeconfig := k8sclient.GetKubeConfig()
-	routeClient, _ := routev1.NewForConfig(kubeconfig)
-	dcClient, _ := apps.NewForConfig(kubeconfig)
+	phaseHandler := clusterPhaseHandler(k8client)
+	phaseHandler.kcClientFactory = kcClientFactory
 	return &Reconciler{
 		kcClientFactory: kcClientFactory,
 		k8sClient:       k8client,
 		defaultClients:  set,
-		kubeconfig:      kubeconfig,
+		kubeconfig:      k8sclient.GetKubeConfig(),
 		sdkCrud:         cruder,
-		phaseHandler:    NewPhaseHandler(k8client, routeClient, dcClient, k8sclient.GetResourceClient),
+		phaseHandler:    phaseHandler,
 	}
 }
 
+// clusterPhaseHandler returns a phase handler using the clients of the cluster the operator runs in
+func clusterPhaseHandler(k8client kubernetes.Interface) *phaseHandler {
+	// todo move out and stop ignoring error
+	kubeconfig := k8sclient.GetKubeConfig()
+	routeClient, _ := routev1.NewForConfig(kubeconfig)
+	dcClient, _ := apps.NewForConfig(kubeconfig)
+	return NewPhaseHandler(k8client, routeClient, dcClient, k8sclient.GetResourceClient)
+}
+
 func (h *Reconciler) Handle(ctx context.Context, object interface{}, deleted bool) error {
 
 	if deleted {
@@ -10,6 +10,8 @@ import (
 
 var (
 	lockKeycloakClientFactoryMockAuthenticatedClient sync.RWMutex
+	lockKeycloakClientFactoryMockInvalidate          sync.RWMutex
+	lockKeycloakClientFactoryMockPasswordClient      sync.RWMutex
 )
 
 // Ensure, that KeycloakClientFactoryMock does implement KeycloakClientFactory.
@@ -25,6 +27,12 @@ var _ KeycloakClientFactory = &KeycloakClientFactoryMock{}
 //             AuthenticatedClientFunc: func(kc v1alpha1.Keycloak) (KeycloakInterface, error) {
 // 	               panic("mock out the AuthenticatedClient method")
 //             },
+//             InvalidateFunc: func(kc v1alpha1.Keycloak)  {
+// 	               panic("mock out the Invalidate method")
+//             },
+//             PasswordClientFunc: func(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error) {
+// 	               panic("mock out the PasswordClient method")
+//             },
 //         }
 //
 //         // use mockedKeycloakClientFactory in code that requires KeycloakClientFactory
@@ -35,6 +43,12 @@ type KeycloakClientFactoryMock struct {
 	// AuthenticatedClientFunc mocks the AuthenticatedClient method.
 	AuthenticatedClientFunc func(kc v1alpha1.Keycloak) (KeycloakInterface, error)
 
+	// InvalidateFunc mocks the Invalidate method.
+	InvalidateFunc func(kc v1alpha1.Keycloak)
+
+	// PasswordClientFunc mocks the PasswordClient method.
+	PasswordClientFunc func(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// AuthenticatedClient holds details about calls to the AuthenticatedClient method.
@@ -42,6 +56,18 @@ type KeycloakClientFactoryMock struct {
 			// Kc is the kc argument value.
 			Kc v1alpha1.Keycloak
 		}
+		// Invalidate holds details about calls to the Invalidate method.
+		Invalidate []struct {
+			// Kc is the kc argument value.
+			Kc v1alpha1.Keycloak
+		}
+		// PasswordClient holds details about calls to the PasswordClient method.
+		PasswordClient []struct {
+			// Kc is the kc argument value.
+			Kc v1alpha1.Keycloak
+			// Password is the password argument value.
+			Password string
+		}
 	}
 }
 
@@ -75,3 +101,69 @@ func (mock *KeycloakClientFactoryMock) AuthenticatedClientCalls() []struct {
 	lockKeycloakClientFactoryMockAuthenticatedClient.RUnlock()
 	return calls
 }
+
+// Invalidate calls InvalidateFunc.
+func (mock *KeycloakClientFactoryMock) Invalidate(kc v1alpha1.Keycloak) {
+	if mock.InvalidateFunc == nil {
+		panic("KeycloakClientFactoryMock.InvalidateFunc: method is nil but KeycloakClientFactory.Invalidate was just called")
+	}
+	callInfo := struct {
+		Kc v1alpha1.Keycloak
+	}{
+		Kc: kc,
+	}
+	lockKeycloakClientFactoryMockInvalidate.Lock()
+	mock.calls.Invalidate = append(mock.calls.Invalidate, callInfo)
+	lockKeycloakClientFactoryMockInvalidate.Unlock()
+	mock.InvalidateFunc(kc)
+}
+
+// InvalidateCalls gets all the calls that were made to Invalidate.
+// Check the length with:
+//     len(mockedKeycloakClientFactory.InvalidateCalls())
+func (mock *KeycloakClientFactoryMock) InvalidateCalls() []struct {
+	Kc v1alpha1.Keycloak
+} {
+	var calls []struct {
+		Kc v1alpha1.Keycloak
+	}
+	lockKeycloakClientFactoryMockInvalidate.RLock()
+	calls = mock.calls.Invalidate
+	lockKeycloakClientFactoryMockInvalidate.RUnlock()
+	return calls
+}
+
+// PasswordClient calls PasswordClientFunc.
+func (mock *KeycloakClientFactoryMock) PasswordClient(kc v1alpha1.Keycloak, password string) (KeycloakInterface, error) {
+	if mock.PasswordClientFunc == nil {
+		panic("KeycloakClientFactoryMock.PasswordClientFunc: method is nil but KeycloakClientFactory.PasswordClient was just called")
+	}
+	callInfo := struct {
+		Kc       v1alpha1.Keycloak
+		Password string
+	}{
+		Kc:       kc,
+		Password: password,
+	}
+	lockKeycloakClientFactoryMockPasswordClient.Lock()
+	mock.calls.PasswordClient = append(mock.calls.PasswordClient, callInfo)
+	lockKeycloakClientFactoryMockPasswordClient.Unlock()
+	return mock.PasswordClientFunc(kc, password)
+}
+
+// PasswordClientCalls gets all the calls that were made to PasswordClient.
+// Check the length with:
+//     len(mockedKeycloakClientFactory.PasswordClientCalls())
+func (mock *KeycloakClientFactoryMock) PasswordClientCalls() []struct {
+	Kc       v1alpha1.Keycloak
+	Password string
+} {
+	var calls []struct {
+		Kc       v1alpha1.Keycloak
+		Password string
+	}
+	lockKeycloakClientFactoryMockPasswordClient.RLock()
+	calls = mock.calls.PasswordClient
+	lockKeycloakClientFactoryMockPasswordClient.RUnlock()
+	return calls
+}
@@ -32,6 +32,7 @@ var (
 	lockKeycloakInterfaceMockGetClientSecret                     sync.RWMutex
 	lockKeycloakInterfaceMockGetIdentityProvider                 sync.RWMutex
 	lockKeycloakInterfaceMockGetRealm                            sync.RWMutex
+	lockKeycloakInterfaceMockGetServerInfo                       sync.RWMutex
 	lockKeycloakInterfaceMockGetUser                             sync.RWMutex
 	lockKeycloakInterfaceMockGetUserFederatedIdentities          sync.RWMutex
 	lockKeycloakInterfaceMockListAuthenticationExecutionsForFlow sync.RWMutex
@@ -132,6 +133,9 @@ var _ KeycloakInterface = &KeycloakInterfaceMock{}
 //             GetRealmFunc: func(realmName string) (*v1alpha1.KeycloakRealm, error) {
 // 	               panic("mock out the GetRealm method")
 //             },
+//             GetServerInfoFunc: func() (*v1alpha1.KeycloakServerInfo, error) {
+// 	               panic("mock out the GetServerInfo method")
+//             },
 //             GetUserFunc: func(userID string, realmName string) (*v1alpha1.KeycloakUser, error) {
 // 	               panic("mock out the GetUser method")
 //             },
@@ -265,6 +269,9 @@ type KeycloakInterfaceMock struct {
 	// GetRealmFunc mocks the GetRealm method.
 	GetRealmFunc func(realmName string) (*v1alpha1.KeycloakRealm, error)
 
+	// GetServerInfoFunc mocks the GetServerInfo method.
+	GetServerInfoFunc func() (*v1alpha1.KeycloakServerInfo, error)
+
 	// GetUserFunc mocks the GetUser method.
 	GetUserFunc func(userID string, realmName string) (*v1alpha1.KeycloakUser, error)
 
@@ -495,6 +502,9 @@ type KeycloakInterfaceMock struct {
 			// RealmName is the realmName argument value.
 			RealmName string
 		}
+		// GetServerInfo holds details about calls to the GetServerInfo method.
+		GetServerInfo []struct {
+		}
 		// GetUser holds details about calls to the GetUser method.
 		GetUser []struct {
 			// UserID is the userID argument value.
@@ -1448,6 +1458,32 @@ func (mock *KeycloakInterfaceMock) GetRealmCalls() []struct {
 	return calls
 }
 
+// GetServerInfo calls GetServerInfoFunc.
+func (mock *KeycloakInterfaceMock) GetServerInfo() (*v1alpha1.KeycloakServerInfo, error) {
+	if mock.GetServerInfoFunc == nil {
+		panic("KeycloakInterfaceMock.GetServerInfoFunc: method is nil but KeycloakInterface.GetServerInfo was just called")
+	}
+	callInfo := struct {
+	}{}
+	lockKeycloakInterfaceMockGetServerInfo.Lock()
+	mock.calls.GetServerInfo = append(mock.calls.GetServerInfo, callInfo)
+	lockKeycloakInterfaceMockGetServerInfo.Unlock()
+	return mock.GetServerInfoFunc()
+}
+
+// GetServerInfoCalls gets all the calls that were made to GetServerInfo.
+// Check the length with:
+//     len(mockedKeycloakInterface.GetServerInfoCalls())
+func (mock *KeycloakInterfaceMock) GetServerInfoCalls() []struct {
+} {
+	var calls []struct {
+	}
+	lockKeycloakInterfaceMockGetServerInfo.RLock()
+	calls = mock.calls.GetServerInfo
+	lockKeycloakInterfaceMockGetServerInfo.RUnlock()
+	return calls
+}
+
 // GetUser calls GetUserFunc.
 func (mock *KeycloakInterfaceMock) GetUser(userID string, realmName string) (*v1alpha1.KeycloakUser, error) {
 	if mock.GetUserFunc == nil {
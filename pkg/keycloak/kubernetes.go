@@ -0,0 +1,407 @@
+package keycloak
+
+import (
+	"fmt"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	POSTGRES_KUBERNETES_IMAGE = "registry.redhat.io/rhscl/postgresql-96-rhel7:1"
+	SSO_HTTP_PORT             = 8080
+	SSO_PING_PORT             = 8888
+	POSTGRES_PORT             = 5432
+	SSO_DEFAULT_DATABASE      = "root"
+	SSO_VOLUME_CAPACITY       = "1Gi"
+	SSO_MEMORY_LIMIT          = "1Gi"
+)
+
+// kubernetesPlatform provisions Keycloak as native Deployments, StatefulSets, Services and an Ingress,
+// using the same RH-SSO and PostgreSQL images and environment as the OpenShift template
+type kubernetesPlatform struct {
+	k8sClient kubernetes.Interface
+}
+
+func (p *kubernetesPlatform) InstallResources(kc *v1alpha1.Keycloak, params map[string]string) ([]runtime.Object, error) {
+	dbParams, err := databaseParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return applyImage([]runtime.Object{
+		kubernetesPostgresService(kc),
+		kubernetesPostgresStatefulSet(kc, dbParams),
+		kubernetesService(kc),
+		kubernetesPingService(kc),
+		kubernetesDeployment(kc, dbParams, params),
+		kubernetesIngress(kc),
+	}, kc)
+}
+
+func (p *kubernetesPlatform) DataLayerSelector(kc *v1alpha1.Keycloak) string {
+	return fmt.Sprintf("statefulSet=%v", databaseName(kc))
+}
+
+func (p *kubernetesPlatform) ApplicationSelector(kc *v1alpha1.Keycloak) string {
+	return fmt.Sprintf("application=%v,deployment=%v", applicationName(kc), applicationName(kc))
+}
+
+func (p *kubernetesPlatform) ApplicationContainer(kc *v1alpha1.Keycloak) (*v1.Container, error) {
+	deployment, err := p.k8sClient.AppsV1().Deployments(kc.Namespace).Get(applicationName(kc), v12.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get '%s' deployment", applicationName(kc))
+	}
+	for i, c := range deployment.Spec.Template.Spec.Containers {
+		if c.Name == applicationName(kc) {
+			return &deployment.Spec.Template.Spec.Containers[i], nil
+		}
+	}
+	return nil, errors.Errorf("could not find the sso container in the '%s' deployment", applicationName(kc))
+}
+
+func (p *kubernetesPlatform) Workloads(kc *v1alpha1.Keycloak) (*workload, *workload, error) {
+	deployments := p.k8sClient.AppsV1().Deployments(kc.Namespace)
+	deployment, err := deployments.Get(applicationName(kc), v12.GetOptions{})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not get '%s' deployment", applicationName(kc))
+	}
+	application := &workload{object: deployment, rolledOut: deploymentRolledOut(deployment), update: func() error {
+		_, err := deployments.Update(deployment)
+		return err
+	}}
+	statefulSets := p.k8sClient.AppsV1().StatefulSets(kc.Namespace)
+	statefulSet, err := statefulSets.Get(databaseName(kc), v12.GetOptions{})
+	if errors2.IsNotFound(err) {
+		return application, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not get '%s' statefulset", databaseName(kc))
+	}
+	database := &workload{object: statefulSet, rolledOut: statefulSetRolledOut(statefulSet), update: func() error {
+		_, err := statefulSets.Update(statefulSet)
+		return err
+	}}
+	return application, database, nil
+}
+
+// AdminURL prefers the host or load balancer address of the ingress and falls back to the service
+// address, which the operator can always reach from inside the cluster
+func (p *kubernetesPlatform) AdminURL(kc *v1alpha1.Keycloak) (string, error) {
+	ingress, err := p.k8sClient.ExtensionsV1beta1().Ingresses(kc.Namespace).Get(applicationName(kc), v12.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the sso ingress")
+	}
+	protocol := "http"
+	if len(ingress.Spec.TLS) > 0 {
+		protocol = "https"
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host != "" {
+			return fmt.Sprintf("%v://%v", protocol, rule.Host), nil
+		}
+	}
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		if lb.Hostname != "" {
+			return fmt.Sprintf("%v://%v", protocol, lb.Hostname), nil
+		}
+		if lb.IP != "" {
+			return fmt.Sprintf("%v://%v", protocol, lb.IP), nil
+		}
+	}
+	return fmt.Sprintf("http://%v.%v.svc:%d", applicationName(kc), kc.Namespace, SSO_HTTP_PORT), nil
+}
+
+func (p *kubernetesPlatform) Deprovision(kc *v1alpha1.Keycloak, deleteOpts *v12.DeleteOptions, listOpts v12.ListOptions) error {
+	if err := p.k8sClient.AppsV1().Deployments(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return errors.Wrap(err, "failed to remove the deployments")
+	}
+	if err := p.k8sClient.AppsV1().StatefulSets(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return errors.Wrap(err, "failed to remove the statefulsets")
+	}
+	if err := p.k8sClient.ExtensionsV1beta1().Ingresses(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return errors.Wrap(err, "failed to remove the ingresses")
+	}
+	return nil
+}
+
+// databaseParams returns the database credentials from params, generating the ones that are missing
+// the same way the OpenShift template does
+func databaseParams(params map[string]string) (map[string]string, error) {
+	dbParams := map[string]string{
+		"DB_USERNAME": params["DB_USERNAME"],
+		"DB_PASSWORD": params["DB_PASSWORD"],
+		"DB_DATABASE": params["DB_DATABASE"],
+	}
+	if dbParams["DB_USERNAME"] == "" {
+		suffix, err := GeneratePassword()
+		if err != nil {
+			return nil, err
+		}
+		dbParams["DB_USERNAME"] = "user" + suffix[:3]
+	}
+	if dbParams["DB_PASSWORD"] == "" {
+		password, err := GeneratePassword()
+		if err != nil {
+			return nil, err
+		}
+		dbParams["DB_PASSWORD"] = password
+	}
+	if dbParams["DB_DATABASE"] == "" {
+		dbParams["DB_DATABASE"] = SSO_DEFAULT_DATABASE
+	}
+	return dbParams, nil
+}
+
+// kubernetesLabels mirror the labels of the OpenShift template, the generated objects also get the instance labels
+func kubernetesLabels(kc *v1alpha1.Keycloak, extra map[string]string) map[string]string {
+	labels := map[string]string{"application": applicationName(kc)}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+func kubernetesService(kc *v1alpha1.Keycloak) *v1.Service {
+	return &v1.Service{
+		TypeMeta: v12.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: v12.ObjectMeta{
+			Name:      applicationName(kc),
+			Namespace: kc.Namespace,
+			Labels:    kubernetesLabels(kc, nil),
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				// the port is named so the service monitor can find the metrics endpoint
+				{Name: SSO_APPLICATION_NAME, Port: SSO_HTTP_PORT, TargetPort: intstr.FromInt(SSO_HTTP_PORT)},
+			},
+			Selector: map[string]string{"deployment": applicationName(kc)},
+		},
+	}
+}
+
+func kubernetesPingService(kc *v1alpha1.Keycloak) *v1.Service {
+	return &v1.Service{
+		TypeMeta: v12.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: v12.ObjectMeta{
+			Name:      applicationName(kc) + "-ping",
+			Namespace: kc.Namespace,
+			Labels:    kubernetesLabels(kc, nil),
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP:                "None",
+			PublishNotReadyAddresses: true,
+			Ports: []v1.ServicePort{
+				{Name: "ping", Port: SSO_PING_PORT, TargetPort: intstr.FromInt(SSO_PING_PORT)},
+			},
+			Selector: map[string]string{"deployment": applicationName(kc)},
+		},
+	}
+}
+
+func kubernetesPostgresService(kc *v1alpha1.Keycloak) *v1.Service {
+	name := databaseName(kc)
+	return &v1.Service{
+		TypeMeta: v12.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: v12.ObjectMeta{
+			Name:      name,
+			Namespace: kc.Namespace,
+			Labels:    kubernetesLabels(kc, nil),
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Port: POSTGRES_PORT, TargetPort: intstr.FromInt(POSTGRES_PORT)},
+			},
+			Selector: map[string]string{"statefulSet": name},
+		},
+	}
+}
+
+func kubernetesPostgresStatefulSet(kc *v1alpha1.Keycloak, dbParams map[string]string) *appsv1.StatefulSet {
+	name := databaseName(kc)
+	replicas := int32(1)
+	podLabels := kubernetesLabels(kc, map[string]string{"statefulSet": name})
+	return &appsv1.StatefulSet{
+		TypeMeta: v12.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+		ObjectMeta: v12.ObjectMeta{
+			Name:      name,
+			Namespace: kc.Namespace,
+			Labels:    kubernetesLabels(kc, nil),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: name,
+			Selector:    &v12.LabelSelector{MatchLabels: map[string]string{"statefulSet": name}},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: v12.ObjectMeta{Labels: podLabels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:  name,
+							Image: POSTGRES_KUBERNETES_IMAGE,
+							Ports: []v1.ContainerPort{{ContainerPort: POSTGRES_PORT, Protocol: v1.ProtocolTCP}},
+							Env: []v1.EnvVar{
+								{Name: "POSTGRESQL_USER", Value: dbParams["DB_USERNAME"]},
+								{Name: "POSTGRESQL_PASSWORD", Value: dbParams["DB_PASSWORD"]},
+								{Name: "POSTGRESQL_DATABASE", Value: dbParams["DB_DATABASE"]},
+							},
+							ReadinessProbe: &v1.Probe{
+								Handler: v1.Handler{
+									Exec: &v1.ExecAction{
+										Command: []string{"/bin/sh", "-i", "-c", "psql -h 127.0.0.1 -U $POSTGRESQL_USER -q -d $POSTGRESQL_DATABASE -c 'SELECT 1'"},
+									},
+								},
+								InitialDelaySeconds: 5,
+								TimeoutSeconds:      10,
+							},
+							LivenessProbe: &v1.Probe{
+								Handler: v1.Handler{
+									TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(POSTGRES_PORT)},
+								},
+								InitialDelaySeconds: 90,
+								TimeoutSeconds:      10,
+							},
+							VolumeMounts: []v1.VolumeMount{
+								{Name: name + "-pvol", MountPath: "/var/lib/pgsql/data"},
+							},
+						},
+					},
+				},
+			},
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{
+				{
+					ObjectMeta: v12.ObjectMeta{
+						Name:   name + "-pvol",
+						Labels: kubernetesLabels(kc, nil),
+					},
+					Spec: v1.PersistentVolumeClaimSpec{
+						AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+						Resources: v1.ResourceRequirements{
+							Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(SSO_VOLUME_CAPACITY)},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func kubernetesDeployment(kc *v1alpha1.Keycloak, dbParams, params map[string]string) *appsv1.Deployment {
+	mutator := newTemplateMutator()
+	replicas := int32(1)
+	podLabels := kubernetesLabels(kc, map[string]string{"deployment": applicationName(kc)})
+	adminSecretKey := func(key string) *v1.EnvVarSource {
+		return &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: kc.Spec.AdminCredentials},
+				Key:                  key,
+			},
+		}
+	}
+	probe := func(script string, delay int32) *v1.Probe {
+		return &v1.Probe{
+			Handler: v1.Handler{
+				Exec: &v1.ExecAction{Command: []string{"/bin/bash", "-c", script}},
+			},
+			InitialDelaySeconds: delay,
+			PeriodSeconds:       30,
+			TimeoutSeconds:      22,
+		}
+	}
+	volumes := []v1.Volume{}
+	volumeMounts := []v1.VolumeMount{}
+	initVolumeMounts := []v1.VolumeMount{}
+	for _, volume := range []VolumeInfo{mutator.PluginsVolumeInfo, mutator.ThemesVolumeInfo} {
+		volumes = append(volumes, v1.Volume{Name: volume.VolumeName, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{Name: volume.VolumeName, MountPath: volume.VolumeMount})
+		initVolumeMounts = append(initVolumeMounts, v1.VolumeMount{Name: volume.VolumeName, MountPath: volume.InitVolumeMount})
+	}
+
+	return &appsv1.Deployment{
+		TypeMeta: v12.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: v12.ObjectMeta{
+			Name:      applicationName(kc),
+			Namespace: kc.Namespace,
+			Labels:    kubernetesLabels(kc, nil),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &v12.LabelSelector{MatchLabels: map[string]string{"deployment": applicationName(kc)}},
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: v12.ObjectMeta{Labels: podLabels},
+				Spec: v1.PodSpec{
+					InitContainers: []v1.Container{
+						{
+							Name:         mutator.InitContainerName,
+							Image:        mutator.InitContainerImage,
+							Env:          []v1.EnvVar{{Name: mutator.PluginsEnvVarName, Value: params[mutator.PluginsEnvVarName]}},
+							VolumeMounts: initVolumeMounts,
+						},
+					},
+					Containers: []v1.Container{
+						{
+							Name: applicationName(kc),
+							Resources: v1.ResourceRequirements{
+								Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(SSO_MEMORY_LIMIT)},
+							},
+							Ports: []v1.ContainerPort{
+								{Name: "http", ContainerPort: SSO_HTTP_PORT, Protocol: v1.ProtocolTCP},
+								{Name: "ping", ContainerPort: SSO_PING_PORT, Protocol: v1.ProtocolTCP},
+							},
+							Env: []v1.EnvVar{
+								{Name: "SSO_HOSTNAME", Value: params["SSO_HOSTNAME"]},
+								{Name: "DB_SERVICE_PREFIX_MAPPING", Value: databaseName(kc) + "=DB"},
+								{Name: "TX_DATABASE_PREFIX_MAPPING", Value: databaseName(kc) + "=DB"},
+								{Name: "DB_JNDI", Value: "java:jboss/datasources/KeycloakDS"},
+								{Name: "DB_USERNAME", Value: dbParams["DB_USERNAME"]},
+								{Name: "DB_PASSWORD", Value: dbParams["DB_PASSWORD"]},
+								{Name: "DB_DATABASE", Value: dbParams["DB_DATABASE"]},
+								{Name: "JGROUPS_PING_PROTOCOL", Value: "dns.DNS_PING"},
+								{Name: "OPENSHIFT_DNS_PING_SERVICE_NAME", Value: applicationName(kc) + "-ping"},
+								{Name: "OPENSHIFT_DNS_PING_SERVICE_PORT", Value: fmt.Sprintf("%d", SSO_PING_PORT)},
+								{Name: "X509_CA_BUNDLE", Value: "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"},
+								{Name: "SSO_ADMIN_USERNAME", ValueFrom: adminSecretKey("SSO_ADMIN_USERNAME")},
+								{Name: "SSO_ADMIN_PASSWORD", ValueFrom: adminSecretKey("SSO_ADMIN_PASSWORD")},
+							},
+							LivenessProbe:  probe("/opt/eap/bin/livenessProbe.sh", 60),
+							ReadinessProbe: probe("/opt/eap/bin/readinessProbe.sh", 40),
+							Lifecycle: &v1.Lifecycle{
+								PostStart: &v1.Handler{
+									Exec: &v1.ExecAction{Command: []string{"/bin/sh", "-c", "cp -RT /opt/themes /opt/eap/themes"}},
+								},
+							},
+							VolumeMounts: volumeMounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+func kubernetesIngress(kc *v1alpha1.Keycloak) *extv1beta1.Ingress {
+	return &extv1beta1.Ingress{
+		TypeMeta: v12.TypeMeta{APIVersion: "extensions/v1beta1", Kind: "Ingress"},
+		ObjectMeta: v12.ObjectMeta{
+			Name:      applicationName(kc),
+			Namespace: kc.Namespace,
+			Labels:    kubernetesLabels(kc, nil),
+		},
+		Spec: extv1beta1.IngressSpec{
+			Backend: &extv1beta1.IngressBackend{
+				ServiceName: applicationName(kc),
+				ServicePort: intstr.FromInt(SSO_HTTP_PORT),
+			},
+		},
+	}
+}
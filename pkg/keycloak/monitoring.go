@@ -0,0 +1,111 @@
+package keycloak
+
+import (
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// monitoringResources are the templates of the monitoring resources, in the order they are reconciled
+var monitoringResources = []string{GrafanaDashboardName, ServiceMonitorName, PrometheusRuleName}
+
+// monitoringName is the name of the monitoring resource of template for kc. Instances provisioned before names were
+// derived from the Keycloak keep the fixed names the templates used to set
+func monitoringName(kc *v1alpha1.Keycloak, template string) string {
+	if kc.Status.ApplicationName == "" {
+		switch template {
+		case GrafanaDashboardName:
+			return "keycloak"
+		case ServiceMonitorName:
+			return "keycloak-monitoring"
+		}
+		return "application-monitoring"
+	}
+	if template == GrafanaDashboardName {
+		return kc.Status.ApplicationName
+	}
+	return scopedName(kc, "monitoring")
+}
+
+// monitoringResourceEnabled reports whether the spec of kc asks for the monitoring resource of template
+func monitoringResourceEnabled(kc *v1alpha1.Keycloak, template string) bool {
+	monitoring := kc.Spec.Monitoring
+	switch template {
+	case GrafanaDashboardName:
+		return !monitoring.GrafanaDashboard.Disabled
+	case ServiceMonitorName:
+		return !monitoring.ServiceMonitor.Disabled
+	case PrometheusRuleName:
+		return !monitoring.PrometheusRule.Disabled
+	}
+	return false
+}
+
+// reconcileMonitoringResources renders the monitoring resources of kc and keeps the live ones in sync with them on
+// every reconcile, recreating the deleted ones and deleting the disabled ones. A resource whose CRD isn't installed is
+// skipped until it is
+func (ph *phaseHandler) reconcileMonitoringResources(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	resourceHelper := newResourceHelper(kc)
+	created := true
+	for _, template := range monitoringResources {
+		resource, err := resourceHelper.createResource(template)
+		if err != nil {
+			return kc, errors.Wrapf(err, "failed to render the %s template", template)
+		}
+		gvk := resource.GroupVersionKind()
+		apiVersion, kind := gvk.ToAPIVersionAndKind()
+		name := kind + "/" + resource.GetName()
+		resourceClient, _, err := ph.dynamicResourceClientFactory(apiVersion, kind, kc.Namespace)
+		if err != nil {
+			// The CRD is not installed in the cluster, we can try again later
+			created = created && !monitoringResourceEnabled(kc, template)
+			continue
+		}
+
+		if !monitoringResourceEnabled(kc, template) {
+			live, err := resourceClient.Get(resource.GetName(), v12.GetOptions{})
+			if errors2.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return kc, errors.Wrapf(err, "failed to get %s", name)
+			}
+			// only delete what was created for kc
+			if ref := v12.GetControllerOf(live); ref == nil || ref.UID != kc.UID {
+				continue
+			}
+			if err := resourceClient.Delete(resource.GetName(), v12.NewDeleteOptions(0)); err != nil && !errors2.IsNotFound(err) {
+				return kc, errors.Wrapf(err, "failed to delete the disabled %s", name)
+			}
+			logrus.Infof("keycloak %s/%s: deleted the disabled %s", kc.Namespace, kc.Name, name)
+			continue
+		}
+
+		// never take over the resource of another instance using the same name
+		live, err := resourceClient.Get(resource.GetName(), v12.GetOptions{})
+		if err != nil && !errors2.IsNotFound(err) {
+			return kc, errors.Wrapf(err, "failed to get %s", name)
+		}
+		if err == nil {
+			if ref := v12.GetControllerOf(live); ref != nil && ref.UID != kc.UID {
+				logrus.Warnf("keycloak %s/%s: %s is controlled by %s %s, not updating it", kc.Namespace, kc.Name, name, ref.Kind, ref.Name)
+				created = false
+				continue
+			}
+		}
+
+		ownObject(kc, resource)
+		correction, err := ph.reconcileInstallObject(kc, resource)
+		if err != nil {
+			return kc, err
+		}
+		if correction != "" {
+			logrus.Infof("keycloak %s/%s: %s", kc.Namespace, kc.Name, correction)
+		}
+	}
+	kc.Status.MonitoringResourcesCreated = created
+	return kc, nil
+}
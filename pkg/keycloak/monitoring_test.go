@@ -0,0 +1,319 @@
+package keycloak
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func monitoringKeycloak() *v1alpha1.Keycloak {
+	return &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace", UID: "keycloak-uid"},
+		Spec:       v1alpha1.KeycloakSpec{Provision: true},
+	}
+}
+
+// alertExpressions returns the expressions of the alerts of a PrometheusRule by their name
+func alertExpressions(rule *unstructured.Unstructured) map[string]string {
+	exprs := map[string]string{}
+	groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	for _, g := range groups {
+		rules, _, _ := unstructured.NestedSlice(g.(map[string]interface{}), "rules")
+		for _, r := range rules {
+			alert, _, _ := unstructured.NestedString(r.(map[string]interface{}), "alert")
+			expr, _, _ := unstructured.NestedString(r.(map[string]interface{}), "expr")
+			exprs[alert] = expr
+		}
+	}
+	return exprs
+}
+
+func TestKeycloakMonitoringValidate(t *testing.T) {
+	percent := func(p float64) *float64 { return &p }
+	failedLogins := int32(-1)
+	cases := []struct {
+		Name        string
+		Monitoring  v1alpha1.KeycloakMonitoringSpec
+		ExpectError bool
+	}{
+		{
+			Name: "Labels and thresholds",
+			Monitoring: v1alpha1.KeycloakMonitoringSpec{
+				Labels:         map[string]string{"monitoring-key": "identity", "team": "sso"},
+				PrometheusRule: v1alpha1.KeycloakPrometheusRuleSpec{Thresholds: v1alpha1.KeycloakAlertThresholds{HeapUsagePercent: percent(80), RequestsWithin10sPercent: percent(99.9)}},
+			},
+		},
+		{
+			Name:        "Invalid label value",
+			Monitoring:  v1alpha1.KeycloakMonitoringSpec{Labels: map[string]string{"team": "identity and access"}},
+			ExpectError: true,
+		},
+		{
+			Name:        "Percent above 100",
+			Monitoring:  v1alpha1.KeycloakMonitoringSpec{PrometheusRule: v1alpha1.KeycloakPrometheusRuleSpec{Thresholds: v1alpha1.KeycloakAlertThresholds{GCTimePercent: percent(120)}}},
+			ExpectError: true,
+		},
+		{
+			Name:        "Negative failed logins",
+			Monitoring:  v1alpha1.KeycloakMonitoringSpec{PrometheusRule: v1alpha1.KeycloakPrometheusRuleSpec{Thresholds: v1alpha1.KeycloakAlertThresholds{FailedLogins: &failedLogins}}},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{Spec: v1alpha1.KeycloakSpec{Monitoring: tc.Monitoring}}
+			if err := kc.Validate(); (err != nil) != tc.ExpectError {
+				t.Fatalf("expected an error: %v, got %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
+
+func TestMonitoringTemplates(t *testing.T) {
+	os.Setenv(SSO_TEMPLATE_PATH_ENV_VAR, "../../"+SSO_TEMPLATE_PATH)
+	heap, requests, failedLogins := 75.0, 99.9, int32(20)
+	kc := monitoringKeycloak()
+	kc.Spec.Monitoring.Labels = map[string]string{"monitoring-key": "identity", "team": "true"}
+	kc.Spec.Monitoring.PrometheusRule.Thresholds = v1alpha1.KeycloakAlertThresholds{
+		HeapUsagePercent:         &heap,
+		RequestsWithin10sPercent: &requests,
+		FailedLogins:             &failedLogins,
+	}
+
+	for _, template := range monitoringResources {
+		resource, err := newResourceHelper(kc).createResource(template)
+		if err != nil {
+			t.Fatalf("unexpected error rendering %s: %v", template, err)
+		}
+		if labels := resource.GetLabels(); labels["monitoring-key"] != "identity" || labels["team"] != "true" {
+			t.Fatalf("expected the labels of the spec on %s, got %v", template, labels)
+		}
+	}
+
+	rule, err := newResourceHelper(kc).createResource(PrometheusRuleName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exprs := alertExpressions(rule)
+	expected := map[string]string{
+		"KeycloakJavaHeapThresholdExceeded":                 "> 75\n",
+		"KeycloakJavaNonHeapThresholdExceeded":              "> 90\n",
+		"KeycloakJavaGCTimePerMinuteScavenge":               "> 60 * 90 / 100\n",
+		"KeycloakLoginFailedThresholdExceeded":              "* 300 > 20\n",
+		"KeycloakAPIRequestDuration90PercThresholdExceeded": "* 100 < 90\n",
+		"KeycloakAPIRequestDuration99PercThresholdExceeded": "* 100 < 99.9\n",
+	}
+	for alert, suffix := range expected {
+		if !strings.HasSuffix(exprs[alert], suffix) {
+			t.Fatalf("expected the expression of %s to end with %q, got %q", alert, suffix, exprs[alert])
+		}
+	}
+}
+
+func TestMonitoringTemplatesPlatformAndContextPath(t *testing.T) {
+	os.Setenv(SSO_TEMPLATE_PATH_ENV_VAR, "../../"+SSO_TEMPLATE_PATH)
+	cases := []struct {
+		Name             string
+		Platform         v1alpha1.Platform
+		Image            string
+		ExpectedJoin     string
+		ExpectedDatabase string
+		ExpectedPath     string
+	}{
+		{
+			Name:             "OpenShift release image",
+			Platform:         v1alpha1.PlatformOpenShift,
+			ExpectedJoin:     `kube_pod_labels{label_deploymentConfig="sso"}`,
+			ExpectedDatabase: `kube_pod_labels{label_deploymentConfig="sso-postgresql"}`,
+			ExpectedPath:     "/auth/realms/master/metrics",
+		},
+		{
+			Name:             "Kubernetes release image",
+			Platform:         v1alpha1.PlatformKubernetes,
+			ExpectedJoin:     `kube_pod_labels{label_deployment="sso"}`,
+			ExpectedDatabase: `kube_pod_labels{label_statefulSet="sso-postgresql"}`,
+			ExpectedPath:     "/auth/realms/master/metrics",
+		},
+		{
+			Name:             "Kubernetes Quarkus image",
+			Platform:         v1alpha1.PlatformKubernetes,
+			Image:            "quay.io/keycloak/keycloak:21.1.2",
+			ExpectedJoin:     `kube_pod_labels{label_deployment="sso"}`,
+			ExpectedDatabase: `kube_pod_labels{label_statefulSet="sso-postgresql"}`,
+			ExpectedPath:     "/realms/master/metrics",
+		},
+		{
+			Name:             "WildFly image on a registry with a port",
+			Platform:         v1alpha1.PlatformOpenShift,
+			Image:            "registry.example.com:5000/keycloak/keycloak:15.0.2",
+			ExpectedJoin:     `kube_pod_labels{label_deploymentConfig="sso"}`,
+			ExpectedDatabase: `kube_pod_labels{label_deploymentConfig="sso-postgresql"}`,
+			ExpectedPath:     "/auth/realms/master/metrics",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := monitoringKeycloak()
+			kc.Status.Platform = tc.Platform
+			kc.Status.Image = tc.Image
+			rule, err := newResourceHelper(kc).createResource(PrometheusRuleName)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			exprs := alertExpressions(rule)
+			if !strings.Contains(exprs["KeycloakInstanceNotAvailable"], tc.ExpectedJoin) {
+				t.Fatalf("expected the instance to be joined on %s, got %q", tc.ExpectedJoin, exprs["KeycloakInstanceNotAvailable"])
+			}
+			if !strings.Contains(exprs["KeycloakDatabaseNotAvailable"], tc.ExpectedDatabase) {
+				t.Fatalf("expected the database to be joined on %s, got %q", tc.ExpectedDatabase, exprs["KeycloakDatabaseNotAvailable"])
+			}
+			monitor, err := newResourceHelper(kc).createResource(ServiceMonitorName)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			endpoints, _, _ := unstructured.NestedSlice(monitor.Object, "spec", "endpoints")
+			if len(endpoints) != 1 || endpoints[0].(map[string]interface{})["path"] != tc.ExpectedPath {
+				t.Fatalf("expected the metrics to be scraped at %s, got %v", tc.ExpectedPath, endpoints)
+			}
+		})
+	}
+}
+
+func TestReconcileMonitoringResources(t *testing.T) {
+	os.Setenv(SSO_TEMPLATE_PATH_ENV_VAR, "../../"+SSO_TEMPLATE_PATH)
+	resources := newFakeResourceClients()
+	ph := NewPhaseHandler(fake.NewSimpleClientset(), nil, nil, resources.Factory)
+	kc, err := ph.reconcileMonitoringResources(monitoringKeycloak())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !kc.Status.MonitoringResourcesCreated {
+		t.Fatal("expected the monitoring resources to be reported as created")
+	}
+	rule := resources.Get("PrometheusRule", "application-monitoring")
+	if rule == nil || resources.Get("ServiceMonitor", "keycloak-monitoring") == nil || resources.Get("GrafanaDashboard", "keycloak") == nil {
+		t.Fatalf("expected the monitoring resources to be created, got %v", resources.Names())
+	}
+	if ref := v12.GetControllerOf(rule); ref == nil || ref.UID != kc.UID {
+		t.Fatalf("expected the keycloak to own the monitoring resources, got %v", rule.GetOwnerReferences())
+	}
+
+	// a deleted service monitor is recreated and an edited rule is set back
+	client, _, _ := resources.Factory("monitoring.coreos.com/v1", "ServiceMonitor", kc.Namespace)
+	if err := client.Delete("keycloak-monitoring", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client, _, _ = resources.Factory("monitoring.coreos.com/v1", "PrometheusRule", kc.Namespace)
+	unstructured.SetNestedSlice(rule.Object, []interface{}{}, "spec", "groups")
+	if _, err := client.Update(rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// threshold changes roll out to the live rule
+	failedLogins := int32(10)
+	kc.Spec.Monitoring.PrometheusRule.Thresholds.FailedLogins = &failedLogins
+	if kc, err = ph.reconcileMonitoringResources(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resources.Get("ServiceMonitor", "keycloak-monitoring") == nil {
+		t.Fatalf("expected the deleted service monitor to be recreated, got %v", resources.Names())
+	}
+	rule = resources.Get("PrometheusRule", "application-monitoring")
+	if expr := alertExpressions(rule)["KeycloakLoginFailedThresholdExceeded"]; !strings.HasSuffix(expr, "* 300 > 10\n") {
+		t.Fatalf("expected the rule to be set back with the new threshold, got %q", expr)
+	}
+
+	// disabled resources are deleted
+	kc.Spec.Monitoring.PrometheusRule.Disabled = true
+	kc.Spec.Monitoring.GrafanaDashboard.Disabled = true
+	if kc, err = ph.reconcileMonitoringResources(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resources.Get("PrometheusRule", "application-monitoring") != nil || resources.Get("GrafanaDashboard", "keycloak") != nil {
+		t.Fatalf("expected the disabled resources to be deleted, got %v", resources.Names())
+	}
+	if resources.Get("ServiceMonitor", "keycloak-monitoring") == nil || !kc.Status.MonitoringResourcesCreated {
+		t.Fatalf("expected the enabled service monitor to be kept, got %v", resources.Names())
+	}
+}
+
+func TestReconcileMonitoringResourcesOfTwoInstances(t *testing.T) {
+	os.Setenv(SSO_TEMPLATE_PATH_ENV_VAR, "../../"+SSO_TEMPLATE_PATH)
+	resources := newFakeResourceClients()
+	ph := NewPhaseHandler(fake.NewSimpleClientset(), nil, nil, resources.Factory)
+	instance := func(name string, failedLogins int32) *v1alpha1.Keycloak {
+		kc := monitoringKeycloak()
+		kc.Name, kc.UID = name, types.UID(name+"-uid")
+		kc.Status.ApplicationName = name
+		kc.Spec.Monitoring.PrometheusRule.Thresholds.FailedLogins = &failedLogins
+		return kc
+	}
+	instances := []*v1alpha1.Keycloak{instance("staging", 100), instance("production", 10)}
+
+	// reconciling twice, each instance must keep its own resources
+	for i := 0; i < 2; i++ {
+		for j, kc := range instances {
+			kc, err := ph.reconcileMonitoringResources(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !kc.Status.MonitoringResourcesCreated {
+				t.Fatalf("expected the monitoring resources of %s to be reported as created", kc.Name)
+			}
+			instances[j] = kc
+		}
+	}
+	cases := []struct {
+		Name      string
+		Threshold string
+	}{
+		{Name: "staging", Threshold: "* 300 > 100\n"},
+		{Name: "production", Threshold: "* 300 > 10\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rule := resources.Get("PrometheusRule", tc.Name+"-monitoring")
+			monitor := resources.Get("ServiceMonitor", tc.Name+"-monitoring")
+			dashboard := resources.Get("GrafanaDashboard", tc.Name)
+			if rule == nil || monitor == nil || dashboard == nil {
+				t.Fatalf("expected the monitoring resources of %s, got %v", tc.Name, resources.Names())
+			}
+			for _, o := range []*unstructured.Unstructured{rule, monitor, dashboard} {
+				if ref := v12.GetControllerOf(o); ref == nil || ref.UID != types.UID(tc.Name+"-uid") {
+					t.Fatalf("expected %s to own %s, got %v", tc.Name, o.GetName(), o.GetOwnerReferences())
+				}
+			}
+			if expr := alertExpressions(rule)["KeycloakLoginFailedThresholdExceeded"]; !strings.HasSuffix(expr, tc.Threshold) || !strings.Contains(expr, `service="`+tc.Name+`"`) {
+				t.Fatalf("expected the rule of %s to keep its threshold and service, got %q", tc.Name, expr)
+			}
+			if selector, _, _ := unstructured.NestedStringMap(monitor.Object, "spec", "selector", "matchLabels"); len(selector) != 1 || selector[SSO_INSTANCE_LABEL] != tc.Name {
+				t.Fatalf("expected the service monitor of %s to select its services, got %v", tc.Name, selector)
+			}
+		})
+	}
+
+	// a resource of the same name controlled by another instance is left alone
+	other := instance("staging", 5)
+	other.UID = "other-uid"
+	other, err := ph.reconcileMonitoringResources(other)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other.Status.MonitoringResourcesCreated {
+		t.Fatal("expected the resources controlled by another instance not to be reported as created")
+	}
+	rule := resources.Get("PrometheusRule", "staging-monitoring")
+	if ref := v12.GetControllerOf(rule); ref == nil || ref.UID != "staging-uid" {
+		t.Fatalf("expected the rule to stay owned by staging, got %v", rule.GetOwnerReferences())
+	}
+	if expr := alertExpressions(rule)["KeycloakLoginFailedThresholdExceeded"]; !strings.HasSuffix(expr, "* 300 > 100\n") {
+		t.Fatalf("expected the rule of staging not to be overwritten, got %q", expr)
+	}
+}
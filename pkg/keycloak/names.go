@@ -0,0 +1,46 @@
+package keycloak
+
+import (
+	"strings"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+)
+
+// applicationName is the name of the Keycloak workload, its container, service and route, the other generated objects
+// are named after it. Instances provisioned before the name was recorded in their status all used SSO_APPLICATION_NAME
+func applicationName(kc *v1alpha1.Keycloak) string {
+	if kc.Status.ApplicationName != "" {
+		return kc.Status.ApplicationName
+	}
+	return SSO_APPLICATION_NAME
+}
+
+// databaseName is the name of the bundled PostgreSQL workload and service of kc
+func databaseName(kc *v1alpha1.Keycloak) string {
+	return applicationName(kc) + "-postgresql"
+}
+
+// databaseHost is the address of the bundled PostgreSQL service of kc
+func databaseHost(kc *v1alpha1.Keycloak) string {
+	return databaseName(kc) + "." + kc.Namespace + ".svc"
+}
+
+// databaseSecretName is the secret holding the credentials of the database of kc, the bundled workloads and the backup
+// jobs read them from it
+func databaseSecretName(kc *v1alpha1.Keycloak) string {
+	return "db-credentials-" + kc.Name
+}
+
+// scopedName prefixes name with the application name of kc, for objects named after something in the spec. Instances
+// provisioned before names were derived from the Keycloak keep name unprefixed
+func scopedName(kc *v1alpha1.Keycloak, name string) string {
+	if kc.Status.ApplicationName == "" {
+		return name
+	}
+	return kc.Status.ApplicationName + "-" + name
+}
+
+// dataLayerObject reports whether the install object named name belongs to the bundled database of kc
+func dataLayerObject(kc *v1alpha1.Keycloak, name string) bool {
+	return strings.HasPrefix(name, databaseName(kc))
+}
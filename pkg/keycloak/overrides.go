@@ -0,0 +1,203 @@
+package keycloak
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// overridesAnnotation records a checksum of the overrides applied to an object, JSON patches may not be idempotent so
+// they are only applied to a live object again when its overrides change
+const overridesAnnotation = "aerogear.org/overrides"
+
+// objectOverrides returns the overrides of kc selecting the object of kind named name
+func objectOverrides(kc *v1alpha1.Keycloak, kind, name string) []v1alpha1.KeycloakOverride {
+	overrides := []v1alpha1.KeycloakOverride{}
+	for _, o := range kc.Spec.Overrides {
+		if o.Kind == kind && o.Name == name {
+			overrides = append(overrides, o)
+		}
+	}
+	return overrides
+}
+
+// overridesChecksum identifies the overrides applied to an object, it is empty without overrides
+func overridesChecksum(overrides []v1alpha1.KeycloakOverride) string {
+	if len(overrides) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(overrides)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// applyOverrides patches the install objects with the overrides of kc and records their checksum on the patched
+// objects. An override selecting no object is an error, so a typo doesn't go unnoticed
+func applyOverrides(kc *v1alpha1.Keycloak, objects []runtime.Object) ([]runtime.Object, error) {
+	patched := make([]runtime.Object, 0, len(objects))
+	selected := map[int]bool{}
+	for _, o := range objects {
+		kind, name := o.GetObjectKind().GroupVersionKind().Kind, objectName(o)
+		overrides := objectOverrides(kc, kind, name)
+		for _, override := range overrides {
+			var err error
+			if o, err = patchObject(o, o, override); err != nil {
+				return nil, err
+			}
+		}
+		for i, override := range kc.Spec.Overrides {
+			selected[i] = selected[i] || (override.Kind == kind && override.Name == name)
+		}
+		if checksum := overridesChecksum(overrides); checksum != "" {
+			accessor, err := meta.Accessor(o)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to access the metadata of %s/%s", kind, name)
+			}
+			setAnnotation(accessor, overridesAnnotation, checksum)
+		}
+		patched = append(patched, o)
+	}
+	for i, override := range kc.Spec.Overrides {
+		if !selected[i] {
+			return nil, errors.Errorf("the override of %s/%s selects none of the generated objects", override.Kind, override.Name)
+		}
+	}
+	return patched, nil
+}
+
+// checkOverrides applies the overrides of kc to the objects rendered for it, so a patch that doesn't apply is found
+// before the install objects are provisioned or reconciled. The objects are rendered without the credentials and
+// exposure, which a patch can't rely on at this point
+func checkOverrides(kc *v1alpha1.Keycloak, p platform) error {
+	if len(kc.Spec.Overrides) == 0 {
+		return nil
+	}
+	objects, err := p.InstallResources(kc, map[string]string{"APPLICATION_NAME": applicationName(kc)})
+	if err != nil {
+		return errors.Wrap(err, "failed to render the install objects to check the overrides")
+	}
+	applySizing(objects, kc)
+	for _, o := range objects {
+		applyExtensions(kc, o)
+	}
+	_, err = applyOverrides(kc, objects)
+	return err
+}
+
+// verifyOverrides checks the overrides of kc again whenever its spec changed and reports the result in the status
+func verifyOverrides(kc *v1alpha1.Keycloak, p platform) {
+	if len(kc.Spec.Overrides) == 0 {
+		kc.Status.Overrides = nil
+		return
+	}
+	data, _ := json.Marshal(kc.Spec)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if kc.Status.Overrides != nil && kc.Status.Overrides.Checksum == checksum {
+		return
+	}
+	kc.Status.Overrides = &v1alpha1.KeycloakOverridesStatus{Checksum: checksum}
+	if err := checkOverrides(kc, p); err != nil {
+		logrus.Errorf("the overrides of keycloak %s/%s don't apply: %v", kc.Namespace, kc.Name, err)
+		kc.Status.Overrides.Error = err.Error()
+	}
+}
+
+// brokenOverrides reports whether the last check of the overrides of kc failed
+func brokenOverrides(kc *v1alpha1.Keycloak) bool {
+	return kc.Status.Overrides != nil && kc.Status.Overrides.Error != ""
+}
+
+// reconcileOverrides checks the overrides of a provisioned instance after a change of its spec
+func (ph *phaseHandler) reconcileOverrides(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return kc, err
+	}
+	verifyOverrides(kc, p)
+	return kc, nil
+}
+
+// patchObject applies override to o and returns the patched copy. Strategic merge patches look up how to merge lists
+// in the type of typed, so o may be the live unstructured copy of typed
+func patchObject(o, typed runtime.Object, override v1alpha1.KeycloakOverride) (runtime.Object, error) {
+	name := override.Kind + "/" + override.Name
+	patch, err := override.PatchJSON()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %s", name)
+	}
+	switch override.Type {
+	case "", v1alpha1.OverrideStrategic:
+		if _, ok := typed.(*unstructured.Unstructured); ok {
+			return nil, errors.Errorf("the kind of %s has no strategic merge patch support, use a json patch", name)
+		}
+		data, err = strategicpatch.StrategicMergePatch(data, patch, typed)
+	case v1alpha1.OverrideJSON:
+		var jsonPatch util.JSONPatch
+		if jsonPatch, err = util.DecodeJSONPatch(patch); err == nil {
+			data, err = jsonPatch.Apply(data)
+		}
+	default:
+		err = errors.Errorf("unknown override type '%s'", override.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to apply the override of %s", name)
+	}
+
+	result := reflect.New(reflect.TypeOf(o).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, errors.Wrapf(err, "the override of %s produced an invalid object", name)
+	}
+	if result.GetObjectKind().GroupVersionKind() != o.GetObjectKind().GroupVersionKind() || objectName(result) != objectName(o) {
+		return nil, errors.Errorf("the override of %s can't change the kind or name of the object", name)
+	}
+	return result, nil
+}
+
+// reapplyOverrides applies the overrides of desired to the live object again and returns whether that changed it.
+// Strategic merge patches are applied on every reconcile, JSON patches only when the overrides changed
+func reapplyOverrides(kc *v1alpha1.Keycloak, desired runtime.Object, live *unstructured.Unstructured) (bool, error) {
+	overrides := objectOverrides(kc, live.GetKind(), live.GetName())
+	checksum := overridesChecksum(overrides)
+	applied := live.GetAnnotations()[overridesAnnotation]
+	if checksum == "" && applied == "" {
+		return false, nil
+	}
+
+	var o runtime.Object = live.DeepCopy()
+	for _, override := range overrides {
+		if applied == checksum && override.Type == v1alpha1.OverrideJSON {
+			continue
+		}
+		var err error
+		if o, err = patchObject(o, desired, override); err != nil {
+			return false, err
+		}
+	}
+	patched := o.(*unstructured.Unstructured)
+	if checksum == "" {
+		annotations := patched.GetAnnotations()
+		delete(annotations, overridesAnnotation)
+		patched.SetAnnotations(annotations)
+	} else {
+		setAnnotation(patched, overridesAnnotation, checksum)
+	}
+	if reflect.DeepEqual(patched.Object, live.Object) {
+		return false, nil
+	}
+	live.Object = patched.Object
+	return true, nil
+}
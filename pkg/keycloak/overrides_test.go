@@ -0,0 +1,201 @@
+package keycloak
+
+import (
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKeycloakOverridesValidate(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Override    v1alpha1.KeycloakOverride
+		ExpectError bool
+	}{
+		{
+			Name:     "Strategic merge patch in YAML",
+			Override: v1alpha1.KeycloakOverride{Kind: "Deployment", Name: "sso", Patch: "spec:\n  minReadySeconds: 30\n"},
+		},
+		{
+			Name:     "JSON patch",
+			Override: v1alpha1.KeycloakOverride{Kind: "Service", Name: "sso", Type: "json", Patch: `[{"op": "add", "path": "/spec/sessionAffinity", "value": "ClientIP"}]`},
+		},
+		{
+			Name:        "Missing name",
+			Override:    v1alpha1.KeycloakOverride{Kind: "Deployment", Patch: "{}"},
+			ExpectError: true,
+		},
+		{
+			Name:        "Strategic merge patch that is not an object",
+			Override:    v1alpha1.KeycloakOverride{Kind: "Deployment", Name: "sso", Patch: "- minReadySeconds"},
+			ExpectError: true,
+		},
+		{
+			Name:        "Broken JSON patch",
+			Override:    v1alpha1.KeycloakOverride{Kind: "Service", Name: "sso", Type: "json", Patch: `[{"op": "add", "path": "spec"}]`},
+			ExpectError: true,
+		},
+		{
+			Name:        "Unknown type",
+			Override:    v1alpha1.KeycloakOverride{Kind: "Service", Name: "sso", Type: "merge", Patch: "{}"},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{Spec: v1alpha1.KeycloakSpec{Overrides: []v1alpha1.KeycloakOverride{tc.Override}}}
+			if err := kc.Validate(); (err != nil) != tc.ExpectError {
+				t.Fatalf("expected an error: %v, got %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Overrides   []v1alpha1.KeycloakOverride
+		ExpectError bool
+		Validate    func(t *testing.T, deployment *appsv1.Deployment)
+	}{
+		{
+			Name: "Strategic merge patch of a container",
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "Deployment", Name: SSO_APPLICATION_NAME, Patch: `{"spec": {"template": {"spec": {"containers": [{"name": "sso", "env": [{"name": "JAVA_OPTS_APPEND", "value": "-Dkeycloak.profile=preview"}]}]}}}}`},
+			},
+			Validate: func(t *testing.T, deployment *appsv1.Deployment) {
+				container := workloadContainer(deployment, SSO_APPLICATION_NAME)
+				if envVar(container, "JAVA_OPTS_APPEND") != "-Dkeycloak.profile=preview" || len(container.Env) < 2 {
+					t.Fatalf("expected the env var to be merged into the container, got %v", container.Env)
+				}
+				if len(container.Ports) == 0 || container.ReadinessProbe == nil {
+					t.Fatalf("expected the rest of the container to be kept, got %v", container)
+				}
+				if deployment.Annotations[overridesAnnotation] == "" {
+					t.Fatalf("expected the checksum of the overrides to be recorded, got %v", deployment.Annotations)
+				}
+			},
+		},
+		{
+			Name: "JSON patches in order",
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "Deployment", Name: SSO_APPLICATION_NAME, Type: "json", Patch: `[{"op": "add", "path": "/spec/minReadySeconds", "value": 10}]`},
+				{Kind: "Deployment", Name: SSO_APPLICATION_NAME, Type: "json", Patch: `[{"op": "replace", "path": "/spec/minReadySeconds", "value": 30}]`},
+			},
+			Validate: func(t *testing.T, deployment *appsv1.Deployment) {
+				if deployment.Spec.MinReadySeconds != 30 {
+					t.Fatalf("expected the patches to be applied in order, got %d", deployment.Spec.MinReadySeconds)
+				}
+			},
+		},
+		{
+			Name: "Override selecting no object",
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "DeploymentConfig", Name: SSO_APPLICATION_NAME, Patch: `{"spec": {"replicas": 2}}`},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "JSON patch that doesn't apply",
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "Deployment", Name: SSO_APPLICATION_NAME, Type: "json", Patch: `[{"op": "replace", "path": "/spec/missing/field", "value": 1}]`},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "Override renaming the object",
+			Overrides: []v1alpha1.KeycloakOverride{
+				{Kind: "Deployment", Name: SSO_APPLICATION_NAME, Patch: `{"metadata": {"name": "other"}}`},
+			},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+				Spec:       v1alpha1.KeycloakSpec{Overrides: tc.Overrides},
+			}
+			objects := []runtime.Object{kubernetesDeployment(kc, map[string]string{}, map[string]string{}), kubernetesService(kc)}
+
+			objects, err := applyOverrides(kc, objects)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(objects) != 2 {
+				t.Fatalf("expected the objects to be kept, got %v", objects)
+			}
+			if annotations := objects[1].(v12.Object).GetAnnotations(); annotations[overridesAnnotation] != "" {
+				t.Fatalf("expected objects without overrides to be left alone, got %v", annotations)
+			}
+			tc.Validate(t, objects[0].(*appsv1.Deployment))
+		})
+	}
+}
+
+func TestCheckOverrides(t *testing.T) {
+	kc := externalDatabaseKeycloak(nil)
+	kc.Spec.Overrides = []v1alpha1.KeycloakOverride{
+		{Kind: "Ingress", Name: SSO_APPLICATION_NAME, Type: "json", Patch: `[{"op": "remove", "path": "/spec/rules/0"}]`},
+	}
+	ph := NewPhaseHandler(fake.NewSimpleClientset(), nil, nil, nil)
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := checkOverrides(kc, p); err == nil {
+		t.Fatal("expected a patch of a missing rule to be refused before provisioning")
+	}
+	kc.Spec.Overrides[0].Patch = `[{"op": "add", "path": "/metadata/annotations", "value": {"kubernetes.io/ingress.class": "nginx"}}]`
+	if err := checkOverrides(kc, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyOverrides(t *testing.T) {
+	kc := externalDatabaseKeycloak(nil)
+	kc.Spec.Overrides = []v1alpha1.KeycloakOverride{
+		{Kind: "Ingress", Name: SSO_APPLICATION_NAME, Type: "json", Patch: `[{"op": "remove", "path": "/spec/rules/0"}]`},
+	}
+	k8sClient := fake.NewSimpleClientset()
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	verifyOverrides(kc, p)
+	if !brokenOverrides(kc) || kc.Status.Overrides.Checksum == "" {
+		t.Fatalf("expected the patch of a missing rule to be reported, got %v", kc.Status.Overrides)
+	}
+	k8sClient.ClearActions()
+	kc, err = ph.reconcileInstallObjects(kc)
+	if err != nil || len(k8sClient.Actions()) != 0 {
+		t.Fatalf("expected the install objects to be left alone while the overrides are broken, got %v %v", err, k8sClient.Actions())
+	}
+
+	checksum := kc.Status.Overrides.Checksum
+	kc.Spec.Overrides[0].Patch = `[{"op": "add", "path": "/metadata/annotations", "value": {"kubernetes.io/ingress.class": "nginx"}}]`
+	verifyOverrides(kc, p)
+	if brokenOverrides(kc) || kc.Status.Overrides.Checksum == checksum {
+		t.Fatalf("expected the fixed overrides to be checked again, got %v", kc.Status.Overrides)
+	}
+
+	kc.Spec.Overrides = nil
+	verifyOverrides(kc, p)
+	if kc.Status.Overrides != nil {
+		t.Fatalf("expected the status to be cleared without overrides, got %v", kc.Status.Overrides)
+	}
+}
@@ -0,0 +1,70 @@
+package keycloak
+
+import (
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// instanceLabels are set on every object generated for kc, Deprovision only deletes what carries them. The application
+// label is the one the templates set on the pods, so the objects and pods of an instance agree
+func instanceLabels(kc *v1alpha1.Keycloak) map[string]string {
+	return map[string]string{"application": applicationName(kc), SSO_INSTANCE_LABEL: kc.Name}
+}
+
+// instanceSelector selects the objects generated for kc
+func instanceSelector(kc *v1alpha1.Keycloak) string {
+	return labels.SelectorFromSet(instanceLabels(kc)).String()
+}
+
+// ownerReference makes kc the controller of an object so it is garbage collected along with kc
+func ownerReference(kc *v1alpha1.Keycloak) v12.OwnerReference {
+	return *v12.NewControllerRef(kc, schema.GroupVersionKind{
+		Group:   v1alpha1.Group,
+		Version: v1alpha1.Version,
+		Kind:    v1alpha1.KeycloakKind,
+	})
+}
+
+// labelObject sets the instance labels of kc on o, keeping its other labels
+func labelObject(kc *v1alpha1.Keycloak, o v12.Object) {
+	l := o.GetLabels()
+	if l == nil {
+		l = map[string]string{}
+	}
+	for k, v := range instanceLabels(kc) {
+		l[k] = v
+	}
+	o.SetLabels(l)
+}
+
+// ownObject sets the instance labels of kc on o and kc as its controller, unless o already has one
+func ownObject(kc *v1alpha1.Keycloak, o v12.Object) {
+	labelObject(kc, o)
+	if v12.GetControllerOf(o) == nil {
+		o.SetOwnerReferences(append(o.GetOwnerReferences(), ownerReference(kc)))
+	}
+}
+
+// ownObjects is ownObject for the install objects of kc. The volume claim templates of stateful sets get the instance
+// labels too so Deprovision deletes their claims
+func ownObjects(kc *v1alpha1.Keycloak, objects []runtime.Object) error {
+	for _, o := range objects {
+		accessor, err := meta.Accessor(o)
+		if err != nil {
+			return errors.Wrap(err, "failed to access the metadata of "+o.GetObjectKind().GroupVersionKind().String())
+		}
+		ownObject(kc, accessor)
+		if statefulSet, ok := o.(*appsv1.StatefulSet); ok {
+			for i := range statefulSet.Spec.VolumeClaimTemplates {
+				labelObject(kc, &statefulSet.Spec.VolumeClaimTemplates[i])
+			}
+		}
+	}
+	return nil
+}
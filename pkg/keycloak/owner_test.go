@@ -0,0 +1,87 @@
+package keycloak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPhaseHandlerOwnsInstallObjects(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(externalDatabaseSecret(), &corev1.Secret{
+		ObjectMeta: v12.ObjectMeta{Name: "credential-keycloak", Namespace: "test-namespace"},
+	})
+	resources := newFakeResourceClients()
+	ph := NewPhaseHandler(k8sClient, nil, nil, resources.Factory)
+	kc := externalDatabaseKeycloak(nil)
+	kc.UID = "keycloak-uid"
+	kc.Status.ApplicationName = "keycloak"
+
+	if _, err := ph.ProvisionApplication(kc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := resources.Names()
+	if len(names) == 0 {
+		t.Fatal("expected install objects to be created")
+	}
+	for _, name := range names {
+		kindName := strings.SplitN(name, "/", 2)
+		o := resources.Get(kindName[0], kindName[1])
+		if o.GetLabels()[SSO_INSTANCE_LABEL] != kc.Name || o.GetLabels()["application"] != applicationName(kc) {
+			t.Fatalf("expected %s to carry the instance label, got %v", name, o.GetLabels())
+		}
+		owner := v12.GetControllerOf(o)
+		if owner == nil || owner.Kind != v1alpha1.KeycloakKind || owner.UID != kc.UID {
+			t.Fatalf("expected %s to be owned by the keycloak, got %v", name, o.GetOwnerReferences())
+		}
+	}
+}
+
+func TestPhaseHandlerDeprovisionScope(t *testing.T) {
+	cases := []struct {
+		Name             string
+		ApplicationName  string
+		ExpectedSelector string
+	}{
+		{
+			Name:             "Instance named after the keycloak",
+			ApplicationName:  "keycloak",
+			ExpectedSelector: "application=keycloak,sso=keycloak",
+		},
+		{
+			Name:             "Instance provisioned before the names were derived",
+			ExpectedSelector: "application=sso,sso=keycloak",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset()
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+				Status:     v1alpha1.KeycloakStatus{Platform: v1alpha1.PlatformKubernetes, ApplicationName: tc.ApplicationName},
+			}
+
+			if _, err := ph.Deprovision(kc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			deleted := 0
+			for _, action := range k8sClient.Actions() {
+				if collection, ok := action.(k8stesting.DeleteCollectionAction); ok {
+					deleted++
+					if selector := collection.GetListRestrictions().Labels.String(); selector != tc.ExpectedSelector {
+						t.Fatalf("expected %s to be deleted by the instance selector, got '%s'", collection.GetResource().Resource, selector)
+					}
+				}
+			}
+			if deleted == 0 {
+				t.Fatal("expected the objects of the instance to be deleted")
+			}
+		})
+	}
+}
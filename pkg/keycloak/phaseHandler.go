@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"github.com/integr8ly/keycloak-operator/pkg/util"
 	"github.com/sirupsen/logrus"
-	batchv1 "k8s.io/api/batch/v1"
-	"k8s.io/api/batch/v1beta1"
 	"strings"
 
 	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
@@ -16,6 +14,8 @@ import (
 	"k8s.io/api/core/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
@@ -25,6 +25,9 @@ type phaseHandler struct {
 	dynamicResourceClientFactory func(apiVersion, kind, namespace string) (dynamic.ResourceInterface, string, error)
 	ocRouteClient                v13.RouteV1Interface
 	ocDCClient                   v14.AppsV1Interface
+	platforms                    map[v1alpha1.Platform]platform
+	// kcClientFactory talks to the admin API of provisioned instances, such as to rotate their admin credentials
+	kcClientFactory KeycloakClientFactory
 }
 
 func NewPhaseHandler(k8sClient kubernetes.Interface, ocRouteClient v13.RouteV1Interface, ocDCClient v14.AppsV1Interface, dynamicResourceClientFactory func(apiVersion, kind, namespace string) (dynamic.ResourceInterface, string, error)) *phaseHandler {
@@ -33,7 +36,25 @@ func NewPhaseHandler(k8sClient kubernetes.Interface, ocRouteClient v13.RouteV1In
 		dynamicResourceClientFactory: dynamicResourceClientFactory,
 		ocRouteClient:                ocRouteClient,
 		ocDCClient:                   ocDCClient,
+		platforms: map[v1alpha1.Platform]platform{
+			v1alpha1.PlatformOpenShift:  &openshiftPlatform{k8sClient: k8sClient, ocRouteClient: ocRouteClient, ocDCClient: ocDCClient},
+			v1alpha1.PlatformKubernetes: &kubernetesPlatform{k8sClient: k8sClient},
+		},
+	}
+}
+
+// platformFor returns the platform an instance was provisioned on. Instances initialised before the
+// platform was recorded in their status were all provisioned on OpenShift
+func (ph *phaseHandler) platformFor(kc *v1alpha1.Keycloak) (platform, error) {
+	name := kc.Status.Platform
+	if name == "" {
+		name = v1alpha1.PlatformOpenShift
+	}
+	p, ok := ph.platforms[name]
+	if !ok {
+		return nil, errors.Errorf("unsupported platform '%s'", name)
 	}
+	return p, nil
 }
 
 func (ph *phaseHandler) Initialise(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
@@ -55,9 +76,36 @@ func (ph *phaseHandler) Initialise(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak,
 			return nil, err
 		}
 	}
+	kcState.Status.Platform = kcState.Spec.Platform
+	if kcState.Status.Platform == "" {
+		kcState.Status.Platform, err = detectPlatform(ph.k8sClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p, err := ph.platformFor(kcState)
+	if err != nil {
+		return nil, errors.Wrap(err, "validation failed")
+	}
+	kcState.Status.ApplicationName = kcState.Name
+	if errs := validation.IsDNS1035Label(databaseName(kcState)); kcState.Spec.Provision && len(errs) > 0 {
+		return nil, errors.Errorf("validation failed: the names generated for %s are invalid: %s", kcState.Name, strings.Join(errs, ", "))
+	}
 	// set the phase to accepted or set a message that it cannot be accepted
 	kcState.Status.Phase = v1alpha1.PhaseAccepted
-	kcState.Status.Version = SSO_VERSION
+	release, err := targetRelease(kcState)
+	if err != nil {
+		return nil, errors.Wrap(err, "validation failed")
+	}
+	kcState.Status.Version = release.Version
+	kcState.Status.Image = kcState.Spec.Image
+	if kcState.Spec.Provision {
+		verifyOverrides(kcState, p)
+		if brokenOverrides(kcState) {
+			// stay unaccepted until a change of the spec fixes the overrides
+			kcState.Status.Phase = v1alpha1.NoPhase
+		}
+	}
 	return kcState, nil
 }
 
@@ -81,9 +129,10 @@ func (ph *phaseHandler) Accepted(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, er
 			Kind:       "Secret",
 		},
 		ObjectMeta: v12.ObjectMeta{
-			Labels:    map[string]string{"application": "sso", "sso": kc.Name},
-			Namespace: namespace,
-			Name:      "credential-" + kc.Name,
+			Labels:          instanceLabels(kc),
+			Namespace:       namespace,
+			Name:            "credential-" + kc.Name,
+			OwnerReferences: []v12.OwnerReference{ownerReference(kc)},
 		},
 		Data: data,
 		Type: "Opaque",
@@ -97,140 +146,29 @@ func (ph *phaseHandler) Accepted(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, er
 	kc.Status.Phase = v1alpha1.PhaseAwaitProvision
 	if sso.Spec.Provision {
 		kc.Status.Phase = v1alpha1.PhaseProvisionDataLayer
-	}
-	return kc, nil
-}
-
-// Upgrade will perform the necessary actions to do the upgrade for an in place sso instance
-// Note we rely on imagestreams that the operator itself does not install (these are installed currently by the installer in the openshift ns )
-func (ph *phaseHandler) Upgrade(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
-	cpSSO := sso.DeepCopy()
-	if !CanUpgrade(cpSSO.Status.Version) || (cpSSO.Status.Phase != v1alpha1.PhaseUpgrading && cpSSO.Status.Phase != v1alpha1.PhaseReconcile) {
-		cpSSO.Status.Message = "not upgrading. Version is either current or there is no upgrade path."
-		return cpSSO, nil
-	}
-	logrus.Info("Can upgrade")
-	dc, err := ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Get(SSO_APPLICATION_NAME, v12.GetOptions{})
-	if err != nil {
-		return cpSSO, errors.Wrap(err, "failed to get current deploymentconfig for sso")
-	}
-	if cpSSO.Status.Phase == v1alpha1.PhaseReconcile {
-		logrus.Infof("marking for upgrade %s %s", cpSSO.Status.Version, cpSSO.Status.Phase)
-		cpSSO.Status.Phase = v1alpha1.PhaseUpgrading
-		cpSSO.Status.Replicas = dc.Spec.Replicas
-		return cpSSO, nil
-	}
-
-	logrus.Info(" starting upgrade")
-
-	// scale down pod  ( we need to do this for RH-SSO to allow DB schema to be applied by the new image)
-	dc, err = ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Get(SSO_APPLICATION_NAME, v12.GetOptions{})
-	if err != nil {
-		return cpSSO, errors.Wrap(err, "failed to get current scale for sso")
-	}
-
-	if !DeploymentUpgraded(dc.DeepCopy()) {
-		if dc.Spec.Replicas > 0 {
-			logrus.Debug("scaling down rh-sso")
-			newScale := dc.DeepCopy()
-			newScale.Spec.Replicas = 0
-			dc, err = ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Update(newScale)
-			if err != nil {
-				return cpSSO, errors.Wrap(err, "failed to update deploymentconfig for sso during upgrade when trying to scale down ")
-			}
-		}
-		// ensure fresh copy
-		dc, err = ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Get(SSO_APPLICATION_NAME, v12.GetOptions{})
-		if err != nil {
-			return cpSSO, errors.Wrap(err, "failed to get current dc for sso during upgrade")
-		}
-		if dc.Status.Replicas != 0 && dc.Status.AvailableReplicas != 0 {
-			logrus.Debug("not yet scaled down waiting")
-			return cpSSO, nil
+		if sso.Spec.ExternalDatabase != nil {
+			// there is no data layer to provision or wait for
+			kc.Status.Phase = v1alpha1.PhaseProvisionApplication
 		}
-
-		logrus.Debug("upgrading deployment config")
-		upgradedDc := UpgradeDeploymentConfig(dc)
-		dc, err = ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Update(upgradedDc)
-		if err != nil {
-			return cpSSO, errors.Wrap(err, "failed to update deployment config for sso during upgrade")
-		}
-	}
-	// dc upgraded moving on to service
-	svc, err := ph.k8sClient.CoreV1().Services(cpSSO.Namespace).Get(fmt.Sprintf("%s-ping", SSO_APPLICATION_NAME), v12.GetOptions{})
-	if err != nil {
-		return cpSSO, errors.Wrap(err, "failed to get the ping service during upgrade")
-	}
-
-	if !ServiceUpgraded(svc) {
-		logrus.Debug("service being upgraded ", svc.Name)
-		upgradedSvc := UpgradeService(svc.DeepCopy())
-		if _, err := ph.k8sClient.CoreV1().Services(upgradedSvc.Namespace).Update(upgradedSvc); err != nil {
-			return cpSSO, errors.Wrap(err, "failed to update the service "+upgradedSvc.Name+" during upgrade")
-		}
-	}
-	logrus.Debug("upgrade completed scaling the replicas back up to original")
-	dc, err = ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Get(SSO_APPLICATION_NAME, v12.GetOptions{})
-	if err != nil {
-		return cpSSO, errors.Wrap(err, "failed to get current scale for sso")
-	}
-	if dc.Spec.Replicas == 0 {
-		logrus.Debug("scaling replicas to ", cpSSO.Status.Replicas)
-		dc.Spec.Replicas = cpSSO.Status.Replicas
-		if _, err := ph.ocDCClient.DeploymentConfigs(cpSSO.Namespace).Update(dc); err != nil {
-			return cpSSO, errors.Wrap(err, "failed to update sso deploymentconfig after replacing the image stream trigger and scaling back to 1")
-		}
-	}
-
-	if dc.Status.Replicas != cpSSO.Status.Replicas && dc.Status.AvailableReplicas != cpSSO.Status.Replicas {
-		logrus.Debug("not yet scaled up waiting")
-		return cpSSO, nil
 	}
-	// check pods are ready
-	pods, err := ph.k8sClient.CoreV1().Pods(cpSSO.Namespace).List(v12.ListOptions{LabelSelector: "application=sso"})
-	if err != nil {
-		return cpSSO, errors.Wrap(err, "failed waiting for sso pod to be ready")
-	}
-	for _, p := range pods.Items {
-		for _, ps := range p.Status.ContainerStatuses {
-			if !ps.Ready {
-				logrus.Debug("containers not ready yet")
-				return cpSSO, nil
-			}
-		}
-	}
-	cpSSO.Status.Version = SSO_VERSION
-	cpSSO.Status.Phase = v1alpha1.PhaseReconcile
-	return cpSSO, nil
+	return kc, nil
 }
 
 func (ph *phaseHandler) ProvisionDataLayer(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
 	// copy state and modify return state
 	kc := sso.DeepCopy()
-	secretName := "credential-" + kc.Name
-
-	adminCreds, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(secretName, v12.GetOptions{})
+	p, err := ph.platformFor(kc)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get the secret for the admin credentials")
+		return nil, err
 	}
-
-	// List of plugins passed in the custom resource
-	plugins := sso.Spec.Plugins
-	decodedParams := map[string]string{
-		"SSO_PLUGINS": strings.Join(plugins, ","),
-	}
-
-	for k, v := range adminCreds.Data {
-		decodedParams[k] = string(v)
-	}
-	objects, err := GetInstallResourcesAsRuntimeObjects(kc, decodedParams)
+	objects, err := ph.installObjects(kc, p, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get runtime objects during provision")
+		return nil, err
 	}
 	for _, o := range objects {
 		unstructObj, err := k8sutil.UnstructuredFromRuntimeObject(o)
 		// only create postgresql now
-		if !strings.Contains(unstructObj.GetName(), "postgresql") {
+		if !dataLayerObject(kc, unstructObj.GetName()) {
 			continue
 		}
 		logrus.Infof("Creating %v", unstructObj.GetName())
@@ -255,8 +193,12 @@ func (ph *phaseHandler) ProvisionDataLayer(sso *v1alpha1.Keycloak) (*v1alpha1.Ke
 
 func (ph *phaseHandler) WaitForDataLayer(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
 	kc := sso.DeepCopy()
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return nil, err
+	}
 	podList, err := ph.k8sClient.CoreV1().Pods(kc.Namespace).List(v12.ListOptions{
-		LabelSelector:        fmt.Sprintf("deploymentConfig=%v", "sso-postgresql"),
+		LabelSelector:        p.DataLayerSelector(kc),
 		IncludeUninitialized: false,
 	})
 
@@ -290,60 +232,33 @@ func (ph *phaseHandler) WaitForDataLayer(sso *v1alpha1.Keycloak) (*v1alpha1.Keyc
 func (ph *phaseHandler) ProvisionApplication(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
 	// copy state and modify return state
 	kc := sso.DeepCopy()
-	secretName := "credential-" + kc.Name
-
-	adminCreds, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(secretName, v12.GetOptions{})
+	p, err := ph.platformFor(kc)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get the secret for the admin credentials")
+		return nil, err
 	}
 
 	//get DB Password
-	podList, err := ph.k8sClient.CoreV1().Pods(kc.Namespace).List(v12.ListOptions{
-		LabelSelector:        fmt.Sprintf("deploymentConfig=%v", "sso-postgresql"),
-		IncludeUninitialized: false,
-	})
-
-	if err != nil || len(podList.Items) == 0 {
-		return kc, nil
-	}
-	dbPassword := ""
-	dbUsername := ""
-	for _, pod := range podList.Items {
-		for _, container := range pod.Spec.Containers {
-			for _, envVar := range container.Env {
-				if envVar.Name == "POSTGRESQL_USER" {
-					dbUsername = envVar.Value
-				}
-				if envVar.Name == "POSTGRESQL_PASSWORD" {
-					dbPassword = envVar.Value
-				}
-			}
+	var dbCreds *databaseCredentials
+	if kc.Spec.ExternalDatabase != nil {
+		dbCreds, err = externalDatabaseCredentials(ph.k8sClient, kc)
+		if err != nil {
+			return nil, err
 		}
-		if dbPassword == "" || dbUsername == "" {
-			logrus.Infof("could not find Postgres username and password env vars")
+	} else {
+		dbCreds = ph.bundledDatabaseCredentials(kc, p)
+		if dbCreds == nil {
 			return kc, nil
 		}
 	}
 
-	// List of plugins passed in the custom resource
-	plugins := sso.Spec.Plugins
-	decodedParams := map[string]string{
-		"SSO_PLUGINS": strings.Join(plugins, ","),
-		"DB_PASSWORD": dbPassword,
-		"DB_USERNAME": dbUsername,
-	}
-
-	for k, v := range adminCreds.Data {
-		decodedParams[k] = string(v)
-	}
-	objects, err := GetInstallResourcesAsRuntimeObjects(kc, decodedParams)
+	objects, err := ph.installObjects(kc, p, dbCreds)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get runtime objects during provision")
+		return nil, err
 	}
 	for _, o := range objects {
 		unstructObj, err := k8sutil.UnstructuredFromRuntimeObject(o)
 		// dont create postgresql now
-		if strings.Contains(unstructObj.GetName(), "postgresql") {
+		if dataLayerObject(kc, unstructObj.GetName()) {
 			continue
 		}
 		logrus.Infof("Creating %v", unstructObj.GetName())
@@ -367,10 +282,112 @@ func (ph *phaseHandler) ProvisionApplication(sso *v1alpha1.Keycloak) (*v1alpha1.
 	return kc, nil
 }
 
+// installObjects renders the install objects of kc the way they are provisioned. The template generates the database
+// credentials when dbCreds is nil, the bundled workloads read them from the database secret which is created from the
+// rendered credentials when it doesn't exist yet
+func (ph *phaseHandler) installObjects(kc *v1alpha1.Keycloak, p platform, dbCreds *databaseCredentials) ([]runtime.Object, error) {
+	secretName := "credential-" + kc.Name
+	adminCreds, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(secretName, v12.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the secret for the admin credentials")
+	}
+
+	// List of plugins passed in the custom resource
+	plugins := kc.Spec.Plugins
+	decodedParams := map[string]string{
+		"APPLICATION_NAME": applicationName(kc),
+		"SSO_PLUGINS":      strings.Join(plugins, ","),
+	}
+	if dbCreds != nil {
+		decodedParams["DB_PASSWORD"] = dbCreds.Password
+		decodedParams["DB_USERNAME"] = dbCreds.Username
+		if dbCreds.Database != "" {
+			decodedParams["DB_DATABASE"] = dbCreds.Database
+		}
+	}
+
+	for k, v := range adminCreds.Data {
+		decodedParams[k] = string(v)
+	}
+	objects, err := p.InstallResources(kc, decodedParams)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get runtime objects during provision")
+	}
+	applySizing(objects, kc)
+	for _, o := range objects {
+		applyExtensions(kc, o)
+	}
+	if err := ph.applyExposure(kc, objects); err != nil {
+		return nil, errors.Wrap(err, "failed to apply the exposure")
+	}
+	if kc.Spec.ExternalDatabase == nil {
+		if err := ph.ensureDatabaseSecret(kc, objects); err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			secretDatabaseEnv(kc, o)
+		}
+	}
+	if kc.Spec.ExternalDatabase != nil && dbCreds != nil {
+		objects, err = wireExternalDatabase(objects, kc, dbCreds)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to use the external database")
+		}
+	}
+	if objects, err = applyOverrides(kc, objects); err != nil {
+		return nil, err
+	}
+	if err := ownObjects(kc, objects); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// bundledDatabaseCredentials reads the credentials of the database deployed with the instance from the
+// database pods, it returns nil until they are available
+func (ph *phaseHandler) bundledDatabaseCredentials(kc *v1alpha1.Keycloak, p platform) *databaseCredentials {
+	podList, err := ph.k8sClient.CoreV1().Pods(kc.Namespace).List(v12.ListOptions{
+		LabelSelector:        p.DataLayerSelector(kc),
+		IncludeUninitialized: false,
+	})
+
+	if err != nil || len(podList.Items) == 0 {
+		return nil
+	}
+	dbPassword := ""
+	dbUsername := ""
+	for _, pod := range podList.Items {
+		for _, container := range pod.Spec.Containers {
+			for _, envVar := range container.Env {
+				value, err := ph.envValue(kc.Namespace, envVar)
+				if err != nil {
+					logrus.Infof("could not read the Postgres env vars: %v", err)
+					return nil
+				}
+				if envVar.Name == "POSTGRESQL_USER" {
+					dbUsername = value
+				}
+				if envVar.Name == "POSTGRESQL_PASSWORD" {
+					dbPassword = value
+				}
+			}
+		}
+		if dbPassword == "" || dbUsername == "" {
+			logrus.Infof("could not find Postgres username and password env vars")
+			return nil
+		}
+	}
+	return &databaseCredentials{Username: dbUsername, Password: dbPassword}
+}
+
 func (ph *phaseHandler) WaitForApplication(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
 	kc := sso.DeepCopy()
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return nil, err
+	}
 	podList, err := ph.k8sClient.CoreV1().Pods(kc.Namespace).List(v12.ListOptions{
-		LabelSelector:        fmt.Sprintf("application=%v,deploymentConfig=%v", SSO_APPLICATION_NAME, "sso"),
+		LabelSelector:        p.ApplicationSelector(kc),
 		IncludeUninitialized: false,
 	})
 
@@ -387,23 +404,19 @@ func (ph *phaseHandler) WaitForApplication(sso *v1alpha1.Keycloak) (*v1alpha1.Ke
 			}
 		}
 	}
-	//get the route to keycloak admin
-	routeList, _ := ph.ocRouteClient.Routes(kc.Namespace).List(v12.ListOptions{LabelSelector: "application=sso"})
-	for _, route := range routeList.Items {
-		if route.Spec.To.Name == SSO_ROUTE_NAME {
-			protocol := "https"
-			if route.Spec.TLS == nil {
-				protocol = "http"
-			}
-			url := fmt.Sprintf("%v://%v", protocol, route.Spec.Host)
-			secret, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(kc.Spec.AdminCredentials, v12.GetOptions{})
-			if err != nil {
-				return nil, errors.Wrap(err, "could not retrieve admin secret")
-			}
-			secret.Data["SSO_ADMIN_URL"] = []byte(url)
-			if _, err = ph.k8sClient.CoreV1().Secrets(kc.Namespace).Update(secret); err != nil {
-				return nil, errors.Wrap(err, "could not update admin credentials")
-			}
+	//get the url of keycloak admin
+	url, err := p.AdminURL(kc)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the admin url")
+	}
+	if url != "" {
+		secret, err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).Get(kc.Spec.AdminCredentials, v12.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not retrieve admin secret")
+		}
+		secret.Data["SSO_ADMIN_URL"] = []byte(url)
+		if _, err = ph.k8sClient.CoreV1().Secrets(kc.Namespace).Update(secret); err != nil {
+			return nil, errors.Wrap(err, "could not update admin credentials")
 		}
 	}
 	kc.Status.Phase = v1alpha1.PhaseReconcile
@@ -413,11 +426,36 @@ func (ph *phaseHandler) WaitForApplication(sso *v1alpha1.Keycloak) (*v1alpha1.Ke
 
 func (ph *phaseHandler) Reconcile(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
 	multiError := &util.MultiError{}
-	sso, err := ph.reconcileDBPassword(sso)
+	sso, err := ph.reconcileOverrides(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile overrides"))
+	}
+
+	sso, err = ph.reconcileInstallObjects(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile install objects"))
+	}
+
+	sso, err = ph.reconcileExposure(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile exposure"))
+	}
+
+	sso, err = ph.reconcileDBPassword(sso)
 	if err != nil {
 		multiError.AddError(errors.Wrap(err, "could not reconcile db password"))
 	}
 
+	sso, err = ph.reconcileAdminCredentials(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile admin credentials"))
+	}
+
+	sso, err = ph.reconcileDatabaseCredentials(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile database credentials"))
+	}
+
 	sso, err = ph.reconcileMonitoringResources(sso)
 	if err != nil {
 		multiError.AddError(errors.Wrap(err, "could not reconcile monitoring resources"))
@@ -427,6 +465,16 @@ func (ph *phaseHandler) Reconcile(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, e
 	if err != nil {
 		multiError.AddError(errors.Wrap(err, "could not reconcile backups"))
 	}
+
+	sso, err = ph.reconcileSizing(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile sizing"))
+	}
+
+	sso, err = ph.reconcileExtensions(sso)
+	if err != nil {
+		multiError.AddError(errors.Wrap(err, "could not reconcile extensions"))
+	}
 	if multiError.IsNil() {
 		return sso, nil
 	}
@@ -434,191 +482,107 @@ func (ph *phaseHandler) Reconcile(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, e
 	return sso, multiError
 }
 
-func (ph *phaseHandler) reconcileBackups(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
-	multiError := &util.MultiError{}
-
-	for _, backup := range sso.Spec.Backups {
-		err := ph.reconcileBackup(sso, backup, sso.Namespace)
-		if err != nil {
-			multiError.AddError(err)
+func (ph *phaseHandler) reconcileDBPassword(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	var creds *databaseCredentials
+	var err error
+	if sso.Spec.ExternalDatabase != nil {
+		creds, err = externalDatabaseCredentials(ph.k8sClient, sso)
+	} else {
+		creds, err = ph.deployedDatabaseCredentials(sso)
+		if errors2.IsNotFound(errors.Cause(err)) {
+			// keep the stored credentials until the workload is recreated
+			logrus.Infof("not reconciling the db password of %s/%s, its workload is missing", sso.Namespace, sso.Name)
+			return sso, nil
 		}
 	}
-	if !multiError.IsNil() {
-		return sso, multiError
-	}
-	return sso, nil
-}
-
-func (ph *phaseHandler) reconcileBackup(sso *v1alpha1.Keycloak, backup v1alpha1.KeycloakBackup, namespace string) error {
-	cronJobLabels := map[string]string{"application": "sso", "sso": sso.Name}
-	jobLabels := map[string]string{"cronjob-name": backup.Name}
-	for k, v := range backup.Labels {
-		cronJobLabels[k] = v
-		jobLabels[k] = v
-	}
-	cron := &v1beta1.CronJob{
-		ObjectMeta: v12.ObjectMeta{
-			Name:   backup.Name,
-			Labels: cronJobLabels,
-		},
-		Spec: v1beta1.CronJobSpec{
-			Schedule: backup.Schedule,
-			JobTemplate: v1beta1.JobTemplateSpec{
-				Spec: batchv1.JobSpec{
-					Template: v1.PodTemplateSpec{
-						ObjectMeta: v12.ObjectMeta{
-							Labels: jobLabels,
-						},
-						Spec: v1.PodSpec{
-							ServiceAccountName: "backupjob",
-							Containers: []v1.Container{
-								{
-									Name:    backup.Name + "-keycloak-backup",
-									Image:   backup.Image + ":" + backup.ImageTag,
-									Command: []string{"/opt/intly/tools/entrypoint.sh", "-c", "postgres", "-n", namespace, "-b", "s3", "-e", ""},
-									Env: []v1.EnvVar{
-										{
-											Name:  "BACKEND_SECRET_NAME",
-											Value: backup.AwsCredentialsSecretName,
-										},
-										{
-											Name:  "BACKEND_SECRET_NAMESPACE",
-											Value: backup.AwsCredentialsSecretNamespace,
-										},
-										{
-											Name:  "ENCRYPTION_SECRET_NAME",
-											Value: backup.EncryptionKeySecretName,
-										},
-										{
-											Name:  "COMPONENT_SECRET_NAME",
-											Value: "db-credentials-" + sso.Name,
-										},
-										{
-											Name:  "COMPONENT_SECRET_NAMESPACE",
-											Value: sso.Namespace,
-										},
-										{
-											Name:  "PRODUCT_NAME",
-											Value: "rhsso",
-										},
-									},
-								},
-							},
-							RestartPolicy: v1.RestartPolicyNever,
-						},
-					},
-				},
-			},
-		},
+	if err != nil {
+		return sso, err
 	}
 
-	_, err := ph.k8sClient.BatchV1beta1().CronJobs(namespace).Create(cron)
+	secrets := ph.k8sClient.CoreV1().Secrets(sso.Namespace)
+	dbCredentialsSecret := databaseSecret(sso, creds)
+	_, err = secrets.Create(dbCredentialsSecret)
 	if err != nil && !errors2.IsAlreadyExists(err) {
-		return errors.Wrapf(err, "error creating cronjob %s/%s", cron.Namespace, cron.Name)
+		return sso, errors.Wrap(err, "could not create db credentials secret")
 	}
 	if err != nil && errors2.IsAlreadyExists(err) {
-		_, err := ph.k8sClient.BatchV1beta1().CronJobs(namespace).Update(cron)
+		existing, err := secrets.Get(dbCredentialsSecret.Name, v12.GetOptions{})
 		if err != nil {
-			return errors.Wrapf(err, "could not update cronjob %s/%s", cron.Namespace, cron.Name)
+			return sso, errors.Wrap(err, "could not get db credentials secret")
+		}
+		// keep the other keys, such as the password of a running rotation
+		if existing.Data == nil {
+			existing.Data = map[string][]byte{}
+		}
+		for k, v := range dbCredentialsSecret.Data {
+			existing.Data[k] = v
+		}
+		if _, err = secrets.Update(existing); err != nil {
+			return sso, errors.Wrap(err, "could not update db credentials secret")
 		}
 	}
 
-	return nil
-}
+	return sso, nil
 
-func (ph *phaseHandler) reconcileDBPassword(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
-	ssoDc, err := ph.ocDCClient.DeploymentConfigs(sso.Namespace).Get("sso", v12.GetOptions{})
-	if err != nil {
-		return sso, errors.Wrap(err, "could not get 'sso' deploymentconfig")
-	}
+}
 
-	username := ""
-	password := ""
-	host := "sso-postgresql." + sso.Namespace + ".svc"
+// databaseSecret is the secret holding creds for the database of sso
+func databaseSecret(sso *v1alpha1.Keycloak, creds *databaseCredentials) *v1.Secret {
 	superuser := "false"
-	superuserdb := ""
-	for _, envVar := range ssoDc.Spec.Template.Spec.Containers[0].Env {
-		if envVar.Name == "DB_USERNAME" {
-			username = envVar.Value
-		}
-		if envVar.Name == "DB_PASSWORD" {
-			password = envVar.Value
-		}
-		if envVar.Name == "DB_DATABASE" {
-			superuserdb = envVar.Value
-		}
-	}
-	data := map[string][]byte{
-		"POSTGRES_USERNAME":  []byte(username),
-		"POSTGRES_PASSWORD":  []byte(password),
-		"POSTGRES_DATABASE":  []byte(superuserdb),
-		"POSTGRES_HOST":      []byte(host),
-		"POSTGRES_SUPERUSER": []byte(superuser),
-	}
-	dbCredentialsSecret := &v1.Secret{
+	return &v1.Secret{
 		TypeMeta: v12.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "Secret",
 		},
 		ObjectMeta: v12.ObjectMeta{
-			Labels:    map[string]string{"application": "sso", "sso": sso.Name},
-			Namespace: sso.Namespace,
-			Name:      "db-credentials-" + sso.Name,
+			Labels:          instanceLabels(sso),
+			Namespace:       sso.Namespace,
+			Name:            databaseSecretName(sso),
+			OwnerReferences: []v12.OwnerReference{ownerReference(sso)},
+		},
+		Data: map[string][]byte{
+			"POSTGRES_USERNAME":  []byte(creds.Username),
+			"POSTGRES_PASSWORD":  []byte(creds.Password),
+			"POSTGRES_DATABASE":  []byte(creds.Database),
+			"POSTGRES_HOST":      []byte(creds.Host),
+			"POSTGRES_PORT":      []byte(fmt.Sprintf("%d", creds.Port)),
+			"POSTGRES_SUPERUSER": []byte(superuser),
 		},
-		Data: data,
 		Type: "Opaque",
 	}
-	_, err = ph.k8sClient.CoreV1().Secrets(sso.Namespace).Create(dbCredentialsSecret)
-	if err != nil && !errors2.IsAlreadyExists(err) {
-		return sso, errors.Wrap(err, "could not create db credentials secret")
-	}
-	if err != nil && errors2.IsAlreadyExists(err) {
-		_, err = ph.k8sClient.CoreV1().Secrets(sso.Namespace).Update(dbCredentialsSecret)
-		if err != nil {
-			return sso, errors.Wrap(err, "could not update db credentials secret")
-		}
-	}
-
-	return sso, nil
-
 }
 
-func (ph *phaseHandler) reconcileMonitoringResources(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
-	kc := sso.DeepCopy()
-	if kc.Status.MonitoringResourcesCreated == false {
-		created, err := ph.reconcileMonitoringResource(kc, GrafanaDashboardName)
-		if err != nil || !created {
-			return kc, err
-		}
-
-		created, err = ph.reconcileMonitoringResource(kc, ServiceMonitorName)
-		if err != nil || !created {
-			return kc, err
-		}
-
-		created, err = ph.reconcileMonitoringResource(kc, PrometheusRuleName)
-		if err != nil || !created {
-			return kc, err
-		}
-
-		kc.Status.MonitoringResourcesCreated = true
-		return kc, nil
+// deployedDatabaseCredentials reads the credentials of the bundled database from the deployed Keycloak container
+func (ph *phaseHandler) deployedDatabaseCredentials(sso *v1alpha1.Keycloak) (*databaseCredentials, error) {
+	p, err := ph.platformFor(sso)
+	if err != nil {
+		return nil, err
 	}
-
-	return kc, nil
-}
-
-func (ph *phaseHandler) reconcileMonitoringResource(sso *v1alpha1.Keycloak, resource string) (bool, error) {
-	created, err := ph.createResource(sso, resource)
+	container, err := p.ApplicationContainer(sso)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	if created {
-		return true, nil
+	creds := &databaseCredentials{
+		Host: databaseHost(sso),
+		Port: POSTGRES_PORT,
 	}
-
-	return false, nil
+	for _, envVar := range container.Env {
+		value, err := ph.envValue(sso.Namespace, envVar)
+		if err != nil {
+			return nil, err
+		}
+		if envVar.Name == "DB_USERNAME" {
+			creds.Username = value
+		}
+		if envVar.Name == "DB_PASSWORD" {
+			creds.Password = value
+		}
+		if envVar.Name == "DB_DATABASE" {
+			creds.Database = value
+		}
+	}
+	return creds, nil
 }
 
 func (ph *phaseHandler) Deprovision(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
@@ -629,19 +593,19 @@ func (ph *phaseHandler) Deprovision(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak,
 	}
 	namespace := kc.ObjectMeta.Namespace
 	deleteOpts := v12.NewDeleteOptions(0)
-	listOpts := v12.ListOptions{LabelSelector: "application=sso"}
-	// delete dcs
-	if err := ph.ocDCClient.DeploymentConfigs(namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
-		return nil, errors.Wrap(err, "failed to remove the deployment configs")
+	listOpts := v12.ListOptions{LabelSelector: instanceSelector(kc)}
+	// delete the workloads and how they are exposed
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Deprovision(kc, deleteOpts, listOpts); err != nil {
+		return nil, err
 	}
 	// delete pvc
-	if err := ph.k8sClient.CoreV1().PersistentVolumeClaims(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+	if err := ph.k8sClient.CoreV1().PersistentVolumeClaims(namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
 		return nil, errors.Wrap(err, "failed to remove the pvc")
 	}
-	// delete routes
-	if err := ph.ocRouteClient.Routes(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
-		return nil, errors.Wrap(err, "failed to remove the routes")
-	}
 
 	// delete secrets
 	if err := ph.k8sClient.CoreV1().Secrets(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
@@ -656,6 +620,14 @@ func (ph *phaseHandler) Deprovision(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak,
 	if err := ph.k8sClient.BatchV1beta1().CronJobs(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
 		return nil, errors.Wrap(err, "failed to delete all cronjobs for sso")
 	}
+	// delete the jobs of pre-upgrade backups and restores
+	if err := ph.k8sClient.BatchV1().Jobs(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return nil, errors.Wrap(err, "failed to delete all jobs for sso")
+	}
+	// delete pod disruption budgets
+	if err := ph.k8sClient.PolicyV1beta1().PodDisruptionBudgets(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return nil, errors.Wrap(err, "failed to delete all pod disruption budgets for sso")
+	}
 
 	// todo handle more than one error
 	var errs []string
@@ -671,29 +643,3 @@ func (ph *phaseHandler) Deprovision(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak,
 	}
 	return kc, nil
 }
-
-// Creates a generic kubernetes resource from a templates
-func (ph *phaseHandler) createResource(sso *v1alpha1.Keycloak, resourceName string) (bool, error) {
-	kc := sso.DeepCopy()
-	resourceHelper := newResourceHelper(kc)
-	resource, err := resourceHelper.createResource(resourceName)
-	if err != nil {
-		return false, err
-	}
-
-	gvk := resource.GetObjectKind().GroupVersionKind()
-	apiVersion, kind := gvk.ToAPIVersionAndKind()
-	resourceClient, _, err := ph.dynamicResourceClientFactory(apiVersion, kind, kc.Namespace)
-	if err != nil {
-		// The resource cannot be created because the CRD is not installed in the cluster.
-		// We can try again later.
-		return false, nil
-	}
-
-	resource, err = resourceClient.Create(resource)
-	if err != nil && !errors2.IsAlreadyExists(err) {
-		return false, errors.Wrap(err, "failed to create unstructured object")
-	}
-
-	return true, nil
-}
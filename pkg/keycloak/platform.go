@@ -0,0 +1,137 @@
+package keycloak
+
+import (
+	"fmt"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	v14 "github.com/openshift/client-go/apps/clientset/versioned/typed/apps/v1"
+	v13 "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	openshiftAppsGroup  = "apps.openshift.io"
+	openshiftRouteGroup = "route.openshift.io"
+)
+
+// platform renders and inspects the workloads of a provisioned Keycloak instance on a kind of cluster
+type platform interface {
+	// InstallResources returns every object making up the instance, the data layer objects are named *postgresql*
+	InstallResources(kc *v1alpha1.Keycloak, params map[string]string) ([]runtime.Object, error)
+	// DataLayerSelector selects the database pods
+	DataLayerSelector(kc *v1alpha1.Keycloak) string
+	// ApplicationSelector selects the Keycloak pods
+	ApplicationSelector(kc *v1alpha1.Keycloak) string
+	// ApplicationContainer returns the Keycloak container of the deployed workload
+	ApplicationContainer(kc *v1alpha1.Keycloak) (*v1.Container, error)
+	// Workloads returns the deployed Keycloak and database workloads, the database is nil when it isn't deployed
+	Workloads(kc *v1alpha1.Keycloak) (application, database *workload, err error)
+	// AdminURL returns the URL the instance is exposed on, or an empty string when it isn't exposed yet
+	AdminURL(kc *v1alpha1.Keycloak) (string, error)
+	// Deprovision removes the platform specific workloads of the instance
+	Deprovision(kc *v1alpha1.Keycloak, deleteOpts *v12.DeleteOptions, listOpts v12.ListOptions) error
+}
+
+// detectPlatform returns OpenShift when the cluster serves the DeploymentConfig and Route APIs, Kubernetes otherwise
+func detectPlatform(k8sClient kubernetes.Interface) (v1alpha1.Platform, error) {
+	groups, err := k8sClient.Discovery().ServerGroups()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to discover the api groups served by the cluster")
+	}
+	found := map[string]bool{}
+	for _, g := range groups.Groups {
+		found[g.Name] = true
+	}
+	if found[openshiftAppsGroup] && found[openshiftRouteGroup] {
+		return v1alpha1.PlatformOpenShift, nil
+	}
+	return v1alpha1.PlatformKubernetes, nil
+}
+
+type openshiftPlatform struct {
+	k8sClient     kubernetes.Interface
+	ocRouteClient v13.RouteV1Interface
+	ocDCClient    v14.AppsV1Interface
+}
+
+func (p *openshiftPlatform) InstallResources(kc *v1alpha1.Keycloak, params map[string]string) ([]runtime.Object, error) {
+	objects, err := GetInstallResourcesAsRuntimeObjects(kc, params)
+	if err != nil {
+		return nil, err
+	}
+	return applyImage(objects, kc)
+}
+
+func (p *openshiftPlatform) DataLayerSelector(kc *v1alpha1.Keycloak) string {
+	return fmt.Sprintf("deploymentConfig=%v", databaseName(kc))
+}
+
+func (p *openshiftPlatform) ApplicationSelector(kc *v1alpha1.Keycloak) string {
+	return fmt.Sprintf("application=%v,deploymentConfig=%v", applicationName(kc), applicationName(kc))
+}
+
+func (p *openshiftPlatform) ApplicationContainer(kc *v1alpha1.Keycloak) (*v1.Container, error) {
+	ssoDc, err := p.ocDCClient.DeploymentConfigs(kc.Namespace).Get(applicationName(kc), v12.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get '%s' deploymentconfig", applicationName(kc))
+	}
+	return &ssoDc.Spec.Template.Spec.Containers[0], nil
+}
+
+func (p *openshiftPlatform) Workloads(kc *v1alpha1.Keycloak) (*workload, *workload, error) {
+	dcClient := p.ocDCClient.DeploymentConfigs(kc.Namespace)
+	ssoDc, err := dcClient.Get(applicationName(kc), v12.GetOptions{})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not get '%s' deploymentconfig", applicationName(kc))
+	}
+	application := &workload{object: ssoDc, rolledOut: deploymentConfigRolledOut(ssoDc), update: func() error {
+		_, err := dcClient.Update(ssoDc)
+		return err
+	}}
+	dbDc, err := dcClient.Get(databaseName(kc), v12.GetOptions{})
+	if errors2.IsNotFound(err) {
+		return application, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not get '%s' deploymentconfig", databaseName(kc))
+	}
+	database := &workload{object: dbDc, rolledOut: deploymentConfigRolledOut(dbDc), update: func() error {
+		_, err := dcClient.Update(dbDc)
+		return err
+	}}
+	return application, database, nil
+}
+
+func (p *openshiftPlatform) AdminURL(kc *v1alpha1.Keycloak) (string, error) {
+	routeList, err := p.ocRouteClient.Routes(kc.Namespace).List(v12.ListOptions{LabelSelector: instanceSelector(kc)})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list the sso routes")
+	}
+	for _, route := range routeList.Items {
+		if route.Spec.To.Name == applicationName(kc) {
+			protocol := "https"
+			if route.Spec.TLS == nil {
+				protocol = "http"
+			}
+			return fmt.Sprintf("%v://%v", protocol, route.Spec.Host), nil
+		}
+	}
+	return "", nil
+}
+
+func (p *openshiftPlatform) Deprovision(kc *v1alpha1.Keycloak, deleteOpts *v12.DeleteOptions, listOpts v12.ListOptions) error {
+	// delete dcs
+	if err := p.ocDCClient.DeploymentConfigs(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return errors.Wrap(err, "failed to remove the deployment configs")
+	}
+	// delete routes
+	if err := p.ocRouteClient.Routes(kc.Namespace).DeleteCollection(deleteOpts, listOpts); err != nil {
+		return errors.Wrap(err, "failed to remove the routes")
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package keycloak
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func fakeClientWithGroups(groupVersions ...string) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	for _, gv := range groupVersions {
+		discovery.Resources = append(discovery.Resources, &v12.APIResourceList{GroupVersion: gv})
+	}
+	return client
+}
+
+func TestPhaseHandlerInitialiseSelectsPlatform(t *testing.T) {
+	cases := []struct {
+		Name             string
+		GroupVersions    []string
+		SpecPlatform     v1alpha1.Platform
+		ExpectedPlatform v1alpha1.Platform
+		ExpectError      bool
+	}{
+		{
+			Name:             "OpenShift detected",
+			GroupVersions:    []string{"v1", "apps/v1", "apps.openshift.io/v1", "route.openshift.io/v1"},
+			ExpectedPlatform: v1alpha1.PlatformOpenShift,
+		},
+		{
+			Name:             "Kubernetes detected",
+			GroupVersions:    []string{"v1", "apps/v1", "extensions/v1beta1"},
+			ExpectedPlatform: v1alpha1.PlatformKubernetes,
+		},
+		{
+			Name:             "Platform set in the spec",
+			GroupVersions:    []string{"v1", "apps/v1", "apps.openshift.io/v1", "route.openshift.io/v1"},
+			SpecPlatform:     v1alpha1.PlatformKubernetes,
+			ExpectedPlatform: v1alpha1.PlatformKubernetes,
+		},
+		{
+			Name:         "Unknown platform",
+			SpecPlatform: "mesos",
+			ExpectError:  true,
+		},
+	}
+
+	os.Setenv("WATCH_NAMESPACE", "test-namespace")
+	defer os.Unsetenv("WATCH_NAMESPACE")
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ph := NewPhaseHandler(fakeClientWithGroups(tc.GroupVersions...), nil, nil, nil)
+			kc := &v1alpha1.Keycloak{
+				ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+				Spec:       v1alpha1.KeycloakSpec{Platform: tc.SpecPlatform},
+			}
+			kcState, err := ph.Initialise(kc)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kcState.Status.Platform != tc.ExpectedPlatform {
+				t.Fatalf("expected platform %s, got %s", tc.ExpectedPlatform, kcState.Status.Platform)
+			}
+		})
+	}
+}
+
+func TestKubernetesPlatformInstallResources(t *testing.T) {
+	p := &kubernetesPlatform{k8sClient: fake.NewSimpleClientset()}
+	kc := &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakSpec{AdminCredentials: "credential-keycloak"},
+	}
+	objects, err := p.InstallResources(kc, map[string]string{"SSO_PLUGINS": "keycloak-metrics-spi", "DB_USERNAME": "user", "DB_PASSWORD": "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	kinds := map[string]string{}
+	for _, o := range objects {
+		unstruct, err := k8sutil.UnstructuredFromRuntimeObject(o)
+		if err != nil {
+			t.Fatalf("unexpected error converting %v: %v", o.GetObjectKind(), err)
+		}
+		if unstruct.GetNamespace() != "test-namespace" || unstruct.GetLabels()["application"] != "sso" {
+			t.Fatalf("expected %s to be labelled and namespaced, got %v in '%s'", unstruct.GetName(), unstruct.GetLabels(), unstruct.GetNamespace())
+		}
+		kinds[unstruct.GetKind()+"/"+unstruct.GetName()] = unstruct.GetAPIVersion()
+	}
+	for _, expected := range []string{"Service/sso", "Service/sso-ping", "Service/sso-postgresql", "Deployment/sso", "StatefulSet/sso-postgresql", "Ingress/sso"} {
+		if _, ok := kinds[expected]; !ok {
+			t.Fatalf("expected %s in the install resources, got %v", expected, kinds)
+		}
+	}
+
+	for _, o := range objects {
+		switch obj := o.(type) {
+		case *appsv1.Deployment:
+			env := map[string]string{}
+			for _, e := range obj.Spec.Template.Spec.Containers[0].Env {
+				env[e.Name] = e.Value
+				if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef.Name != "credential-keycloak" {
+					t.Fatalf("expected %s to come from the admin credentials secret", e.Name)
+				}
+			}
+			if env["DB_USERNAME"] != "user" || env["DB_PASSWORD"] != "secret" {
+				t.Fatalf("expected the database credentials to be passed to keycloak, got %v", env)
+			}
+			if obj.Spec.Template.Spec.InitContainers[0].Env[0].Value != "keycloak-metrics-spi" {
+				t.Fatal("expected the plugins to be passed to the init container")
+			}
+		case *appsv1.StatefulSet:
+			if !strings.Contains(p.DataLayerSelector(kc), obj.Spec.Template.Labels["statefulSet"]) {
+				t.Fatalf("expected the data layer selector to match the postgresql pods, got %v", obj.Spec.Template.Labels)
+			}
+		}
+	}
+}
+
+func TestKubernetesPlatformInstancesSideBySide(t *testing.T) {
+	p := &kubernetesPlatform{k8sClient: fake.NewSimpleClientset()}
+	names := map[string]string{}
+	selectors := map[string]string{}
+	for _, name := range []string{"staging", "prod"} {
+		kc := &v1alpha1.Keycloak{
+			ObjectMeta: v12.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Status:     v1alpha1.KeycloakStatus{ApplicationName: name},
+		}
+		objects, err := p.InstallResources(kc, map[string]string{"DB_USERNAME": "user", "DB_PASSWORD": "secret"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, o := range objects {
+			unstruct, err := k8sutil.UnstructuredFromRuntimeObject(o)
+			if err != nil {
+				t.Fatalf("unexpected error converting %v: %v", o.GetObjectKind(), err)
+			}
+			key := unstruct.GetKind() + "/" + unstruct.GetName()
+			if other, ok := names[key]; ok {
+				t.Fatalf("expected %s of %s not to collide with %s", key, name, other)
+			}
+			names[key] = name
+			if deployment, ok := o.(*appsv1.Deployment); ok {
+				selector := p.ApplicationSelector(kc)
+				for k, v := range deployment.Spec.Template.Labels {
+					selector = strings.Replace(selector, k+"="+v, "", 1)
+				}
+				if strings.Trim(selector, ",") != "" {
+					t.Fatalf("expected the pods of %s to match its selector, %s is not matched by %v", name, selector, deployment.Spec.Template.Labels)
+				}
+			}
+		}
+		if other, ok := selectors[p.ApplicationSelector(kc)]; ok {
+			t.Fatalf("expected the selectors of %s and %s to differ", name, other)
+		}
+		selectors[p.ApplicationSelector(kc)] = name
+		if p.DataLayerSelector(kc) == p.ApplicationSelector(kc) {
+			t.Fatalf("expected the data layer and application selectors of %s to differ", name)
+		}
+	}
+	for _, expected := range []string{"Deployment/staging", "StatefulSet/staging-postgresql", "Deployment/prod", "Service/prod-ping", "Ingress/prod"} {
+		if _, ok := names[expected]; !ok {
+			t.Fatalf("expected %s in the install resources, got %v", expected, names)
+		}
+	}
+}
+
+func TestKubernetesPlatformAdminURL(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Ingress  *extv1beta1.Ingress
+		Expected string
+	}{
+		{
+			Name:     "Ingress without address",
+			Ingress:  kubernetesIngress(&v1alpha1.Keycloak{ObjectMeta: v12.ObjectMeta{Namespace: "test-namespace"}}),
+			Expected: "http://sso.test-namespace.svc:8080",
+		},
+		{
+			Name: "Ingress with a load balancer",
+			Ingress: func() *extv1beta1.Ingress {
+				ingress := kubernetesIngress(&v1alpha1.Keycloak{ObjectMeta: v12.ObjectMeta{Namespace: "test-namespace"}})
+				ingress.Status.LoadBalancer.Ingress = append(ingress.Status.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: "10.0.0.1"})
+				return ingress
+			}(),
+			Expected: "http://10.0.0.1",
+		},
+		{
+			Name: "Ingress with a host and tls",
+			Ingress: func() *extv1beta1.Ingress {
+				ingress := kubernetesIngress(&v1alpha1.Keycloak{ObjectMeta: v12.ObjectMeta{Namespace: "test-namespace"}})
+				ingress.Spec.Rules = []extv1beta1.IngressRule{{Host: "sso.example.com"}}
+				ingress.Spec.TLS = []extv1beta1.IngressTLS{{Hosts: []string{"sso.example.com"}}}
+				return ingress
+			}(),
+			Expected: "https://sso.example.com",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			p := &kubernetesPlatform{k8sClient: fake.NewSimpleClientset(tc.Ingress)}
+			url, err := p.AdminURL(&v1alpha1.Keycloak{ObjectMeta: v12.ObjectMeta{Namespace: "test-namespace"}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if url != tc.Expected {
+				t.Fatalf("expected url %s, got %s", tc.Expected, url)
+			}
+		})
+	}
+}
@@ -2,16 +2,20 @@ package realm
 
 import (
 	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/sirupsen/logrus"
 	"reflect"
-	"strings"
+	"sort"
 
 	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
 	"github.com/integr8ly/keycloak-operator/pkg/keycloak"
+	"github.com/integr8ly/keycloak-operator/pkg/metrics"
 	"github.com/integr8ly/keycloak-operator/pkg/util"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -21,9 +25,11 @@ type phaseHandler struct {
 	operatorNS      string
 	kcClientFactory keycloak.KeycloakClientFactory
 	defaultClients  map[string]struct{}
+	// parallelism is the number of users or clients of a realm reconciled at the same time
+	parallelism int
 }
 
-func NewPhaseHandler(k8sClient kubernetes.Interface, sdk keycloak.SdkCruder, operatorNS string, kcFactory keycloak.KeycloakClientFactory) *phaseHandler {
+func NewPhaseHandler(k8sClient kubernetes.Interface, sdk keycloak.SdkCruder, operatorNS string, kcFactory keycloak.KeycloakClientFactory, parallelism int) *phaseHandler {
 	kcDefaultClients := []string{"account", "admin-cli", "broker", "realm-management", "security-admin-console"}
 	set := make(map[string]struct{}, len(kcDefaultClients))
 	for _, s := range kcDefaultClients {
@@ -35,6 +41,7 @@ func NewPhaseHandler(k8sClient kubernetes.Interface, sdk keycloak.SdkCruder, ope
 		operatorNS:      operatorNS,
 		kcClientFactory: kcFactory,
 		defaultClients:  set,
+		parallelism:     parallelism,
 	}
 }
 func (ph *phaseHandler) PreflightChecks(kcr *v1alpha1.KeycloakRealm) (*v1alpha1.KeycloakRealm, error) {
@@ -135,11 +142,13 @@ func (ph *phaseHandler) Reconcile(kcr *v1alpha1.KeycloakRealm) (*v1alpha1.Keyclo
 	if err != nil {
 		return kcr, errors.Wrapf(err, "error reconciling keycloak realm: '%v'", kcr.Spec.Realm)
 	}
+	metrics.SetRealmObjects(kcr.Namespace, kcr.Name, len(kcr.Spec.Users), len(kcr.Spec.Clients), len(kcr.Spec.IdentityProviders))
 
 	errors := util.NewMultiError()
-	errors.AppendMultiErrorer(ph.reconcileUsers(kcClient, kcr, kcr.ObjectMeta.Namespace))
-	errors.AppendMultiErrorer(ph.reconcileClients(kcClient, kcr, kcr.ObjectMeta.Namespace))
+	// the users link to identity providers and are given client roles, so those must exist before them
 	errors.AppendMultiErrorer(ph.reconcileIdentityProviders(kcClient, kcr))
+	errors.AppendMultiErrorer(ph.reconcileClients(kcClient, kcr))
+	errors.AppendMultiErrorer(ph.reconcileUsers(kcClient, kcr))
 	errors.AddError(ph.reconcileBrowserRedirector(kcr.Spec.BrowserRedirectorIdentityProvider, kcr.Spec.Realm, kcr.Spec.CreateOnly, kcClient))
 
 	if !errors.IsNil() {
@@ -149,7 +158,7 @@ func (ph *phaseHandler) Reconcile(kcr *v1alpha1.KeycloakRealm) (*v1alpha1.Keyclo
 	return kcr, nil
 }
 
-func (ph *phaseHandler) reconcileUsers(kcClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm, ns string) util.MultiErrorer {
+func (ph *phaseHandler) reconcileUsers(kcClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm) util.MultiErrorer {
 	users, err := kcClient.ListUsers(realm.Spec.Realm)
 	if err != nil {
 		retErr := util.NewMultiError()
@@ -177,23 +186,38 @@ func (ph *phaseHandler) reconcileUsers(kcClient keycloak.KeycloakInterface, real
 			}
 		}
 	}
-	errors := util.NewMultiError()
-	for i := range userPairsList {
-		errors.AddError(ph.reconcileUser(userPairsList[i].KcUser, userPairsList[i].SpecUser, realm.Spec.Realm, realm.Spec.CreateOnly, kcClient, ns))
+	// sorted so the errors are reported in the same order on every pass
+	userNames := make([]string, 0, len(userPairsList))
+	for name := range userPairsList {
+		userNames = append(userNames, name)
 	}
-	return errors
+	sort.Strings(userNames)
+	userPairs := make([]*v1alpha1.KeycloakUserPair, 0, len(userNames))
+	for _, name := range userNames {
+		userPairs = append(userPairs, userPairsList[name])
+	}
+	return util.RunBounded(ph.parallelism, len(userPairs), func(i int) error {
+		return ph.reconcileUser(userPairs[i].KcUser, userPairs[i].SpecUser, realm.Spec.Realm, realm.Spec.CreateOnly, kcClient, realm)
+	})
 }
 
-func (ph *phaseHandler) reconcileUser(kcUser, specUser *v1alpha1.KeycloakUser, realmName string, createOnly bool, authenticatedClient keycloak.KeycloakInterface, ns string) error {
+func (ph *phaseHandler) reconcileUser(kcUser, specUser *v1alpha1.KeycloakUser, realmName string, createOnly bool, authenticatedClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm) error {
 	if specUser == nil {
 		if !createOnly {
-			return authenticatedClient.DeleteUser(kcUser.ID, realmName)
+			if err := authenticatedClient.DeleteUser(kcUser.ID, realmName); err != nil && !keycloak.IsNotFound(err) {
+				return err
+			}
 		}
 
 		return nil
 	}
 	if kcUser == nil {
 		err := authenticatedClient.CreateUser(specUser, realmName)
+		if keycloak.IsConflict(err) {
+			// the user exists but was not listed, it will be reconciled on the next pass
+			logrus.Infof("user %s already exists in realm %s", specUser.UserName, realmName)
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -221,20 +245,8 @@ func (ph *phaseHandler) reconcileUser(kcUser, specUser *v1alpha1.KeycloakUser, r
 			return errors.Wrap(err, "failed to update password for user "+u.Email)
 		}
 		data := map[string][]byte{"username": []byte(specUser.UserName), "password": []byte(newPass)}
-		userSecret := corev1.Secret{
-			TypeMeta: v1.TypeMeta{
-				APIVersion: "v1",
-				Kind:       "Secret",
-			},
-			ObjectMeta: v1.ObjectMeta{
-				Labels:    map[string]string{"application": "sso", "realm": realmName},
-				Namespace: ns,
-				Name:      *specUser.OutputSecret,
-			},
-			Data: data,
-			Type: "Opaque",
-		}
-		if _, err := ph.k8sClient.CoreV1().Secrets(ns).Create(&userSecret); err != nil {
+		userSecret := outputSecret(realm, *specUser.OutputSecret, data)
+		if _, err := ph.k8sClient.CoreV1().Secrets(realm.Namespace).Create(userSecret); err != nil {
 			return errors.Wrap(err, "failed to create secret ")
 		}
 
@@ -450,7 +462,7 @@ func (ph *phaseHandler) reconcileRolesForClient(roles []string, client *v1alpha1
 	return nil
 }
 
-func (ph *phaseHandler) reconcileClients(kcClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm, ns string) util.MultiErrorer {
+func (ph *phaseHandler) reconcileClients(kcClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm) util.MultiErrorer {
 	clients, err := kcClient.ListClients(realm.Spec.Realm)
 	if err != nil {
 		retErr := util.NewMultiError()
@@ -478,11 +490,19 @@ func (ph *phaseHandler) reconcileClients(kcClient keycloak.KeycloakInterface, re
 			}
 		}
 	}
-	errors := util.NewMultiError()
-	for i := range clientPairsList {
-		errors.AddError(ph.reconcileClient(clientPairsList[i].KcClient, clientPairsList[i].SpecClient, realm.Spec.Realm, realm.Spec.CreateOnly, kcClient, ns))
+	// sorted so the errors are reported in the same order on every pass
+	clientIDs := make([]string, 0, len(clientPairsList))
+	for id := range clientPairsList {
+		clientIDs = append(clientIDs, id)
 	}
-	return errors
+	sort.Strings(clientIDs)
+	clientPairs := make([]*v1alpha1.KeycloakClientPair, 0, len(clientIDs))
+	for _, id := range clientIDs {
+		clientPairs = append(clientPairs, clientPairsList[id])
+	}
+	return util.RunBounded(ph.parallelism, len(clientPairs), func(i int) error {
+		return ph.reconcileClient(clientPairs[i].KcClient, clientPairs[i].SpecClient, realm.Spec.Realm, realm.Spec.CreateOnly, kcClient, realm)
+	})
 }
 
 func (ph *phaseHandler) isDefaultClient(client string) bool {
@@ -490,15 +510,23 @@ func (ph *phaseHandler) isDefaultClient(client string) bool {
 	return ok
 }
 
-func (ph *phaseHandler) reconcileClient(kcClient, specClient *v1alpha1.KeycloakClient, realmName string, createOnly bool, authenticatedClient keycloak.KeycloakInterface, ns string) error {
+func (ph *phaseHandler) reconcileClient(kcClient, specClient *v1alpha1.KeycloakClient, realmName string, createOnly bool, authenticatedClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm) error {
 	if specClient == nil && !ph.isDefaultClient(kcClient.ClientID) && !createOnly {
-		if err := authenticatedClient.DeleteClient(kcClient.ID, realmName); err != nil {
+		if err := authenticatedClient.DeleteClient(kcClient.ID, realmName); err != nil && !keycloak.IsNotFound(err) {
 			return err
 		}
 	} else if kcClient == nil {
-		if err := authenticatedClient.CreateClient(specClient, realmName); err != nil {
+		if err := authenticatedClient.CreateClient(specClient, realmName); err != nil && !keycloak.IsConflict(err) {
 			return err
 		}
+		// the output secret is written from the client keycloak created
+		if specClient.OutputSecret != nil && *specClient.OutputSecret != "" {
+			created, err := findClient(authenticatedClient, specClient.ClientID, realmName)
+			if err != nil {
+				return err
+			}
+			kcClient = created
+		}
 	} else if !createOnly {
 		if !resourcesEqual(kcClient, specClient) && !ph.isDefaultClient(kcClient.ClientID) {
 			specClient.ID = kcClient.ID
@@ -518,25 +546,13 @@ func (ph *phaseHandler) reconcileClient(kcClient, specClient *v1alpha1.KeycloakC
 		}
 
 		data := map[string][]byte{"secret": []byte(cs), "install": clientJSON}
-		clientSecret := &corev1.Secret{
-			TypeMeta: v1.TypeMeta{
-				APIVersion: "v1",
-				Kind:       "Secret",
-			},
-			ObjectMeta: v1.ObjectMeta{
-				Labels:    map[string]string{"application": "sso", "realm": realmName},
-				Namespace: ns,
-				Name:      *specClient.OutputSecret,
-			},
-			Data: data,
-			Type: "Opaque",
-		}
-		if _, err := ph.k8sClient.CoreV1().Secrets(ns).Create(clientSecret); err != nil {
-			if !strings.Contains(err.Error(), "already exists") {
+		clientSecret := outputSecret(realm, *specClient.OutputSecret, data)
+		if _, err := ph.k8sClient.CoreV1().Secrets(realm.Namespace).Create(clientSecret); err != nil {
+			if !errors2.IsAlreadyExists(err) {
 				return errors.Wrap(err, "failed to create client secret")
 			}
 			if !createOnly {
-				if _, err := ph.k8sClient.CoreV1().Secrets(ns).Update(clientSecret); err != nil {
+				if _, err := ph.k8sClient.CoreV1().Secrets(realm.Namespace).Update(clientSecret); err != nil {
 					return errors.Wrap(err, "failed to update client secret")
 				}
 			}
@@ -548,6 +564,20 @@ func (ph *phaseHandler) reconcileClient(kcClient, specClient *v1alpha1.KeycloakC
 	return nil
 }
 
+// findClient returns the client of realmName with clientID
+func findClient(authenticatedClient keycloak.KeycloakInterface, clientID, realmName string) (*v1alpha1.KeycloakClient, error) {
+	clients, err := authenticatedClient.ListClients(realmName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list clients")
+	}
+	for _, c := range clients {
+		if c.ClientID == clientID {
+			return c, nil
+		}
+	}
+	return nil, errors.New("failed to find client " + clientID)
+}
+
 func (ph *phaseHandler) reconcileIdentityProviders(kcClient keycloak.KeycloakInterface, realm *v1alpha1.KeycloakRealm) util.MultiErrorer {
 	identityProviders, err := kcClient.ListIdentityProviders(realm.Spec.Realm)
 	if err != nil {
@@ -589,12 +619,12 @@ func (ph *phaseHandler) reconcileIdentityProviders(kcClient keycloak.KeycloakInt
 
 func (ph *phaseHandler) reconcileIdentityProvider(kcIdentityProvider, specIdentityProvider *v1alpha1.KeycloakIdentityProvider, realmName string, createOnly bool, authenticatedClient keycloak.KeycloakInterface) error {
 	if specIdentityProvider == nil && !createOnly {
-		if err := authenticatedClient.DeleteIdentityProvider(kcIdentityProvider.Alias, realmName); err != nil {
+		if err := authenticatedClient.DeleteIdentityProvider(kcIdentityProvider.Alias, realmName); err != nil && !keycloak.IsNotFound(err) {
 			return err
 		}
 		return nil
 	} else if kcIdentityProvider == nil {
-		if err := authenticatedClient.CreateIdentityProvider(specIdentityProvider, realmName); err != nil {
+		if err := authenticatedClient.CreateIdentityProvider(specIdentityProvider, realmName); err != nil && !keycloak.IsConflict(err) {
 			return err
 		}
 		return nil
@@ -705,7 +735,7 @@ func (ph *phaseHandler) Deprovision(realm *v1alpha1.KeycloakRealm) (*v1alpha1.Ke
 	}
 
 	err = kcClient.DeleteRealm(realm.Spec.ID)
-	if err != nil && !strings.Contains(err.Error(), "404") {
+	if err != nil && !keycloak.IsNotFound(err) {
 		return realm, err
 	}
 
@@ -733,6 +763,30 @@ func (ph *phaseHandler) getClient(kcr *v1alpha1.KeycloakRealm) (keycloak.Keycloa
 	return nil, errors.New("Could not find keycloak instance: " + kcr.Status.KeycloakName)
 }
 
+// outputSecret holds the credentials of a user or client of realm. It is owned by the KeycloakRealm so it is garbage
+// collected along with it
+func outputSecret(realm *v1alpha1.KeycloakRealm, name string, data map[string][]byte) *corev1.Secret {
+	owner := v1.NewControllerRef(realm, schema.GroupVersionKind{
+		Version: v1alpha1.Version,
+		Group:   v1alpha1.Group,
+		Kind:    v1alpha1.KeycloakRealmKind,
+	})
+	return &corev1.Secret{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Labels:          map[string]string{"application": "sso", "realm": realm.Spec.Realm},
+			Namespace:       realm.Namespace,
+			Name:            name,
+			OwnerReferences: []v1.OwnerReference{*owner},
+		},
+		Data: data,
+		Type: "Opaque",
+	}
+}
+
 func resourcesEqual(obj1, obj2 keycloak.T) bool {
 	return reflect.DeepEqual(obj1, obj2)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
 	"github.com/integr8ly/keycloak-operator/pkg/keycloak"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -65,7 +66,7 @@ func TestPhaseHandlerInitialise(t *testing.T) {
 
 	for _, testCase := range cases {
 		t.Run(testCase.Name, func(t *testing.T) {
-			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF)
+			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF, 1)
 			result, err := phaseHandler.Initialise(testCase.Object)
 			if err != nil && testCase.ExpectedError != "" {
 				t.Fatalf("expected error: %v, got: %v", testCase.ExpectedError, err)
@@ -157,7 +158,7 @@ func TestPhaseHandlerAccepted(t *testing.T) {
 
 	for _, testCase := range cases {
 		t.Run(testCase.Name, func(t *testing.T) {
-			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF)
+			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF, 1)
 			result, err := phaseHandler.Accepted(testCase.Object)
 			if err != nil && testCase.ExpectedError != "" {
 				t.Fatalf("expected error: %v, got: %v", testCase.ExpectedError, err)
@@ -270,7 +271,7 @@ func TestPhaseHandlerProvision(t *testing.T) {
 
 	for _, testCase := range cases {
 		t.Run(testCase.Name, func(t *testing.T) {
-			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF)
+			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF, 1)
 			result, err := phaseHandler.Provision(testCase.Object)
 			if err != nil && testCase.ExpectedError != "" {
 				t.Fatalf("expected error: %v, got: %v", testCase.ExpectedError, err)
@@ -963,7 +964,7 @@ func TestPhaseHandlerReconcile(t *testing.T) {
 
 	for _, testCase := range cases {
 		t.Run(testCase.Name, func(t *testing.T) {
-			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF)
+			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF, 1)
 			result, err := phaseHandler.Reconcile(testCase.Object)
 			if err != nil && testCase.ExpectedError != "" {
 				t.Fatalf("expected error: %v, got: %v", testCase.ExpectedError, err)
@@ -1071,7 +1072,7 @@ func TestProvisionDeletesPassword(t *testing.T) {
 
 	for _, testCase := range cases {
 		t.Run(testCase.Name, func(t *testing.T) {
-			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF)
+			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF, 1)
 			_, err := phaseHandler.Reconcile(testCase.Object)
 			if err != nil && testCase.ExpectedError != "" {
 				t.Fatalf("expected error: %v, got: %v", testCase.ExpectedError, err)
@@ -1190,7 +1191,7 @@ func TestPhaseHandlerDeprovision(t *testing.T) {
 
 	for _, testCase := range cases {
 		t.Run(testCase.Name, func(t *testing.T) {
-			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF)
+			phaseHandler := NewPhaseHandler(testCase.FakeClient, testCase.FakeSDK, "test-namespace", testCase.FakeKCF, 1)
 			result, err := phaseHandler.Deprovision(testCase.Object)
 			if err != nil && testCase.ExpectedError != "" {
 				t.Fatalf("expected error: %v, got: %v", testCase.ExpectedError, err)
@@ -1202,3 +1203,76 @@ func TestPhaseHandlerDeprovision(t *testing.T) {
 		})
 	}
 }
+
+func TestPhaseHandlerClientOutputSecretOwner(t *testing.T) {
+	outputSecret := "client-secret"
+	realm := &v1alpha1.KeycloakRealm{
+		ObjectMeta: metav1.ObjectMeta{Name: "realm-cr", Namespace: "test-namespace", UID: "realm-uid"},
+		Spec:       v1alpha1.KeycloakRealmSpec{KeycloakApiRealm: &v1alpha1.KeycloakApiRealm{Realm: "keycloak-realm"}},
+	}
+	client := &v1alpha1.KeycloakClient{
+		OutputSecret:      &outputSecret,
+		KeycloakApiClient: &v1alpha1.KeycloakApiClient{ID: "client-id", ClientID: "test-client"},
+	}
+	k8sClient := fake.NewSimpleClientset()
+	ph := NewPhaseHandler(k8sClient, nil, "test-namespace", nil, 1)
+	kcClient := &keycloak.KeycloakInterfaceMock{
+		GetClientSecretFunc: func(clientId string, realmName string) (string, error) {
+			return "secret", nil
+		},
+		GetClientInstallFunc: func(clientId string, realmName string) ([]byte, error) {
+			return []byte("{}"), nil
+		},
+	}
+
+	if err := ph.reconcileClient(client, client, "keycloak-realm", false, kcClient, realm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, err := k8sClient.CoreV1().Secrets("test-namespace").Get(outputSecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the output secret to be created: %v", err)
+	}
+	owner := metav1.GetControllerOf(secret)
+	if owner == nil || owner.Kind != v1alpha1.KeycloakRealmKind || owner.Name != realm.Name || owner.UID != realm.UID {
+		t.Fatalf("expected the output secret to be owned by the realm, got %v", secret.OwnerReferences)
+	}
+}
+
+func TestPhaseHandlerReconcileErrorOrder(t *testing.T) {
+	realm := &v1alpha1.KeycloakRealm{
+		Spec: v1alpha1.KeycloakRealmSpec{KeycloakApiRealm: &v1alpha1.KeycloakApiRealm{Realm: "keycloak-realm"}},
+	}
+	for _, name := range []string{"carol", "alice", "dave", "bob"} {
+		realm.Spec.Users = append(realm.Spec.Users, &v1alpha1.KeycloakUser{KeycloakApiUser: &v1alpha1.KeycloakApiUser{UserName: name}})
+		realm.Spec.Clients = append(realm.Spec.Clients, &v1alpha1.KeycloakClient{KeycloakApiClient: &v1alpha1.KeycloakApiClient{ClientID: name}})
+	}
+	kcClient := &keycloak.KeycloakInterfaceMock{
+		ListUsersFunc: func(realmName string) ([]*v1alpha1.KeycloakUser, error) {
+			return nil, nil
+		},
+		CreateUserFunc: func(user *v1alpha1.KeycloakUser, realmName string) error {
+			return errors.New("failed to create user " + user.UserName)
+		},
+		ListClientsFunc: func(realmName string) ([]*v1alpha1.KeycloakClient, error) {
+			return nil, nil
+		},
+		CreateClientFunc: func(client *v1alpha1.KeycloakClient, realmName string) error {
+			return errors.New("failed to create client " + client.ClientID)
+		},
+	}
+	ph := NewPhaseHandler(fake.NewSimpleClientset(), nil, "test-namespace", nil, 4)
+
+	// the pairs come from maps, run a few passes to catch a random order
+	for i := 0; i < 10; i++ {
+		users := ph.reconcileUsers(kcClient, realm).GetErrors()
+		clients := ph.reconcileClients(kcClient, realm).GetErrors()
+		if len(users) != 4 || len(clients) != 4 {
+			t.Fatalf("expected an error per user and client, got %v %v", users, clients)
+		}
+		for j, name := range []string{"alice", "bob", "carol", "dave"} {
+			if users[j].Error() != "failed to create user "+name || clients[j].Error() != "failed to create client "+name {
+				t.Fatalf("expected the errors sorted by name, got %v %v", users, clients)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
 	"github.com/integr8ly/keycloak-operator/pkg/keycloak"
+	"github.com/integr8ly/keycloak-operator/pkg/metrics"
 	"github.com/pkg/errors"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -58,6 +59,9 @@ func (r *realmHandler) handleDelete(kcr *v1alpha1.KeycloakRealm) error {
 
 func (r *realmHandler) Handle(context context.Context, object interface{}, deleted bool) error {
 	if deleted {
+		if kcr, ok := object.(*v1alpha1.KeycloakRealm); ok {
+			metrics.DeleteRealmObjects(kcr.Namespace, kcr.Name)
+		}
 		return nil
 	}
 
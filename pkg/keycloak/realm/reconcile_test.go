@@ -0,0 +1,270 @@
+package realm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/keycloak"
+	"github.com/integr8ly/keycloak-operator/pkg/keycloak/fake"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	fakeOperatorNS = "operator-namespace"
+	fakeRealmNS    = "realm-namespace"
+	fakeRealm      = "test-realm"
+)
+
+// newFakeKeycloakPhaseHandler returns a phase handler talking to an in-memory Keycloak through the real client
+func newFakeKeycloakPhaseHandler(t *testing.T) (*phaseHandler, *fake.Server, *k8sfake.Clientset) {
+	server := fake.NewServer("admin", "admin-password")
+	k8sClient := k8sfake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credential-keycloak", Namespace: fakeOperatorNS},
+		Data: map[string][]byte{
+			"SSO_ADMIN_USERNAME": []byte("admin"),
+			"SSO_ADMIN_PASSWORD": []byte("admin-password"),
+			"SSO_ADMIN_URL":      []byte(server.URL),
+		},
+	})
+	sdkCrud := &keycloak.SdkCruderMock{
+		ListFunc: func(namespace string, into sdk.Object, opts ...sdk.ListOption) error {
+			into.(*v1alpha1.KeycloakList).Items = []v1alpha1.Keycloak{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "keycloak", Namespace: fakeOperatorNS},
+					Spec:       v1alpha1.KeycloakSpec{AdminCredentials: "credential-keycloak"},
+				},
+			}
+			return nil
+		},
+		DeleteFunc: func(object sdk.Object, opts ...sdk.DeleteOption) error {
+			secret := object.(*corev1.Secret)
+			return k8sClient.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, &metav1.DeleteOptions{})
+		},
+	}
+	factory := &keycloak.KeycloakFactory{SecretClient: k8sClient.CoreV1().Secrets(fakeOperatorNS)}
+	return NewPhaseHandler(k8sClient, sdkCrud, fakeOperatorNS, factory, 1), server, k8sClient
+}
+
+func fakeKeycloakRealm(createOnly bool) *v1alpha1.KeycloakRealm {
+	userSecret := "alice-credentials"
+	clientSecret := "app-client"
+	return &v1alpha1.KeycloakRealm{
+		ObjectMeta: metav1.ObjectMeta{Name: fakeRealm, Namespace: fakeRealmNS},
+		Spec: v1alpha1.KeycloakRealmSpec{
+			CreateOnly:                        createOnly,
+			BrowserRedirectorIdentityProvider: "github",
+			KeycloakApiRealm: &v1alpha1.KeycloakApiRealm{
+				ID:          fakeRealm,
+				Realm:       fakeRealm,
+				Enabled:     true,
+				DisplayName: "Test Realm",
+				Users: []*v1alpha1.KeycloakUser{
+					{
+						KeycloakApiUser: &v1alpha1.KeycloakApiUser{
+							UserName:    "alice",
+							Email:       "alice@example.com",
+							Enabled:     true,
+							RealmRoles:  []string{"offline_access"},
+							ClientRoles: map[string][]string{"account": {"manage-account"}},
+						},
+						OutputSecret:        &userSecret,
+						FederatedIdentities: []v1alpha1.FederatedIdentity{{IdentityProvider: "github", UserId: "1234", UserName: "alice"}},
+					},
+				},
+				Clients: []*v1alpha1.KeycloakClient{
+					{
+						KeycloakApiClient: &v1alpha1.KeycloakApiClient{
+							ClientID:     "app",
+							Enabled:      true,
+							RedirectUris: []string{"https://app.example.com/*"},
+						},
+						OutputSecret: &clientSecret,
+					},
+				},
+				IdentityProviders: []*v1alpha1.KeycloakIdentityProvider{
+					{
+						Alias:      "github",
+						ProviderID: "github",
+						Enabled:    true,
+						Config:     map[string]string{"clientId": "github-client", "clientSecret": "github-secret"},
+					},
+				},
+			},
+		},
+		Status: v1alpha1.KeycloakRealmStatus{
+			Phase:        v1alpha1.PhaseProvision,
+			KeycloakName: "keycloak",
+		},
+	}
+}
+
+// converge provisions the realm and reconciles it once, a single pass must bring the server in line with the spec
+func converge(t *testing.T, ph *phaseHandler, kcr *v1alpha1.KeycloakRealm) {
+	if _, err := ph.Provision(kcr); err != nil {
+		t.Fatalf("unexpected error provisioning realm: %v", err)
+	}
+	if _, err := ph.Reconcile(kcr); err != nil {
+		t.Fatalf("unexpected error reconciling realm: %v", err)
+	}
+}
+
+type fakeRealmState struct {
+	Users             []v1alpha1.KeycloakApiUser
+	Clients           []v1alpha1.KeycloakApiClient
+	IdentityProviders []v1alpha1.KeycloakIdentityProvider
+}
+
+func snapshot(server *fake.Server) fakeRealmState {
+	return fakeRealmState{
+		Users:             server.Users(fakeRealm),
+		Clients:           server.Clients(fakeRealm),
+		IdentityProviders: server.IdentityProviders(fakeRealm),
+	}
+}
+
+func userByName(server *fake.Server, name string) *v1alpha1.KeycloakApiUser {
+	for _, u := range server.Users(fakeRealm) {
+		if u.UserName == name {
+			return &u
+		}
+	}
+	return nil
+}
+
+func hasClient(server *fake.Server, clientID string) bool {
+	for _, c := range server.Clients(fakeRealm) {
+		if c.ClientID == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFakeKeycloakReconcileIsIdempotent(t *testing.T) {
+	ph, server, k8sClient := newFakeKeycloakPhaseHandler(t)
+	defer server.Close()
+	kcr := fakeKeycloakRealm(false)
+
+	converge(t, ph, kcr)
+
+	alice := userByName(server, "alice")
+	if alice == nil {
+		t.Fatal("expected user alice to be created")
+	}
+	if roles := server.UserRealmRoles(fakeRealm, alice.ID); !reflect.DeepEqual(roles, []string{"offline_access"}) {
+		t.Fatalf("unexpected realm roles for alice: %v", roles)
+	}
+	if roles := server.UserClientRoles(fakeRealm, alice.ID, "account"); !reflect.DeepEqual(roles, []string{"manage-account"}) {
+		t.Fatalf("unexpected account client roles for alice: %v", roles)
+	}
+	userSecret, err := k8sClient.CoreV1().Secrets(fakeRealmNS).Get("alice-credentials", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected user output secret: %v", err)
+	}
+	if string(userSecret.Data["password"]) != server.UserPassword(fakeRealm, alice.ID) {
+		t.Fatal("expected the user output secret to hold the password set in keycloak")
+	}
+	if _, err := k8sClient.CoreV1().Secrets(fakeRealmNS).Get("app-client", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected client output secret: %v", err)
+	}
+	if provider := server.BrowserRedirectorProvider(fakeRealm); provider != "github" {
+		t.Fatalf("expected browser redirector to use github, got '%s'", provider)
+	}
+
+	before := snapshot(server)
+	for i := 0; i < 2; i++ {
+		if _, err := ph.Provision(kcr); err != nil {
+			t.Fatalf("unexpected error provisioning existing realm: %v", err)
+		}
+		if _, err := ph.Reconcile(kcr); err != nil {
+			t.Fatalf("unexpected error reconciling converged realm: %v", err)
+		}
+	}
+	if after := snapshot(server); !reflect.DeepEqual(before, after) {
+		t.Fatalf("expected reconciling a converged realm to change nothing\nbefore: %+v\nafter:  %+v", before, after)
+	}
+}
+
+func TestFakeKeycloakReconcileCreateOnly(t *testing.T) {
+	ph, server, _ := newFakeKeycloakPhaseHandler(t)
+	defer server.Close()
+	kcr := fakeKeycloakRealm(true)
+
+	converge(t, ph, kcr)
+
+	server.AddUser(fakeRealm, v1alpha1.KeycloakApiUser{UserName: "bob", Enabled: true})
+	server.AddClient(fakeRealm, v1alpha1.KeycloakApiClient{ClientID: "unmanaged", Enabled: true})
+	kcr.Spec.Users[0].RealmRoles = []string{}
+	kcr.Spec.Users[0].FederatedIdentities = nil
+	kcr.Spec.Clients[0].RedirectUris = []string{"https://changed.example.com/*"}
+
+	if _, err := ph.Reconcile(kcr); err != nil {
+		t.Fatalf("unexpected error reconciling: %v", err)
+	}
+
+	if userByName(server, "bob") == nil {
+		t.Fatal("expected unmanaged user to be kept in createOnly mode")
+	}
+	if !hasClient(server, "unmanaged") {
+		t.Fatal("expected unmanaged client to be kept in createOnly mode")
+	}
+	alice := userByName(server, "alice")
+	if roles := server.UserRealmRoles(fakeRealm, alice.ID); !reflect.DeepEqual(roles, []string{"offline_access"}) {
+		t.Fatalf("expected realm roles to be kept in createOnly mode, got: %v", roles)
+	}
+	for _, c := range server.Clients(fakeRealm) {
+		if c.ClientID == "app" && !reflect.DeepEqual(c.RedirectUris, []string{"https://app.example.com/*"}) {
+			t.Fatalf("expected client not to be updated in createOnly mode, got: %v", c.RedirectUris)
+		}
+	}
+}
+
+func TestFakeKeycloakReconcileDeletes(t *testing.T) {
+	ph, server, k8sClient := newFakeKeycloakPhaseHandler(t)
+	defer server.Close()
+	kcr := fakeKeycloakRealm(false)
+
+	converge(t, ph, kcr)
+
+	server.AddUser(fakeRealm, v1alpha1.KeycloakApiUser{UserName: "bob", Enabled: true})
+	server.AddClient(fakeRealm, v1alpha1.KeycloakApiClient{ClientID: "unmanaged", Enabled: true})
+	kcr.Spec.Users[0].RealmRoles = []string{}
+
+	if _, err := ph.Reconcile(kcr); err != nil {
+		t.Fatalf("unexpected error reconciling: %v", err)
+	}
+	if userByName(server, "bob") != nil {
+		t.Fatal("expected unmanaged user to be deleted")
+	}
+	if hasClient(server, "unmanaged") {
+		t.Fatal("expected unmanaged client to be deleted")
+	}
+	if !hasClient(server, "account") {
+		t.Fatal("expected default clients to be kept")
+	}
+	alice := userByName(server, "alice")
+	if roles := server.UserRealmRoles(fakeRealm, alice.ID); len(roles) != 0 {
+		t.Fatalf("expected realm roles to be removed, got: %v", roles)
+	}
+
+	if _, err := ph.Deprovision(kcr); err != nil {
+		t.Fatalf("unexpected error deprovisioning: %v", err)
+	}
+	if server.HasRealm(fakeRealm) {
+		t.Fatal("expected realm to be deleted")
+	}
+	for _, name := range []string{"alice-credentials", "app-client"} {
+		if _, err := k8sClient.CoreV1().Secrets(fakeRealmNS).Get(name, metav1.GetOptions{}); err == nil {
+			t.Fatalf("expected secret %s to be deleted", name)
+		}
+	}
+
+	// deprovisioning a realm that is already gone succeeds
+	if _, err := ph.Deprovision(kcr); err != nil {
+		t.Fatalf("unexpected error deprovisioning a deleted realm: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package keycloak
+
+import (
+	"sync"
+
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// fakeResourceClients keeps the objects created through the dynamic resource clients it hands out in memory
+type fakeResourceClients struct {
+	mu      sync.Mutex
+	objects map[string]*unstructured.Unstructured
+}
+
+func newFakeResourceClients() *fakeResourceClients {
+	return &fakeResourceClients{objects: map[string]*unstructured.Unstructured{}}
+}
+
+// Factory matches the signature of the dynamic resource client factory of the phase handler
+func (f *fakeResourceClients) Factory(apiVersion, kind, namespace string) (dynamic.ResourceInterface, string, error) {
+	return &fakeResourceClient{clients: f, kind: kind, namespace: namespace}, kind, nil
+}
+
+// Get returns the object of kind with name, or nil when it does not exist
+func (f *fakeResourceClients) Get(kind, name string) *unstructured.Unstructured {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, o := range f.objects {
+		if o.GetKind() == kind && o.GetName() == name {
+			return o.DeepCopy()
+		}
+	}
+	return nil
+}
+
+// Names returns the kind/name of every object
+func (f *fakeResourceClients) Names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for _, o := range f.objects {
+		names = append(names, o.GetKind()+"/"+o.GetName())
+	}
+	return names
+}
+
+type fakeResourceClient struct {
+	clients   *fakeResourceClients
+	kind      string
+	namespace string
+}
+
+func (c *fakeResourceClient) key(name string) string {
+	return c.kind + "/" + c.namespace + "/" + name
+}
+
+func (c *fakeResourceClient) notFound(name string) error {
+	return errors2.NewNotFound(schema.GroupResource{Resource: c.kind}, name)
+}
+
+func (c *fakeResourceClient) Create(obj *unstructured.Unstructured, subresources ...string) (*unstructured.Unstructured, error) {
+	c.clients.mu.Lock()
+	defer c.clients.mu.Unlock()
+	if _, ok := c.clients.objects[c.key(obj.GetName())]; ok {
+		return nil, errors2.NewAlreadyExists(schema.GroupResource{Resource: c.kind}, obj.GetName())
+	}
+	c.clients.objects[c.key(obj.GetName())] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (c *fakeResourceClient) Update(obj *unstructured.Unstructured, subresources ...string) (*unstructured.Unstructured, error) {
+	c.clients.mu.Lock()
+	defer c.clients.mu.Unlock()
+	if _, ok := c.clients.objects[c.key(obj.GetName())]; !ok {
+		return nil, c.notFound(obj.GetName())
+	}
+	c.clients.objects[c.key(obj.GetName())] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (c *fakeResourceClient) UpdateStatus(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return c.Update(obj)
+}
+
+func (c *fakeResourceClient) Delete(name string, options *v12.DeleteOptions, subresources ...string) error {
+	c.clients.mu.Lock()
+	defer c.clients.mu.Unlock()
+	if _, ok := c.clients.objects[c.key(name)]; !ok {
+		return c.notFound(name)
+	}
+	delete(c.clients.objects, c.key(name))
+	return nil
+}
+
+func (c *fakeResourceClient) DeleteCollection(options *v12.DeleteOptions, listOptions v12.ListOptions) error {
+	list, err := c.List(listOptions)
+	if err != nil {
+		return err
+	}
+	for _, o := range list.Items {
+		if err := c.Delete(o.GetName(), options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fakeResourceClient) Get(name string, options v12.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	c.clients.mu.Lock()
+	defer c.clients.mu.Unlock()
+	o, ok := c.clients.objects[c.key(name)]
+	if !ok {
+		return nil, c.notFound(name)
+	}
+	return o.DeepCopy(), nil
+}
+
+func (c *fakeResourceClient) List(opts v12.ListOptions) (*unstructured.UnstructuredList, error) {
+	c.clients.mu.Lock()
+	defer c.clients.mu.Unlock()
+	list := &unstructured.UnstructuredList{}
+	for _, o := range c.clients.objects {
+		if o.GetKind() == c.kind && o.GetNamespace() == c.namespace {
+			list.Items = append(list.Items, *o.DeepCopy())
+		}
+	}
+	return list, nil
+}
+
+func (c *fakeResourceClient) Watch(opts v12.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+func (c *fakeResourceClient) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*unstructured.Unstructured, error) {
+	return c.Get(name, v12.GetOptions{})
+}
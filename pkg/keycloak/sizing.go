@@ -0,0 +1,250 @@
+package keycloak
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	osappsv1 "github.com/openshift/api/apps/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/policy/v1beta1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// javaOptsEnv is appended to the options computed by the image, so the heap set here wins
+	javaOptsEnv = "JAVA_OPTS_APPEND"
+)
+
+// workload is a deployed Keycloak or database workload
+type workload struct {
+	object runtime.Object
+	// rolledOut is false while a previous change is still rolling out
+	rolledOut bool
+	update    func() error
+}
+
+// applySizing sets the sizing of kc on the Keycloak and database workloads in objects
+func applySizing(objects []runtime.Object, kc *v1alpha1.Keycloak) {
+	for _, o := range objects {
+		switch objectName(o) {
+		case applicationName(kc):
+			applyInstanceSpec(o, kc.Spec.Instance)
+		case databaseName(kc):
+			applyWorkloadSpec(o, kc.Spec.Database)
+		}
+	}
+}
+
+// applyInstanceSpec sets spec on the Keycloak workload o and returns whether anything changed. Only changes to the
+// pod template switch it to rolling updates, scaling keeps the strategy of the template
+func applyInstanceSpec(o runtime.Object, spec v1alpha1.KeycloakInstanceSpec) bool {
+	templateChanged := applyWorkloadSpec(o, spec.KeycloakWorkloadSpec)
+	if jvm := spec.JVM; jvm != nil {
+		if container := workloadContainer(o, objectName(o)); container != nil {
+			before := container.DeepCopy()
+			setEnv(container, javaOptsEnv, jvmOptions(jvm))
+			templateChanged = templateChanged || !reflect.DeepEqual(before, container)
+		}
+	}
+	if templateChanged {
+		rollingUpdate(o)
+	}
+	if replicas := workloadReplicas(o); spec.Replicas != nil && replicas != nil && *replicas != *spec.Replicas {
+		*replicas = *spec.Replicas
+		return true
+	}
+	return templateChanged
+}
+
+// applyWorkloadSpec sets the resources and placement of spec on the container and pod of workload o and returns
+// whether anything changed. The container is named after the workload
+func applyWorkloadSpec(o runtime.Object, spec v1alpha1.KeycloakWorkloadSpec) bool {
+	podSpec := workloadPodSpec(o)
+	if podSpec == nil {
+		return false
+	}
+	before := podSpec.DeepCopy()
+	if container := workloadContainer(o, objectName(o)); container != nil && spec.Resources != nil {
+		container.Resources = *spec.Resources.DeepCopy()
+	}
+	if spec.NodeSelector != nil {
+		podSpec.NodeSelector = spec.NodeSelector
+	}
+	if spec.Tolerations != nil {
+		podSpec.Tolerations = spec.Tolerations
+	}
+	if spec.Affinity != nil {
+		podSpec.Affinity = spec.Affinity.DeepCopy()
+	}
+	return !reflect.DeepEqual(before, podSpec)
+}
+
+func jvmOptions(jvm *v1alpha1.KeycloakJVMSpec) string {
+	opts := ""
+	if jvm.InitialHeap != nil {
+		opts = fmt.Sprintf("-Xms%dm", jvm.InitialHeap.Value()/(1024*1024))
+	}
+	if jvm.MaxHeap != nil {
+		if opts != "" {
+			opts += " "
+		}
+		opts += fmt.Sprintf("-Xmx%dm", jvm.MaxHeap.Value()/(1024*1024))
+	}
+	return opts
+}
+
+// rollingUpdate makes Keycloak roll out changes by starting a new pod before stopping an old one, the template
+// recreates every pod which takes the instance down on each change
+func rollingUpdate(o runtime.Object) {
+	maxUnavailable := intstr.FromInt(0)
+	maxSurge := intstr.FromInt(1)
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		w.Spec.Strategy = appsv1.DeploymentStrategy{
+			Type:          appsv1.RollingUpdateDeploymentStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &maxUnavailable, MaxSurge: &maxSurge},
+		}
+	case *osappsv1.DeploymentConfig:
+		w.Spec.Strategy.Type = osappsv1.DeploymentStrategyTypeRolling
+		w.Spec.Strategy.RecreateParams = nil
+		w.Spec.Strategy.RollingParams = &osappsv1.RollingDeploymentStrategyParams{MaxUnavailable: &maxUnavailable, MaxSurge: &maxSurge}
+	}
+}
+
+func workloadReplicas(o runtime.Object) *int32 {
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		return w.Spec.Replicas
+	case *appsv1.StatefulSet:
+		return w.Spec.Replicas
+	case *osappsv1.DeploymentConfig:
+		return &w.Spec.Replicas
+	}
+	return nil
+}
+
+func workloadContainer(o runtime.Object, name string) *v1.Container {
+	podSpec := workloadPodSpec(o)
+	if podSpec == nil {
+		return nil
+	}
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == name {
+			return &podSpec.Containers[i]
+		}
+	}
+	return nil
+}
+
+func deploymentRolledOut(d *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation && d.Status.UpdatedReplicas == replicas && d.Status.AvailableReplicas == replicas
+}
+
+func statefulSetRolledOut(s *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	return s.Status.ObservedGeneration >= s.Generation && s.Status.CurrentRevision == s.Status.UpdateRevision && s.Status.ReadyReplicas == replicas
+}
+
+func deploymentConfigRolledOut(dc *osappsv1.DeploymentConfig) bool {
+	return dc.Status.ObservedGeneration >= dc.Generation && dc.Status.UpdatedReplicas == dc.Spec.Replicas && dc.Status.AvailableReplicas == dc.Spec.Replicas
+}
+
+// reconcileSizing keeps the deployed workloads in line with the sizing in the spec, a workload is only changed once
+// its previous change has rolled out
+func (ph *phaseHandler) reconcileSizing(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	p, err := ph.platformFor(sso)
+	if err != nil {
+		return sso, err
+	}
+	application, database, err := p.Workloads(sso)
+	if err != nil {
+		return sso, err
+	}
+	if restoring(application.object) {
+		logrus.Infof("not applying the sizing to %s while it is scaled down for a restore", objectName(application.object))
+	} else if applyInstanceSpec(application.object, sso.Spec.Instance) {
+		if err := updateWorkload(application); err != nil {
+			return sso, err
+		}
+	}
+	if database != nil && applyWorkloadSpec(database.object, sso.Spec.Database) {
+		if err := updateWorkload(database); err != nil {
+			return sso, err
+		}
+	}
+	return sso, ph.reconcilePodDisruptionBudget(sso, p)
+}
+
+func updateWorkload(w *workload) error {
+	name := objectName(w.object)
+	if !w.rolledOut {
+		logrus.Infof("waiting for the previous rollout of %s to finish before applying the sizing", name)
+		return nil
+	}
+	logrus.Infof("applying the sizing to %s", name)
+	return errors.Wrapf(w.update(), "failed to update the sizing of %s", name)
+}
+
+// reconcilePodDisruptionBudget creates, replaces or removes the budget of the Keycloak pods. Budgets can't be
+// updated on every supported cluster version so a changed budget is replaced
+func (ph *phaseHandler) reconcilePodDisruptionBudget(sso *v1alpha1.Keycloak, p platform) error {
+	pdbClient := ph.k8sClient.PolicyV1beta1().PodDisruptionBudgets(sso.Namespace)
+	existing, err := pdbClient.Get(applicationName(sso), v12.GetOptions{})
+	if err != nil && !errors2.IsNotFound(err) {
+		return errors.Wrap(err, "failed to get the pod disruption budget")
+	}
+	if errors2.IsNotFound(err) {
+		existing = nil
+	}
+
+	spec := sso.Spec.Instance.PodDisruptionBudget
+	if spec == nil {
+		if existing != nil && existing.Labels[SSO_INSTANCE_LABEL] == sso.Name {
+			return errors.Wrap(pdbClient.Delete(existing.Name, &v12.DeleteOptions{}), "failed to remove the pod disruption budget")
+		}
+		return nil
+	}
+	selector, err := v12.ParseToLabelSelector(p.ApplicationSelector(sso))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse the application selector")
+	}
+	desired := &v1beta1.PodDisruptionBudget{
+		ObjectMeta: v12.ObjectMeta{
+			Name:            applicationName(sso),
+			Namespace:       sso.Namespace,
+			Labels:          instanceLabels(sso),
+			OwnerReferences: []v12.OwnerReference{ownerReference(sso)},
+		},
+		Spec: v1beta1.PodDisruptionBudgetSpec{
+			MinAvailable:   spec.MinAvailable,
+			MaxUnavailable: spec.MaxUnavailable,
+			Selector:       selector,
+		},
+	}
+	if existing != nil {
+		if reflect.DeepEqual(existing.Spec, desired.Spec) {
+			return nil
+		}
+		if err := pdbClient.Delete(existing.Name, &v12.DeleteOptions{}); err != nil && !errors2.IsNotFound(err) {
+			return errors.Wrap(err, "failed to remove the outdated pod disruption budget")
+		}
+	}
+	if _, err := pdbClient.Create(desired); err != nil {
+		return errors.Wrap(err, "failed to create the pod disruption budget")
+	}
+	return nil
+}
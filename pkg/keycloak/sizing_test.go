@@ -0,0 +1,237 @@
+package keycloak
+
+import (
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func quantityPtr(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func sizedKeycloak() *v1alpha1.Keycloak {
+	return &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+		Spec: v1alpha1.KeycloakSpec{
+			Provision: true,
+			Instance: v1alpha1.KeycloakInstanceSpec{
+				KeycloakWorkloadSpec: v1alpha1.KeycloakWorkloadSpec{
+					Resources: &corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+					},
+					NodeSelector: map[string]string{"node-role": "sso"},
+					Tolerations:  []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "sso", Effect: corev1.TaintEffectNoSchedule}},
+				},
+				Replicas:            int32Ptr(3),
+				JVM:                 &v1alpha1.KeycloakJVMSpec{InitialHeap: quantityPtr("512Mi"), MaxHeap: quantityPtr("1536Mi")},
+				PodDisruptionBudget: &v1alpha1.KeycloakPodDisruptionBudgetSpec{MinAvailable: &intstr.IntOrString{Type: intstr.Int, IntVal: 2}},
+			},
+			Database: v1alpha1.KeycloakWorkloadSpec{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+				},
+			},
+		},
+		Status: v1alpha1.KeycloakStatus{Platform: v1alpha1.PlatformKubernetes},
+	}
+}
+
+func TestApplyInstanceSpec(t *testing.T) {
+	kc := sizedKeycloak()
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+	if !applyInstanceSpec(deployment, kc.Spec.Instance) {
+		t.Fatal("expected the deployment to change")
+	}
+	if *deployment.Spec.Replicas != 3 {
+		t.Fatalf("expected 3 replicas, got %d", *deployment.Spec.Replicas)
+	}
+	podSpec := deployment.Spec.Template.Spec
+	if podSpec.NodeSelector["node-role"] != "sso" || len(podSpec.Tolerations) != 1 {
+		t.Fatalf("expected the placement to be set, got %v and %v", podSpec.NodeSelector, podSpec.Tolerations)
+	}
+	container := workloadContainer(deployment, SSO_APPLICATION_NAME)
+	if container.Resources.Limits.Memory().String() != "2Gi" {
+		t.Fatalf("expected a memory limit of 2Gi, got %s", container.Resources.Limits.Memory().String())
+	}
+	for _, e := range container.Env {
+		if e.Name == javaOptsEnv && e.Value != "-Xms512m -Xmx1536m" {
+			t.Fatalf("expected the heap to be set, got '%s'", e.Value)
+		}
+	}
+	if deployment.Spec.Strategy.Type != appsv1.RollingUpdateDeploymentStrategyType || deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue() != 0 {
+		t.Fatalf("expected changes to roll out without taking pods down first, got %v", deployment.Spec.Strategy)
+	}
+	if applyInstanceSpec(deployment, kc.Spec.Instance) {
+		t.Fatal("expected applying the same spec twice to leave the deployment unchanged")
+	}
+}
+
+func TestApplyInstanceSpecScaling(t *testing.T) {
+	kc := &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakSpec{Instance: v1alpha1.KeycloakInstanceSpec{Replicas: int32Ptr(2)}},
+	}
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+	if !applyInstanceSpec(deployment, kc.Spec.Instance) || *deployment.Spec.Replicas != 2 {
+		t.Fatalf("expected the deployment to be scaled to 2 replicas, got %d", *deployment.Spec.Replicas)
+	}
+	if deployment.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Fatalf("expected scaling to keep the recreate strategy, got %v", deployment.Spec.Strategy)
+	}
+}
+
+func TestKeycloakInstanceSpecValidate(t *testing.T) {
+	cases := []struct {
+		Name        string
+		JVM         *v1alpha1.KeycloakJVMSpec
+		ExpectError string
+	}{
+		{
+			Name: "Heap in MiB",
+			JVM:  &v1alpha1.KeycloakJVMSpec{InitialHeap: quantityPtr("1Mi"), MaxHeap: quantityPtr("1536Mi")},
+		},
+		{
+			Name:        "Initial heap below 1Mi",
+			JVM:         &v1alpha1.KeycloakJVMSpec{InitialHeap: quantityPtr("512Ki"), MaxHeap: quantityPtr("1536Mi")},
+			ExpectError: "instance.jvm.initialHeap must be at least 1Mi, got 512Ki",
+		},
+		{
+			Name:        "Max heap below 1Mi",
+			JVM:         &v1alpha1.KeycloakJVMSpec{MaxHeap: quantityPtr("1000k")},
+			ExpectError: "instance.jvm.maxHeap must be at least 1Mi, got 1M",
+		},
+		{
+			Name:        "Initial heap above max heap",
+			JVM:         &v1alpha1.KeycloakJVMSpec{InitialHeap: quantityPtr("2Gi"), MaxHeap: quantityPtr("1Gi")},
+			ExpectError: "instance.jvm.initialHeap 2Gi is above maxHeap 1Gi",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := &v1alpha1.Keycloak{Spec: v1alpha1.KeycloakSpec{Instance: v1alpha1.KeycloakInstanceSpec{JVM: tc.JVM}}}
+			err := kc.Validate()
+			if tc.ExpectError == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.ExpectError != "" && (err == nil || err.Error() != tc.ExpectError) {
+				t.Fatalf("expected the error '%s', got %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
+
+func TestPhaseHandlerReconcileSizing(t *testing.T) {
+	cases := []struct {
+		Name            string
+		RolledOut       bool
+		ExpectReplicas  int32
+		ExpectDBRequest string
+	}{
+		{
+			Name:            "Workloads rolled out",
+			RolledOut:       true,
+			ExpectReplicas:  3,
+			ExpectDBRequest: "500m",
+		},
+		{
+			Name:            "Previous change still rolling out",
+			RolledOut:       false,
+			ExpectReplicas:  1,
+			ExpectDBRequest: "0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := sizedKeycloak()
+			deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+			statefulSet := kubernetesPostgresStatefulSet(kc, map[string]string{})
+			if tc.RolledOut {
+				deployment.Status = appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1}
+				statefulSet.Status = appsv1.StatefulSetStatus{ReadyReplicas: 1}
+			}
+			k8sClient := fake.NewSimpleClientset(deployment, statefulSet)
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+			if _, err := ph.reconcileSizing(kc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			deployment, _ = k8sClient.AppsV1().Deployments("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+			if *deployment.Spec.Replicas != tc.ExpectReplicas {
+				t.Fatalf("expected %d replicas, got %d", tc.ExpectReplicas, *deployment.Spec.Replicas)
+			}
+			statefulSet, _ = k8sClient.AppsV1().StatefulSets("test-namespace").Get(databaseName(kc), v12.GetOptions{})
+			request := statefulSet.Spec.Template.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU]
+			if request.String() != tc.ExpectDBRequest {
+				t.Fatalf("expected a cpu request of %s, got %s", tc.ExpectDBRequest, request.String())
+			}
+			pdb, err := k8sClient.PolicyV1beta1().PodDisruptionBudgets("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected the pod disruption budget to be created: %v", err)
+			}
+			if pdb.Spec.MinAvailable.IntValue() != 2 || pdb.Spec.Selector.MatchLabels["deployment"] != SSO_APPLICATION_NAME {
+				t.Fatalf("unexpected pod disruption budget %v", pdb.Spec)
+			}
+		})
+	}
+}
+
+func TestPhaseHandlerRemovePodDisruptionBudget(t *testing.T) {
+	cases := []struct {
+		Name         string
+		Labels       map[string]string
+		ExpectRemove bool
+	}{
+		{
+			Name:         "Budget of the instance",
+			Labels:       map[string]string{"application": SSO_APPLICATION_NAME, SSO_INSTANCE_LABEL: "keycloak"},
+			ExpectRemove: true,
+		},
+		{
+			Name:   "Budget of another instance",
+			Labels: map[string]string{"application": SSO_APPLICATION_NAME, SSO_INSTANCE_LABEL: "other"},
+		},
+		{
+			Name:   "Budget created by hand",
+			Labels: map[string]string{"application": SSO_APPLICATION_NAME},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			kc := sizedKeycloak()
+			kc.Spec.Instance.PodDisruptionBudget = nil
+			k8sClient := fake.NewSimpleClientset(&policyv1beta1.PodDisruptionBudget{
+				ObjectMeta: v12.ObjectMeta{Name: SSO_APPLICATION_NAME, Namespace: "test-namespace", Labels: tc.Labels},
+			})
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+			p, err := ph.platformFor(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := ph.reconcilePodDisruptionBudget(kc, p); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err = k8sClient.PolicyV1beta1().PodDisruptionBudgets("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+			if removed := errors2.IsNotFound(err); removed != tc.ExpectRemove {
+				t.Fatalf("expected the budget to be removed: %v, got %v", tc.ExpectRemove, err)
+			}
+		})
+	}
+}
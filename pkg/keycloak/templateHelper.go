@@ -16,9 +16,43 @@ const (
 	ServiceMonitorName   = "service-monitor"
 )
 
+// the alert thresholds of the PrometheusRule when the spec doesn't set them
+const (
+	defaultHeapUsagePercent         = 90
+	defaultNonHeapUsagePercent      = 90
+	defaultGCTimePercent            = 90
+	defaultFailedLogins             = 50
+	defaultRequestsWithin1sPercent  = 90
+	defaultRequestsWithin10sPercent = 99.5
+)
+
 type MonitoringParameters struct {
 	MonitoringKey string
 	Namespace     string
+	// Labels are set on every monitoring resource, they include the monitoring-key label
+	Labels map[string]string
+	// the names of the monitoring resources
+	DashboardName  string
+	DashboardTitle string
+	MonitorName    string
+	RuleName       string
+	// InstanceName is the name of the Keycloak, the service monitor selects the services labelled with it
+	InstanceName string
+	// MetricsPath is where the server serves the metrics of the master realm, under its context path
+	MetricsPath string
+	// ApplicationName and DatabaseName are the workloads the availability alerts watch, their pods are joined on the
+	// ApplicationPodLabel and DatabasePodLabel kube_pod_labels labels of the platform
+	ApplicationName     string
+	DatabaseName        string
+	ApplicationPodLabel string
+	DatabasePodLabel    string
+	// the alert thresholds
+	HeapUsagePercent         float64
+	NonHeapUsagePercent      float64
+	GCTimePercent            float64
+	FailedLogins             int32
+	RequestsWithin1sPercent  float64
+	RequestsWithin10sPercent float64
 }
 
 type MonitoringTemplateHelper struct {
@@ -59,11 +93,51 @@ func newTemplateHelper(sso *v1alpha1.Keycloak) *MonitoringTemplateHelper {
 		param.MonitoringKey = monitoringKey
 	}
 
+	monitoring := sso.Spec.Monitoring
+	param.Labels = map[string]string{"monitoring-key": param.MonitoringKey}
+	for k, v := range monitoring.Labels {
+		param.Labels[k] = v
+	}
+	param.MonitoringKey = param.Labels["monitoring-key"]
+	param.DashboardName = monitoringName(sso, GrafanaDashboardName)
+	param.DashboardTitle = "Keycloak"
+	if sso.Status.ApplicationName != "" {
+		param.DashboardTitle += " " + sso.Status.ApplicationName
+	}
+	param.MonitorName = monitoringName(sso, ServiceMonitorName)
+	param.RuleName = monitoringName(sso, PrometheusRuleName)
+	param.InstanceName = sso.Name
+	param.ApplicationName = applicationName(sso)
+	param.DatabaseName = databaseName(sso)
+	param.ApplicationPodLabel, param.DatabasePodLabel = "label_deploymentConfig", "label_deploymentConfig"
+	if sso.Status.Platform == v1alpha1.PlatformKubernetes {
+		param.ApplicationPodLabel, param.DatabasePodLabel = "label_deployment", "label_statefulSet"
+	}
+	param.MetricsPath = imageContextPath(sso.Status.Image) + "/realms/master/metrics"
+
+	thresholds := monitoring.PrometheusRule.Thresholds
+	param.HeapUsagePercent = percentOrDefault(thresholds.HeapUsagePercent, defaultHeapUsagePercent)
+	param.NonHeapUsagePercent = percentOrDefault(thresholds.NonHeapUsagePercent, defaultNonHeapUsagePercent)
+	param.GCTimePercent = percentOrDefault(thresholds.GCTimePercent, defaultGCTimePercent)
+	param.FailedLogins = defaultFailedLogins
+	if thresholds.FailedLogins != nil {
+		param.FailedLogins = *thresholds.FailedLogins
+	}
+	param.RequestsWithin1sPercent = percentOrDefault(thresholds.RequestsWithin1sPercent, defaultRequestsWithin1sPercent)
+	param.RequestsWithin10sPercent = percentOrDefault(thresholds.RequestsWithin10sPercent, defaultRequestsWithin10sPercent)
+
 	return &MonitoringTemplateHelper{
 		Parameters: param,
 	}
 }
 
+func percentOrDefault(percent *float64, value float64) float64 {
+	if percent != nil {
+		return *percent
+	}
+	return value
+}
+
 // load a templates from a given resource name
 func (h *MonitoringTemplateHelper) loadTemplate(name string) ([]byte, error) {
 	templatePath, err := getTemplatePath(name)
@@ -0,0 +1,160 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"fmt"
+
+	osappsv1 "github.com/openshift/api/apps/v1"
+	templatev1 "github.com/openshift/api/template/v1"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const postgresImageStreamTagParameter = "POSTGRESQL_IMAGE_STREAM_TAG"
+
+type VolumeInfo struct {
+	VolumeName      string
+	VolumeMount     string
+	InitVolumeMount string
+}
+
+// templateMutator adds the plugins init container, the volumes it shares with the SSO container and the named port
+// to the objects of the SSO template. It works on the typed objects and reports which element of the template it
+// expected and didn't find, so a template whose layout changed fails loudly
+type templateMutator struct {
+	PluginsEnvVarName  string
+	PluginsVolumeInfo  VolumeInfo
+	ThemesVolumeInfo   VolumeInfo
+	InitContainerName  string
+	InitContainerImage string
+}
+
+func newTemplateMutator() *templateMutator {
+	return &templateMutator{
+		PluginsEnvVarName:  "SSO_PLUGINS",
+		PluginsVolumeInfo:  VolumeInfo{VolumeName: "sso-plugins", VolumeMount: "/opt/eap/providers", InitVolumeMount: "/opt/plugins"},
+		ThemesVolumeInfo:   VolumeInfo{VolumeName: "sso-themes", VolumeMount: "/opt/themes", InitVolumeMount: "/opt/themes"},
+		InitContainerName:  "sso-plugins-init",
+		InitContainerImage: "quay.io/integreatly/sso_plugins_init:1.0.0",
+	}
+}
+
+// MutateParameters points the postgresql image of templ at the tag in SSO_POSTGRES_VERSION
+func (m *templateMutator) MutateParameters(templ *templatev1.Template) error {
+	for i, p := range templ.Parameters {
+		if p.Name == postgresImageStreamTagParameter {
+			templ.Parameters[i].Value = SSO_POSTGRES_VERSION
+			return nil
+		}
+	}
+	return errors.Errorf("template %s has no parameter %s", templ.Name, postgresImageStreamTagParameter)
+}
+
+// MutateObjects mutates the DeploymentConfig and Service named applicationName in the processed objects of the
+// template, the other objects are returned as they are. plugins is the list of plugins the init container installs
+func (m *templateMutator) MutateObjects(objects []runtime.RawExtension, applicationName, plugins string) ([]runtime.RawExtension, error) {
+	mutated := make([]runtime.RawExtension, 0, len(objects))
+	found := map[string]bool{}
+	for i, raw := range objects {
+		header := struct {
+			v12.TypeMeta `json:",inline"`
+			Metadata     v12.ObjectMeta `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(raw.Raw, &header); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode object %d of the template", i)
+		}
+		if header.Metadata.Name != applicationName {
+			mutated = append(mutated, raw)
+			continue
+		}
+
+		var o interface{}
+		var err error
+		switch header.Kind {
+		case "DeploymentConfig":
+			dc := &osappsv1.DeploymentConfig{}
+			if err := json.Unmarshal(raw.Raw, dc); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode the DeploymentConfig %s", applicationName)
+			}
+			o, err = dc, m.mutateDeploymentConfig(dc, plugins)
+		case "Service":
+			service := &v1.Service{}
+			if err := json.Unmarshal(raw.Raw, service); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode the Service %s", applicationName)
+			}
+			o, err = service, m.mutateService(service)
+		default:
+			mutated = append(mutated, raw)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode the %s %s", header.Kind, applicationName)
+		}
+		found[header.Kind] = true
+		mutated = append(mutated, runtime.RawExtension{Raw: data})
+	}
+	for _, kind := range []string{"DeploymentConfig", "Service"} {
+		if !found[kind] {
+			return nil, errors.Errorf("the template has no %s named %s", kind, applicationName)
+		}
+	}
+	return mutated, nil
+}
+
+// mutateDeploymentConfig adds the plugins init container and the volumes it fills to the SSO pod, mounts them into
+// the SSO container and copies the themes into place when the container starts
+func (m *templateMutator) mutateDeploymentConfig(dc *osappsv1.DeploymentConfig, plugins string) error {
+	if dc.Spec.Template == nil {
+		return errors.Errorf("the DeploymentConfig %s has no pod template", dc.Name)
+	}
+	podSpec := &dc.Spec.Template.Spec
+	var container *v1.Container
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == dc.Name {
+			container = &podSpec.Containers[i]
+		}
+	}
+	if container == nil {
+		return errors.Errorf("the DeploymentConfig %s has no container named %s", dc.Name, dc.Name)
+	}
+
+	initContainer := v1.Container{
+		Name:  m.InitContainerName,
+		Image: m.InitContainerImage,
+		Env:   []v1.EnvVar{{Name: m.PluginsEnvVarName, Value: plugins}},
+	}
+	for _, volume := range []VolumeInfo{m.PluginsVolumeInfo, m.ThemesVolumeInfo} {
+		for _, v := range podSpec.Volumes {
+			if v.Name == volume.VolumeName {
+				return errors.Errorf("the DeploymentConfig %s already has a volume named %s", dc.Name, volume.VolumeName)
+			}
+		}
+		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{Name: volume.VolumeName, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{Name: volume.VolumeName, MountPath: volume.VolumeMount})
+		initContainer.VolumeMounts = append(initContainer.VolumeMounts, v1.VolumeMount{Name: volume.VolumeName, MountPath: volume.InitVolumeMount})
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers, initContainer)
+
+	if container.Lifecycle == nil {
+		container.Lifecycle = &v1.Lifecycle{}
+	}
+	container.Lifecycle.PostStart = &v1.Handler{Exec: &v1.ExecAction{
+		Command: []string{"/bin/sh", "-c", fmt.Sprintf("cp -RT %s /opt/eap/themes", m.ThemesVolumeInfo.VolumeMount)},
+	}}
+	return nil
+}
+
+// mutateService names the first port of the SSO service, the service monitor selects the metrics endpoint by name
+func (m *templateMutator) mutateService(service *v1.Service) error {
+	if len(service.Spec.Ports) == 0 {
+		return errors.Errorf("the Service %s has no ports", service.Name)
+	}
+	service.Spec.Ports[0].Name = "sso"
+	return nil
+}
@@ -0,0 +1,157 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/integr8ly/keycloak-operator/pkg/apis/openshift"
+	osappsv1 "github.com/openshift/api/apps/v1"
+	templatev1 "github.com/openshift/api/template/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRenderShippedTemplates(t *testing.T) {
+	os.Setenv(SSO_TEMPLATE_PATH_ENV_VAR, "../../"+SSO_TEMPLATE_PATH)
+	files, err := filepath.Glob("../../" + SSO_TEMPLATE_PATH + "/sso*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected the shipped templates, got %v %v", files, err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			templ, err := readTemplate(filepath.Base(file))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			objects, err := renderTemplate(templ, map[string]string{"APPLICATION_NAME": "keycloak", "SSO_PLUGINS": "keycloak-metrics-spi"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			dc := &osappsv1.DeploymentConfig{}
+			service := &corev1.Service{}
+			for _, raw := range objects {
+				header := struct {
+					Kind     string
+					Metadata struct{ Name string }
+				}{}
+				decodeInto(t, raw, &header)
+				switch {
+				case header.Kind == "DeploymentConfig" && header.Metadata.Name == "keycloak":
+					decodeInto(t, raw, dc)
+				case header.Kind == "Service" && header.Metadata.Name == "keycloak":
+					decodeInto(t, raw, service)
+				}
+			}
+			mutator := newTemplateMutator()
+			if dc.Name != "keycloak" || len(dc.Spec.Template.Spec.InitContainers) != 1 {
+				t.Fatalf("expected the plugins init container on the keycloak DeploymentConfig, got %v", dc.Spec.Template)
+			}
+			initContainer := dc.Spec.Template.Spec.InitContainers[0]
+			if initContainer.Name != mutator.InitContainerName || envVar(&initContainer, mutator.PluginsEnvVarName) != "keycloak-metrics-spi" {
+				t.Fatalf("expected the init container to install the plugins, got %v", initContainer)
+			}
+			container := workloadContainer(dc, "keycloak")
+			mounts := map[string]string{}
+			for _, m := range container.VolumeMounts {
+				mounts[m.Name] = m.MountPath
+			}
+			if mounts[mutator.PluginsVolumeInfo.VolumeName] != mutator.PluginsVolumeInfo.VolumeMount || mounts[mutator.ThemesVolumeInfo.VolumeName] != mutator.ThemesVolumeInfo.VolumeMount {
+				t.Fatalf("expected the plugins and themes to be mounted, got %v", container.VolumeMounts)
+			}
+			if container.Lifecycle == nil || container.Lifecycle.PostStart == nil {
+				t.Fatalf("expected the themes to be copied when the container starts, got %v", container.Lifecycle)
+			}
+			if service.Name != "keycloak" || service.Spec.Ports[0].Name != "sso" {
+				t.Fatalf("expected the first port of the keycloak service to be named, got %v", service.Spec.Ports)
+			}
+			for _, p := range templ.Parameters {
+				if p.Name == postgresImageStreamTagParameter && p.Value != SSO_POSTGRES_VERSION {
+					t.Fatalf("expected the postgresql image stream tag %s, got %s", SSO_POSTGRES_VERSION, p.Value)
+				}
+			}
+		})
+	}
+}
+
+func decodeInto(t *testing.T, raw runtime.RawExtension, o interface{}) {
+	if err := json.Unmarshal(raw.Raw, o); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTemplateMutatorMissingElements(t *testing.T) {
+	dc := `{"kind": "DeploymentConfig", "metadata": {"name": "sso"}, "spec": {"template": {"spec": {"containers": [{"name": "sso"}]}}}}`
+	service := `{"kind": "Service", "metadata": {"name": "sso"}, "spec": {"ports": [{"port": 8443}]}}`
+	cases := []struct {
+		Name        string
+		Objects     []string
+		ExpectError string
+	}{
+		{
+			Name:    "Expected layout",
+			Objects: []string{dc, service},
+		},
+		{
+			Name:        "Missing DeploymentConfig",
+			Objects:     []string{service},
+			ExpectError: "the template has no DeploymentConfig named sso",
+		},
+		{
+			Name:        "Missing Service",
+			Objects:     []string{dc},
+			ExpectError: "the template has no Service named sso",
+		},
+		{
+			Name:        "Renamed container",
+			Objects:     []string{strings.Replace(dc, `"containers": [{"name": "sso"}]`, `"containers": [{"name": "keycloak"}]`, 1), service},
+			ExpectError: "the DeploymentConfig sso has no container named sso",
+		},
+		{
+			Name:        "Missing pod template",
+			Objects:     []string{`{"kind": "DeploymentConfig", "metadata": {"name": "sso"}, "spec": {}}`, service},
+			ExpectError: "the DeploymentConfig sso has no pod template",
+		},
+		{
+			Name:        "Existing plugins volume",
+			Objects:     []string{strings.Replace(dc, `"containers"`, `"volumes": [{"name": "sso-plugins"}], "containers"`, 1), service},
+			ExpectError: "the DeploymentConfig sso already has a volume named sso-plugins",
+		},
+		{
+			Name:        "Service without ports",
+			Objects:     []string{dc, `{"kind": "Service", "metadata": {"name": "sso"}, "spec": {}}`},
+			ExpectError: "the Service sso has no ports",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			objects := []runtime.RawExtension{}
+			for _, o := range tc.Objects {
+				objects = append(objects, runtime.RawExtension{Raw: []byte(o)})
+			}
+			_, err := newTemplateMutator().MutateObjects(objects, "sso", "")
+			if tc.ExpectError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.ExpectError {
+				t.Fatalf("expected the error '%s', got %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
+
+func TestTemplateMutatorMissingParameter(t *testing.T) {
+	templ := &templatev1.Template{Parameters: []templatev1.Parameter{{Name: "APPLICATION_NAME"}}}
+	templ.Name = "sso"
+	if err := newTemplateMutator().MutateParameters(templ); err == nil || err.Error() != "template sso has no parameter "+postgresImageStreamTagParameter {
+		t.Fatalf("expected the missing parameter to be reported, got %v", err)
+	}
+}
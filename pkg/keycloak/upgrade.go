@@ -1,156 +1,486 @@
 package keycloak
 
 import (
-	v1 "github.com/openshift/api/apps/v1"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/keycloak/upgrade"
+	osappsv1 "github.com/openshift/api/apps/v1"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	cv1 "k8s.io/api/core/v1"
-	"regexp"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// defaultImageStreamNamespace is where the RH-SSO image streams are installed on OpenShift
+	defaultImageStreamNamespace = "openshift"
+	// upgradeReadyTimeout is how long the pods of an upgrade step get to become ready before it is rolled back
+	upgradeReadyTimeout = 15 * time.Minute
 )
 
-func CanUpgrade(version string) bool {
-	// we will handle upgrade for any 7.3.x version
-	r := regexp.MustCompile("^v7.3.*.GA$")
-	return r.MatchString(version)
+// targetRelease returns the release kc should run, the latest release when the spec doesn't name one
+func targetRelease(kc *v1alpha1.Keycloak) (upgrade.Release, error) {
+	if kc.Spec.Version == "" {
+		return upgrade.Releases.Latest(), nil
+	}
+	return upgrade.Releases.Release(kc.Spec.Version)
 }
 
-func DeploymentUpgraded(dc *v1.DeploymentConfig) bool {
-	if !triggersUpgraded(dc) {
-		logrus.Debug("triggers are not upgraded")
-		return false
+// applyImage points the Keycloak workload in objects at the image kc should run
+func applyImage(objects []runtime.Object, kc *v1alpha1.Keycloak) ([]runtime.Object, error) {
+	release, err := targetRelease(kc)
+	if err != nil {
+		return nil, err
 	}
-	if !volumesUpgraded(dc) {
-		logrus.Debug("volumes are not upgraded")
-		return false
+	for _, o := range objects {
+		if objectName(o) == applicationName(kc) {
+			setImage(o, release, kc.Spec.Image)
+		}
 	}
+	return objects, nil
+}
 
-	return envVarsAndVolumeMountsUpgraded(dc)
+// Upgrade moves a provisioned instance to the version and image in its spec. It plans the path of steps while the
+// instance is reconciled, backs up the database with the first backup of the spec with a pvc destination, refusing
+// to upgrade when the spec only has backups the operator can't restore, and then runs one step at a time:
+// each step scales the workload down, applies its changes, scales it back up and waits for the pods to be ready
+// before the next one starts. When they never become ready the backup is restored and the previous image pinned
+func (ph *phaseHandler) Upgrade(sso *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	kc := sso.DeepCopy()
+	if !kc.Spec.Provision {
+		return kc, nil
+	}
+	switch kc.Status.Phase {
+	case v1alpha1.PhaseReconcile:
+		return ph.planUpgrade(kc)
+	case v1alpha1.PhaseUpgrading:
+		if kc.Status.Upgrade == nil {
+			// the upgrade was started by an operator that didn't plan it ahead
+			return ph.planUpgrade(kc)
+		}
+		return ph.runUpgradeStep(kc)
+	}
+	return kc, nil
 }
 
-func triggersUpgraded(dc *v1.DeploymentConfig) bool {
-	for _, t := range dc.Spec.Triggers {
-		if t.Type == v1.DeploymentTriggerOnImageChange {
-			if t.ImageChangeParams.From.Name == SSO_IMAGE_STREAM {
-				return true
+func (ph *phaseHandler) planUpgrade(kc *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	target, err := targetRelease(kc)
+	if err != nil {
+		kc.Status.Message = fmt.Sprintf("not upgrading. %v", err)
+		return kc, nil
+	}
+	if kc.Status.Version == target.Version && kc.Status.Image == kc.Spec.Image && kc.Status.Phase != v1alpha1.PhaseUpgrading {
+		return kc, nil
+	}
+	if rb := kc.Status.RolledBack; rb != nil && rb.TargetVersion == target.Version && rb.TargetImage == kc.Spec.Image && kc.Status.Phase != v1alpha1.PhaseUpgrading {
+		kc.Status.Message = fmt.Sprintf("not upgrading. the upgrade to %s was rolled back, change spec.version or spec.image to retry", target.Version)
+		return kc, nil
+	}
+	path, err := upgrade.Releases.Path(kc.Status.Version, target.Version)
+	if err != nil {
+		kc.Status.Message = fmt.Sprintf("not upgrading. %v", err)
+		return kc, nil
+	}
+
+	if kc.Status.Phase != v1alpha1.PhaseUpgrading {
+		p, err := ph.platformFor(kc)
+		if err != nil {
+			return kc, err
+		}
+		application, _, err := p.Workloads(kc)
+		if err != nil {
+			return kc, errors.Wrap(err, "failed to get the workload to upgrade")
+		}
+		if restoring(application.object) {
+			kc.Status.Message = "not upgrading while a restore is running"
+			return kc, nil
+		}
+		kc.Status.Replicas = *workloadReplicas(application.object)
+		kc.Status.RollbackPoint = &v1alpha1.KeycloakRollbackPoint{Version: kc.Status.Version}
+		if container := workloadContainer(application.object, objectName(application.object)); container != nil {
+			kc.Status.RollbackPoint.Image = container.Image
+		}
+		if len(kc.Spec.Backups) > 0 {
+			backup, err := rollbackBackup(kc)
+			if err != nil {
+				kc.Status.Message = fmt.Sprintf("not upgrading. %v", err)
+				return kc, nil
 			}
+			kc.Status.RollbackPoint.Backup = backup.Name
+			kc.Status.RollbackPoint.BackupJob = fmt.Sprintf("%s-pre-upgrade-%d", kc.Name, time.Now().Unix())
 		}
 	}
-	return false
+	logrus.Infof("upgrading %s/%s from %s to %s", kc.Namespace, kc.Name, kc.Status.Version, target.Version)
+	kc.Status.Phase = v1alpha1.PhaseUpgrading
+	kc.Status.Message = fmt.Sprintf("upgrading from %s to %s", kc.Status.Version, target.Version)
+	kc.Status.RolledBack = nil
+	kc.Status.Upgrade = &v1alpha1.KeycloakUpgradeStatus{
+		TargetVersion: target.Version,
+		TargetImage:   kc.Spec.Image,
+		Path:          upgrade.Versions(path),
+	}
+	return kc, nil
 }
 
-func volumesUpgraded(dc *v1.DeploymentConfig) bool {
-	for _, v := range dc.Spec.Template.Spec.Volumes {
-		if v.Name == "sso-x509-jgroups-volume" {
-			return true
+// rollbackBackup is the first backup in the spec the operator can restore to roll back an upgrade
+func rollbackBackup(kc *v1alpha1.Keycloak) (v1alpha1.KeycloakBackupConfig, error) {
+	for _, backup := range kc.Spec.Backups {
+		if restorable(backup) == nil {
+			return backup, nil
 		}
 	}
-	return false
+	return v1alpha1.KeycloakBackupConfig{}, errors.New("the upgrade can't be rolled back as none of the backups has a pvc destination the operator can restore, add one or remove the backups to upgrade without a rollback")
 }
 
-func envVarsAndVolumeMountsUpgraded(dc *v1.DeploymentConfig) bool {
-	jgroupEnvFound := false
-	ssoHostEnvFound := false
-	for _, c := range dc.Spec.Template.Spec.Containers {
-		if c.Name == SSO_APPLICATION_NAME {
-			volumeMountFound := false
-			for _, vm := range c.VolumeMounts {
-				if vm.Name == "sso-x509-jgroups-volume" {
-					volumeMountFound = true
-				}
-			}
-			if !volumeMountFound {
-				logrus.Debug("volume mound missing")
-				return false
-			}
-			for _, e := range c.Env {
-				if e.Name == "SSO_HOSTNAME" {
-					ssoHostEnvFound = true
-				}
-				if e.Name == "JGROUPS_ENCRYPT_PROTOCOL" {
-					jgroupEnvFound = true
-				}
+func (ph *phaseHandler) runUpgradeStep(kc *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	plan := kc.Status.Upgrade
+	if plan.RollingBack {
+		return ph.rollBack(kc)
+	}
+	if backedUp, err := ph.preUpgradeBackup(kc); err != nil || !backedUp {
+		return kc, err
+	}
+	path, err := upgrade.Releases.Path(kc.Status.Version, plan.TargetVersion)
+	if err != nil {
+		return kc, errors.Wrap(err, "failed to resume the upgrade")
+	}
+	// an image change within a version still needs a step to roll it out
+	step := upgrade.Step{To: plan.TargetVersion}
+	if len(path) > 0 {
+		step = path[0]
+	}
+	release, err := upgrade.Releases.Release(step.To)
+	if err != nil {
+		return kc, err
+	}
+	image := ""
+	if step.To == plan.TargetVersion {
+		image = plan.TargetImage
+	}
+	plan.Step = step.To
+	kc.Status.Message = fmt.Sprintf("upgrading from %s to %s, running the step to %s", kc.Status.Version, plan.TargetVersion, step.To)
+
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return kc, err
+	}
+	application, _, err := p.Workloads(kc)
+	if err != nil {
+		return kc, errors.Wrap(err, "failed to get the workload to upgrade")
+	}
+	services, err := ph.k8sClient.CoreV1().Services(kc.Namespace).List(v12.ListOptions{LabelSelector: instanceSelector(kc)})
+	if err != nil {
+		return kc, errors.Wrap(err, "failed to list the services to upgrade")
+	}
+	target := &upgrade.Target{Name: applicationName(kc), Workload: application.object, Services: map[string]*v1.Service{}}
+	for i := range services.Items {
+		target.Services[services.Items[i].Name] = &services.Items[i]
+	}
+
+	replicas := workloadReplicas(application.object)
+	if !(step.Migrated == nil || step.Migrated(target)) || !imageSet(application.object, release, image) {
+		// scale down so the new image can migrate the database schema without the old one running
+		if *replicas > 0 {
+			logrus.Debugf("scaling down %s for the upgrade to %s", objectName(application.object), step.To)
+			*replicas = 0
+			return kc, errors.Wrap(application.update(), "failed to scale down for the upgrade")
+		}
+		if !scaledDown(application.object) {
+			logrus.Debug("not yet scaled down waiting")
+			return kc, nil
+		}
+		if err := ph.migrate(kc, step, target, release, image, application); err != nil {
+			return kc, err
+		}
+		return kc, nil
+	}
+
+	if *replicas == 0 && kc.Status.Replicas > 0 {
+		logrus.Debug("scaling replicas to ", kc.Status.Replicas)
+		*replicas = kc.Status.Replicas
+		now := v12.Now()
+		plan.ScaledUp = &now
+		return kc, errors.Wrap(application.update(), "failed to scale back up after the upgrade")
+	}
+	ready := application.rolledOut
+	if ready {
+		if ready, err = ph.podsReady(kc.Namespace, p.ApplicationSelector(kc)); err != nil {
+			return kc, errors.Wrap(err, "failed waiting for sso pod to be ready")
+		}
+	}
+	if !ready {
+		if plan.ScaledUp == nil {
+			now := v12.Now()
+			plan.ScaledUp = &now
+		}
+		if rp := kc.Status.RollbackPoint; time.Since(plan.ScaledUp.Time) > upgradeReadyTimeout {
+			if rp == nil || rp.Completed == nil {
+				kc.Status.Message = fmt.Sprintf("the pods of the step to %s are not ready and there is no backup to roll back to", step.To)
+				return kc, nil
 			}
-			break
+			logrus.Warnf("rolling back the upgrade of %s/%s to %s, the pods never became ready", kc.Namespace, kc.Name, step.To)
+			plan.RollingBack = true
+			kc.Status.Message = fmt.Sprintf("rolling back to %s, the pods of the step to %s never became ready", rp.Version, step.To)
+			return kc, nil
 		}
+		logrus.Debug("not yet scaled up waiting")
+		return kc, nil
 	}
-	if jgroupEnvFound == true || !ssoHostEnvFound {
-		logrus.Debug("env vars are not correct")
-		return false
+
+	logrus.Infof("upgraded %s/%s to %s", kc.Namespace, kc.Name, step.To)
+	kc.Status.Version = step.To
+	plan.ScaledUp = nil
+	if step.To == plan.TargetVersion {
+		kc.Status.Image = plan.TargetImage
+		kc.Status.Upgrade = nil
+		kc.Status.Phase = v1alpha1.PhaseReconcile
+		kc.Status.Message = fmt.Sprintf("upgraded to %s", step.To)
 	}
-	return true
+	return kc, nil
 }
 
-func ServiceUpgraded(service *cv1.Service) bool {
-	_, ok := service.ObjectMeta.Annotations["service.alpha.openshift.io/serving-cert-secret-name"]
-	return ok
+// migrate applies the changes of step and the image of release to the scaled down workload and services
+func (ph *phaseHandler) migrate(kc *v1alpha1.Keycloak, step upgrade.Step, target *upgrade.Target, release upgrade.Release, image string, application *workload) error {
+	original := map[string]*v1.Service{}
+	for name, s := range target.Services {
+		original[name] = s.DeepCopy()
+	}
+	if step.Migrate != nil {
+		if err := step.Migrate(target); err != nil {
+			return errors.Wrapf(err, "failed to migrate to %s", step.To)
+		}
+	}
+	setImage(application.object, release, image)
+	logrus.Debugf("upgrading %s to %s", objectName(application.object), step.To)
+	if err := application.update(); err != nil {
+		return errors.Wrapf(err, "failed to update %s during upgrade", objectName(application.object))
+	}
+	for name, s := range target.Services {
+		if reflect.DeepEqual(original[name], s) {
+			continue
+		}
+		logrus.Debug("service being upgraded ", name)
+		if _, err := ph.k8sClient.CoreV1().Services(kc.Namespace).Update(s); err != nil {
+			return errors.Wrap(err, "failed to update the service "+name+" during upgrade")
+		}
+	}
+	return nil
 }
 
-func UpgradeDeploymentConfig(dc *v1.DeploymentConfig) *v1.DeploymentConfig {
-	for i, _ := range dc.Spec.Template.Spec.InitContainers {
-		if dc.Spec.Template.Spec.InitContainers[i].Name == "sso-plugins-init" {
-			logrus.Infof("updated init container image")
-			dc.Spec.Template.Spec.InitContainers[i].Image = "quay.io/integreatly/sso_plugins_init:0.0.3"
-		}
+// preUpgradeBackup runs the backup job of the rollback point and reports whether it succeeded, it reports true
+// straight away when no backup is set in the spec
+func (ph *phaseHandler) preUpgradeBackup(kc *v1alpha1.Keycloak) (bool, error) {
+	rp := kc.Status.RollbackPoint
+	if rp == nil || rp.BackupJob == "" || rp.Completed != nil {
+		return true, nil
+	}
+	backup, ok := specBackup(kc, rp.Backup)
+	if !ok {
+		kc.Status.Message = fmt.Sprintf("not upgrading. the backup %s was removed from the spec before the pre-upgrade backup completed", rp.Backup)
+		return false, nil
+	}
+	job, err := runJob(ph.k8sClient, backupJob(kc, backup, rp.BackupJob))
+	if err != nil {
+		return false, err
+	}
+	if c := jobFailure(job); c != nil {
+		kc.Status.Message = fmt.Sprintf("not upgrading. the pre-upgrade backup failed, delete the job %s to retry: %s", rp.BackupJob, c.Message)
+		return false, nil
 	}
-	for _, t := range dc.Spec.Triggers {
-		if t.Type == v1.DeploymentTriggerOnImageChange {
-			t.ImageChangeParams.From.Name = SSO_IMAGE_STREAM
+	if job.Status.Succeeded == 0 {
+		kc.Status.Message = fmt.Sprintf("waiting for the pre-upgrade backup %s", rp.BackupJob)
+		return false, nil
+	}
+	logrus.Infof("backed up %s/%s before upgrading, the archive is %s", kc.Namespace, kc.Name, rp.BackupJob)
+	now := v12.Now()
+	rp.Completed = &now
+	return true, nil
+}
+
+// rollBack restores the database from the backup of the rollback point and pins the image the instance ran before
+// the upgrade. The workload stays scaled down while the database is restored
+func (ph *phaseHandler) rollBack(kc *v1alpha1.Keycloak) (*v1alpha1.Keycloak, error) {
+	plan := kc.Status.Upgrade
+	rp := kc.Status.RollbackPoint
+	p, err := ph.platformFor(kc)
+	if err != nil {
+		return kc, err
+	}
+	application, _, err := p.Workloads(kc)
+	if err != nil {
+		return kc, errors.Wrap(err, "failed to get the workload to roll back")
+	}
+
+	replicas := workloadReplicas(application.object)
+	if !plan.Restored || !imageSet(application.object, upgrade.Release{}, rp.Image) {
+		if *replicas > 0 {
+			logrus.Debugf("scaling down %s to roll back", objectName(application.object))
+			*replicas = 0
+			return kc, errors.Wrap(application.update(), "failed to scale down for the rollback")
+		}
+		if !scaledDown(application.object) {
+			logrus.Debug("not yet scaled down waiting")
+			return kc, nil
 		}
 	}
-	volumeExists := false
-	volumeName := "sso-x509-jgroups-volume"
-	for _, v := range dc.Spec.Template.Spec.Volumes {
-		if v.Name == volumeName {
-			volumeExists = true
-			break
+	if !plan.Restored {
+		backup, ok := specBackup(kc, rp.Backup)
+		if !ok {
+			kc.Status.Message = fmt.Sprintf("not rolling back. the backup %s was removed from the spec", rp.Backup)
+			return kc, nil
 		}
+		if err := restorable(backup); err != nil {
+			kc.Status.Message = fmt.Sprintf("not rolling back. %v", err)
+			return kc, nil
+		}
+		job, err := runJob(ph.k8sClient, restoreJob(kc, backup, rp.BackupJob+"-restore", rp.BackupJob))
+		if err != nil {
+			return kc, err
+		}
+		if c := jobFailure(job); c != nil {
+			kc.Status.Message = fmt.Sprintf("rolling back to %s. restoring the backup failed, delete the job %s to retry: %s", rp.Version, job.Name, c.Message)
+			return kc, nil
+		}
+		if job.Status.Succeeded == 0 {
+			kc.Status.Message = fmt.Sprintf("rolling back to %s. waiting for the backup %s to be restored", rp.Version, rp.BackupJob)
+			return kc, nil
+		}
+		plan.Restored = true
 	}
-	if !volumeExists {
-		dc.Spec.Template.Spec.Volumes = append(dc.Spec.Template.Spec.Volumes, cv1.Volume{
-			Name: volumeName,
-			VolumeSource: cv1.VolumeSource{
-				Secret: &cv1.SecretVolumeSource{
-					SecretName: "sso-x509-jgroups-secret",
-				},
-			},
-		})
-	}
-	for i, c := range dc.Spec.Template.Spec.Containers {
-		if c.Name == SSO_APPLICATION_NAME {
-			// check if the volume already exists
-			volumeMountName := "sso-x509-jgroups-volume"
-			volumeMountExists := false
-			for _, vm := range dc.Spec.Template.Spec.Containers[i].VolumeMounts {
-				if vm.Name == volumeMountName {
-					volumeMountExists = true
-					break
-				}
-			}
-			if !volumeMountExists {
-				dc.Spec.Template.Spec.Containers[i].VolumeMounts = append(c.VolumeMounts, cv1.VolumeMount{
-					Name:      volumeMountName,
-					MountPath: "/etc/x509/jgroups",
-					ReadOnly:  true,
-				})
+	if !imageSet(application.object, upgrade.Release{}, rp.Image) {
+		setImage(application.object, upgrade.Release{}, rp.Image)
+		return kc, errors.Wrapf(application.update(), "failed to pin the image of %s", objectName(application.object))
+	}
+	if *replicas == 0 && kc.Status.Replicas > 0 {
+		*replicas = kc.Status.Replicas
+		return kc, errors.Wrap(application.update(), "failed to scale back up after the rollback")
+	}
+	if !application.rolledOut {
+		return kc, nil
+	}
+	if ready, err := ph.podsReady(kc.Namespace, p.ApplicationSelector(kc)); err != nil || !ready {
+		return kc, errors.Wrap(err, "failed waiting for sso pod to be ready")
+	}
+
+	logrus.Infof("rolled back %s/%s to %s", kc.Namespace, kc.Name, rp.Version)
+	kc.Status.RolledBack = &v1alpha1.KeycloakRolledBackUpgrade{
+		TargetVersion: plan.TargetVersion,
+		TargetImage:   plan.TargetImage,
+		Reason:        fmt.Sprintf("the pods of the step to %s never became ready", plan.Step),
+	}
+	kc.Status.Version = rp.Version
+	kc.Status.Image = rp.Image
+	kc.Status.Upgrade = nil
+	kc.Status.Phase = v1alpha1.PhaseReconcile
+	kc.Status.Message = fmt.Sprintf("rolled back to %s, the upgrade to %s failed", rp.Version, plan.TargetVersion)
+	return kc, nil
+}
+
+func (ph *phaseHandler) podsReady(namespace, selector string) (bool, error) {
+	pods, err := ph.k8sClient.CoreV1().Pods(namespace).List(v12.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return false, err
+	}
+	for _, p := range pods.Items {
+		for _, ps := range p.Status.ContainerStatuses {
+			if !ps.Ready {
+				logrus.Debug("containers not ready yet")
+				return false, nil
 			}
-			var ei = 0
-			var e = cv1.EnvVar{}
-			for ei, e = range c.Env {
-				if e.Name == "JGROUPS_ENCRYPT_PROTOCOL" {
-					break
+		}
+	}
+	return true, nil
+}
+
+func scaledDown(o runtime.Object) bool {
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		return w.Status.Replicas == 0 && w.Status.AvailableReplicas == 0
+	case *osappsv1.DeploymentConfig:
+		return w.Status.Replicas == 0 && w.Status.AvailableReplicas == 0
+	}
+	return true
+}
+
+// setImage points the Keycloak workload o at image, or at the image of release when image is empty. On OpenShift
+// the image of a release comes from its image stream, so an image set in the spec replaces the image trigger
+func setImage(o runtime.Object, release upgrade.Release, image string) {
+	name := objectName(o)
+	container := workloadContainer(o, name)
+	if container == nil {
+		return
+	}
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		if image == "" {
+			image = release.Image
+		}
+		container.Image = image
+	case *osappsv1.DeploymentConfig:
+		namespace := defaultImageStreamNamespace
+		triggers := osappsv1.DeploymentTriggerPolicies{}
+		for _, t := range w.Spec.Triggers {
+			if imageTriggerFor(t, name) {
+				if t.ImageChangeParams.From.Namespace != "" {
+					namespace = t.ImageChangeParams.From.Namespace
 				}
+				continue
 			}
-			dc.Spec.Template.Spec.Containers[i].Env = append(c.Env[:ei], c.Env[ei+1:]...)
-			dc.Spec.Template.Spec.Containers[i].Env = append(dc.Spec.Template.Spec.Containers[i].Env, cv1.EnvVar{
-				Name:  "SSO_HOSTNAME",
-				Value: "",
+			triggers = append(triggers, t)
+		}
+		if image != "" {
+			container.Image = image
+		} else {
+			triggers = append(triggers, osappsv1.DeploymentTriggerPolicy{
+				Type: osappsv1.DeploymentTriggerOnImageChange,
+				ImageChangeParams: &osappsv1.DeploymentTriggerImageChangeParams{
+					Automatic:      true,
+					ContainerNames: []string{name},
+					From:           v1.ObjectReference{Kind: "ImageStreamTag", Namespace: namespace, Name: release.ImageStream},
+				},
 			})
-			return dc
 		}
+		w.Spec.Triggers = triggers
 	}
-	return dc
 }
 
-func UpgradeService(s *cv1.Service) *cv1.Service {
-	s.ObjectMeta.Annotations["service.alpha.openshift.io/serving-cert-secret-name"] = "sso-x509-jgroups-secret"
-	return s
+// imageSet reports whether setImage was already applied to o
+func imageSet(o runtime.Object, release upgrade.Release, image string) bool {
+	name := objectName(o)
+	container := workloadContainer(o, name)
+	if container == nil {
+		return true
+	}
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		if image == "" {
+			image = release.Image
+		}
+		return container.Image == image
+	case *osappsv1.DeploymentConfig:
+		for _, t := range w.Spec.Triggers {
+			if imageTriggerFor(t, name) {
+				return image == "" && t.ImageChangeParams.From.Name == release.ImageStream
+			}
+		}
+		return image != "" && container.Image == image
+	}
+	return true
+}
+
+func imageTriggerFor(t osappsv1.DeploymentTriggerPolicy, container string) bool {
+	if t.Type != osappsv1.DeploymentTriggerOnImageChange || t.ImageChangeParams == nil {
+		return false
+	}
+	for _, name := range t.ImageChangeParams.ContainerNames {
+		if name == container {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,29 @@
+package upgrade
+
+import "regexp"
+
+const (
+	SSO74_VERSION      = "v7.4.2.GA"
+	SSO74_IMAGE_STREAM = "redhat-sso74-openshift:1.0"
+)
+
+// Releases are the releases supported by the operator and the steps between them
+var Releases = NewRegistry(
+	[]Release{
+		{
+			Version:     SSO74_VERSION,
+			Template:    "sso74-x509-postgresql-persistent.json",
+			ImageStream: SSO74_IMAGE_STREAM,
+			Image:       "registry.redhat.io/rh-sso-7/sso74-openshift-rhel8:7.4",
+		},
+	},
+	[]Step{
+		{
+			// we will handle upgrade for any 7.3.x version
+			From:     regexp.MustCompile(`^v7\.3\..*\.GA$`),
+			To:       SSO74_VERSION,
+			Migrated: migratedTo74,
+			Migrate:  migrateTo74,
+		},
+	},
+)
@@ -0,0 +1,104 @@
+package upgrade
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Release is a version of Keycloak the operator can provision and upgrade to
+type Release struct {
+	Version string
+	// Template is the file name of the OpenShift template the release is provisioned from
+	Template string
+	// ImageStream is the image stream tag that triggers the DeploymentConfig of the release on OpenShift
+	ImageStream string
+	// Image is the container image of the release on Kubernetes
+	Image string
+}
+
+// Target is the deployed instance a step migrates
+type Target struct {
+	// Name is the application name the objects of the instance are named after
+	Name string
+	// Workload is the Keycloak DeploymentConfig or Deployment
+	Workload runtime.Object
+	// Services are the services of the instance by name
+	Services map[string]*corev1.Service
+}
+
+// Step migrates an instance from the versions matched by From to the release To
+type Step struct {
+	From *regexp.Regexp
+	To   string
+	// Migrated reports whether the target already has the changes of the step, a nil Migrated means it has
+	Migrated func(t *Target) bool
+	// Migrate changes the target. It is called while the workload is scaled down so the image of the release
+	// can migrate the database schema on its own before serving requests
+	Migrate func(t *Target) error
+}
+
+// Registry holds the releases the operator supports and the steps between them
+type Registry struct {
+	releases []Release
+	steps    []Step
+}
+
+// NewRegistry returns a registry of releases, ordered from oldest to latest, and the steps between them
+func NewRegistry(releases []Release, steps []Step) *Registry {
+	return &Registry{releases: releases, steps: steps}
+}
+
+// Latest returns the most recent release
+func (r *Registry) Latest() Release {
+	return r.releases[len(r.releases)-1]
+}
+
+// Release returns the release of version
+func (r *Registry) Release(version string) (Release, error) {
+	for _, release := range r.releases {
+		if release.Version == version {
+			return release, nil
+		}
+	}
+	return Release{}, errors.Errorf("unsupported version '%s'", version)
+}
+
+// Path returns the steps that take an instance from version from to version to, in the order they have to run.
+// It returns an error when no sequence of steps leads there, which includes every downgrade
+func (r *Registry) Path(from, to string) ([]Step, error) {
+	if _, err := r.Release(to); err != nil {
+		return nil, err
+	}
+	path := []Step{}
+	current := from
+	for current != to {
+		step, ok := r.next(current)
+		if !ok || len(path) == len(r.steps) {
+			return nil, errors.Errorf("no upgrade path from version '%s' to '%s'", from, to)
+		}
+		path = append(path, step)
+		current = step.To
+	}
+	return path, nil
+}
+
+func (r *Registry) next(version string) (Step, bool) {
+	for _, s := range r.steps {
+		if s.From.MatchString(version) {
+			return s, true
+		}
+	}
+	return Step{}, false
+}
+
+// Versions returns the version every step of path upgrades to
+func Versions(path []Step) []string {
+	versions := make([]string, 0, len(path))
+	for _, s := range path {
+		versions = append(versions, s.To)
+	}
+	return versions
+}
@@ -0,0 +1,83 @@
+package upgrade_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/keycloak/upgrade"
+)
+
+func TestRegistryPath(t *testing.T) {
+	registry := upgrade.NewRegistry(
+		[]upgrade.Release{{Version: "v1.0"}, {Version: "v2.0"}, {Version: "v3.0"}},
+		[]upgrade.Step{
+			{From: regexp.MustCompile(`^v1\.`), To: "v2.0"},
+			{From: regexp.MustCompile(`^v2\.`), To: "v3.0"},
+			{From: regexp.MustCompile(`^v9\.`), To: "v9.1"},
+			{From: regexp.MustCompile(`^v9\.1$`), To: "v9.0"},
+		},
+	)
+	cases := []struct {
+		Name        string
+		From        string
+		To          string
+		Expected    []string
+		ExpectError bool
+	}{
+		{
+			Name:     "Same version",
+			From:     "v2.0",
+			To:       "v2.0",
+			Expected: []string{},
+		},
+		{
+			Name:     "Single step",
+			From:     "v1.3",
+			To:       "v2.0",
+			Expected: []string{"v2.0"},
+		},
+		{
+			Name:     "Several steps in order",
+			From:     "v1.0",
+			To:       "v3.0",
+			Expected: []string{"v2.0", "v3.0"},
+		},
+		{
+			Name:        "Downgrade",
+			From:        "v3.0",
+			To:          "v1.0",
+			ExpectError: true,
+		},
+		{
+			Name:        "Unknown target",
+			From:        "v1.0",
+			To:          "v4.0",
+			ExpectError: true,
+		},
+		{
+			Name:        "Steps going round in circles",
+			From:        "v9.0",
+			To:          "v3.0",
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path, err := registry.Path(tc.From, tc.To)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatalf("expected an error but got the path %v", upgrade.Versions(path))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(upgrade.Versions(path), tc.Expected) {
+				t.Fatalf("expected the path %v, got %v", tc.Expected, upgrade.Versions(path))
+			}
+		})
+	}
+}
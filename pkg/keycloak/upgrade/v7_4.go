@@ -0,0 +1,177 @@
+package upgrade
+
+import (
+	v1 "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	cv1 "k8s.io/api/core/v1"
+)
+
+// migratedTo74 only looks at DeploymentConfigs, instances were first provisioned on other platforms with 7.4
+func migratedTo74(t *Target) bool {
+	dc, ok := t.Workload.(*v1.DeploymentConfig)
+	if !ok {
+		return true
+	}
+	ping, ok := t.Services[t.Name+"-ping"]
+	return DeploymentUpgraded(dc.DeepCopy(), t.Name) && (!ok || ServiceUpgraded(ping))
+}
+
+func migrateTo74(t *Target) error {
+	dc, ok := t.Workload.(*v1.DeploymentConfig)
+	if !ok {
+		return nil
+	}
+	UpgradeDeploymentConfig(dc, t.Name)
+	if ping, ok := t.Services[t.Name+"-ping"]; ok && !ServiceUpgraded(ping) {
+		UpgradeService(ping, t.Name)
+	}
+	return nil
+}
+
+// DeploymentUpgraded reports whether the DeploymentConfig of the application name was migrated to 7.4
+func DeploymentUpgraded(dc *v1.DeploymentConfig, name string) bool {
+	if !triggersUpgraded(dc) {
+		logrus.Debug("triggers are not upgraded")
+		return false
+	}
+	if !volumesUpgraded(dc) {
+		logrus.Debug("volumes are not upgraded")
+		return false
+	}
+
+	return envVarsAndVolumeMountsUpgraded(dc, name)
+}
+
+func triggersUpgraded(dc *v1.DeploymentConfig) bool {
+	for _, t := range dc.Spec.Triggers {
+		if t.Type == v1.DeploymentTriggerOnImageChange {
+			if t.ImageChangeParams.From.Name == SSO74_IMAGE_STREAM {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func volumesUpgraded(dc *v1.DeploymentConfig) bool {
+	for _, v := range dc.Spec.Template.Spec.Volumes {
+		if v.Name == "sso-x509-jgroups-volume" {
+			return true
+		}
+	}
+	return false
+}
+
+func envVarsAndVolumeMountsUpgraded(dc *v1.DeploymentConfig, name string) bool {
+	jgroupEnvFound := false
+	ssoHostEnvFound := false
+	for _, c := range dc.Spec.Template.Spec.Containers {
+		if c.Name == name {
+			volumeMountFound := false
+			for _, vm := range c.VolumeMounts {
+				if vm.Name == "sso-x509-jgroups-volume" {
+					volumeMountFound = true
+				}
+			}
+			if !volumeMountFound {
+				logrus.Debug("volume mound missing")
+				return false
+			}
+			for _, e := range c.Env {
+				if e.Name == "SSO_HOSTNAME" {
+					ssoHostEnvFound = true
+				}
+				if e.Name == "JGROUPS_ENCRYPT_PROTOCOL" {
+					jgroupEnvFound = true
+				}
+			}
+			break
+		}
+	}
+	if jgroupEnvFound == true || !ssoHostEnvFound {
+		logrus.Debug("env vars are not correct")
+		return false
+	}
+	return true
+}
+
+func ServiceUpgraded(service *cv1.Service) bool {
+	_, ok := service.ObjectMeta.Annotations["service.alpha.openshift.io/serving-cert-secret-name"]
+	return ok
+}
+
+// UpgradeDeploymentConfig migrates the DeploymentConfig of the application name to 7.4
+func UpgradeDeploymentConfig(dc *v1.DeploymentConfig, name string) *v1.DeploymentConfig {
+	for i, _ := range dc.Spec.Template.Spec.InitContainers {
+		if dc.Spec.Template.Spec.InitContainers[i].Name == "sso-plugins-init" {
+			logrus.Infof("updated init container image")
+			dc.Spec.Template.Spec.InitContainers[i].Image = "quay.io/integreatly/sso_plugins_init:0.0.3"
+		}
+	}
+	for _, t := range dc.Spec.Triggers {
+		if t.Type == v1.DeploymentTriggerOnImageChange {
+			t.ImageChangeParams.From.Name = SSO74_IMAGE_STREAM
+		}
+	}
+	volumeExists := false
+	volumeName := "sso-x509-jgroups-volume"
+	for _, v := range dc.Spec.Template.Spec.Volumes {
+		if v.Name == volumeName {
+			volumeExists = true
+			break
+		}
+	}
+	if !volumeExists {
+		dc.Spec.Template.Spec.Volumes = append(dc.Spec.Template.Spec.Volumes, cv1.Volume{
+			Name: volumeName,
+			VolumeSource: cv1.VolumeSource{
+				Secret: &cv1.SecretVolumeSource{
+					SecretName: name + "-x509-jgroups-secret",
+				},
+			},
+		})
+	}
+	for i, c := range dc.Spec.Template.Spec.Containers {
+		if c.Name == name {
+			// check if the volume already exists
+			volumeMountName := "sso-x509-jgroups-volume"
+			volumeMountExists := false
+			for _, vm := range dc.Spec.Template.Spec.Containers[i].VolumeMounts {
+				if vm.Name == volumeMountName {
+					volumeMountExists = true
+					break
+				}
+			}
+			if !volumeMountExists {
+				dc.Spec.Template.Spec.Containers[i].VolumeMounts = append(c.VolumeMounts, cv1.VolumeMount{
+					Name:      volumeMountName,
+					MountPath: "/etc/x509/jgroups",
+					ReadOnly:  true,
+				})
+			}
+			var ei = 0
+			var e = cv1.EnvVar{}
+			for ei, e = range c.Env {
+				if e.Name == "JGROUPS_ENCRYPT_PROTOCOL" {
+					break
+				}
+			}
+			dc.Spec.Template.Spec.Containers[i].Env = append(c.Env[:ei], c.Env[ei+1:]...)
+			dc.Spec.Template.Spec.Containers[i].Env = append(dc.Spec.Template.Spec.Containers[i].Env, cv1.EnvVar{
+				Name:  "SSO_HOSTNAME",
+				Value: "",
+			})
+			return dc
+		}
+	}
+	return dc
+}
+
+// UpgradeService has the ping service of the application name serve the jgroups certificate
+func UpgradeService(s *cv1.Service, name string) *cv1.Service {
+	if s.ObjectMeta.Annotations == nil {
+		s.ObjectMeta.Annotations = map[string]string{}
+	}
+	s.ObjectMeta.Annotations["service.alpha.openshift.io/serving-cert-secret-name"] = name + "-x509-jgroups-secret"
+	return s
+}
@@ -1,338 +1,467 @@
-package keycloak_test
+package keycloak
 
 import (
-	"fmt"
-	"github.com/integr8ly/keycloak-operator/pkg/keycloak"
-	v1 "github.com/openshift/api/apps/v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/apis/aerogear/v1alpha1"
+	"github.com/integr8ly/keycloak-operator/pkg/keycloak/upgrade"
+	osappsv1 "github.com/openshift/api/apps/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"testing"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
-func TestCanUpgrade(t *testing.T) {
+func upgradeKeycloak(version, image string) *v1alpha1.Keycloak {
+	return &v1alpha1.Keycloak{
+		ObjectMeta: v12.ObjectMeta{Name: "keycloak", Namespace: "test-namespace"},
+		Spec:       v1alpha1.KeycloakSpec{Provision: true, Version: version, Image: image},
+		Status: v1alpha1.KeycloakStatus{
+			GenericStatus: v1alpha1.GenericStatus{Phase: v1alpha1.PhaseReconcile, Version: upgrade.SSO74_VERSION},
+			Platform:      v1alpha1.PlatformKubernetes,
+		},
+	}
+}
+
+func TestPhaseHandlerPlanUpgrade(t *testing.T) {
 	cases := []struct {
-		Name     string
-		Versions []string
-		Expected bool
+		Name          string
+		Keycloak      *v1alpha1.Keycloak
+		ExpectedPhase v1alpha1.StatusPhase
+		ExpectedPath  []string
+		ExpectMessage string
 	}{
 		{
-			Name:     "Test Should upgrade",
-			Versions: []string{"v7.3.11.GA", "v7.3.1.GA"},
-			Expected: true,
+			Name:          "Up to date",
+			Keycloak:      upgradeKeycloak("", ""),
+			ExpectedPhase: v1alpha1.PhaseReconcile,
+		},
+		{
+			Name:          "New image",
+			Keycloak:      upgradeKeycloak("", "quay.io/keycloak/custom:1"),
+			ExpectedPhase: v1alpha1.PhaseUpgrading,
+			ExpectedPath:  []string{},
 		},
 		{
-			Name:     "Test Should Not upgrade",
-			Versions: []string{"v7.4.2.GA", "v7.4.1.GA", "v7.4.0.GA", "v7.3.0-ALPHA"},
-			Expected: false,
+			Name: "Older version",
+			Keycloak: func() *v1alpha1.Keycloak {
+				kc := upgradeKeycloak("", "")
+				kc.Status.Version = "v7.3.1.GA"
+				return kc
+			}(),
+			ExpectedPhase: v1alpha1.PhaseUpgrading,
+			ExpectedPath:  []string{upgrade.SSO74_VERSION},
+		},
+		{
+			Name: "Backups that can't be restored",
+			Keycloak: func() *v1alpha1.Keycloak {
+				kc := backedUpKeycloak("", "quay.io/keycloak/custom:1")
+				kc.Spec.Backups[0].Destination = nil
+				return kc
+			}(),
+			ExpectedPhase: v1alpha1.PhaseReconcile,
+			ExpectMessage: "can't be rolled back",
+		},
+		{
+			Name:          "Unsupported version",
+			Keycloak:      upgradeKeycloak("v7.5.0.GA", ""),
+			ExpectedPhase: v1alpha1.PhaseReconcile,
+			ExpectMessage: "unsupported version",
+		},
+		{
+			Name: "No upgrade path",
+			Keycloak: func() *v1alpha1.Keycloak {
+				kc := upgradeKeycloak("", "")
+				kc.Status.Version = "v7.2.0.GA"
+				return kc
+			}(),
+			ExpectedPhase: v1alpha1.PhaseReconcile,
+			ExpectMessage: "no upgrade path",
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.Name, func(t *testing.T) {
-			for _, v := range tc.Versions {
-				ex := keycloak.CanUpgrade(v)
-				if ex != tc.Expected {
-					t.Fatal("expected ", tc.Expected, " but got ", ex)
+			deployment := kubernetesDeployment(tc.Keycloak, map[string]string{}, map[string]string{})
+			ph := NewPhaseHandler(fake.NewSimpleClientset(deployment), nil, nil, nil)
+			kc, err := ph.Upgrade(tc.Keycloak)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kc.Status.Phase != tc.ExpectedPhase {
+				t.Fatalf("expected phase %s, got %s", tc.ExpectedPhase, kc.Status.Phase)
+			}
+			if !strings.Contains(kc.Status.Message, tc.ExpectMessage) {
+				t.Fatalf("expected the message to contain '%s', got '%s'", tc.ExpectMessage, kc.Status.Message)
+			}
+			if tc.ExpectedPath != nil {
+				if kc.Status.Upgrade == nil || strings.Join(kc.Status.Upgrade.Path, ",") != strings.Join(tc.ExpectedPath, ",") {
+					t.Fatalf("expected the path %v, got %v", tc.ExpectedPath, kc.Status.Upgrade)
+				}
+				if kc.Status.Replicas != 1 {
+					t.Fatalf("expected the replicas to be recorded, got %d", kc.Status.Replicas)
 				}
 			}
 		})
 	}
 }
 
-func TestUpgradeService(t *testing.T) {
-	cases := []struct {
-		Name     string
-		SVC      *corev1.Service
-		Validate func(t *testing.T, s *corev1.Service)
-	}{
-		{
-			Name: "test service upgraded as expected",
-			SVC: &corev1.Service{
-				ObjectMeta: v12.ObjectMeta{Annotations: map[string]string{}},
-			},
-			Validate: func(t *testing.T, s *corev1.Service) {
-				v, ok := s.Annotations["service.alpha.openshift.io/serving-cert-secret-name"]
-				if !ok {
-					t.Fatal("expected the annotation ", "service.alpha.openshift.io/serving-cert-secret-name", "to be present")
-				}
-				if v != "sso-x509-jgroups-secret" {
-					t.Fatal("expected the annotation service.alpha.openshift.io/serving-cert-secret-name to be sso-x509-jgroups-secret but it was  ", v)
-				}
-			},
-		},
+func TestPhaseHandlerRunUpgrade(t *testing.T) {
+	image := "quay.io/keycloak/custom:1"
+	kc := upgradeKeycloak("", image)
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+	setImage(deployment, upgrade.Releases.Latest(), "")
+	deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	k8sClient := fake.NewSimpleClientset(deployment)
+	deployments := k8sClient.AppsV1().Deployments("test-namespace")
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+	upgradeStep := func(kc *v1alpha1.Keycloak) (*v1alpha1.Keycloak, *appsv1.Deployment) {
+		kc, err := ph.Upgrade(kc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		deployment, err := deployments.Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return kc, deployment
+	}
+	setStatus := func(status appsv1.DeploymentStatus) {
+		d, _ := deployments.Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+		d.Status = status
+		if _, err := deployments.Update(d); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
 	}
 
-	for _, tc := range cases {
-		t.Run(tc.Name, func(t *testing.T) {
-			tc.Validate(t, keycloak.UpgradeService(tc.SVC))
-		})
+	kc, _ = upgradeStep(kc)
+	if kc.Status.Phase != v1alpha1.PhaseUpgrading {
+		t.Fatalf("expected the upgrade to be planned, got phase %s", kc.Status.Phase)
+	}
+	kc, deployment = upgradeStep(kc)
+	if *deployment.Spec.Replicas != 0 {
+		t.Fatalf("expected the deployment to be scaled down, got %d replicas", *deployment.Spec.Replicas)
+	}
+	kc, deployment = upgradeStep(kc)
+	if workloadContainer(deployment, SSO_APPLICATION_NAME).Image == image {
+		t.Fatal("expected the image to be kept until the pods are gone")
+	}
+	setStatus(appsv1.DeploymentStatus{})
+	kc, deployment = upgradeStep(kc)
+	if workloadContainer(deployment, SSO_APPLICATION_NAME).Image != image {
+		t.Fatalf("expected the image to be set once scaled down, got %s", workloadContainer(deployment, SSO_APPLICATION_NAME).Image)
+	}
+	kc, deployment = upgradeStep(kc)
+	if *deployment.Spec.Replicas != 1 {
+		t.Fatalf("expected the deployment to be scaled back up, got %d replicas", *deployment.Spec.Replicas)
+	}
+	kc, _ = upgradeStep(kc)
+	if kc.Status.Phase != v1alpha1.PhaseUpgrading {
+		t.Fatal("expected the upgrade to wait for the rollout")
+	}
+	setStatus(appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1})
+	kc, _ = upgradeStep(kc)
+	if kc.Status.Phase != v1alpha1.PhaseReconcile || kc.Status.Image != image || kc.Status.Upgrade != nil {
+		t.Fatalf("expected the upgrade to complete, got %v", kc.Status)
 	}
 }
 
-func TestDeploymentUpgraded(t *testing.T) {
-	dc := &v1.DeploymentConfig{
-		Spec: v1.DeploymentConfigSpec{
-			Triggers: v1.DeploymentTriggerPolicies{
-				v1.DeploymentTriggerPolicy{
-					Type: v1.DeploymentTriggerOnImageChange,
-					ImageChangeParams: &v1.DeploymentTriggerImageChangeParams{
-						From: corev1.ObjectReference{
-							Name: keycloak.SSO_IMAGE_STREAM,
-						},
-					},
-				},
-			},
-			Template: &corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						corev1.Volume{Name: "sso-x509-jgroups-volume"},
-						corev1.Volume{},
-					},
-					Containers: []corev1.Container{
-						corev1.Container{
-							Name: keycloak.SSO_APPLICATION_NAME,
-							VolumeMounts: []corev1.VolumeMount{
-								corev1.VolumeMount{Name: "sso-x509-jgroups-volume"},
-								corev1.VolumeMount{},
-							},
-							Env: []corev1.EnvVar{
-								corev1.EnvVar{Name: "SSO_HOSTNAME"},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
+func backedUpKeycloak(version, image string) *v1alpha1.Keycloak {
+	kc := upgradeKeycloak(version, image)
+	kc.Spec.Backups = []v1alpha1.KeycloakBackupConfig{{
+		Name:                    "nightly",
+		Schedule:                "0 2 * * *",
+		EncryptionKeySecretName: "encryption",
+		Image:                   "quay.io/integreatly/backup-container",
+		ImageTag:                "1.0.8",
+		Destination:             &v1alpha1.KeycloakBackupDestination{PVC: &v1alpha1.KeycloakBackupPVCDestination{ClaimName: "backups", Path: "sso"}},
+	}}
+	return kc
+}
+
+func TestPhaseHandlerPreUpgradeBackup(t *testing.T) {
 	cases := []struct {
-		Name     string
-		Expect   bool
-		DC       *v1.DeploymentConfig
-		ModifyDC func(config *v1.DeploymentConfig) *v1.DeploymentConfig
+		Name           string
+		JobStatus      batchv1.JobStatus
+		ExpectReplicas int32
+		ExpectMessage  string
 	}{
 		{
-			Name:   "test an upgraded deployment return true",
-			DC:     dc,
-			Expect: true,
+			Name:           "Backup succeeded",
+			JobStatus:      batchv1.JobStatus{Succeeded: 1},
+			ExpectReplicas: 0,
+			ExpectMessage:  "running the step",
 		},
 		{
-			Name:   "test missing volumes in deployment return false",
-			DC:     dc,
-			Expect: false,
-			ModifyDC: func(config *v1.DeploymentConfig) *v1.DeploymentConfig {
-				cp := config.DeepCopy()
-				cp.Spec.Template.Spec.Volumes = []corev1.Volume{}
-				return cp
-			},
+			Name:           "Backup running",
+			ExpectReplicas: 1,
+			ExpectMessage:  "waiting for the pre-upgrade backup",
 		},
 		{
-			Name:   "test missing env var return false",
-			DC:     dc,
-			Expect: false,
-			ModifyDC: func(config *v1.DeploymentConfig) *v1.DeploymentConfig {
-				cp := config.DeepCopy()
-				cp.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{}
-				return cp
-			},
+			Name: "Backup failed",
+			JobStatus: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+			}},
+			ExpectReplicas: 1,
+			ExpectMessage:  "pre-upgrade backup failed",
 		},
 	}
+
 	for _, tc := range cases {
 		t.Run(tc.Name, func(t *testing.T) {
-			dc := tc.DC
-			if tc.ModifyDC != nil {
-				dc = tc.ModifyDC(tc.DC)
+			kc := backedUpKeycloak("", "quay.io/keycloak/custom:1")
+			deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+			setImage(deployment, upgrade.Releases.Latest(), "")
+			k8sClient := fake.NewSimpleClientset(deployment)
+			ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+
+			kc, err := ph.Upgrade(kc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			fmt.Println(dc.Spec.Template.Spec.Volumes)
-			upgraded := keycloak.DeploymentUpgraded(dc)
-			if upgraded != tc.Expect {
-				t.Fatalf("expected to get %v but got %v for DeploymentUpgraded ", tc.Expect, upgraded)
+			rp := kc.Status.RollbackPoint
+			if rp == nil || rp.Backup != "nightly" || rp.Version != upgrade.SSO74_VERSION || rp.Image != upgrade.Releases.Latest().Image {
+				t.Fatalf("expected the rollback point to be recorded, got %v", rp)
+			}
+			if kc, err = ph.Upgrade(kc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			jobs := k8sClient.BatchV1().Jobs("test-namespace")
+			job, err := jobs.Get(rp.BackupJob, v12.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected the backup job to be created: %v", err)
+			}
+			container := job.Spec.Template.Spec.Containers[0]
+			cron := backupContainer(kc, kc.Spec.Backups[0], kc.Namespace)
+			if container.Image != cron.Image || strings.Join(container.Command, " ") != strings.Join(cron.Command, " ") {
+				t.Fatalf("expected the container of the scheduled backup, got %v", container)
+			}
+			if e := container.Env[len(container.Env)-1]; e.Name != backupArchiveEnv || e.Value != rp.BackupJob {
+				t.Fatalf("expected the archive to be named after the job, got %v", e)
+			}
+			job.Status = tc.JobStatus
+			if _, err := jobs.Update(job); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if kc, err = ph.Upgrade(kc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			deployment, _ = k8sClient.AppsV1().Deployments("test-namespace").Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+			if *deployment.Spec.Replicas != tc.ExpectReplicas {
+				t.Fatalf("expected %d replicas, got %d", tc.ExpectReplicas, *deployment.Spec.Replicas)
+			}
+			if !strings.Contains(kc.Status.Message, tc.ExpectMessage) {
+				t.Fatalf("expected the message to contain '%s', got '%s'", tc.ExpectMessage, kc.Status.Message)
+			}
+			if (kc.Status.RollbackPoint.Completed != nil) != (tc.JobStatus.Succeeded > 0) {
+				t.Fatalf("expected the backup to be recorded once it succeeded, got %v", kc.Status.RollbackPoint.Completed)
 			}
 		})
 	}
 }
 
-func TestServiceUpgraded(t *testing.T) {
-	cases := []struct {
-		Name   string
-		Expect bool
-		SVC    *corev1.Service
-	}{
-		{
-			Name:   "test service is upgraded",
-			Expect: true,
-			SVC: &corev1.Service{
-				ObjectMeta: v12.ObjectMeta{
-					Annotations: map[string]string{"service.alpha.openshift.io/serving-cert-secret-name": "sso-x509-jgroups-secret"},
-				},
-			},
-		},
-		{
-			Name:   "test service should is not upgraded",
-			Expect: false,
-			SVC: &corev1.Service{
-				ObjectMeta: v12.ObjectMeta{
-					Annotations: map[string]string{},
-				},
-			},
-		},
+func TestPhaseHandlerRollBack(t *testing.T) {
+	image := "quay.io/keycloak/custom:2"
+	previous := "quay.io/keycloak/custom:1"
+	kc := backedUpKeycloak("", image)
+	kc.Status.Image = previous
+	deployment := kubernetesDeployment(kc, map[string]string{}, map[string]string{})
+	setImage(deployment, upgrade.Releases.Latest(), previous)
+	deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	k8sClient := fake.NewSimpleClientset(deployment)
+	deployments := k8sClient.AppsV1().Deployments("test-namespace")
+	jobs := k8sClient.BatchV1().Jobs("test-namespace")
+	ph := NewPhaseHandler(k8sClient, nil, nil, nil)
+	// the volume of the backup destination, the jobs are run from their spec in the fake against it
+	volume, err := ioutil.TempDir("", "backups")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
+	defer os.RemoveAll(volume)
 
-	for _, tc := range cases {
-		t.Run(tc.Name, func(t *testing.T) {
-			upgraded := keycloak.ServiceUpgraded(tc.SVC)
-			if upgraded != tc.Expect {
-				t.Fatalf("Expected to get %v but got %v ", tc.Expect, upgraded)
-			}
-		})
+	upgradeStep := func(kc *v1alpha1.Keycloak) (*v1alpha1.Keycloak, *appsv1.Deployment) {
+		kc, err := ph.Upgrade(kc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		deployment, err := deployments.Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return kc, deployment
+	}
+	setStatus := func(status appsv1.DeploymentStatus) {
+		d, _ := deployments.Get(SSO_APPLICATION_NAME, v12.GetOptions{})
+		d.Status = status
+		if _, err := deployments.Update(d); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// runJob runs the job from the fake on the volume and records that it succeeded
+	runJob := func(name string) (*batchv1.Job, string) {
+		job, err := jobs.Get(name, v12.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected the job %s to be created: %v", name, err)
+		}
+		claim := job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim
+		if claim == nil || claim.ClaimName != "backups" {
+			t.Fatalf("expected the job to mount the claim of the backup, got %v", job.Spec.Template.Spec.Volumes)
+		}
+		out, err := runVolumeJob(t, job, filepath.Join(volume, "sso"), "keycloak")
+		if err != nil {
+			t.Fatalf("expected the job %s to succeed, got %v", name, err)
+		}
+		job.Status = batchv1.JobStatus{Succeeded: 1}
+		if _, err := jobs.Update(job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return job, out
 	}
-}
 
-func TestUpgradeDeploymentConfig(t *testing.T) {
-	testDC := &v1.DeploymentConfig{
-		Spec: v1.DeploymentConfigSpec{
-			Triggers: []v1.DeploymentTriggerPolicy{
-				v1.DeploymentTriggerPolicy{
-					Type: v1.DeploymentTriggerOnImageChange,
-					ImageChangeParams: &v1.DeploymentTriggerImageChangeParams{
-						From: corev1.ObjectReference{
-							Name: "test",
-						},
-					},
-				},
-			},
-			Template: &corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						corev1.Container{
-							Name:         keycloak.SSO_APPLICATION_NAME,
-							VolumeMounts: []corev1.VolumeMount{},
-							Env: []corev1.EnvVar{
-								corev1.EnvVar{
-									Name:  "JGROUPS_ENCRYPT_PROTOCOL",
-									Value: "test",
-								},
-							},
-						},
-					},
-				},
-			},
-		},
+	kc, _ = upgradeStep(kc)
+	rp := kc.Status.RollbackPoint
+	if kc.Status.Phase != v1alpha1.PhaseUpgrading || rp == nil || rp.Image != previous {
+		t.Fatalf("expected the upgrade to be planned with a rollback point, got %v", kc.Status)
 	}
-	cases := []struct {
-		Name     string
-		DC       func() *v1.DeploymentConfig
-		Validate func(t *testing.T, d *v1.DeploymentConfig)
-	}{
-		{
-			Name: "Test deployment config updated correctly",
-			DC: func() *v1.DeploymentConfig {
-				return testDC
-			},
-			Validate: func(t *testing.T, dc *v1.DeploymentConfig) {
-				imageTriggerFound := false
-				for _, tr := range dc.Spec.Triggers {
-					if tr.Type == v1.DeploymentTriggerOnImageChange {
-						imageTriggerFound = true
-						if tr.ImageChangeParams.From.Name != keycloak.SSO_IMAGE_STREAM {
-							t.Fatal("image stream name should be set to ", keycloak.SSO_IMAGE_STREAM, " but is set to ", tr.ImageChangeParams.From.Name)
-						}
-					}
-				}
-				if !imageTriggerFound {
-					t.Fatal("no image stream trigger found for on image change")
-				}
-				volumeFound := false
-				for _, v := range dc.Spec.Template.Spec.Volumes {
-					if v.Name == "sso-x509-jgroups-volume" {
-						volumeFound = true
-						if v.Secret.SecretName != "sso-x509-jgroups-secret" {
-							t.Fatal("expected the volume to be from a secret named sso-x509-jgroups-secret")
-						}
-					}
+	kc, _ = upgradeStep(kc)
+	backupJob, _ := runJob(rp.BackupJob)
+	if archives := archives(t, filepath.Join(volume, "sso")); len(archives) != 1 || archives[0] != rp.BackupJob+archiveExtension {
+		t.Fatalf("expected the pre-upgrade archive to be written, got %v", archives)
+	}
+	kc, deployment = upgradeStep(kc)
+	if *deployment.Spec.Replicas != 0 {
+		t.Fatalf("expected the deployment to be scaled down once backed up, got %d replicas", *deployment.Spec.Replicas)
+	}
+	setStatus(appsv1.DeploymentStatus{})
+	kc, deployment = upgradeStep(kc)
+	if workloadContainer(deployment, SSO_APPLICATION_NAME).Image != image {
+		t.Fatalf("expected the image to be upgraded, got %s", workloadContainer(deployment, SSO_APPLICATION_NAME).Image)
+	}
+	kc, _ = upgradeStep(kc)
+	setStatus(appsv1.DeploymentStatus{Replicas: 1, UnavailableReplicas: 1})
+	scaledUp := v12.NewTime(time.Now().Add(-2 * upgradeReadyTimeout))
+	kc.Status.Upgrade.ScaledUp = &scaledUp
 
-				}
-				if !volumeFound {
-					t.Fatal("did not find new volume after upgrade ")
-				}
-				containerFound := false
-				volumeMountFound := false
-				newContainerEnvFound := false
+	kc, _ = upgradeStep(kc)
+	if !kc.Status.Upgrade.RollingBack {
+		t.Fatalf("expected the upgrade to be rolled back, got %v", kc.Status.Message)
+	}
+	kc, deployment = upgradeStep(kc)
+	if *deployment.Spec.Replicas != 0 {
+		t.Fatalf("expected the deployment to be scaled down, got %d replicas", *deployment.Spec.Replicas)
+	}
+	setStatus(appsv1.DeploymentStatus{})
+	kc, _ = upgradeStep(kc)
+	kc, deployment = upgradeStep(kc)
+	if workloadContainer(deployment, SSO_APPLICATION_NAME).Image != image || kc.Status.Upgrade.Restored {
+		t.Fatal("expected the rollback to wait for the restore")
+	}
+	restoreJob, out := runJob(rp.BackupJob + "-restore")
+	if out != "DROP OWNED BY CURRENT_USER\nrestore of keycloak\n" {
+		t.Fatalf("expected the pre-upgrade archive to be restored, got %q", out)
+	}
+	backupEnv, restoreEnv := map[string]string{}, map[string]string{}
+	for _, e := range backupJob.Spec.Template.Spec.Containers[0].Env {
+		backupEnv[e.Name] = e.Value
+	}
+	for _, e := range restoreJob.Spec.Template.Spec.Containers[0].Env {
+		restoreEnv[e.Name] = e.Value
+	}
+	for _, name := range []string{backupDirectoryEnv, backupArchiveEnv} {
+		if backupEnv[name] != restoreEnv[name] {
+			t.Fatalf("expected the restore to read the archive the backup wrote, got %s %s and %s", name, backupEnv[name], restoreEnv[name])
+		}
+	}
 
-				for _, c := range dc.Spec.Template.Spec.Containers {
-					if c.Name == keycloak.SSO_APPLICATION_NAME {
-						containerFound = true
-						for _, vm := range c.VolumeMounts {
-							if vm.Name == "sso-x509-jgroups-volume" {
-								volumeMountFound = true
-								if !vm.ReadOnly {
-									t.Fatal("expected the volume mount ", "sso-x509-jgroups-volume", "to be read only")
-								}
-								if vm.MountPath != "/etc/x509/jgroups" {
-									t.Fatal("epected the mount path to be ", "/etc/x509/jgroups", "but it was "+vm.MountPath)
-								}
-							}
-						}
-						for _, ev := range c.Env {
-							if ev.Name == "SSO_HOSTNAME" {
-								newContainerEnvFound = true
-							}
-							if ev.Name == "JGROUPS_ENCRYPT_PROTOCOL" {
-								t.Fatal("did not expect to find JGROUPS_ENCRYPT_PROTOCOL in the env")
-							}
-						}
-					}
-				}
-				if !containerFound {
-					t.Fatal("expected the ", keycloak.SSO_APPLICATION_NAME, " container but it was not present")
-				}
-				if !volumeMountFound {
-					t.Fatal("expected to find a new volume mount named ", "sso-x509-jgroups-volume", "but found none")
-				}
-				if !newContainerEnvFound {
-					t.Fatal("expected to find a new env var SSO_HOSTNAME but it was missing")
-				}
+	kc, deployment = upgradeStep(kc)
+	if workloadContainer(deployment, SSO_APPLICATION_NAME).Image != previous {
+		t.Fatalf("expected the previous image to be pinned, got %s", workloadContainer(deployment, SSO_APPLICATION_NAME).Image)
+	}
+	kc, deployment = upgradeStep(kc)
+	if *deployment.Spec.Replicas != 1 {
+		t.Fatalf("expected the deployment to be scaled back up, got %d replicas", *deployment.Spec.Replicas)
+	}
+	setStatus(appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1})
+	kc, _ = upgradeStep(kc)
+	if kc.Status.Phase != v1alpha1.PhaseReconcile || kc.Status.Image != previous || kc.Status.RolledBack == nil || kc.Status.Upgrade != nil {
+		t.Fatalf("expected the rollback to complete, got %v", kc.Status)
+	}
+	kc, _ = upgradeStep(kc)
+	if kc.Status.Phase != v1alpha1.PhaseReconcile || !strings.Contains(kc.Status.Message, "rolled back") {
+		t.Fatalf("expected the rolled back upgrade not to be retried, got %s: %s", kc.Status.Phase, kc.Status.Message)
+	}
+}
 
-			},
-		},
+func TestSetImageOnDeploymentConfig(t *testing.T) {
+	release := upgrade.Releases.Latest()
+	cases := []struct {
+		Name          string
+		Image         string
+		ExpectTrigger bool
+		ExpectedImage string
+	}{
 		{
-			Name: "test volume and volume only exists once",
-			DC: func() *v1.DeploymentConfig {
-				dcCopy := testDC.DeepCopy()
-				dcCopy.Spec.Template.Spec.Volumes = []corev1.Volume{
-					corev1.Volume{
-						Name: "sso-x509-jgroups-volume",
-						VolumeSource: corev1.VolumeSource{
-							Secret: &corev1.SecretVolumeSource{
-								SecretName: "sso-x509-jgroups-secret",
-							},
-						},
-					},
-				}
-				return dcCopy
-			},
-			Validate: func(t *testing.T, d *v1.DeploymentConfig) {
-				t.Log(d.Spec.Template.Spec.Volumes)
-				if len(d.Spec.Template.Spec.Volumes) > 1 {
-					t.Fatal("expected only once volume but got ", len(d.Spec.Template.Spec.Volumes))
-				}
-			},
+			Name:          "Image of the release",
+			ExpectTrigger: true,
+			ExpectedImage: "sso",
 		},
 		{
-			Name: "test upgrade and is upgraded",
-			DC: func() *v1.DeploymentConfig {
-				return testDC
-			},
-			Validate: func(t *testing.T, d *v1.DeploymentConfig) {
-				if !keycloak.DeploymentUpgraded(d) {
-					t.Fatal("expected the deployment to be recognised as upgraded")
-				}
-			},
+			Name:          "Image set in the spec",
+			Image:         "quay.io/keycloak/custom:1",
+			ExpectedImage: "quay.io/keycloak/custom:1",
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.Name, func(t *testing.T) {
-			tc.Validate(t, keycloak.UpgradeDeploymentConfig(tc.DC()))
+			dc := &osappsv1.DeploymentConfig{
+				ObjectMeta: v12.ObjectMeta{Name: SSO_APPLICATION_NAME},
+				Spec: osappsv1.DeploymentConfigSpec{
+					Triggers: osappsv1.DeploymentTriggerPolicies{
+						{Type: osappsv1.DeploymentTriggerOnConfigChange},
+						{
+							Type: osappsv1.DeploymentTriggerOnImageChange,
+							ImageChangeParams: &osappsv1.DeploymentTriggerImageChangeParams{
+								ContainerNames: []string{SSO_APPLICATION_NAME},
+								From:           corev1.ObjectReference{Kind: "ImageStreamTag", Namespace: "images", Name: "redhat-sso73-openshift:1.0"},
+							},
+						},
+					},
+					Template: &corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: SSO_APPLICATION_NAME, Image: "sso"}}},
+					},
+				},
+			}
+			if imageSet(dc, release, tc.Image) {
+				t.Fatal("expected the image not to be set yet")
+			}
+			setImage(dc, release, tc.Image)
+			if !imageSet(dc, release, tc.Image) {
+				t.Fatal("expected the image to be set")
+			}
+			if dc.Spec.Template.Spec.Containers[0].Image != tc.ExpectedImage {
+				t.Fatalf("expected image %s, got %s", tc.ExpectedImage, dc.Spec.Template.Spec.Containers[0].Image)
+			}
+			triggers := 0
+			for _, tr := range dc.Spec.Triggers {
+				if imageTriggerFor(tr, SSO_APPLICATION_NAME) {
+					triggers++
+					if tr.ImageChangeParams.From.Name != release.ImageStream || tr.ImageChangeParams.From.Namespace != "images" {
+						t.Fatalf("expected the trigger to follow %s in the same namespace, got %v", release.ImageStream, tr.ImageChangeParams.From)
+					}
+				}
+			}
+			if (triggers == 1) != tc.ExpectTrigger || len(dc.Spec.Triggers) != 1+triggers {
+				t.Fatalf("expected an image trigger: %v, got %v", tc.ExpectTrigger, dc.Spec.Triggers)
+			}
 		})
 	}
 }
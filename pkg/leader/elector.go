@@ -0,0 +1,324 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/integr8ly/keycloak-operator/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LeaderAnnotation holds the leader election record on the lock ConfigMap, it is the annotation client-go uses so
+// kubectl and other tooling can read it
+const LeaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// ErrLeadershipLost is returned by Run when the lease could not be renewed and another replica may be leading
+var ErrLeadershipLost = errors.New("the leader election lease could not be renewed")
+
+// Record is the leader election record stored on the lock ConfigMap
+type Record struct {
+	HolderIdentity       string   `json:"holderIdentity"`
+	LeaseDurationSeconds int      `json:"leaseDurationSeconds"`
+	AcquireTime          v12.Time `json:"acquireTime"`
+	RenewTime            v12.Time `json:"renewTime"`
+	LeaderTransitions    int      `json:"leaderTransitions"`
+}
+
+type Config struct {
+	// Namespace and Name of the lock ConfigMap
+	Namespace string
+	Name      string
+	// Identity of this replica, unique amongst the replicas
+	Identity string
+	// LeaseDuration is how long the other replicas wait after the last renewal they saw before taking over
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps trying to renew before it steps down, shorter than LeaseDuration
+	RenewDeadline time.Duration
+	// RetryPeriod is the time between two attempts to acquire or renew the lease
+	RetryPeriod time.Duration
+}
+
+func (c Config) validate() error {
+	if c.Namespace == "" || c.Name == "" || c.Identity == "" {
+		return errors.New("leader election needs the namespace and name of the lock and the identity of the replica")
+	}
+	if c.RetryPeriod <= 0 || c.RenewDeadline <= c.RetryPeriod || c.LeaseDuration <= c.RenewDeadline {
+		return errors.Errorf("leader election needs a retry period (%v) shorter than the renew deadline (%v), itself shorter than the lease duration (%v)", c.RetryPeriod, c.RenewDeadline, c.LeaseDuration)
+	}
+	return nil
+}
+
+// Identity is the name of the pod of the operator, or the hostname when POD_NAME isn't set
+func Identity() (string, error) {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name, nil
+	}
+	return os.Hostname()
+}
+
+// Elector elects a single leader amongst the replicas of the operator with a lease recorded on a ConfigMap
+type Elector struct {
+	client kubernetes.Interface
+	config Config
+	now    func() time.Time
+
+	mu sync.Mutex
+	// observed is the last record read, observedTime when it was first seen. Other replicas are trusted to hold the
+	// lease for LeaseDuration after observedTime so the clocks of the replicas don't need to agree
+	observed     Record
+	observedTime time.Time
+	// lastAttempt and lastRead are the last times the lock was tried and successfully read, lastRenew the last time
+	// this replica renewed its lease
+	lastAttempt time.Time
+	lastRead    time.Time
+	lastRenew   time.Time
+	leading     bool
+}
+
+func NewElector(client kubernetes.Interface, config Config) (*Elector, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &Elector{client: client, config: config, now: time.Now, lastAttempt: time.Now()}, nil
+}
+
+// Run blocks until this replica leads, then runs lead with a context that is cancelled when ctx is done or the lease
+// is lost. When ctx is done, the lease is released once lead returns so another replica takes over without waiting for
+// it to expire. ErrLeadershipLost is returned when the lease is lost, the replica should exit as it can't know what
+// lead left behind
+func (e *Elector) Run(ctx context.Context, lead func(context.Context)) error {
+	logrus.Infof("leader election: %s is waiting for the lease on configmap %s/%s", e.config.Identity, e.config.Namespace, e.config.Name)
+	for !e.tryAcquireOrRenew() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+	logrus.Infof("leader election: %s is the leader", e.config.Identity)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+	lost := e.renew(leadCtx, done)
+	cancel()
+	<-done
+
+	e.mu.Lock()
+	e.leading = false
+	e.mu.Unlock()
+	metrics.SetLeader(false)
+	if lost {
+		logrus.Errorf("leader election: %s could not renew the lease for %v", e.config.Identity, e.config.RenewDeadline)
+		return ErrLeadershipLost
+	}
+	if err := e.release(); err != nil {
+		return errors.Wrap(err, "failed to release the leader election lease")
+	}
+	logrus.Infof("leader election: %s released the lease", e.config.Identity)
+	return nil
+}
+
+// renew renews the lease every retry period until ctx is done, lead returns or the lease couldn't be renewed for
+// RenewDeadline, in which case it returns true
+func (e *Elector) renew(ctx context.Context, done <-chan struct{}) bool {
+	ticker := time.NewTicker(e.config.RetryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-done:
+			return false
+		case <-ticker.C:
+		}
+		if e.tryAcquireOrRenew() {
+			continue
+		}
+		e.mu.Lock()
+		lastRenew := e.lastRenew
+		e.mu.Unlock()
+		if e.now().Sub(lastRenew) > e.config.RenewDeadline {
+			return true
+		}
+	}
+}
+
+// tryAcquireOrRenew takes the lease when it is free or expired, or renews it when this replica holds it
+func (e *Elector) tryAcquireOrRenew() bool {
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastAttempt = now
+
+	record := Record{
+		HolderIdentity:       e.config.Identity,
+		LeaseDurationSeconds: int(e.config.LeaseDuration / time.Second),
+		AcquireTime:          v12.NewTime(now),
+		RenewTime:            v12.NewTime(now),
+	}
+	configMaps := e.client.CoreV1().ConfigMaps(e.config.Namespace)
+	lock, err := configMaps.Get(e.config.Name, v12.GetOptions{})
+	if errors2.IsNotFound(err) {
+		lock = &v1.ConfigMap{ObjectMeta: v12.ObjectMeta{Namespace: e.config.Namespace, Name: e.config.Name}}
+		if err := setRecord(lock, record); err != nil {
+			logrus.Errorf("leader election: %v", err)
+			return false
+		}
+		if _, err := configMaps.Create(lock); err != nil {
+			logrus.Errorf("leader election: failed to create the lock: %v", err)
+			return false
+		}
+		e.lastRead = now
+		e.observe(record, now)
+		e.hold(now)
+		return true
+	}
+	if err != nil {
+		logrus.Errorf("leader election: failed to get the lock: %v", err)
+		return false
+	}
+	e.lastRead = now
+
+	current, err := getRecord(lock)
+	if err != nil {
+		logrus.Errorf("leader election: %v", err)
+		return false
+	}
+	e.observe(current, now)
+	if current.HolderIdentity != "" && current.HolderIdentity != e.config.Identity &&
+		e.observedTime.Add(time.Duration(current.LeaseDurationSeconds)*time.Second).After(now) {
+		return false
+	}
+
+	if current.HolderIdentity == e.config.Identity {
+		record.AcquireTime = current.AcquireTime
+		record.LeaderTransitions = current.LeaderTransitions
+	} else {
+		record.LeaderTransitions = current.LeaderTransitions + 1
+	}
+	if err := setRecord(lock, record); err != nil {
+		logrus.Errorf("leader election: %v", err)
+		return false
+	}
+	// the update fails with a conflict when another replica changed the lock since it was read
+	if _, err := configMaps.Update(lock); err != nil {
+		logrus.Errorf("leader election: failed to update the lock: %v", err)
+		return false
+	}
+	e.observe(record, now)
+	e.hold(now)
+	return true
+}
+
+// observe keeps the last record read and when it changed
+func (e *Elector) observe(record Record, now time.Time) {
+	if record == e.observed {
+		return
+	}
+	if record.HolderIdentity != e.observed.HolderIdentity && record.HolderIdentity != "" {
+		logrus.Infof("leader election: the leader is %s", record.HolderIdentity)
+	}
+	e.observed = record
+	e.observedTime = now
+}
+
+func (e *Elector) hold(now time.Time) {
+	e.lastRenew = now
+	if !e.leading {
+		e.leading = true
+		metrics.SetLeader(true)
+	}
+}
+
+// release clears the holder of the lease when this replica still holds it
+func (e *Elector) release() error {
+	configMaps := e.client.CoreV1().ConfigMaps(e.config.Namespace)
+	lock, err := configMaps.Get(e.config.Name, v12.GetOptions{})
+	if err != nil {
+		return err
+	}
+	current, err := getRecord(lock)
+	if err != nil || current.HolderIdentity != e.config.Identity {
+		return err
+	}
+	current.HolderIdentity = ""
+	current.LeaseDurationSeconds = 1
+	current.RenewTime = v12.NewTime(e.now())
+	if err := setRecord(lock, current); err != nil {
+		return err
+	}
+	_, err = configMaps.Update(lock)
+	return err
+}
+
+// IsLeader reports whether this replica holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Check fails when the election stopped trying to get or renew the lease, or when this replica kept leading without
+// renewing it for a whole lease, as another replica may have taken over by then
+func (e *Elector) Check() error {
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if since := now.Sub(e.lastAttempt); since > e.config.LeaseDuration {
+		return errors.Errorf("the lease was not tried for %v", since.Round(time.Second))
+	}
+	if since := now.Sub(e.lastRenew); e.leading && since > e.config.LeaseDuration {
+		return errors.Errorf("this replica leads but did not renew the lease for %v", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready fails when the lock could not be read for a whole lease, so the replica can't know who leads
+func (e *Elector) Ready() error {
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lastRead.IsZero() {
+		return errors.New("the lock was not read yet")
+	}
+	if since := now.Sub(e.lastRead); since > e.config.LeaseDuration {
+		return errors.Errorf("the lock could not be read for %v", since.Round(time.Second))
+	}
+	return nil
+}
+
+func getRecord(lock *v1.ConfigMap) (Record, error) {
+	record := Record{}
+	raw, ok := lock.Annotations[LeaderAnnotation]
+	if !ok || raw == "" {
+		return record, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return record, errors.Wrapf(err, "failed to parse the %s annotation of configmap %s/%s", LeaderAnnotation, lock.Namespace, lock.Name)
+	}
+	return record, nil
+}
+
+func setRecord(lock *v1.ConfigMap, record Record) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the leader election record")
+	}
+	if lock.Annotations == nil {
+		lock.Annotations = map[string]string{}
+	}
+	lock.Annotations[LeaderAnnotation] = string(raw)
+	return nil
+}
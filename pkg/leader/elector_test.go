@@ -0,0 +1,152 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testConfig(identity string) Config {
+	return Config{
+		Namespace:     "test-namespace",
+		Name:          "keycloak-operator-lock",
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}
+}
+
+func lockRecord(t *testing.T, client kubernetes.Interface) Record {
+	lock, err := client.CoreV1().ConfigMaps("test-namespace").Get("keycloak-operator-lock", v12.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record, err := getRecord(lock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return record
+}
+
+func TestNewElectorValidation(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Config      func(Config) Config
+		ExpectError bool
+	}{
+		{
+			Name:   "Valid config",
+			Config: func(c Config) Config { return c },
+		},
+		{
+			Name:        "Missing identity",
+			Config:      func(c Config) Config { c.Identity = ""; return c },
+			ExpectError: true,
+		},
+		{
+			Name:        "Renew deadline longer than the lease",
+			Config:      func(c Config) Config { c.RenewDeadline = 20 * time.Second; return c },
+			ExpectError: true,
+		},
+		{
+			Name:        "Retry period longer than the renew deadline",
+			Config:      func(c Config) Config { c.RetryPeriod = 12 * time.Second; return c },
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if _, err := NewElector(fake.NewSimpleClientset(), tc.Config(testConfig("a"))); (err != nil) != tc.ExpectError {
+				t.Fatalf("expected an error: %v, got %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
+
+func TestElectorTakesOverExpiredLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	now := time.Now()
+	clock := func() time.Time { return now }
+	a, _ := NewElector(client, testConfig("a"))
+	b, _ := NewElector(client, testConfig("b"))
+	a.now, b.now = clock, clock
+
+	if err := b.Ready(); err == nil {
+		t.Fatal("expected a replica that never read the lock not to be ready")
+	}
+	if !a.tryAcquireOrRenew() || !a.IsLeader() {
+		t.Fatal("expected the first replica to acquire the free lease")
+	}
+	if b.tryAcquireOrRenew() || b.IsLeader() {
+		t.Fatal("expected the second replica to wait for the lease")
+	}
+	if err := b.Ready(); err != nil {
+		t.Fatalf("expected a standby replica that read the lock to be ready, got %v", err)
+	}
+
+	// the leader renews before the lease expires
+	now = now.Add(10 * time.Second)
+	if !a.tryAcquireOrRenew() || b.tryAcquireOrRenew() {
+		t.Fatal("expected the leader to keep a lease it renews")
+	}
+
+	// the leader stops renewing
+	now = now.Add(16 * time.Second)
+	if err := a.Check(); err == nil {
+		t.Fatal("expected a leader that didn't renew its lease to be unhealthy")
+	}
+	if !b.tryAcquireOrRenew() {
+		t.Fatal("expected the second replica to take over the expired lease")
+	}
+	if a.tryAcquireOrRenew() {
+		t.Fatal("expected the former leader not to get the lease back")
+	}
+	if record := lockRecord(t, client); record.HolderIdentity != "b" || record.LeaderTransitions != 1 {
+		t.Fatalf("expected b to lead after 1 transition, got %v", record)
+	}
+	if err := b.Check(); err != nil {
+		t.Fatalf("expected the new leader to be healthy, got %v", err)
+	}
+}
+
+func TestElectorReleasesLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	config := testConfig("a")
+	config.LeaseDuration, config.RenewDeadline, config.RetryPeriod = time.Minute, 30*time.Second, 10*time.Millisecond
+	a, _ := NewElector(client, config)
+	b, _ := NewElector(client, testConfig("b"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leading := make(chan struct{})
+	stopped := false
+	result := make(chan error)
+	go func() {
+		result <- a.Run(ctx, func(ctx context.Context) {
+			close(leading)
+			<-ctx.Done()
+			stopped = true
+		})
+	}()
+	<-leading
+	// wait for a renewal
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-result; err != nil || !stopped {
+		t.Fatalf("expected the leader to stop leading and return, got %v", err)
+	}
+	if a.IsLeader() {
+		t.Fatal("expected the replica not to lead anymore")
+	}
+	if record := lockRecord(t, client); record.HolderIdentity != "" {
+		t.Fatalf("expected the lease to be released, got %v", record)
+	}
+	if !b.tryAcquireOrRenew() {
+		t.Fatal("expected another replica to take the released lease right away")
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "keycloak_operator"
+
+var (
+	reconciles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Events handled per kind and the phase the object was in",
+	}, []string{"kind", "phase"})
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Events whose handling failed per kind and the phase the object was in",
+	}, []string{"kind", "phase"})
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time spent handling an event per kind and the phase the object was in",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"kind", "phase"})
+	phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Time objects spent in a phase before moving to the next one, per kind and phase",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"kind", "phase"})
+	adminAPIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admin_api_requests_total",
+		Help:      "Requests to the Keycloak admin API per endpoint, method and status code, the code is error when no response was received",
+	}, []string{"endpoint", "method", "code"})
+	adminAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admin_api_request_duration_seconds",
+		Help:      "Latency of the requests to the Keycloak admin API per endpoint and method",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+	realmObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "realm_managed_objects",
+		Help:      "Users, clients and identity providers declared in a KeycloakRealm and managed by the operator",
+	}, []string{"realm_namespace", "realm", "type"})
+	leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "1 when this replica holds the leader election lease and reconciles the resources, 0 otherwise",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(reconciles, reconcileErrors, reconcileDuration, phaseDuration, adminAPIRequests, adminAPIDuration, realmObjects, leader)
+}
+
+// phaseLabel is the label value of phase, objects that weren't handled yet have no phase
+func phaseLabel(phase string) string {
+	if phase == "" {
+		return "none"
+	}
+	return phase
+}
+
+// ObserveReconcile records the handling of an event for an object of kind in phase that took d and failed with err
+func ObserveReconcile(kind, phase string, d time.Duration, err error) {
+	phase = phaseLabel(phase)
+	reconciles.WithLabelValues(kind, phase).Inc()
+	reconcileDuration.WithLabelValues(kind, phase).Observe(d.Seconds())
+	if err != nil {
+		reconcileErrors.WithLabelValues(kind, phase).Inc()
+	}
+}
+
+// ObserveAdminAPIRequest records a request to the admin API endpoint that took d, statusCode is 0 when the request
+// got no response
+func ObserveAdminAPIRequest(endpoint, method string, statusCode int, d time.Duration) {
+	code := "error"
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	adminAPIRequests.WithLabelValues(endpoint, method, code).Inc()
+	adminAPIDuration.WithLabelValues(endpoint, method).Observe(d.Seconds())
+}
+
+// SetRealmObjects records the number of users, clients and identity providers the operator manages in the realm of
+// the KeycloakRealm namespace/name
+func SetRealmObjects(namespace, name string, users, clients, identityProviders int) {
+	realmObjects.WithLabelValues(namespace, name, "users").Set(float64(users))
+	realmObjects.WithLabelValues(namespace, name, "clients").Set(float64(clients))
+	realmObjects.WithLabelValues(namespace, name, "identity_providers").Set(float64(identityProviders))
+}
+
+// DeleteRealmObjects drops the counts of a KeycloakRealm that was deleted
+func DeleteRealmObjects(namespace, name string) {
+	for _, t := range []string{"users", "clients", "identity_providers"} {
+		realmObjects.DeleteLabelValues(namespace, name, t)
+	}
+}
+
+// SetLeader records whether this replica leads
+func SetLeader(leading bool) {
+	if leading {
+		leader.Set(1)
+		return
+	}
+	leader.Set(0)
+}
+
+// PhaseTracker records how long objects stay in a phase. It only sees the phases objects are handled in, so the time
+// of a phase runs from the first event seen in it to the first event seen in the next one
+type PhaseTracker struct {
+	mu      sync.Mutex
+	entered map[string]phaseEntry
+}
+
+type phaseEntry struct {
+	phase string
+	since time.Time
+}
+
+func NewPhaseTracker() *PhaseTracker {
+	return &PhaseTracker{entered: map[string]phaseEntry{}}
+}
+
+// Observe notes that the object of kind identified by key is in phase at now, and records the time it spent in its
+// previous phase when it moved on
+func (t *PhaseTracker) Observe(kind, key, phase string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := kind + "/" + key
+	previous, ok := t.entered[id]
+	if ok && previous.phase == phase {
+		return
+	}
+	if ok {
+		phaseDuration.WithLabelValues(kind, phaseLabel(previous.phase)).Observe(now.Sub(previous.since).Seconds())
+	}
+	t.entered[id] = phaseEntry{phase: phase, since: now}
+}
+
+// Forget stops tracking the object of kind identified by key, once it is deleted
+func (t *PhaseTracker) Forget(kind, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entered, kind+"/"+key)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) (uint64, float64) {
+	m := &dto.Metric{}
+	if err := o.(prometheus.Metric).Write(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestObserveReconcile(t *testing.T) {
+	ObserveReconcile("Keycloak", "", time.Second, nil)
+	ObserveReconcile("Keycloak", "", time.Second, errors.New("failed"))
+
+	if v := counterValue(t, reconciles.WithLabelValues("Keycloak", "none")); v != 2 {
+		t.Fatalf("expected 2 reconciles of keycloaks without a phase, got %v", v)
+	}
+	if v := counterValue(t, reconcileErrors.WithLabelValues("Keycloak", "none")); v != 1 {
+		t.Fatalf("expected 1 failed reconcile, got %v", v)
+	}
+	if count, sum := histogramCount(t, reconcileDuration.WithLabelValues("Keycloak", "none")); count != 2 || sum != 2 {
+		t.Fatalf("expected 2 reconciles lasting 2s in total, got %d lasting %vs", count, sum)
+	}
+}
+
+func TestObserveAdminAPIRequest(t *testing.T) {
+	ObserveAdminAPIRequest("user", "GET", 200, time.Millisecond)
+	ObserveAdminAPIRequest("user", "GET", 0, time.Millisecond)
+
+	if v := counterValue(t, adminAPIRequests.WithLabelValues("user", "GET", "200")); v != 1 {
+		t.Fatalf("expected 1 successful request, got %v", v)
+	}
+	if v := counterValue(t, adminAPIRequests.WithLabelValues("user", "GET", "error")); v != 1 {
+		t.Fatalf("expected 1 request without a response, got %v", v)
+	}
+	if count, _ := histogramCount(t, adminAPIDuration.WithLabelValues("user", "GET")); count != 2 {
+		t.Fatalf("expected the latency of both requests, got %d", count)
+	}
+}
+
+func TestPhaseTracker(t *testing.T) {
+	tracker := NewPhaseTracker()
+	start := time.Now()
+	tracker.Observe("KeycloakRealm", "ns/realm", "accepted", start)
+	tracker.Observe("KeycloakRealm", "ns/realm", "accepted", start.Add(time.Minute))
+	tracker.Observe("KeycloakRealm", "ns/realm", "provision", start.Add(2*time.Minute))
+
+	count, sum := histogramCount(t, phaseDuration.WithLabelValues("KeycloakRealm", "accepted"))
+	if count != 1 || sum != 120 {
+		t.Fatalf("expected the realm to have spent 120s in the accepted phase once, got %d times %vs", count, sum)
+	}
+
+	tracker.Forget("KeycloakRealm", "ns/realm")
+	tracker.Observe("KeycloakRealm", "ns/realm", "reconcile", start.Add(time.Hour))
+	if count, _ := histogramCount(t, phaseDuration.WithLabelValues("KeycloakRealm", "provision")); count != 0 {
+		t.Fatalf("expected a forgotten object to start over, got %d observations", count)
+	}
+}
+
+func TestRealmObjects(t *testing.T) {
+	SetRealmObjects("ns", "realm", 3, 2, 1)
+	m := &dto.Metric{}
+	if err := realmObjects.WithLabelValues("ns", "realm", "clients").Write(m); err != nil || m.GetGauge().GetValue() != 2 {
+		t.Fatalf("expected 2 clients, got %v %v", m.GetGauge().GetValue(), err)
+	}
+	DeleteRealmObjects("ns", "realm")
+	if deleted := realmObjects.DeleteLabelValues("ns", "realm", "users"); deleted {
+		t.Fatal("expected the counts of the realm to be dropped")
+	}
+}
+
+func TestSetLeader(t *testing.T) {
+	SetLeader(true)
+	m := &dto.Metric{}
+	if err := leader.Write(m); err != nil || m.GetGauge().GetValue() != 1 {
+		t.Fatalf("expected the replica to lead, got %v %v", m.GetGauge().GetValue(), err)
+	}
+	SetLeader(false)
+	if err := leader.Write(m); err != nil || m.GetGauge().GetValue() != 0 {
+		t.Fatalf("expected the replica not to lead, got %v %v", m.GetGauge().GetValue(), err)
+	}
+}
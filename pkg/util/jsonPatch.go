@@ -0,0 +1,249 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// JSONPatch is a list of RFC 6902 operations applied in order
+type JSONPatch []JSONPatchOperation
+
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// DecodeJSONPatch decodes and checks the operations of a JSON patch without applying them
+func DecodeJSONPatch(data []byte) (JSONPatch, error) {
+	patch := JSONPatch{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the json patch")
+	}
+	for i, op := range patch {
+		switch op.Op {
+		case "add", "replace", "test":
+			if len(op.Value) == 0 {
+				return nil, errors.Errorf("operation %d (%s) requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if _, err := splitPointer(op.From); err != nil {
+				return nil, errors.Wrapf(err, "operation %d (%s) has an invalid from", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, errors.Errorf("operation %d has an unknown op '%s'", i, op.Op)
+		}
+		if _, err := splitPointer(op.Path); err != nil {
+			return nil, errors.Wrapf(err, "operation %d (%s) has an invalid path", i, op.Op)
+		}
+	}
+	return patch, nil
+}
+
+// Apply applies the patch to the JSON document data, a failing operation fails the whole patch
+func (p JSONPatch) Apply(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the document")
+	}
+	for _, op := range p {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to %s %s", op.Op, op.Path)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func (op JSONPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := splitPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the value")
+		}
+	}
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, value)
+	case "remove":
+		doc, _, err := removeValue(doc, path)
+		return doc, err
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, _, err := removeValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "move", "copy":
+		from, err := splitPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			doc, value, err = removeValue(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return addValue(doc, path, value)
+		}
+		value, err = getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// the copy must not share maps and slices with the original
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "test":
+		current, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, errors.Errorf("expected %s, got %v", string(op.Value), current)
+		}
+		return doc, nil
+	}
+	return nil, errors.Errorf("unknown op '%s'", op.Op)
+}
+
+// splitPointer splits an RFC 6901 JSON pointer into its unescaped tokens
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.Errorf("'%s' must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= length || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Errorf("index %s is out of range", token)
+	}
+	return i, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[token]
+			if !ok {
+				return nil, errors.Errorf("%s not found", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(d))
+			if err != nil {
+				return nil, err
+			}
+			doc = d[i]
+		default:
+			return nil, errors.Errorf("%s not found", token)
+		}
+	}
+	return doc, nil
+}
+
+// updateParent calls update with the parent of the last token of path and stores the parent it returns
+func updateParent(doc interface{}, path []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateParent(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		d[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(d))
+		d[i] = child
+	}
+	return doc, nil
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch d := parent.(type) {
+		case map[string]interface{}:
+			d[token] = value
+			return d, nil
+		case []interface{}:
+			i := len(d)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(d)+1); err != nil {
+					return nil, err
+				}
+			}
+			d = append(d, nil)
+			copy(d[i+1:], d[i:])
+			d[i] = value
+			return d, nil
+		}
+		return nil, errors.Errorf("can't add %s to %v", token, parent)
+	})
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("can't remove the whole document")
+	}
+	var removed interface{}
+	doc, err := updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch d := parent.(type) {
+		case map[string]interface{}:
+			v, ok := d[token]
+			if !ok {
+				return nil, errors.Errorf("%s not found", token)
+			}
+			removed = v
+			delete(d, token)
+			return d, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(d))
+			if err != nil {
+				return nil, err
+			}
+			removed = d[i]
+			return append(d[:i], d[i+1:]...), nil
+		}
+		return nil, errors.Errorf("%s not found", token)
+	})
+	return doc, removed, err
+}
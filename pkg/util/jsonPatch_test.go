@@ -0,0 +1,110 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/util"
+)
+
+func TestJSONPatch(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Patch       string
+		Expect      string
+		ExpectError bool
+	}{
+		{
+			Name:   "Add to an object and append to an array",
+			Patch:  `[{"op": "add", "path": "/spec/replicas", "value": 2}, {"op": "add", "path": "/spec/ports/-", "value": 8443}]`,
+			Expect: `{"metadata":{"name":"sso"},"spec":{"ports":[8080,8443],"replicas":2}}`,
+		},
+		{
+			Name:   "Insert into an array",
+			Patch:  `[{"op": "add", "path": "/spec/ports/0", "value": 80}]`,
+			Expect: `{"metadata":{"name":"sso"},"spec":{"ports":[80,8080]}}`,
+		},
+		{
+			Name:   "Replace and remove",
+			Patch:  `[{"op": "replace", "path": "/spec/ports/0", "value": 9090}, {"op": "remove", "path": "/metadata/name"}]`,
+			Expect: `{"metadata":{},"spec":{"ports":[9090]}}`,
+		},
+		{
+			Name:   "Null value",
+			Patch:  `[{"op": "add", "path": "/spec/selector", "value": null}]`,
+			Expect: `{"metadata":{"name":"sso"},"spec":{"ports":[8080],"selector":null}}`,
+		},
+		{
+			Name:   "Escaped keys",
+			Patch:  `[{"op": "add", "path": "/metadata/annotations", "value": {}}, {"op": "add", "path": "/metadata/annotations/example.com~1tilde~0", "value": "yes"}]`,
+			Expect: `{"metadata":{"annotations":{"example.com/tilde~":"yes"},"name":"sso"},"spec":{"ports":[8080]}}`,
+		},
+		{
+			Name:   "Move and copy",
+			Patch:  `[{"op": "copy", "from": "/spec/ports", "path": "/spec/targetPorts"}, {"op": "move", "from": "/metadata/name", "path": "/spec/name"}]`,
+			Expect: `{"metadata":{},"spec":{"name":"sso","ports":[8080],"targetPorts":[8080]}}`,
+		},
+		{
+			Name:   "Passing test",
+			Patch:  `[{"op": "test", "path": "/metadata/name", "value": "sso"}]`,
+			Expect: `{"metadata":{"name":"sso"},"spec":{"ports":[8080]}}`,
+		},
+		{
+			Name:        "Failing test",
+			Patch:       `[{"op": "test", "path": "/metadata/name", "value": "other"}]`,
+			ExpectError: true,
+		},
+		{
+			Name:        "Missing path",
+			Patch:       `[{"op": "replace", "path": "/spec/missing/replicas", "value": 1}]`,
+			ExpectError: true,
+		},
+		{
+			Name:        "Index out of range",
+			Patch:       `[{"op": "add", "path": "/spec/ports/2", "value": 1}]`,
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			patch, err := util.DecodeJSONPatch([]byte(tc.Patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			patched, err := patch.Apply([]byte(`{"metadata": {"name": "sso"}, "spec": {"ports": [8080]}}`))
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(patched) != tc.Expect {
+				t.Fatalf("expected %s, got %s", tc.Expect, patched)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONPatch(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Patch string
+	}{
+		{Name: "Not a list", Patch: `{"op": "add"}`},
+		{Name: "Unknown op", Patch: `[{"op": "merge", "path": "/spec"}]`},
+		{Name: "Missing value", Patch: `[{"op": "add", "path": "/spec"}]`},
+		{Name: "Relative path", Patch: `[{"op": "remove", "path": "spec"}]`},
+		{Name: "Relative from", Patch: `[{"op": "move", "from": "spec", "path": "/spec"}]`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if _, err := util.DecodeJSONPatch([]byte(tc.Patch)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"sync"
+)
+
+//RunBounded calls fn for every index in [0, count) with at most limit calls running at once.
+//Errors are collected into a MultiErrorer in index order, so the result doesn't depend on scheduling.
+//A limit below 2 runs every call sequentially on the calling goroutine.
+func RunBounded(limit, count int, fn func(i int) error) MultiErrorer {
+	me := NewMultiError()
+	if limit < 2 {
+		for i := 0; i < count; i++ {
+			me.AddError(fn(i))
+		}
+		return me
+	}
+
+	errs := make([]error, count)
+	sem := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		me.AddError(err)
+	}
+	return me
+}
@@ -0,0 +1,80 @@
+package util_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/integr8ly/keycloak-operator/pkg/util"
+)
+
+func TestRunBounded(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Limit int
+		Count int
+	}{
+		{
+			Name:  "Sequential",
+			Limit: 1,
+			Count: 5,
+		},
+		{
+			Name:  "Bounded",
+			Limit: 3,
+			Count: 20,
+		},
+		{
+			Name:  "Limit above count",
+			Limit: 10,
+			Count: 4,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			running, maxRunning, calls := 0, 0, 0
+			release := make(chan struct{})
+			go func() {
+				for i := 0; i < tc.Count; i++ {
+					release <- struct{}{}
+				}
+			}()
+
+			me := util.RunBounded(tc.Limit, tc.Count, func(i int) error {
+				mu.Lock()
+				running++
+				calls++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				<-release
+				mu.Lock()
+				running--
+				mu.Unlock()
+				if i%2 == 0 {
+					return fmt.Errorf("error %d", i)
+				}
+				return nil
+			})
+
+			if calls != tc.Count {
+				t.Fatalf("expected %d calls, got %d", tc.Count, calls)
+			}
+			if maxRunning > tc.Limit {
+				t.Fatalf("expected at most %d concurrent calls, got %d", tc.Limit, maxRunning)
+			}
+			errs := me.GetErrors()
+			if len(errs) != (tc.Count+1)/2 {
+				t.Fatalf("expected %d errors, got %d", (tc.Count+1)/2, len(errs))
+			}
+			for i, err := range errs {
+				if err.Error() != fmt.Sprintf("error %d", i*2) {
+					t.Fatalf("expected errors in index order, got %v", me.Error())
+				}
+			}
+		})
+	}
+}